@@ -26,6 +26,9 @@ func InitDB() {
 
 // Migrate runs database migrations
 func Migrate() {
+	// Accounts created before email verification existed are grandfathered in
+	grandfather := !DB.Migrator().HasColumn(&models.User{}, "EmailVerifiedAt")
+
 	err := DB.AutoMigrate(
 		&models.User{},
 		&models.Room{},
@@ -35,11 +38,26 @@ func Migrate() {
 		&models.DirectMessage{},
 		&models.Block{},
 		&models.ReadReceipt{},
+		&models.Session{},
+		&models.RefreshToken{},
+		&models.AccountToken{},
+		&models.RecoveryCode{},
+		&models.UserIdentity{},
+		&models.LoginThrottle{},
+		&models.LockoutEvent{},
+		&models.PersonalAccessToken{},
+		&models.RoomInvite{},
 	)
 	if err != nil {
 		log.Fatal("Failed to run migrations:", err)
 	}
 
+	if grandfather {
+		if err := DB.Exec("UPDATE users SET email_verified_at = created_at WHERE email_verified_at IS NULL").Error; err != nil {
+			log.Fatal("Failed to mark existing accounts verified:", err)
+		}
+	}
+
 	log.Println("Database migrations completed")
 }
 
@@ -48,6 +66,15 @@ func GetDB() *gorm.DB {
 	return DB
 }
 
+// CloseDB closes the database connection
+func CloseDB() error {
+	sqlDB, err := DB.DB()
+	if err != nil {
+		return err
+	}
+	return sqlDB.Close()
+}
+
 // FlushDB deletes all data from all tables
 func FlushDB() error {
 	log.Println("Flushing database...")
@@ -0,0 +1,61 @@
+package events
+
+import (
+	"log"
+	"sync"
+)
+
+// Event is a domain change that other parts of the app may react to
+type Event interface {
+	Name() string
+}
+
+// Handler receives published events
+type Handler func(Event)
+
+// Bus delivers domain events from REST handlers to subscribers such as the
+// WebSocket hub. Delivery is synchronous, in subscription order.
+type Bus struct {
+	mu       sync.RWMutex
+	handlers []Handler
+}
+
+// NewBus creates an event bus with no subscribers
+func NewBus() *Bus {
+	return &Bus{}
+}
+
+// Subscribe registers a handler for every published event
+func (b *Bus) Subscribe(handler Handler) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.handlers = append(b.handlers, handler)
+}
+
+// Publish delivers an event to every subscriber. Publishing on a nil bus is
+// a no-op, so handlers work without one. A panicking subscriber is logged
+// and does not stop delivery to the others.
+func (b *Bus) Publish(event Event) {
+	if b == nil {
+		return
+	}
+
+	b.mu.RLock()
+	handlers := b.handlers
+	b.mu.RUnlock()
+
+	for _, handler := range handlers {
+		deliver(handler, event)
+	}
+}
+
+// deliver calls a single subscriber, recovering from panics
+func deliver(handler Handler, event Event) {
+	defer func() {
+		if r := recover(); r != nil {
+			log.Printf("Event handler for %s panicked: %v", event.Name(), r)
+		}
+	}()
+	handler(event)
+}
@@ -0,0 +1,36 @@
+package events
+
+import "testing"
+
+func TestBus_PublishDeliversToSubscribers(t *testing.T) {
+	bus := NewBus()
+
+	var got []string
+	bus.Subscribe(func(e Event) { got = append(got, "first:"+e.Name()) })
+	bus.Subscribe(func(e Event) { got = append(got, "second:"+e.Name()) })
+
+	bus.Publish(RoomMemberJoined{RoomID: 1, UserID: 2})
+
+	if len(got) != 2 || got[0] != "first:room_member_joined" || got[1] != "second:room_member_joined" {
+		t.Errorf("Publish() delivered %v", got)
+	}
+}
+
+func TestBus_PanickingSubscriberDoesNotStopDelivery(t *testing.T) {
+	bus := NewBus()
+
+	delivered := false
+	bus.Subscribe(func(Event) { panic("boom") })
+	bus.Subscribe(func(Event) { delivered = true })
+
+	bus.Publish(MessageCreated{})
+
+	if !delivered {
+		t.Error("Publish() should reach subscribers after a panicking one")
+	}
+}
+
+func TestBus_NilBusIsNoop(t *testing.T) {
+	var bus *Bus
+	bus.Publish(MessageCreated{})
+}
@@ -0,0 +1,79 @@
+package events
+
+import (
+	"GoChatApp/models"
+	"time"
+)
+
+// MessageCreated is published when a room message is stored
+type MessageCreated struct {
+	Message *models.Message
+}
+
+func (MessageCreated) Name() string { return "message_created" }
+
+// ReactionToggled is published when a user adds or removes a reaction
+type ReactionToggled struct {
+	MessageID uint
+	UserID    uint
+	Username  string
+	Emoji     string
+	Added     bool
+}
+
+func (ReactionToggled) Name() string { return "reaction_toggled" }
+
+// ReadReceiptUpdated is published when a user marks a room read up to a message
+type ReadReceiptUpdated struct {
+	RoomID    uint
+	UserID    uint
+	MessageID uint
+	ReadAt    time.Time
+}
+
+func (ReadReceiptUpdated) Name() string { return "read_receipt_updated" }
+
+// DirectMessageSent is published when a direct message is stored.
+// ParticipantIDs includes the sender.
+type DirectMessageSent struct {
+	Message        *models.DirectMessage
+	ParticipantIDs []uint
+}
+
+func (DirectMessageSent) Name() string { return "direct_message_sent" }
+
+// RoomMemberJoined is published when a user becomes a member of a room
+type RoomMemberJoined struct {
+	RoomID   uint
+	UserID   uint
+	Username string
+}
+
+func (RoomMemberJoined) Name() string { return "room_member_joined" }
+
+// RoomMemberLeft is published when a user stops being a member of a room,
+// either by leaving or by being removed
+type RoomMemberLeft struct {
+	RoomID   uint
+	UserID   uint
+	Username string
+	Removed  bool // Removed by someone else rather than leaving
+}
+
+func (RoomMemberLeft) Name() string { return "room_member_left" }
+
+// UserUpdated is published when a user changes their public profile
+type UserUpdated struct {
+	User *models.User
+}
+
+func (UserUpdated) Name() string { return "user_updated" }
+
+// SessionRevoked is published when a login session is revoked, by logging
+// out, by the user from another device, or on refresh token reuse
+type SessionRevoked struct {
+	SessionID uint // 0 when every session of the user was revoked
+	UserID    uint
+}
+
+func (SessionRevoked) Name() string { return "session_revoked" }
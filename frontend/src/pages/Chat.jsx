@@ -3,8 +3,18 @@ import { useNavigate } from 'react-router-dom';
 import websocketService from '../utils/websocket';
 import api from '../utils/api';
 
+// formatMessage turns a stored message into what the list renders
+function formatMessage(msg) {
+  return {
+    username: msg.user?.username || 'Unknown',
+    content: msg.content,
+    timestamp: msg.created_at,
+  };
+}
+
 function Chat() {
   const [messages, setMessages] = useState([]);
+  const [room, setRoom] = useState(null);
   const [users, setUsers] = useState([]);
   const [newMessage, setNewMessage] = useState('');
   const [connected, setConnected] = useState(false);
@@ -21,18 +31,23 @@ function Chat() {
       return;
     }
 
-    // Fetch message history
-    api.get('/api/messages')
+    // Chat happens in the first public room, which anyone may join
+    api.get('/api/rooms')
       .then((response) => {
-        const messageHistory = response.data.messages || [];
-        // Transform backend messages to match frontend format
-        const formattedMessages = messageHistory.map((msg) => ({
-          username: msg.User?.username || 'Unknown',
-          content: msg.content,
-          timestamp: msg.created_at,
-        }));
-        setMessages(formattedMessages);
-        setLoading(false);
+        const publicRoom = (response.data.rooms || []).find((r) => r.type === 'public');
+        if (!publicRoom) {
+          setLoading(false);
+          return;
+        }
+        setRoom(publicRoom);
+
+        // Fetch message history
+        return api.get('/api/messages').then((response) => {
+          const messageHistory = (response.data.messages || []).filter((msg) => msg.room_id === publicRoom.id);
+          // Transform backend messages to match frontend format
+          setMessages(messageHistory.map(formatMessage));
+          setLoading(false);
+        });
       })
       .catch((error) => {
         console.error('Failed to load message history:', error);
@@ -49,15 +64,17 @@ function Chat() {
       });
   }, [navigate]);
 
-  // Setup WebSocket connection
+  // Setup WebSocket connection once the room is known
   useEffect(() => {
     const userId = localStorage.getItem('user_id');
     const username = localStorage.getItem('username');
 
-    if (!userId || !username) {
+    if (!userId || !username || !room) {
       return;
     }
 
+    websocketService.joinRoom(room.id);
+
     // Connect to WebSocket
     websocketService.connect(userId, username)
       .then(() => {
@@ -68,9 +85,13 @@ function Chat() {
         // Don't block if WebSocket fails - REST endpoints still work
       });
 
-    // Handle incoming messages
+    // Only chat frames are messages; acks, presence and the like are not
     const handleMessage = (data) => {
-      setMessages((prev) => [...prev, data]);
+      if (data.type === 'chat' && data.room_id === room.id) {
+        setMessages((prev) => [...prev, formatMessage(data.message)]);
+      } else if (data.type === 'error' || data.type === 'nack') {
+        console.error('WebSocket frame rejected:', data.message || data.reason);
+      }
     };
 
     websocketService.onMessage(handleMessage);
@@ -79,7 +100,7 @@ function Chat() {
       websocketService.removeMessageHandler(handleMessage);
       websocketService.disconnect();
     };
-  }, []);
+  }, [room]);
 
   useEffect(() => {
     messagesEndRef.current?.scrollIntoView({ behavior: 'smooth' });
@@ -87,18 +108,22 @@ function Chat() {
 
   const handleSendMessage = (e) => {
     e.preventDefault();
-    if (!newMessage.trim()) return;
+    if (!newMessage.trim() || !room) return;
 
     websocketService.send({
-      type: 'message',
+      type: 'chat',
+      room_id: room.id,
       content: newMessage,
+      nonce: crypto.randomUUID(),
     });
 
     setNewMessage('');
   };
 
-  const handleLogout = () => {
+  const handleLogout = async () => {
+    await api.post('/api/logout').catch(() => {});
     localStorage.removeItem('token');
+    localStorage.removeItem('refresh_token');
     localStorage.removeItem('username');
     localStorage.removeItem('user_id');
     websocketService.disconnect();
@@ -114,6 +139,7 @@ function Chat() {
             <h1 className="text-2xl font-bold">GoChatApp</h1>
             <p className="text-sm opacity-80">
               {loading ? 'Loading...' : connected ? '🟢 Connected' : '🔴 Offline (using REST API)'}
+              {room && ` · #${room.name}`}
             </p>
           </div>
           <div className="flex items-center space-x-4">
@@ -207,11 +233,11 @@ function Chat() {
                 onChange={(e) => setNewMessage(e.target.value)}
                 placeholder={connected ? "Type a message..." : "WebSocket disconnected - messages won't send"}
                 className="flex-1 px-4 py-2 border border-gray-300 rounded-lg focus:outline-none focus:ring-2 focus:ring-blue-500"
-                disabled={!connected}
+                disabled={!connected || !room}
               />
               <button
                 type="submit"
-                disabled={!connected}
+                disabled={!connected || !room}
                 className="bg-blue-600 hover:bg-blue-700 text-white px-6 py-2 rounded-lg transition duration-200 disabled:opacity-50 disabled:cursor-not-allowed"
               >
                 Send
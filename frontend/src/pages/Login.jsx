@@ -1,27 +1,42 @@
-import { useState } from 'react';
-import { Link, useNavigate } from 'react-router-dom';
+import { useEffect, useState } from 'react';
+import { Link, useLocation, useNavigate } from 'react-router-dom';
 import api from '../utils/api';
 
 function Login() {
   const [username, setUsername] = useState('');
   const [password, setPassword] = useState('');
+  const location = useLocation();
+  // A single sign-on can also end in a two-factor challenge
+  const [challengeToken, setChallengeToken] = useState(location.state?.challengeToken || '');
+  const [code, setCode] = useState('');
+  const [providers, setProviders] = useState([]);
   const [error, setError] = useState('');
   const [loading, setLoading] = useState(false);
   const navigate = useNavigate();
 
+  useEffect(() => {
+    api
+      .get('/api/auth/oidc/providers')
+      .then((response) => setProviders(response.data.providers))
+      .catch(() => setProviders([]));
+  }, []);
+
   const handleSubmit = async (e) => {
     e.preventDefault();
     setError('');
     setLoading(true);
 
     try {
-      const response = await api.post('/api/login', {
-        username,
-        password,
-      });
+      // With two-factor login on, the password is followed by a code
+      const response = challengeToken
+        ? await api.post('/api/login/2fa', { challenge_token: challengeToken, code })
+        : await api.post('/api/login', { username, password });
 
-      if (response.data.token) {
+      if (response.data.two_factor_required) {
+        setChallengeToken(response.data.challenge_token);
+      } else if (response.data.token) {
         localStorage.setItem('token', response.data.token);
+        localStorage.setItem('refresh_token', response.data.refresh_token);
         localStorage.setItem('username', response.data.user.username);
         localStorage.setItem('user_id', response.data.user.id);
         navigate('/chat');
@@ -45,45 +60,87 @@ function Login() {
         )}
 
         <form onSubmit={handleSubmit} className="space-y-4">
-          <div>
-            <label htmlFor="username" className="block text-gray-700 font-semibold mb-2">
-              Username
-            </label>
-            <input
-              type="text"
-              id="username"
-              value={username}
-              onChange={(e) => setUsername(e.target.value)}
-              className="w-full px-4 py-2 border border-gray-300 rounded-lg focus:outline-none focus:ring-2 focus:ring-blue-500"
-              required
-              disabled={loading}
-            />
-          </div>
+          {challengeToken ? (
+            <div>
+              <label htmlFor="code" className="block text-gray-700 font-semibold mb-2">
+                Authentication code
+              </label>
+              <input
+                type="text"
+                id="code"
+                value={code}
+                onChange={(e) => setCode(e.target.value)}
+                className="w-full px-4 py-2 border border-gray-300 rounded-lg focus:outline-none focus:ring-2 focus:ring-blue-500"
+                placeholder="6-digit code or recovery code"
+                autoComplete="one-time-code"
+                autoFocus
+                required
+                disabled={loading}
+              />
+            </div>
+          ) : (
+            <>
+              <div>
+                <label htmlFor="username" className="block text-gray-700 font-semibold mb-2">
+                  Username
+                </label>
+                <input
+                  type="text"
+                  id="username"
+                  value={username}
+                  onChange={(e) => setUsername(e.target.value)}
+                  className="w-full px-4 py-2 border border-gray-300 rounded-lg focus:outline-none focus:ring-2 focus:ring-blue-500"
+                  required
+                  disabled={loading}
+                />
+              </div>
 
-          <div>
-            <label htmlFor="password" className="block text-gray-700 font-semibold mb-2">
-              Password
-            </label>
-            <input
-              type="password"
-              id="password"
-              value={password}
-              onChange={(e) => setPassword(e.target.value)}
-              className="w-full px-4 py-2 border border-gray-300 rounded-lg focus:outline-none focus:ring-2 focus:ring-blue-500"
-              required
-              disabled={loading}
-            />
-          </div>
+              <div>
+                <label htmlFor="password" className="block text-gray-700 font-semibold mb-2">
+                  Password
+                </label>
+                <input
+                  type="password"
+                  id="password"
+                  value={password}
+                  onChange={(e) => setPassword(e.target.value)}
+                  className="w-full px-4 py-2 border border-gray-300 rounded-lg focus:outline-none focus:ring-2 focus:ring-blue-500"
+                  required
+                  disabled={loading}
+                />
+              </div>
+            </>
+          )}
 
           <button
             type="submit"
             disabled={loading}
             className="w-full bg-blue-600 hover:bg-blue-700 text-white font-semibold py-3 px-6 rounded-lg transition duration-200 disabled:opacity-50 disabled:cursor-not-allowed"
           >
-            {loading ? 'Logging in...' : 'Login'}
+            {loading ? 'Logging in...' : challengeToken ? 'Verify' : 'Login'}
           </button>
         </form>
 
+        {providers.length > 0 && !challengeToken && (
+          <div className="mt-4 space-y-2">
+            {providers.map((provider) => (
+              <a
+                key={provider.name}
+                href={provider.login_url}
+                className="block w-full text-center border border-gray-300 hover:bg-gray-100 text-gray-700 font-semibold py-3 px-6 rounded-lg transition duration-200"
+              >
+                Sign in with {provider.display_name}
+              </a>
+            ))}
+          </div>
+        )}
+
+        <p className="mt-4 text-center">
+          <Link to="/forgot-password" className="text-blue-600 hover:text-blue-700">
+            Forgot your password?
+          </Link>
+        </p>
+
         <p className="mt-6 text-center text-gray-600">
           Don't have an account?{' '}
           <Link to="/register" className="text-blue-600 hover:text-blue-700 font-semibold">
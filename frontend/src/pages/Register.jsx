@@ -31,6 +31,7 @@ function Register() {
 
       if (response.data.token) {
         localStorage.setItem('token', response.data.token);
+        localStorage.setItem('refresh_token', response.data.refresh_token);
         localStorage.setItem('username', response.data.user.username);
         localStorage.setItem('user_id', response.data.user.id);
         navigate('/chat');
@@ -0,0 +1,98 @@
+import { useState } from 'react';
+import { Link, useNavigate, useSearchParams } from 'react-router-dom';
+import api from '../utils/api';
+
+function ResetPassword() {
+  const [searchParams] = useSearchParams();
+  const [password, setPassword] = useState('');
+  const [confirmPassword, setConfirmPassword] = useState('');
+  const [error, setError] = useState('');
+  const [loading, setLoading] = useState(false);
+  const navigate = useNavigate();
+
+  const handleSubmit = async (e) => {
+    e.preventDefault();
+    setError('');
+
+    if (password !== confirmPassword) {
+      setError('Passwords do not match');
+      return;
+    }
+
+    setLoading(true);
+    try {
+      await api.post('/api/password/reset', {
+        token: searchParams.get('token'),
+        password,
+      });
+      navigate('/login');
+    } catch (err) {
+      setError(err.response?.data?.error || 'Reset failed. Please try again.');
+    } finally {
+      setLoading(false);
+    }
+  };
+
+  return (
+    <div className="min-h-screen flex items-center justify-center bg-gradient-to-br from-blue-500 to-purple-600">
+      <div className="bg-white rounded-lg shadow-2xl p-8 max-w-md w-full">
+        <h2 className="text-3xl font-bold text-gray-800 mb-6 text-center">Choose a New Password</h2>
+
+        {error && (
+          <div className="bg-red-100 border border-red-400 text-red-700 px-4 py-3 rounded mb-4">
+            {error}
+          </div>
+        )}
+
+        <form onSubmit={handleSubmit} className="space-y-4">
+          <div>
+            <label htmlFor="password" className="block text-gray-700 font-semibold mb-2">
+              New password
+            </label>
+            <input
+              type="password"
+              id="password"
+              value={password}
+              onChange={(e) => setPassword(e.target.value)}
+              className="w-full px-4 py-2 border border-gray-300 rounded-lg focus:outline-none focus:ring-2 focus:ring-blue-500"
+              required
+              minLength={8}
+              disabled={loading}
+            />
+          </div>
+
+          <div>
+            <label htmlFor="confirmPassword" className="block text-gray-700 font-semibold mb-2">
+              Confirm password
+            </label>
+            <input
+              type="password"
+              id="confirmPassword"
+              value={confirmPassword}
+              onChange={(e) => setConfirmPassword(e.target.value)}
+              className="w-full px-4 py-2 border border-gray-300 rounded-lg focus:outline-none focus:ring-2 focus:ring-blue-500"
+              required
+              disabled={loading}
+            />
+          </div>
+
+          <button
+            type="submit"
+            disabled={loading}
+            className="w-full bg-blue-600 hover:bg-blue-700 text-white font-semibold py-3 px-6 rounded-lg transition duration-200 disabled:opacity-50 disabled:cursor-not-allowed"
+          >
+            {loading ? 'Saving...' : 'Reset password'}
+          </button>
+        </form>
+
+        <p className="mt-6 text-center text-gray-600">
+          <Link to="/forgot-password" className="text-blue-600 hover:text-blue-700 font-semibold">
+            Send a new link
+          </Link>
+        </p>
+      </div>
+    </div>
+  );
+}
+
+export default ResetPassword;
@@ -0,0 +1,57 @@
+import { useEffect, useState } from 'react';
+import { Link, useNavigate, useSearchParams } from 'react-router-dom';
+import api from '../utils/api';
+
+function SsoCallback() {
+  const [searchParams] = useSearchParams();
+  const [error, setError] = useState(searchParams.get('error') || '');
+  const navigate = useNavigate();
+
+  useEffect(() => {
+    const token = searchParams.get('token');
+    if (!token) {
+      return;
+    }
+
+    api
+      .post('/api/auth/oidc/exchange', { token })
+      .then((response) => {
+        // Accounts with two-factor login still need a code
+        if (response.data.two_factor_required) {
+          navigate('/login', { state: { challengeToken: response.data.challenge_token } });
+          return;
+        }
+
+        localStorage.setItem('token', response.data.token);
+        localStorage.setItem('refresh_token', response.data.refresh_token);
+        localStorage.setItem('username', response.data.user.username);
+        localStorage.setItem('user_id', response.data.user.id);
+        navigate('/chat');
+      })
+      .catch((err) => {
+        setError(err.response?.data?.error || 'Sign-in failed. Please try again.');
+      });
+  }, [searchParams, navigate]);
+
+  return (
+    <div className="min-h-screen flex items-center justify-center bg-gradient-to-br from-blue-500 to-purple-600">
+      <div className="bg-white rounded-lg shadow-2xl p-8 max-w-md w-full text-center">
+        <h2 className="text-3xl font-bold text-gray-800 mb-6">Single Sign-On</h2>
+        {error ? (
+          <div className="bg-red-100 border border-red-400 text-red-700 px-4 py-3 rounded mb-4">
+            {error}
+          </div>
+        ) : (
+          <p className="text-gray-700">Signing you in...</p>
+        )}
+        <p className="mt-6 text-gray-600">
+          <Link to="/login" className="text-blue-600 hover:text-blue-700 font-semibold">
+            Back to login
+          </Link>
+        </p>
+      </div>
+    </div>
+  );
+}
+
+export default SsoCallback;
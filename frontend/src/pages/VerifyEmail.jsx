@@ -0,0 +1,35 @@
+import { useEffect, useState } from 'react';
+import { Link, useSearchParams } from 'react-router-dom';
+import api from '../utils/api';
+
+function VerifyEmail() {
+  const [searchParams] = useSearchParams();
+  const [status, setStatus] = useState('Confirming your email address...');
+  const [failed, setFailed] = useState(false);
+
+  useEffect(() => {
+    api
+      .post('/api/email/verify', { token: searchParams.get('token') })
+      .then(() => setStatus('Your email address is confirmed.'))
+      .catch((err) => {
+        setFailed(true);
+        setStatus(err.response?.data?.error || 'Confirmation failed. Please try again.');
+      });
+  }, [searchParams]);
+
+  return (
+    <div className="min-h-screen flex items-center justify-center bg-gradient-to-br from-blue-500 to-purple-600">
+      <div className="bg-white rounded-lg shadow-2xl p-8 max-w-md w-full text-center">
+        <h2 className="text-3xl font-bold text-gray-800 mb-6">Email Verification</h2>
+        <p className={failed ? 'text-red-700' : 'text-gray-700'}>{status}</p>
+        <p className="mt-6 text-gray-600">
+          <Link to="/chat" className="text-blue-600 hover:text-blue-700 font-semibold">
+            Continue to chat
+          </Link>
+        </p>
+      </div>
+    </div>
+  );
+}
+
+export default VerifyEmail;
@@ -23,12 +23,46 @@ api.interceptors.request.use(
   }
 );
 
-// Response interceptor to handle errors
+// Refresh tokens are single use, so concurrent 401s share one refresh
+let refreshing = null;
+
+const refreshSession = () => {
+  if (!refreshing) {
+    refreshing = axios
+      .post(`${API_BASE_URL}/api/token/refresh`, {
+        refresh_token: localStorage.getItem('refresh_token'),
+      })
+      .then((response) => {
+        localStorage.setItem('token', response.data.token);
+        localStorage.setItem('refresh_token', response.data.refresh_token);
+        return response.data.token;
+      })
+      .finally(() => {
+        refreshing = null;
+      });
+  }
+  return refreshing;
+};
+
+// Response interceptor to handle errors. An expired access token is
+// refreshed once and the request retried.
 api.interceptors.response.use(
   (response) => response,
-  (error) => {
+  async (error) => {
+    const original = error.config;
     if (error.response?.status === 401) {
+      if (!original._retried && localStorage.getItem('refresh_token')) {
+        original._retried = true;
+        try {
+          const token = await refreshSession();
+          original.headers.Authorization = `Bearer ${token}`;
+          return api(original);
+        } catch {
+          // Fall through to signing out
+        }
+      }
       localStorage.removeItem('token');
+      localStorage.removeItem('refresh_token');
       window.location.href = '/login';
     }
     return Promise.reject(error);
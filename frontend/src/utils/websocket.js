@@ -1,6 +1,8 @@
 // IMPORTANT: The WebSocket endpoint is at /api/ws NOT /ws
-// WebSocket now uses token-based authentication via query parameter
+// WebSocket authenticates with a single-use ticket from POST /api/ws/ticket
 // Cache busting: 2025-12-01-v3
+import api from './api';
+
 const WS_URL = import.meta.env.VITE_WS_URL || 'ws://localhost:8080/api/ws';
 
 class WebSocketService {
@@ -10,6 +12,7 @@ class WebSocketService {
     this.maxReconnectAttempts = 5;
     this.reconnectDelay = 1000;
     this.messageHandlers = [];
+    this.rooms = new Set();
     this.userId = null;
     this.username = null;
     console.log('[WebSocketService] Initialized with URL:', WS_URL);
@@ -27,40 +30,54 @@ class WebSocketService {
           reject(new Error('No authentication token found'));
           return;
         }
-        const url = `${WS_URL}?token=${encodeURIComponent(token)}`;
-        console.log('[WebSocketService] Connecting to:', url);
-        this.ws = new WebSocket(url);
-
-        this.ws.onopen = () => {
-          console.log('WebSocket connected');
-          this.reconnectAttempts = 0;
-          resolve();
-        };
-
-        this.ws.onmessage = (event) => {
-          try {
-            const data = JSON.parse(event.data);
-            this.messageHandlers.forEach((handler) => handler(data));
-          } catch (error) {
-            console.error('Error parsing WebSocket message:', error);
-          }
-        };
-
-        this.ws.onerror = (error) => {
-          console.error('WebSocket error:', error);
-          reject(error);
-        };
-
-        this.ws.onclose = () => {
-          console.log('WebSocket disconnected');
-          this.attemptReconnect();
-        };
+
+        // Exchange the token for a ticket so it stays out of the URL
+        api.post('/api/ws/ticket').then((response) => {
+          this.open(response.data.ticket, resolve, reject);
+        }).catch(reject);
       } catch (error) {
         reject(error);
       }
     });
   }
 
+  open(ticket, resolve, reject) {
+    const url = `${WS_URL}?ticket=${encodeURIComponent(ticket)}`;
+    console.log('[WebSocketService] Connecting to:', WS_URL);
+    this.ws = new WebSocket(url);
+
+    this.ws.onopen = () => {
+      console.log('WebSocket connected');
+      this.reconnectAttempts = 0;
+      // Subscriptions do not survive a reconnect
+      this.rooms.forEach((roomId) => this.send({ type: 'join_room', room_id: roomId }));
+      resolve();
+    };
+
+    this.ws.onmessage = (event) => {
+      try {
+        const data = JSON.parse(event.data);
+        this.messageHandlers.forEach((handler) => handler(data));
+      } catch (error) {
+        console.error('Error parsing WebSocket message:', error);
+      }
+    };
+
+    this.ws.onerror = (error) => {
+      console.error('WebSocket error:', error);
+      reject(error);
+    };
+
+    this.ws.onclose = (event) => {
+      console.log('WebSocket disconnected');
+      // 4001: token expired, 4003: session revoked; reconnecting would not help
+      if (event.code === 4001 || event.code === 4003) {
+        return;
+      }
+      this.attemptReconnect();
+    };
+  }
+
   attemptReconnect() {
     if (this.reconnectAttempts < this.maxReconnectAttempts && this.userId && this.username) {
       this.reconnectAttempts++;
@@ -79,6 +96,13 @@ class WebSocketService {
     }
   }
 
+  joinRoom(roomId) {
+    this.rooms.add(roomId);
+    if (this.ws && this.ws.readyState === WebSocket.OPEN) {
+      this.send({ type: 'join_room', room_id: roomId });
+    }
+  }
+
   onMessage(handler) {
     this.messageHandlers.push(handler);
   }
@@ -88,6 +112,7 @@ class WebSocketService {
   }
 
   disconnect() {
+    this.rooms.clear();
     if (this.ws) {
       this.ws.close();
       this.ws = null;
@@ -0,0 +1,228 @@
+package handlers
+
+import (
+	"GoChatApp/models"
+	"GoChatApp/repositories"
+	"GoChatApp/utils"
+	"errors"
+	"io"
+	"net/http"
+	"slices"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// maxAccessTokens is how many unrevoked personal access tokens a user may
+// have at once
+const maxAccessTokens = 50
+
+// accessTokenHintLength is how much of a token after its prefix is kept
+// to recognise it by
+const accessTokenHintLength = 4
+
+// AccessTokenHandler lets users manage personal access tokens for scripts
+// and integrations. Tokens are shown once, when created or rotated.
+type AccessTokenHandler struct {
+	tokenRepo *repositories.PersonalAccessTokenRepository
+	userRepo  *repositories.UserRepository
+}
+
+func NewAccessTokenHandler(tokenRepo *repositories.PersonalAccessTokenRepository, userRepo *repositories.UserRepository) *AccessTokenHandler {
+	return &AccessTokenHandler{
+		tokenRepo: tokenRepo,
+		userRepo:  userRepo,
+	}
+}
+
+// GetAccessTokens lists the user's personal access tokens, expired ones
+// included, along with the scopes a token can have
+func (h *AccessTokenHandler) GetAccessTokens(c *gin.Context) {
+	userID, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return
+	}
+
+	tokens, err := h.tokenRepo.FindByUser(userID.(uint))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch tokens"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"tokens": tokens, "scopes": models.AccessTokenScopes})
+}
+
+// CreateAccessToken creates a named token with the given scopes and, if
+// asked, an expiry
+func (h *AccessTokenHandler) CreateAccessToken(c *gin.Context) {
+	userID, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return
+	}
+
+	var input struct {
+		Name          string   `json:"name" binding:"required,max=100"`
+		Scopes        []string `json:"scopes" binding:"required,min=1"`
+		ExpiresInDays int      `json:"expires_in_days" binding:"omitempty,min=1,max=365"`
+	}
+
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	scopes := make([]string, 0, len(input.Scopes))
+	for _, scope := range input.Scopes {
+		if !slices.Contains(models.AccessTokenScopes, scope) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Unknown scope: " + scope})
+			return
+		}
+		if !slices.Contains(scopes, scope) {
+			scopes = append(scopes, scope)
+		}
+	}
+
+	// Tokens outlive sessions, so only owners of a confirmed address get them
+	user, err := h.userRepo.FindByID(userID.(uint))
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return
+	}
+	if user.EmailVerifiedAt == nil {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Verify your email address to use this feature"})
+		return
+	}
+
+	existing, err := h.tokenRepo.FindByUser(user.ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create token"})
+		return
+	}
+	if len(existing) >= maxAccessTokens {
+		c.JSON(http.StatusConflict, gin.H{"error": "Too many tokens; revoke one first"})
+		return
+	}
+
+	token := &models.PersonalAccessToken{
+		UserID: user.ID,
+		Name:   input.Name,
+		Scopes: scopes,
+	}
+	if input.ExpiresInDays > 0 {
+		expiresAt := time.Now().AddDate(0, 0, input.ExpiresInDays)
+		token.ExpiresAt = &expiresAt
+	}
+	secret, err := newAccessTokenSecret(token)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create token"})
+		return
+	}
+	if err := h.tokenRepo.Create(token); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create token"})
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{"token": secret, "access_token": token})
+}
+
+// RotateAccessToken replaces a token's secret, keeping its name and
+// scopes. The old secret stops working at once. The expiry is kept unless
+// a new one is given, which an expired token needs.
+func (h *AccessTokenHandler) RotateAccessToken(c *gin.Context) {
+	userID, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return
+	}
+
+	tokenID, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid token ID"})
+		return
+	}
+
+	// The body is optional
+	var input struct {
+		ExpiresInDays int `json:"expires_in_days" binding:"omitempty,min=1,max=365"`
+	}
+	if err := c.ShouldBindJSON(&input); err != nil && !errors.Is(err, io.EOF) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	token, err := h.tokenRepo.FindForUser(uint(tokenID), userID.(uint))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Token not found"})
+		return
+	}
+
+	now := time.Now()
+	if input.ExpiresInDays > 0 {
+		expiresAt := now.AddDate(0, 0, input.ExpiresInDays)
+		token.ExpiresAt = &expiresAt
+	} else if token.ExpiresAt != nil && !token.ExpiresAt.After(now) {
+		c.JSON(http.StatusConflict, gin.H{"error": "Token has expired; give expires_in_days to renew it"})
+		return
+	}
+	token.RotatedAt = &now
+
+	secret, err := newAccessTokenSecret(token)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to rotate token"})
+		return
+	}
+	rotated, err := h.tokenRepo.Rotate(token)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to rotate token"})
+		return
+	}
+	if !rotated {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Token not found"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"token": secret, "access_token": token})
+}
+
+// RevokeAccessToken revokes one of the user's tokens
+func (h *AccessTokenHandler) RevokeAccessToken(c *gin.Context) {
+	userID, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return
+	}
+
+	tokenID, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid token ID"})
+		return
+	}
+
+	revoked, err := h.tokenRepo.Revoke(uint(tokenID), userID.(uint))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to revoke token"})
+		return
+	}
+	if !revoked {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Token not found"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Token revoked"})
+}
+
+// newAccessTokenSecret generates a secret for a token, storing its hash and
+// hint on the token and returning the secret to show the user once
+func newAccessTokenSecret(token *models.PersonalAccessToken) (string, error) {
+	random, _, err := utils.GenerateOpaqueToken()
+	if err != nil {
+		return "", err
+	}
+	secret := models.AccessTokenPrefix + random
+	token.TokenHash = utils.HashOpaqueToken(secret)
+	token.Hint = secret[:len(models.AccessTokenPrefix)+accessTokenHintLength]
+	return secret, nil
+}
@@ -0,0 +1,234 @@
+package handlers
+
+import (
+	"GoChatApp/middleware"
+	"GoChatApp/models"
+	"GoChatApp/repositories"
+	"GoChatApp/utils"
+	"fmt"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// setupAccessTokenRouter serves token management to sessions only, and a
+// scoped route to sessions and tokens, the way SetupRoutes does
+func setupAccessTokenRouter(db *gorm.DB) *gin.Engine {
+	userRepo := repositories.NewUserRepository(db)
+	sessionRepo := repositories.NewSessionRepository(db)
+	accessTokenRepo := repositories.NewPersonalAccessTokenRepository(db)
+	authHandler := NewAuthHandler(userRepo, sessionRepo, repositories.NewAccountTokenRepository(db), repositories.NewRecoveryCodeRepository(db), accessTokenRepo, &recordingMailer{}, nil)
+	handler := NewAccessTokenHandler(accessTokenRepo, userRepo)
+
+	router := gin.New()
+	router.POST("/register", authHandler.Register)
+	router.POST("/login", authHandler.Login)
+	router.POST("/password/reset", authHandler.ResetPassword)
+
+	protected := router.Group("/")
+	protected.Use(middleware.AuthMiddleware(sessionRepo, nil))
+	protected.PUT("/users/me/password", authHandler.ChangePassword)
+	protected.GET("/tokens", handler.GetAccessTokens)
+	protected.POST("/tokens", handler.CreateAccessToken)
+	protected.POST("/tokens/:id/rotate", handler.RotateAccessToken)
+	protected.DELETE("/tokens/:id", handler.RevokeAccessToken)
+
+	scoped := router.Group("/")
+	scoped.Use(middleware.AuthMiddleware(sessionRepo, accessTokenRepo))
+	scoped.POST("/messages", middleware.RequireScope(models.ScopeMessagesWrite), func(c *gin.Context) {
+		c.JSON(http.StatusOK, gin.H{"username": c.GetString("username")})
+	})
+	return router
+}
+
+// registerVerified registers a user whose email address is verified
+func registerVerified(t *testing.T, db *gorm.DB, router *gin.Engine, username string) string {
+	t.Helper()
+	accessToken, _ := registerSession(t, router, username)
+	userRepo := repositories.NewUserRepository(db)
+	user, _ := userRepo.FindByUsername(username)
+	userRepo.MarkEmailVerified(user.ID, time.Now())
+	return accessToken
+}
+
+// createAccessToken creates a token and returns its secret and ID
+func createAccessToken(t *testing.T, router *gin.Engine, sessionToken string, body map[string]interface{}) (string, float64) {
+	t.Helper()
+	w, response := doJSON(router, "POST", "/tokens", sessionToken, body)
+	if w.Code != http.StatusCreated {
+		t.Fatalf("Failed to create token: %d %s", w.Code, w.Body.String())
+	}
+	return response["token"].(string), response["access_token"].(map[string]interface{})["id"].(float64)
+}
+
+func TestAccessToken_CreateAndUse(t *testing.T) {
+	db := setupTestDB(t)
+	router := setupAccessTokenRouter(db)
+	session := registerVerified(t, db, router, "scripter")
+
+	secret, _ := createAccessToken(t, router, session, map[string]interface{}{
+		"name":   "deploy bot",
+		"scopes": []string{models.ScopeMessagesWrite, models.ScopeMessagesWrite},
+	})
+	if !strings.HasPrefix(secret, models.AccessTokenPrefix) {
+		t.Errorf("Expected the token to start with %q, got %q", models.AccessTokenPrefix, secret)
+	}
+
+	// The token acts as its user on routes its scopes allow
+	w, response := doJSON(router, "POST", "/messages", secret, nil)
+	if w.Code != http.StatusOK || response["username"] != "scripter" {
+		t.Fatalf("Expected the token to work as scripter, got %d %s", w.Code, w.Body.String())
+	}
+
+	// ...but cannot manage tokens
+	if w, _ := doJSON(router, "GET", "/tokens", secret, nil); w.Code != http.StatusForbidden {
+		t.Errorf("Expected status 403 for token management with a token, got %d", w.Code)
+	}
+
+	// The secret is never listed again
+	w, _ = doJSON(router, "GET", "/tokens", session, nil)
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d", w.Code)
+	}
+	if strings.Contains(w.Body.String(), secret) || !strings.Contains(w.Body.String(), `"scopes":["messages:write"]`) {
+		t.Errorf("Expected the listing to show deduplicated scopes and no secret, got %s", w.Body.String())
+	}
+}
+
+func TestAccessToken_ScopesAreEnforced(t *testing.T) {
+	db := setupTestDB(t)
+	router := setupAccessTokenRouter(db)
+	session := registerVerified(t, db, router, "reader")
+
+	secret, _ := createAccessToken(t, router, session, map[string]interface{}{"name": "read only", "scopes": []string{models.ScopeRoomsRead}})
+	if w, _ := doJSON(router, "POST", "/messages", secret, nil); w.Code != http.StatusForbidden {
+		t.Errorf("Expected status 403 without messages:write, got %d", w.Code)
+	}
+
+	if w, _ := doJSON(router, "POST", "/tokens", session, map[string]interface{}{"name": "bad", "scopes": []string{"admin"}}); w.Code != http.StatusBadRequest {
+		t.Errorf("Expected status 400 for an unknown scope, got %d", w.Code)
+	}
+	if w, _ := doJSON(router, "POST", "/tokens", session, map[string]interface{}{"name": "none", "scopes": []string{}}); w.Code != http.StatusBadRequest {
+		t.Errorf("Expected status 400 without scopes, got %d", w.Code)
+	}
+}
+
+func TestAccessToken_RequiresVerifiedEmail(t *testing.T) {
+	db := setupTestDB(t)
+	router := setupAccessTokenRouter(db)
+	session, _ := registerSession(t, router, "unverified")
+
+	w, _ := doJSON(router, "POST", "/tokens", session, map[string]interface{}{"name": "bot", "scopes": []string{models.ScopeMessagesWrite}})
+	if w.Code != http.StatusForbidden {
+		t.Errorf("Expected status 403 for an unverified account, got %d", w.Code)
+	}
+}
+
+func TestAccessToken_RotateAndRevoke(t *testing.T) {
+	db := setupTestDB(t)
+	router := setupAccessTokenRouter(db)
+	session := registerVerified(t, db, router, "rotator")
+	other := registerVerified(t, db, router, "bystander")
+
+	secret, id := createAccessToken(t, router, session, map[string]interface{}{"name": "ci", "scopes": []string{models.ScopeMessagesWrite}, "expires_in_days": 30})
+	path := fmt.Sprintf("/tokens/%d", int(id))
+
+	// Other users' tokens are reported as missing
+	if w, _ := doJSON(router, "POST", path+"/rotate", other, nil); w.Code != http.StatusNotFound {
+		t.Errorf("Expected status 404 rotating another user's token, got %d", w.Code)
+	}
+
+	w, response := doJSON(router, "POST", path+"/rotate", session, nil)
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d. Body: %s", w.Code, w.Body.String())
+	}
+	rotated := response["token"].(string)
+	if rotated == secret {
+		t.Fatal("Expected a new secret")
+	}
+	if w, _ := doJSON(router, "POST", "/messages", secret, nil); w.Code != http.StatusUnauthorized {
+		t.Errorf("Expected the old secret to stop working, got %d", w.Code)
+	}
+	if w, _ := doJSON(router, "POST", "/messages", rotated, nil); w.Code != http.StatusOK {
+		t.Errorf("Expected the new secret to work, got %d", w.Code)
+	}
+
+	if w, _ := doJSON(router, "DELETE", path, session, nil); w.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d", w.Code)
+	}
+	if w, _ := doJSON(router, "POST", "/messages", rotated, nil); w.Code != http.StatusUnauthorized {
+		t.Errorf("Expected a revoked token to stop working, got %d", w.Code)
+	}
+	if w, _ := doJSON(router, "DELETE", path, session, nil); w.Code != http.StatusNotFound {
+		t.Errorf("Expected status 404 revoking twice, got %d", w.Code)
+	}
+}
+
+func TestAccessToken_ExpiredTokens(t *testing.T) {
+	db := setupTestDB(t)
+	router := setupAccessTokenRouter(db)
+	session := registerVerified(t, db, router, "lapsed")
+
+	secret, id := createAccessToken(t, router, session, map[string]interface{}{"name": "ci", "scopes": []string{models.ScopeMessagesWrite}, "expires_in_days": 1})
+	db.Model(&models.PersonalAccessToken{}).Where("id = ?", uint(id)).Update("expires_at", time.Now().Add(-time.Minute))
+
+	if w, _ := doJSON(router, "POST", "/messages", secret, nil); w.Code != http.StatusUnauthorized {
+		t.Errorf("Expected an expired token to be rejected, got %d", w.Code)
+	}
+
+	// Renewing an expired token needs a new expiry
+	path := fmt.Sprintf("/tokens/%d/rotate", int(id))
+	if w, _ := doJSON(router, "POST", path, session, nil); w.Code != http.StatusConflict {
+		t.Errorf("Expected status 409 rotating an expired token without an expiry, got %d", w.Code)
+	}
+	w, response := doJSON(router, "POST", path, session, map[string]int{"expires_in_days": 7})
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d. Body: %s", w.Code, w.Body.String())
+	}
+	if w, _ := doJSON(router, "POST", "/messages", response["token"].(string), nil); w.Code != http.StatusOK {
+		t.Errorf("Expected the renewed token to work, got %d", w.Code)
+	}
+}
+
+func TestAccessToken_RevokedWithPassword(t *testing.T) {
+	db := setupTestDB(t)
+	router := setupAccessTokenRouter(db)
+	session := registerVerified(t, db, router, "compromised")
+	user, _ := repositories.NewUserRepository(db).FindByUsername("compromised")
+
+	// A reset signs out tokens minted with a stolen password
+	secret, _ := createAccessToken(t, router, session, map[string]interface{}{"name": "backdoor", "scopes": []string{models.ScopeMessagesWrite}})
+	reset, hash, _ := utils.GenerateOpaqueToken()
+	repositories.NewAccountTokenRepository(db).Create(&models.AccountToken{
+		UserID:    user.ID,
+		Purpose:   models.TokenPurposePasswordReset,
+		TokenHash: hash,
+		Email:     user.Email,
+		ExpiresAt: time.Now().Add(time.Hour),
+	})
+	if w, _ := doJSON(router, "POST", "/password/reset", "", map[string]string{"token": reset, "password": "new-password"}); w.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d. Body: %s", w.Code, w.Body.String())
+	}
+	if w, _ := doJSON(router, "POST", "/messages", secret, nil); w.Code != http.StatusUnauthorized {
+		t.Errorf("Expected the token to be revoked by a password reset, got %d", w.Code)
+	}
+
+	// ...and so does a change
+	w, response := doJSON(router, "POST", "/login", "", map[string]string{"username": "compromised", "password": "new-password"})
+	if w.Code != http.StatusOK {
+		t.Fatalf("Failed to log in: %d %s", w.Code, w.Body.String())
+	}
+	session = response["token"].(string)
+	secret, _ = createAccessToken(t, router, session, map[string]interface{}{"name": "backdoor", "scopes": []string{models.ScopeMessagesWrite}})
+	change := map[string]string{"current_password": "new-password", "new_password": "newer-password"}
+	if w, _ := doJSON(router, "PUT", "/users/me/password", session, change); w.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d. Body: %s", w.Code, w.Body.String())
+	}
+	if w, _ := doJSON(router, "POST", "/messages", secret, nil); w.Code != http.StatusUnauthorized {
+		t.Errorf("Expected the token to be revoked by a password change, got %d", w.Code)
+	}
+}
@@ -0,0 +1,321 @@
+package handlers
+
+import (
+	"GoChatApp/events"
+	"GoChatApp/mailer"
+	"GoChatApp/models"
+	"GoChatApp/utils"
+	"context"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// How long mailed account tokens stay valid
+const (
+	passwordResetTTL     = time.Hour
+	emailVerificationTTL = 24 * time.Hour
+)
+
+// mailTimeout bounds sending one email
+const mailTimeout = 30 * time.Second
+
+// ForgotPassword mails a password reset link. It answers the same way
+// whether or not the address is registered, or the address or IP has asked
+// too often, so it cannot be used to find accounts.
+func (h *AuthHandler) ForgotPassword(c *gin.Context) {
+	var input struct {
+		Email string `json:"email" binding:"required,email"`
+	}
+
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	// Over the limit nothing is sent, but the answer stays the same
+	if h.Throttle.AllowPasswordReset(input.Email, c.ClientIP()) {
+		user, err := h.userRepo.FindByEmail(input.Email)
+		if err == nil {
+			if err := h.sendPasswordReset(user); err != nil {
+				log.Printf("Error sending password reset to user %d: %v", user.ID, err)
+			}
+		} else if err != gorm.ErrRecordNotFound {
+			log.Printf("Error finding user for password reset: %v", err)
+		}
+	}
+
+	c.JSON(http.StatusAccepted, gin.H{"message": "If the address is registered, a reset link is on its way"})
+}
+
+// ResetPassword sets a new password with a reset token. Every session and
+// personal access token of the account is revoked, in case the old password
+// was compromised.
+func (h *AuthHandler) ResetPassword(c *gin.Context) {
+	var input struct {
+		Token    string `json:"token" binding:"required"`
+		Password string `json:"password" binding:"required"`
+	}
+
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	// The password is checked before the token is used up, so a refused
+	// password can be corrected with the same link
+	token, err := h.tokenRepo.FindValid(models.TokenPurposePasswordReset, utils.HashOpaqueToken(input.Token))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid or expired token"})
+		return
+	}
+	user, err := h.userRepo.FindByID(token.UserID)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid or expired token"})
+		return
+	}
+	if err := h.PasswordPolicy.Check(input.Password, user.Username); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if used, err := h.tokenRepo.Use(token.ID); err != nil || !used {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid or expired token"})
+		return
+	}
+
+	hashedPassword, err := utils.HashPassword(input.Password)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to hash password"})
+		return
+	}
+	if err := h.userRepo.UpdatePassword(token.UserID, hashedPassword); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to reset password"})
+		return
+	}
+
+	if err := h.sessionRepo.RevokeAllForUser(token.UserID); err != nil {
+		log.Printf("Error revoking sessions of user %d after password reset: %v", token.UserID, err)
+	}
+	if err := h.accessTokenRepo.RevokeAllForUser(token.UserID); err != nil {
+		log.Printf("Error revoking access tokens of user %d after password reset: %v", token.UserID, err)
+	}
+	h.bus.Publish(events.SessionRevoked{UserID: token.UserID})
+
+	c.JSON(http.StatusOK, gin.H{"message": "Password has been reset"})
+}
+
+// VerifyEmail confirms the address a verification token was mailed to
+func (h *AuthHandler) VerifyEmail(c *gin.Context) {
+	var input struct {
+		Token string `json:"token" binding:"required"`
+	}
+
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	token, ok := h.redeemAccountToken(models.TokenPurposeEmailVerification, input.Token)
+	if !ok {
+		if token, ok = h.redeemAccountToken(models.TokenPurposeEmailChange, input.Token); ok {
+			h.confirmEmailChange(c, token)
+			return
+		}
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid or expired token"})
+		return
+	}
+
+	// The token only vouches for the address it was sent to
+	user, err := h.userRepo.FindByID(token.UserID)
+	if err != nil || user.Email != token.Email {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid or expired token"})
+		return
+	}
+
+	if err := h.userRepo.MarkEmailVerified(user.ID, time.Now()); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to verify email"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Email verified"})
+}
+
+// confirmEmailChange moves the account to the new address whose link was
+// opened, as long as it is still the one being changed to and nobody took
+// it in the meantime
+func (h *AuthHandler) confirmEmailChange(c *gin.Context, token *models.AccountToken) {
+	user, err := h.userRepo.FindByID(token.UserID)
+	if err != nil || user.PendingEmail != token.Email {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid or expired token"})
+		return
+	}
+	if _, err := h.userRepo.FindByEmail(token.Email); err == nil {
+		c.JSON(http.StatusConflict, gin.H{"error": "Email already exists"})
+		return
+	}
+
+	applied, err := h.userRepo.ApplyPendingEmail(user.ID, token.Email, time.Now())
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to change email"})
+		return
+	}
+	if !applied {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid or expired token"})
+		return
+	}
+
+	// Reset links went to the old address
+	if err := h.tokenRepo.InvalidateForUser(user.ID, models.TokenPurposePasswordReset); err != nil {
+		log.Printf("Error invalidating password resets of user %d: %v", user.ID, err)
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Email changed"})
+}
+
+// ResendVerification mails a new verification link to the current user
+func (h *AuthHandler) ResendVerification(c *gin.Context) {
+	userID, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return
+	}
+
+	user, err := h.userRepo.FindByID(userID.(uint))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+		return
+	}
+	if user.EmailVerifiedAt != nil {
+		c.JSON(http.StatusConflict, gin.H{"error": "Email already verified"})
+		return
+	}
+	if !h.Throttle.AllowAccountMail(user.ID, user.Email) {
+		tooManyMails(c)
+		return
+	}
+
+	if err := h.sendEmailVerification(user); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to send verification email"})
+		return
+	}
+
+	c.JSON(http.StatusAccepted, gin.H{"message": "Verification email sent"})
+}
+
+// tooManyMails refuses a request for a mail once the user or address has
+// had its share
+func tooManyMails(c *gin.Context) {
+	c.JSON(http.StatusTooManyRequests, gin.H{"error": "Too many emails requested, try again later"})
+}
+
+// sendPasswordReset mails a password reset link
+func (h *AuthHandler) sendPasswordReset(user *models.User) error {
+	token, err := h.issueAccountToken(user, models.TokenPurposePasswordReset, passwordResetTTL)
+	if err != nil {
+		return err
+	}
+
+	h.sendMail(mailer.Message{
+		To:      user.Email,
+		Subject: "Reset your GoChatApp password",
+		Body: fmt.Sprintf("Hi %s,\n\nSomeone asked to reset the password of your account. "+
+			"To choose a new password, open this link within an hour:\n\n%s/reset-password?token=%s\n\n"+
+			"If this wasn't you, you can ignore this email.\n", user.Username, h.AppURL, token),
+	})
+	return nil
+}
+
+// sendEmailVerification mails a link confirming the user's address
+func (h *AuthHandler) sendEmailVerification(user *models.User) error {
+	token, err := h.issueAccountToken(user, models.TokenPurposeEmailVerification, emailVerificationTTL)
+	if err != nil {
+		return err
+	}
+
+	h.sendMail(mailer.Message{
+		To:      user.Email,
+		Subject: "Confirm your GoChatApp email address",
+		Body: fmt.Sprintf("Hi %s,\n\nPlease confirm your email address by opening this link within 24 hours:\n\n"+
+			"%s/verify-email?token=%s\n", user.Username, h.AppURL, token),
+	})
+	return nil
+}
+
+// sendEmailChange mails a link confirming the address the user is
+// changing to, and tells the current address about the change
+func (h *AuthHandler) sendEmailChange(user *models.User, email string) error {
+	token, err := h.issueAccountTokenTo(user, email, models.TokenPurposeEmailChange, emailVerificationTTL)
+	if err != nil {
+		return err
+	}
+
+	h.sendMail(mailer.Message{
+		To:      email,
+		Subject: "Confirm your new GoChatApp email address",
+		Body: fmt.Sprintf("Hi %s,\n\nTo move your account to this address, open this link within 24 hours:\n\n"+
+			"%s/verify-email?token=%s\n\nIf this wasn't you, you can ignore this email.\n", user.Username, h.AppURL, token),
+	})
+	h.sendMail(mailer.Message{
+		To:      user.Email,
+		Subject: "Your GoChatApp email address is being changed",
+		Body: fmt.Sprintf("Hi %s,\n\nSomeone asked to move your account to %s. It stays at this address "+
+			"until the link mailed there is opened.\n\nIf this wasn't you, change your password now.\n", user.Username, email),
+	})
+	return nil
+}
+
+// issueAccountToken creates a token for the user's current address,
+// replacing any outstanding token for the same purpose
+func (h *AuthHandler) issueAccountToken(user *models.User, purpose string, ttl time.Duration) (string, error) {
+	return h.issueAccountTokenTo(user, user.Email, purpose, ttl)
+}
+
+// issueAccountTokenTo creates a token to be mailed to the given address
+func (h *AuthHandler) issueAccountTokenTo(user *models.User, email, purpose string, ttl time.Duration) (string, error) {
+	if err := h.tokenRepo.InvalidateForUser(user.ID, purpose); err != nil {
+		return "", err
+	}
+
+	token, hash, err := utils.GenerateOpaqueToken()
+	if err != nil {
+		return "", err
+	}
+	err = h.tokenRepo.Create(&models.AccountToken{
+		UserID:    user.ID,
+		Purpose:   purpose,
+		TokenHash: hash,
+		Email:     email,
+		ExpiresAt: time.Now().Add(ttl),
+	})
+	return token, err
+}
+
+// redeemAccountToken uses up a mailed token, reporting false if it is
+// unknown, expired or already used
+func (h *AuthHandler) redeemAccountToken(purpose, token string) (*models.AccountToken, bool) {
+	accountToken, err := h.tokenRepo.FindValid(purpose, utils.HashOpaqueToken(token))
+	if err != nil {
+		return nil, false
+	}
+	used, err := h.tokenRepo.Use(accountToken.ID)
+	if err != nil || !used {
+		return nil, false
+	}
+	return accountToken, true
+}
+
+// sendMail sends an email in the background, so responses do not wait on
+// the mail server or reveal by their timing whether one was sent
+func (h *AuthHandler) sendMail(msg mailer.Message) {
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(), mailTimeout)
+		defer cancel()
+		if err := h.mailer.Send(ctx, msg); err != nil {
+			log.Printf("Error sending %q to %s: %v", msg.Subject, msg.To, err)
+		}
+	}()
+}
@@ -0,0 +1,190 @@
+package handlers
+
+import (
+	"GoChatApp/mailer"
+	"GoChatApp/middleware"
+	"GoChatApp/repositories"
+	"context"
+	"net/http"
+	"regexp"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// recordingMailer keeps sent messages for tests to inspect
+type recordingMailer struct {
+	mu   sync.Mutex
+	sent []mailer.Message
+}
+
+func (m *recordingMailer) Send(ctx context.Context, msg mailer.Message) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.sent = append(m.sent, msg)
+	return nil
+}
+
+// count returns how many messages have been sent
+func (m *recordingMailer) count() int {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return len(m.sent)
+}
+
+var mailedToken = regexp.MustCompile(`token=([A-Za-z0-9_-]+)`)
+
+// waitForMessage waits for a message with the given subject. Mail is sent
+// in the background.
+func (m *recordingMailer) waitForMessage(t *testing.T, to, subject string) mailer.Message {
+	t.Helper()
+	for deadline := time.Now().Add(2 * time.Second); time.Now().Before(deadline); time.Sleep(5 * time.Millisecond) {
+		m.mu.Lock()
+		for i := len(m.sent) - 1; i >= 0; i-- {
+			msg := m.sent[i]
+			if msg.To == to && strings.Contains(msg.Subject, subject) {
+				m.mu.Unlock()
+				return msg
+			}
+		}
+		m.mu.Unlock()
+	}
+	t.Fatalf("No %q mail sent to %s", subject, to)
+	return mailer.Message{}
+}
+
+// waitForToken waits for a message with the given subject and returns the
+// token from its link
+func (m *recordingMailer) waitForToken(t *testing.T, to, subject string) string {
+	t.Helper()
+	return mailedToken.FindStringSubmatch(m.waitForMessage(t, to, subject).Body)[1]
+}
+
+// setupAccountRouter serves the account recovery routes along with login
+func setupAccountRouter(db *gorm.DB) (*gin.Engine, *recordingMailer) {
+	mail := &recordingMailer{}
+	sessionRepo := repositories.NewSessionRepository(db)
+	handler := NewAuthHandler(repositories.NewUserRepository(db), sessionRepo, repositories.NewAccountTokenRepository(db), repositories.NewRecoveryCodeRepository(db), repositories.NewPersonalAccessTokenRepository(db), mail, nil)
+
+	router := gin.New()
+	router.POST("/register", handler.Register)
+	router.POST("/login", handler.Login)
+	router.POST("/password/forgot", handler.ForgotPassword)
+	router.POST("/password/reset", handler.ResetPassword)
+	router.POST("/email/verify", handler.VerifyEmail)
+
+	protected := router.Group("/")
+	protected.Use(middleware.AuthMiddleware(sessionRepo, nil))
+	protected.GET("/sessions", handler.GetSessions)
+	protected.POST("/email/verify/resend", handler.ResendVerification)
+	return router, mail
+}
+
+func TestAccount_PasswordReset(t *testing.T) {
+	db := setupTestDB(t)
+	router, mail := setupAccountRouter(db)
+	accessToken, _ := registerSession(t, router, "forgetful")
+
+	w, _ := doJSON(router, "POST", "/password/forgot", "", map[string]string{"email": "forgetful@example.com"})
+	if w.Code != http.StatusAccepted {
+		t.Fatalf("Expected status 202, got %d", w.Code)
+	}
+	token := mail.waitForToken(t, "forgetful@example.com", "Reset")
+
+	// A refused password leaves the token usable
+	if w, _ := doJSON(router, "POST", "/password/reset", "", map[string]string{"token": token, "password": "forgetful1"}); w.Code != http.StatusBadRequest {
+		t.Fatalf("Expected a password containing the username to be refused, got %d", w.Code)
+	}
+
+	reset := map[string]string{"token": token, "password": "new-password"}
+	if w, _ := doJSON(router, "POST", "/password/reset", "", reset); w.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d. Body: %s", w.Code, w.Body.String())
+	}
+
+	// Existing sessions are signed out
+	if w, _ := doJSON(router, "GET", "/sessions", accessToken, nil); w.Code != http.StatusUnauthorized {
+		t.Errorf("Expected sessions to be revoked after a reset, got %d", w.Code)
+	}
+
+	// Only the new password works
+	if w, _ := doJSON(router, "POST", "/login", "", map[string]string{"username": "forgetful", "password": "password123"}); w.Code != http.StatusUnauthorized {
+		t.Errorf("Expected the old password to be rejected, got %d", w.Code)
+	}
+	if w, _ := doJSON(router, "POST", "/login", "", map[string]string{"username": "forgetful", "password": "new-password"}); w.Code != http.StatusOK {
+		t.Errorf("Expected the new password to work, got %d", w.Code)
+	}
+
+	// Tokens are single use
+	if w, _ := doJSON(router, "POST", "/password/reset", "", reset); w.Code != http.StatusBadRequest {
+		t.Errorf("Expected a used token to be rejected, got %d", w.Code)
+	}
+}
+
+func TestAccount_ForgotPasswordUnknownEmail(t *testing.T) {
+	db := setupTestDB(t)
+	router, mail := setupAccountRouter(db)
+
+	w, _ := doJSON(router, "POST", "/password/forgot", "", map[string]string{"email": "nobody@example.com"})
+	if w.Code != http.StatusAccepted {
+		t.Errorf("Expected the same answer as for a registered address, got %d", w.Code)
+	}
+
+	time.Sleep(20 * time.Millisecond)
+	if mail.count() != 0 {
+		t.Errorf("Expected no mail, got %d", mail.count())
+	}
+}
+
+func TestAccount_EmailVerification(t *testing.T) {
+	db := setupTestDB(t)
+	router, mail := setupAccountRouter(db)
+	userRepo := repositories.NewUserRepository(db)
+	accessToken, _ := registerSession(t, router, "newcomer")
+
+	first := mail.waitForToken(t, "newcomer@example.com", "Confirm")
+
+	// Asking again replaces the first link
+	if w, _ := doJSON(router, "POST", "/email/verify/resend", accessToken, nil); w.Code != http.StatusAccepted {
+		t.Fatalf("Expected status 202, got %d", w.Code)
+	}
+	for deadline := time.Now().Add(2 * time.Second); mail.count() < 2 && time.Now().Before(deadline); {
+		time.Sleep(5 * time.Millisecond)
+	}
+	second := mail.waitForToken(t, "newcomer@example.com", "Confirm")
+	if w, _ := doJSON(router, "POST", "/email/verify", "", map[string]string{"token": first}); w.Code != http.StatusBadRequest {
+		t.Errorf("Expected a replaced token to be rejected, got %d", w.Code)
+	}
+
+	if w, _ := doJSON(router, "POST", "/email/verify", "", map[string]string{"token": second}); w.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d. Body: %s", w.Code, w.Body.String())
+	}
+
+	user, _ := userRepo.FindByUsername("newcomer")
+	if user.EmailVerifiedAt == nil {
+		t.Error("Expected the address to be marked verified")
+	}
+	if w, _ := doJSON(router, "POST", "/email/verify/resend", accessToken, nil); w.Code != http.StatusConflict {
+		t.Errorf("Expected status 409 once verified, got %d", w.Code)
+	}
+}
+
+func TestAccount_VerificationTokenTiedToAddress(t *testing.T) {
+	db := setupTestDB(t)
+	router, mail := setupAccountRouter(db)
+	userRepo := repositories.NewUserRepository(db)
+	registerSession(t, router, "mover")
+
+	token := mail.waitForToken(t, "mover@example.com", "Confirm")
+
+	user, _ := userRepo.FindByUsername("mover")
+	user.Email = "moved@example.com"
+	userRepo.Update(user)
+
+	if w, _ := doJSON(router, "POST", "/email/verify", "", map[string]string{"token": token}); w.Code != http.StatusBadRequest {
+		t.Errorf("Expected a token for the old address to be rejected, got %d", w.Code)
+	}
+}
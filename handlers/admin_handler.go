@@ -0,0 +1,278 @@
+package handlers
+
+import (
+	"GoChatApp/events"
+	"GoChatApp/models"
+	"GoChatApp/repositories"
+	"log"
+	"net/http"
+	"slices"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// AdminHandler serves the server administration endpoints
+type AdminHandler struct {
+	throttle        *LoginThrottle
+	userRepo        *repositories.UserRepository
+	sessionRepo     *repositories.SessionRepository
+	accessTokenRepo *repositories.PersonalAccessTokenRepository
+	bus             *events.Bus
+}
+
+func NewAdminHandler(throttle *LoginThrottle, userRepo *repositories.UserRepository, sessionRepo *repositories.SessionRepository, accessTokenRepo *repositories.PersonalAccessTokenRepository, bus *events.Bus) *AdminHandler {
+	return &AdminHandler{
+		throttle:        throttle,
+		userRepo:        userRepo,
+		sessionRepo:     sessionRepo,
+		accessTokenRepo: accessTokenRepo,
+		bus:             bus,
+	}
+}
+
+// adminUser is a user as shown to admins, with the fields hidden from the
+// public user endpoints
+type adminUser struct {
+	*models.User
+	EmailVerifiedAt *time.Time `json:"email_verified_at"`
+	Role            string     `json:"role"`
+	DisabledAt      *time.Time `json:"disabled_at,omitempty"`
+	LastSeenAt      *time.Time `json:"last_seen_at"`
+}
+
+func newAdminUser(user *models.User) adminUser {
+	return adminUser{
+		User:            user,
+		EmailVerifiedAt: user.EmailVerifiedAt,
+		Role:            user.Role,
+		DisabledAt:      user.DisabledAt,
+		LastSeenAt:      user.LastSeenAt,
+	}
+}
+
+// GetUsers lists users, optionally filtered by ?q= (part of the username
+// or email address), ?role= and ?disabled=true|false, with ?limit= and
+// ?offset= for paging
+func (h *AdminHandler) GetUsers(c *gin.Context) {
+	limit, ok := queryLimit(c)
+	if !ok {
+		return
+	}
+	offset := 0
+	if value := c.Query("offset"); value != "" {
+		parsed, err := strconv.Atoi(value)
+		if err != nil || parsed < 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid offset"})
+			return
+		}
+		offset = parsed
+	}
+
+	filter := repositories.UserFilter{Query: c.Query("q"), Role: c.Query("role")}
+	if filter.Role != "" && !slices.Contains(models.Roles, filter.Role) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid role"})
+		return
+	}
+	if value := c.Query("disabled"); value != "" {
+		disabled, err := strconv.ParseBool(value)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid disabled filter"})
+			return
+		}
+		filter.Disabled = &disabled
+	}
+
+	users, total, err := h.userRepo.Search(filter, limit, offset)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch users"})
+		return
+	}
+
+	listed := make([]adminUser, len(users))
+	for i := range users {
+		listed[i] = newAdminUser(&users[i])
+	}
+
+	c.JSON(http.StatusOK, gin.H{"users": listed, "total": total})
+}
+
+// SetRole changes a user's global role. A demoted user is signed out
+// everywhere, so tokens carrying the old role stop working at once.
+func (h *AdminHandler) SetRole(c *gin.Context) {
+	var input struct {
+		Role string `json:"role" binding:"required"`
+	}
+
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if !slices.Contains(models.Roles, input.Role) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid role"})
+		return
+	}
+
+	user, ok := h.targetUser(c)
+	if !ok {
+		return
+	}
+
+	if err := h.userRepo.SetRole(user.ID, input.Role); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to change role"})
+		return
+	}
+	adminID, _ := c.Get("user_id")
+	log.Printf("Admin %d changed the role of user %d from %s to %s", adminID.(uint), user.ID, user.Role, input.Role)
+
+	if !models.RoleAtLeast(input.Role, user.Role) {
+		h.signOut(user.ID)
+	}
+	user.Role = input.Role
+
+	c.JSON(http.StatusOK, gin.H{"user": newAdminUser(user)})
+}
+
+// DisableUser disables an account. The user is signed out everywhere, their
+// personal access tokens are revoked and they cannot sign in again until
+// the account is enabled.
+func (h *AdminHandler) DisableUser(c *gin.Context) {
+	user, ok := h.targetUser(c)
+	if !ok {
+		return
+	}
+
+	if user.DisabledAt == nil {
+		now := time.Now()
+		if err := h.userRepo.SetDisabled(user.ID, &now); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to disable user"})
+			return
+		}
+		user.DisabledAt = &now
+		adminID, _ := c.Get("user_id")
+		log.Printf("Admin %d disabled user %d", adminID.(uint), user.ID)
+	}
+
+	// Signing out again is harmless, and catches sessions started in a race
+	h.signOut(user.ID)
+	if err := h.accessTokenRepo.RevokeAllForUser(user.ID); err != nil {
+		log.Printf("Error revoking access tokens of disabled user %d: %v", user.ID, err)
+	}
+
+	c.JSON(http.StatusOK, gin.H{"user": newAdminUser(user)})
+}
+
+// EnableUser lets a disabled user sign in again. Revoked sessions and
+// tokens stay revoked.
+func (h *AdminHandler) EnableUser(c *gin.Context) {
+	user, ok := h.targetUser(c)
+	if !ok {
+		return
+	}
+
+	if err := h.userRepo.SetDisabled(user.ID, nil); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to enable user"})
+		return
+	}
+	user.DisabledAt = nil
+
+	c.JSON(http.StatusOK, gin.H{"user": newAdminUser(user)})
+}
+
+// targetUser loads the user named in the URL. Admins cannot act on
+// themselves, so the server cannot lose its last admin by accident.
+func (h *AdminHandler) targetUser(c *gin.Context) (*models.User, bool) {
+	userID, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid user ID"})
+		return nil, false
+	}
+
+	adminID, _ := c.Get("user_id")
+	if uint(userID) == adminID.(uint) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "You cannot change your own account here"})
+		return nil, false
+	}
+
+	user, err := h.userRepo.FindByID(uint(userID))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+		return nil, false
+	}
+	return user, true
+}
+
+// signOut revokes every session of a user and closes their connections
+func (h *AdminHandler) signOut(userID uint) {
+	if err := h.sessionRepo.RevokeAllForUser(userID); err != nil {
+		log.Printf("Error revoking sessions of user %d: %v", userID, err)
+	}
+	h.bus.Publish(events.SessionRevoked{UserID: userID})
+}
+
+// queryLimit reads ?limit=, 1 to 500 and 50 by default
+func queryLimit(c *gin.Context) (int, bool) {
+	limit := 50
+	if value := c.Query("limit"); value != "" {
+		parsed, err := strconv.Atoi(value)
+		if err != nil || parsed < 1 || parsed > 500 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid limit"})
+			return 0, false
+		}
+		limit = parsed
+	}
+	return limit, true
+}
+
+// GetLockouts lists recent login lockouts, newest first. With ?active=true
+// only lockouts still in force are listed.
+func (h *AdminHandler) GetLockouts(c *gin.Context) {
+	limit, ok := queryLimit(c)
+	if !ok {
+		return
+	}
+
+	events, err := h.throttle.LockoutEvents(c.Query("active") == "true", limit)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch lockouts"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"lockouts": events})
+}
+
+// Unlock lifts the lockout of a username or client IP and forgets its
+// failed logins
+func (h *AdminHandler) Unlock(c *gin.Context) {
+	var input struct {
+		Username string `json:"username"`
+		IP       string `json:"ip"`
+	}
+
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	scope, subject := models.ThrottleScopeAccount, input.Username
+	if input.IP != "" {
+		scope, subject = models.ThrottleScopeIP, input.IP
+	}
+	if (input.Username == "") == (input.IP == "") {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Give either a username or an IP"})
+		return
+	}
+
+	adminID, _ := c.Get("user_id")
+	wasLocked, err := h.throttle.Unlock(scope, subject, adminID.(uint))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to unlock"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message":    "Unlocked",
+		"was_locked": wasLocked,
+	})
+}
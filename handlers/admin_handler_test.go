@@ -0,0 +1,228 @@
+package handlers
+
+import (
+	"GoChatApp/middleware"
+	"GoChatApp/models"
+	"GoChatApp/repositories"
+	"GoChatApp/utils"
+	"fmt"
+	"net/http"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// setupAdminRouter serves sign-in and the user management routes the way
+// SetupRoutes does, plus a route personal access tokens can use
+func setupAdminRouter(db *gorm.DB) *gin.Engine {
+	userRepo := repositories.NewUserRepository(db)
+	sessionRepo := repositories.NewSessionRepository(db)
+	accessTokenRepo := repositories.NewPersonalAccessTokenRepository(db)
+	authHandler := NewAuthHandler(userRepo, sessionRepo, repositories.NewAccountTokenRepository(db), repositories.NewRecoveryCodeRepository(db), repositories.NewPersonalAccessTokenRepository(db), &recordingMailer{}, nil)
+	admin := NewAdminHandler(nil, userRepo, sessionRepo, accessTokenRepo, nil)
+
+	router := gin.New()
+	router.POST("/register", authHandler.Register)
+	router.POST("/login", authHandler.Login)
+	router.POST("/token/refresh", authHandler.RefreshToken)
+
+	protected := router.Group("/")
+	protected.Use(middleware.AuthMiddleware(sessionRepo, nil))
+	protected.GET("/sessions", authHandler.GetSessions)
+
+	group := protected.Group("/admin")
+	group.Use(middleware.RequireRole(models.RoleModerator))
+	group.GET("/users", admin.GetUsers)
+	group.PUT("/users/:id/role", middleware.RequireRole(models.RoleAdmin), admin.SetRole)
+	group.POST("/users/:id/disable", middleware.RequireRole(models.RoleAdmin), admin.DisableUser)
+	group.POST("/users/:id/enable", middleware.RequireRole(models.RoleAdmin), admin.EnableUser)
+
+	users := NewUserHandler(userRepo)
+	router.GET("/users", users.GetUsers)
+	router.GET("/users/:id", users.GetUserByID)
+
+	scoped := router.Group("/")
+	scoped.Use(middleware.AuthMiddleware(sessionRepo, accessTokenRepo))
+	scoped.POST("/messages", middleware.RequireScope(models.ScopeMessagesWrite), func(c *gin.Context) {
+		c.Status(http.StatusOK)
+	})
+	return router
+}
+
+// signInWithRole registers a user, gives them a role and signs them in so
+// their token carries it
+func signInWithRole(t *testing.T, db *gorm.DB, router *gin.Engine, username, role string) (string, uint) {
+	t.Helper()
+	registerSession(t, router, username)
+	userRepo := repositories.NewUserRepository(db)
+	user, _ := userRepo.FindByUsername(username)
+	userRepo.SetRole(user.ID, role)
+	accessToken, _ := loginSession(t, router, username)
+	return accessToken, user.ID
+}
+
+func TestAdmin_RolesGuardRoutes(t *testing.T) {
+	db := setupTestDB(t)
+	router := setupAdminRouter(db)
+	adminToken, _ := signInWithRole(t, db, router, "root", models.RoleAdmin)
+	moderatorToken, _ := signInWithRole(t, db, router, "mod", models.RoleModerator)
+	userToken, userID := signInWithRole(t, db, router, "plain", models.RoleUser)
+
+	if w, _ := doJSON(router, "GET", "/admin/users", userToken, nil); w.Code != http.StatusForbidden {
+		t.Errorf("Expected status 403 for a user, got %d", w.Code)
+	}
+	if w, _ := doJSON(router, "GET", "/admin/users", moderatorToken, nil); w.Code != http.StatusOK {
+		t.Errorf("Expected moderators to list users, got %d", w.Code)
+	}
+
+	rolePath := fmt.Sprintf("/admin/users/%d/role", userID)
+	if w, _ := doJSON(router, "PUT", rolePath, moderatorToken, map[string]string{"role": models.RoleAdmin}); w.Code != http.StatusForbidden {
+		t.Errorf("Expected status 403 for a moderator changing roles, got %d", w.Code)
+	}
+	if w, _ := doJSON(router, "PUT", rolePath, adminToken, map[string]string{"role": "owner"}); w.Code != http.StatusBadRequest {
+		t.Errorf("Expected status 400 for an unknown role, got %d", w.Code)
+	}
+	w, response := doJSON(router, "PUT", rolePath, adminToken, map[string]string{"role": models.RoleModerator})
+	if w.Code != http.StatusOK || response["user"].(map[string]interface{})["role"] != models.RoleModerator {
+		t.Fatalf("Expected the user to become a moderator, got %d %s", w.Code, w.Body.String())
+	}
+
+	// A promotion takes effect with the next token
+	_, refreshed := loginSession(t, router, "plain")
+	w, response = doJSON(router, "POST", "/token/refresh", "", map[string]string{"refresh_token": refreshed})
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d", w.Code)
+	}
+	if w, _ := doJSON(router, "GET", "/admin/users", response["token"].(string), nil); w.Code != http.StatusOK {
+		t.Errorf("Expected the promoted user to list users, got %d", w.Code)
+	}
+}
+
+func TestAdmin_ModerationFieldsOnlyShownToAdmins(t *testing.T) {
+	db := setupTestDB(t)
+	router := setupAdminRouter(db)
+	adminToken, adminID := signInWithRole(t, db, router, "root", models.RoleAdmin)
+
+	hidden := []string{"role", "disabled_at", "last_seen_at", "email_verified_at"}
+	w, response := doJSON(router, "GET", fmt.Sprintf("/users/%d", adminID), "", nil)
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d", w.Code)
+	}
+	for _, field := range hidden {
+		if _, ok := response["user"].(map[string]interface{})[field]; ok {
+			t.Errorf("Expected %s to be hidden from GET /users/:id", field)
+		}
+	}
+	_, response = doJSON(router, "GET", "/users", "", nil)
+	for _, field := range hidden {
+		if _, ok := response["users"].([]interface{})[0].(map[string]interface{})[field]; ok {
+			t.Errorf("Expected %s to be hidden from GET /users", field)
+		}
+	}
+
+	_, response = doJSON(router, "GET", "/admin/users", adminToken, nil)
+	listed := response["users"].([]interface{})[0].(map[string]interface{})
+	if listed["role"] != models.RoleAdmin || listed["username"] != "root" {
+		t.Errorf("Expected admins to see the role alongside the profile, got %v", listed)
+	}
+	if _, ok := listed["email_verified_at"]; !ok {
+		t.Errorf("Expected admins to see email_verified_at, got %v", listed)
+	}
+}
+
+func TestAdmin_DemotionSignsOut(t *testing.T) {
+	db := setupTestDB(t)
+	router := setupAdminRouter(db)
+	adminToken, adminID := signInWithRole(t, db, router, "root", models.RoleAdmin)
+	moderatorToken, moderatorID := signInWithRole(t, db, router, "mod", models.RoleModerator)
+
+	// Admins cannot demote themselves
+	if w, _ := doJSON(router, "PUT", fmt.Sprintf("/admin/users/%d/role", adminID), adminToken, map[string]string{"role": models.RoleUser}); w.Code != http.StatusBadRequest {
+		t.Errorf("Expected status 400 changing one's own role, got %d", w.Code)
+	}
+
+	if w, _ := doJSON(router, "PUT", fmt.Sprintf("/admin/users/%d/role", moderatorID), adminToken, map[string]string{"role": models.RoleUser}); w.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d", w.Code)
+	}
+	if w, _ := doJSON(router, "GET", "/admin/users", moderatorToken, nil); w.Code != http.StatusUnauthorized {
+		t.Errorf("Expected the demoted user's old token to stop working, got %d", w.Code)
+	}
+}
+
+func TestAdmin_ListUsersWithFilters(t *testing.T) {
+	db := setupTestDB(t)
+	router := setupAdminRouter(db)
+	adminToken, _ := signInWithRole(t, db, router, "root", models.RoleAdmin)
+	registerSession(t, router, "alice")
+	registerSession(t, router, "alfred")
+	registerSession(t, router, "bob")
+
+	tests := []struct {
+		query string
+		want  float64
+	}{
+		{"", 4},
+		{"?q=al", 2},
+		{"?role=admin", 1},
+		{"?role=user&q=b", 1},
+		{"?disabled=true", 0},
+		{"?limit=2", 4},
+	}
+	for _, tt := range tests {
+		w, response := doJSON(router, "GET", "/admin/users"+tt.query, adminToken, nil)
+		if w.Code != http.StatusOK || response["total"] != tt.want {
+			t.Errorf("GET /admin/users%s = %d total %v, want %v", tt.query, w.Code, response["total"], tt.want)
+		}
+	}
+	if _, response := doJSON(router, "GET", "/admin/users?limit=2", adminToken, nil); len(response["users"].([]interface{})) != 2 {
+		t.Errorf("Expected a page of 2 users, got %v", response["users"])
+	}
+
+	for _, query := range []string{"?role=owner", "?disabled=maybe", "?limit=0", "?offset=-1"} {
+		if w, _ := doJSON(router, "GET", "/admin/users"+query, adminToken, nil); w.Code != http.StatusBadRequest {
+			t.Errorf("GET /admin/users%s = %d, want 400", query, w.Code)
+		}
+	}
+}
+
+func TestAdmin_DisableAndEnableUser(t *testing.T) {
+	db := setupTestDB(t)
+	router := setupAdminRouter(db)
+	adminToken, _ := signInWithRole(t, db, router, "root", models.RoleAdmin)
+	userToken, refreshToken := registerSession(t, router, "troll")
+	troll, _ := repositories.NewUserRepository(db).FindByUsername("troll")
+
+	accessTokenRepo := repositories.NewPersonalAccessTokenRepository(db)
+	secret := models.AccessTokenPrefix + "troll-bot"
+	accessTokenRepo.Create(&models.PersonalAccessToken{UserID: troll.ID, Name: "bot", Scopes: []string{models.ScopeMessagesWrite}, TokenHash: utils.HashOpaqueToken(secret)})
+
+	w, response := doJSON(router, "POST", fmt.Sprintf("/admin/users/%d/disable", troll.ID), adminToken, nil)
+	if w.Code != http.StatusOK || response["user"].(map[string]interface{})["disabled_at"] == nil {
+		t.Fatalf("Expected the user to be disabled, got %d %s", w.Code, w.Body.String())
+	}
+
+	// Every way in is closed
+	if w, _ := doJSON(router, "GET", "/sessions", userToken, nil); w.Code != http.StatusUnauthorized {
+		t.Errorf("Expected the session to be revoked, got %d", w.Code)
+	}
+	if w, _ := doJSON(router, "POST", "/token/refresh", "", map[string]string{"refresh_token": refreshToken}); w.Code == http.StatusOK {
+		t.Error("Expected refreshing to fail for a disabled user")
+	}
+	if w, _ := doJSON(router, "POST", "/messages", secret, nil); w.Code != http.StatusUnauthorized {
+		t.Errorf("Expected the personal access token to be revoked, got %d", w.Code)
+	}
+	w, response = doJSON(router, "POST", "/login", "", map[string]string{"username": "troll", "password": "password123"})
+	if w.Code != http.StatusForbidden || response["error"] != "This account has been disabled" {
+		t.Errorf("Expected status 403 logging in, got %d %s", w.Code, w.Body.String())
+	}
+
+	if w, _ := doJSON(router, "POST", fmt.Sprintf("/admin/users/%d/enable", troll.ID), adminToken, nil); w.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d", w.Code)
+	}
+	loginSession(t, router, "troll")
+
+	if w, _ := doJSON(router, "POST", "/admin/users/999/disable", adminToken, nil); w.Code != http.StatusNotFound {
+		t.Errorf("Expected status 404 for an unknown user, got %d", w.Code)
+	}
+}
@@ -1,21 +1,53 @@
 package handlers
 
 import (
+	"GoChatApp/events"
+	"GoChatApp/mailer"
 	"GoChatApp/models"
 	"GoChatApp/repositories"
 	"GoChatApp/utils"
+	"log"
+	"math"
 	"net/http"
+	"strconv"
+	"sync"
+	"time"
 
 	"github.com/gin-gonic/gin"
 	"gorm.io/gorm"
 )
 
 type AuthHandler struct {
-	userRepo *repositories.UserRepository
+	userRepo        *repositories.UserRepository
+	sessionRepo     *repositories.SessionRepository
+	tokenRepo       *repositories.AccountTokenRepository
+	codeRepo        *repositories.RecoveryCodeRepository
+	accessTokenRepo *repositories.PersonalAccessTokenRepository
+	mailer          mailer.Mailer
+	bus             *events.Bus
+
+	// Base URL of the web app, for links in emails
+	AppURL string
+
+	// Slows down and locks out password guessing; nil means no limit
+	Throttle *LoginThrottle
+
+	// Rules new passwords must follow
+	PasswordPolicy *utils.PasswordPolicy
 }
 
-func NewAuthHandler(userRepo *repositories.UserRepository) *AuthHandler {
-	return &AuthHandler{userRepo: userRepo}
+func NewAuthHandler(userRepo *repositories.UserRepository, sessionRepo *repositories.SessionRepository, tokenRepo *repositories.AccountTokenRepository, codeRepo *repositories.RecoveryCodeRepository, accessTokenRepo *repositories.PersonalAccessTokenRepository, mailer mailer.Mailer, bus *events.Bus) *AuthHandler {
+	return &AuthHandler{
+		userRepo:        userRepo,
+		sessionRepo:     sessionRepo,
+		tokenRepo:       tokenRepo,
+		codeRepo:        codeRepo,
+		accessTokenRepo: accessTokenRepo,
+		mailer:          mailer,
+		bus:             bus,
+		AppURL:          "http://localhost:8080",
+		PasswordPolicy:  utils.NewPasswordPolicy(),
+	}
 }
 
 // Login handles user login
@@ -30,46 +62,68 @@ func (h *AuthHandler) Login(c *gin.Context) {
 		return
 	}
 
+	// Locked out usernames and IPs get the same answer whether or not the
+	// account exists
+	if wait := h.Throttle.Attempt(credentials.Username, c.ClientIP()); wait > 0 {
+		tooManyAttempts(c, wait)
+		return
+	}
+
 	// Find user by username
 	user, err := h.userRepo.FindByUsername(credentials.Username)
-	if err != nil {
-		if err == gorm.ErrRecordNotFound {
-			c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid credentials"})
-			return
-		}
+	if err != nil && err != gorm.ErrRecordNotFound {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to authenticate"})
 		return
 	}
 
-	// Check password
-	if !utils.CheckPassword(user.PasswordHash, credentials.Password) {
+	// Check password. Unknown usernames and accounts without a password
+	// are checked against a dummy hash, so they take as long to reject.
+	hasPassword := err == nil && user.PasswordHash != ""
+	passwordHash := dummyPasswordHash()
+	if hasPassword {
+		passwordHash = user.PasswordHash
+	}
+	if !utils.CheckPassword(passwordHash, credentials.Password) || !hasPassword {
+		h.Throttle.RecordFailure(credentials.Username, c.ClientIP())
 		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid credentials"})
 		return
 	}
+	h.rehashPassword(user, credentials.Password)
+
+	// With two-factor login on, the password only earns a challenge, and
+	// the attempt stays counted against the username until the code is right
+	twoFactor := user.TOTPEnabledAt != nil
+	if twoFactor {
+		h.Throttle.RecordPartialSuccess(c.ClientIP())
+	} else {
+		h.Throttle.RecordSuccess(credentials.Username, c.ClientIP())
+	}
+
+	if accountDisabled(c, user) {
+		return
+	}
 
-	// Generate JWT token
-	token, err := utils.GenerateToken(user.ID, user.Username, user.Email)
+	if twoFactor {
+		h.startTwoFactorChallenge(c, user)
+		return
+	}
+
+	// Start a session for this device
+	response, err := h.startSession(c, user)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate token"})
 		return
 	}
 
-	c.JSON(http.StatusOK, gin.H{
-		"token": token,
-		"user": gin.H{
-			"id":       user.ID,
-			"username": user.Username,
-			"email":    user.Email,
-			"avatar":   user.Avatar,
-		},
-	})
+	response["user"] = userPayload(user)
+	c.JSON(http.StatusOK, response)
 }
 
 // Register handles user registration
 func (h *AuthHandler) Register(c *gin.Context) {
 	var input struct {
 		Username string `json:"username" binding:"required"`
-		Password string `json:"password" binding:"required,min=6"`
+		Password string `json:"password" binding:"required"`
 		Email    string `json:"email" binding:"required,email"`
 	}
 
@@ -78,6 +132,11 @@ func (h *AuthHandler) Register(c *gin.Context) {
 		return
 	}
 
+	if err := h.PasswordPolicy.Check(input.Password, input.Username); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
 	// Check if username already exists
 	if _, err := h.userRepo.FindByUsername(input.Username); err == nil {
 		c.JSON(http.StatusConflict, gin.H{"error": "Username already exists"})
@@ -110,21 +169,79 @@ func (h *AuthHandler) Register(c *gin.Context) {
 		return
 	}
 
-	// Generate JWT token
-	token, err := utils.GenerateToken(user.ID, user.Username, user.Email)
+	// Confirm the address; the account works meanwhile, within the
+	// configured limits for unverified accounts
+	if err := h.sendEmailVerification(&user); err != nil {
+		log.Printf("Error sending verification email to user %d: %v", user.ID, err)
+	}
+
+	// Start a session for this device
+	response, err := h.startSession(c, &user)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate token"})
 		return
 	}
 
-	c.JSON(http.StatusCreated, gin.H{
-		"message": "User registered successfully",
-		"token":   token,
-		"user": gin.H{
-			"id":       user.ID,
-			"username": user.Username,
-			"email":    user.Email,
-			"avatar":   user.Avatar,
-		},
-	})
+	response["message"] = "User registered successfully"
+	response["user"] = userPayload(&user)
+	c.JSON(http.StatusCreated, response)
+}
+
+// rehashPassword replaces a user's password hash after a successful login
+// if it was made with an outdated algorithm or parameters. Failing to is
+// not fatal; the old hash still works.
+func (h *AuthHandler) rehashPassword(user *models.User, password string) {
+	if !utils.PasswordNeedsRehash(user.PasswordHash) {
+		return
+	}
+	hashedPassword, err := utils.HashPassword(password)
+	if err != nil {
+		log.Printf("Error rehashing password of user %d: %v", user.ID, err)
+		return
+	}
+	if err := h.userRepo.UpdatePassword(user.ID, hashedPassword); err != nil {
+		log.Printf("Error rehashing password of user %d: %v", user.ID, err)
+		return
+	}
+	user.PasswordHash = hashedPassword
 }
+
+// accountDisabled answers for an account an admin has disabled, and
+// reports whether it did
+func accountDisabled(c *gin.Context, user *models.User) bool {
+	if user.DisabledAt == nil {
+		return false
+	}
+	c.JSON(http.StatusForbidden, gin.H{"error": "This account has been disabled"})
+	return true
+}
+
+// tooManyAttempts answers an attempt the throttle turned away
+func tooManyAttempts(c *gin.Context, wait time.Duration) {
+	c.Header("Retry-After", strconv.Itoa(int(math.Ceil(wait.Seconds()))))
+	c.JSON(http.StatusTooManyRequests, gin.H{"error": "Too many failed attempts, try again later"})
+}
+
+// userPayload is the user as returned to them on signing in
+func userPayload(user *models.User) gin.H {
+	return gin.H{
+		"id":                 user.ID,
+		"username":           user.Username,
+		"email":              user.Email,
+		"avatar":             user.Avatar,
+		"display_name":       user.DisplayName,
+		"bio":                user.Bio,
+		"timezone":           user.Timezone,
+		"pronouns":           user.Pronouns,
+		"email_verified":     user.EmailVerifiedAt != nil,
+		"pending_email":      user.PendingEmail,
+		"two_factor_enabled": user.TOTPEnabledAt != nil,
+		"role":               user.Role,
+	}
+}
+
+// dummyPasswordHash is checked against for unknown usernames
+var dummyPasswordHash = sync.OnceValue(func() string {
+	hash, _ := utils.HashPassword("dummy password")
+	return hash
+})
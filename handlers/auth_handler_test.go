@@ -3,10 +3,12 @@ package handlers
 import (
 	"GoChatApp/models"
 	"GoChatApp/repositories"
+	"GoChatApp/utils"
 	"bytes"
 	"encoding/json"
 	"net/http"
 	"net/http/httptest"
+	"strings"
 	"testing"
 
 	"github.com/gin-gonic/gin"
@@ -27,7 +29,12 @@ func setupTestDB(t *testing.T) *gorm.DB {
 		t.Fatalf("Failed to connect to test database: %v", err)
 	}
 
-	err = db.AutoMigrate(&models.User{}, &models.Room{}, &models.Message{})
+	// Every connection to :memory: opens a fresh database, so keep the pool at
+	// one connection for handlers that touch the DB from other goroutines
+	sqlDB, _ := db.DB()
+	sqlDB.SetMaxOpenConns(1)
+
+	err = db.AutoMigrate(&models.User{}, &models.Room{}, &models.Message{}, &models.Reaction{}, &models.ReadReceipt{}, &models.Session{}, &models.RefreshToken{}, &models.AccountToken{}, &models.RecoveryCode{}, &models.UserIdentity{}, &models.LoginThrottle{}, &models.LockoutEvent{}, &models.PersonalAccessToken{}, &models.RoomInvite{})
 	if err != nil {
 		t.Fatalf("Failed to migrate test database: %v", err)
 	}
@@ -38,7 +45,7 @@ func setupTestDB(t *testing.T) *gorm.DB {
 func TestAuthHandler_Register_Success(t *testing.T) {
 	db := setupTestDB(t)
 	userRepo := repositories.NewUserRepository(db)
-	handler := NewAuthHandler(userRepo)
+	handler := NewAuthHandler(userRepo, repositories.NewSessionRepository(db), repositories.NewAccountTokenRepository(db), repositories.NewRecoveryCodeRepository(db), repositories.NewPersonalAccessTokenRepository(db), &recordingMailer{}, nil)
 
 	router := gin.New()
 	router.POST("/register", handler.Register)
@@ -74,7 +81,7 @@ func TestAuthHandler_Register_Success(t *testing.T) {
 func TestAuthHandler_Register_DuplicateUsername(t *testing.T) {
 	db := setupTestDB(t)
 	userRepo := repositories.NewUserRepository(db)
-	handler := NewAuthHandler(userRepo)
+	handler := NewAuthHandler(userRepo, repositories.NewSessionRepository(db), repositories.NewAccountTokenRepository(db), repositories.NewRecoveryCodeRepository(db), repositories.NewPersonalAccessTokenRepository(db), &recordingMailer{}, nil)
 
 	// Create existing user
 	userRepo.Create(&models.User{
@@ -107,7 +114,7 @@ func TestAuthHandler_Register_DuplicateUsername(t *testing.T) {
 func TestAuthHandler_Register_InvalidInput(t *testing.T) {
 	db := setupTestDB(t)
 	userRepo := repositories.NewUserRepository(db)
-	handler := NewAuthHandler(userRepo)
+	handler := NewAuthHandler(userRepo, repositories.NewSessionRepository(db), repositories.NewAccountTokenRepository(db), repositories.NewRecoveryCodeRepository(db), repositories.NewPersonalAccessTokenRepository(db), &recordingMailer{}, nil)
 
 	router := gin.New()
 	router.POST("/register", handler.Register)
@@ -121,6 +128,7 @@ func TestAuthHandler_Register_InvalidInput(t *testing.T) {
 		{"missing password", map[string]string{"username": "user", "email": "test@example.com"}},
 		{"short password", map[string]string{"username": "user", "email": "test@example.com", "password": "12345"}},
 		{"invalid email", map[string]string{"username": "user", "email": "notanemail", "password": "password123"}},
+		{"password contains username", map[string]string{"username": "bobby", "email": "test@example.com", "password": "bobby12345"}},
 	}
 
 	for _, tt := range tests {
@@ -142,7 +150,7 @@ func TestAuthHandler_Register_InvalidInput(t *testing.T) {
 func TestAuthHandler_Login_Success(t *testing.T) {
 	db := setupTestDB(t)
 	userRepo := repositories.NewUserRepository(db)
-	handler := NewAuthHandler(userRepo)
+	handler := NewAuthHandler(userRepo, repositories.NewSessionRepository(db), repositories.NewAccountTokenRepository(db), repositories.NewRecoveryCodeRepository(db), repositories.NewPersonalAccessTokenRepository(db), &recordingMailer{}, nil)
 
 	// First register a user
 	router := gin.New()
@@ -188,7 +196,7 @@ func TestAuthHandler_Login_Success(t *testing.T) {
 func TestAuthHandler_Login_WrongPassword(t *testing.T) {
 	db := setupTestDB(t)
 	userRepo := repositories.NewUserRepository(db)
-	handler := NewAuthHandler(userRepo)
+	handler := NewAuthHandler(userRepo, repositories.NewSessionRepository(db), repositories.NewAccountTokenRepository(db), repositories.NewRecoveryCodeRepository(db), repositories.NewPersonalAccessTokenRepository(db), &recordingMailer{}, nil)
 
 	router := gin.New()
 	router.POST("/register", handler.Register)
@@ -226,7 +234,7 @@ func TestAuthHandler_Login_WrongPassword(t *testing.T) {
 func TestAuthHandler_Login_NonexistentUser(t *testing.T) {
 	db := setupTestDB(t)
 	userRepo := repositories.NewUserRepository(db)
-	handler := NewAuthHandler(userRepo)
+	handler := NewAuthHandler(userRepo, repositories.NewSessionRepository(db), repositories.NewAccountTokenRepository(db), repositories.NewRecoveryCodeRepository(db), repositories.NewPersonalAccessTokenRepository(db), &recordingMailer{}, nil)
 
 	router := gin.New()
 	router.POST("/login", handler.Login)
@@ -246,3 +254,35 @@ func TestAuthHandler_Login_NonexistentUser(t *testing.T) {
 		t.Errorf("Expected status 401, got %d", w.Code)
 	}
 }
+
+func TestAuthHandler_Login_RehashesOutdatedPassword(t *testing.T) {
+	db := setupTestDB(t)
+	userRepo := repositories.NewUserRepository(db)
+	handler := NewAuthHandler(userRepo, repositories.NewSessionRepository(db), repositories.NewAccountTokenRepository(db), repositories.NewRecoveryCodeRepository(db), repositories.NewPersonalAccessTokenRepository(db), &recordingMailer{}, nil)
+
+	router := gin.New()
+	router.POST("/login", handler.Login)
+
+	// A hash from before argon2id, as every existing account has
+	legacyHash, _ := utils.NewBcryptHasher().Hash("password123")
+	user := &models.User{Username: "legacy", Email: "legacy@example.com", PasswordHash: legacyHash}
+	userRepo.Create(user)
+
+	login := map[string]string{"username": "legacy", "password": "password123"}
+	if w, _ := doJSON(router, "POST", "/login", "", login); w.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d", w.Code)
+	}
+
+	rehashed, _ := userRepo.FindByID(user.ID)
+	if !strings.HasPrefix(rehashed.PasswordHash, "$argon2id$") {
+		t.Fatalf("Expected the password to be rehashed with argon2id, got %q", rehashed.PasswordHash)
+	}
+
+	// The new hash works, and is not replaced again
+	if w, _ := doJSON(router, "POST", "/login", "", login); w.Code != http.StatusOK {
+		t.Fatalf("Expected the rehashed password to work, got %d", w.Code)
+	}
+	if again, _ := userRepo.FindByID(user.ID); again.PasswordHash != rehashed.PasswordHash {
+		t.Error("Expected a current hash to be kept")
+	}
+}
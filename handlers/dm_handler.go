@@ -1,6 +1,7 @@
 package handlers
 
 import (
+	"GoChatApp/events"
 	"GoChatApp/models"
 	"GoChatApp/repositories"
 	"net/http"
@@ -11,10 +12,11 @@ import (
 
 type DMHandler struct {
 	dmRepo *repositories.DMRepository
+	bus    *events.Bus
 }
 
-func NewDMHandler(dmRepo *repositories.DMRepository) *DMHandler {
-	return &DMHandler{dmRepo: dmRepo}
+func NewDMHandler(dmRepo *repositories.DMRepository, bus *events.Bus) *DMHandler {
+	return &DMHandler{dmRepo: dmRepo, bus: bus}
 }
 
 // GetConversations gets all DM conversations for authenticated user
@@ -145,6 +147,13 @@ func (h *DMHandler) SendMessage(c *gin.Context) {
 		return
 	}
 
+	if conv, err := h.dmRepo.FindConversationByID(uint(convID)); err == nil {
+		h.bus.Publish(events.DirectMessageSent{
+			Message:        msg,
+			ParticipantIDs: []uint{conv.User1ID, conv.User2ID},
+		})
+	}
+
 	c.JSON(http.StatusCreated, gin.H{"message": msg})
 }
 
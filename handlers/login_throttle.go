@@ -0,0 +1,280 @@
+package handlers
+
+import (
+	"GoChatApp/models"
+	"GoChatApp/repositories"
+	"log"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Defaults for LoginThrottle
+const (
+	defaultMaxFailures      = 10
+	defaultMaxFailuresPerIP = 50
+	defaultLockoutDuration  = 15 * time.Minute
+	defaultBackoffBase      = time.Second
+)
+
+// Defaults for account mail
+const (
+	defaultMaxMailsPerAddress = 5
+	defaultMaxMailsPerIP      = 20
+	defaultMaxMailsPerUser    = 5
+	defaultMailWindow         = time.Hour
+)
+
+// backoffAfter is how many failures are free before each further attempt
+// has to wait, twice as long as the one before
+const backoffAfter = 3
+
+// maxBackoff caps the wait between attempts short of a lockout
+const maxBackoff = time.Minute
+
+// LoginThrottle slows down and then locks out password guessing. Failures
+// are counted per username, whether or not the account exists, and per
+// client IP. It also caps account mail, so password resets, verification
+// and email change links cannot be used to flood an inbox. Counts live in the database, so every instance
+// sees them.
+type LoginThrottle struct {
+	repo *repositories.LoginThrottleRepository
+
+	MaxFailures      int           // Failures per username before a lockout
+	MaxFailuresPerIP int           // Failures per IP before a lockout
+	LockoutDuration  time.Duration // How long a lockout lasts; also how long failures are remembered
+	BackoffBase      time.Duration // First wait once backoff starts
+
+	MaxMailsPerAddress int           // Account mails per recipient address in a window
+	MaxMailsPerIP      int           // Password reset requests per IP in a window
+	MaxMailsPerUser    int           // Verification and email change mails per user in a window
+	MailWindow         time.Duration // How long account mails are remembered
+}
+
+func NewLoginThrottle(repo *repositories.LoginThrottleRepository) *LoginThrottle {
+	return &LoginThrottle{
+		repo:             repo,
+		MaxFailures:      defaultMaxFailures,
+		MaxFailuresPerIP: defaultMaxFailuresPerIP,
+		LockoutDuration:  defaultLockoutDuration,
+		BackoffBase:      defaultBackoffBase,
+
+		MaxMailsPerAddress: defaultMaxMailsPerAddress,
+		MaxMailsPerIP:      defaultMaxMailsPerIP,
+		MaxMailsPerUser:    defaultMaxMailsPerUser,
+		MailWindow:         defaultMailWindow,
+	}
+}
+
+// throttleKey names the counters a login attempt touches
+type throttleKey struct {
+	scope   string
+	subject string
+	limit   int
+}
+
+func (t *LoginThrottle) keys(username, ip string) []throttleKey {
+	return []throttleKey{
+		{models.ThrottleScopeAccount, strings.ToLower(username), t.MaxFailures},
+		{models.ThrottleScopeIP, ip, t.MaxFailuresPerIP},
+	}
+}
+
+// Attempt starts a login attempt and reports how long it must wait instead,
+// zero if it may go ahead. An attempt that goes ahead counts as a failure
+// until RecordSuccess says otherwise, so parallel guesses cannot slip in
+// under the limit. A nil throttle allows everything.
+func (t *LoginThrottle) Attempt(username, ip string) time.Duration {
+	if t == nil {
+		return 0
+	}
+
+	now := time.Now()
+	var counted []throttleKey
+	var wait time.Duration
+	for _, key := range t.keys(username, ip) {
+		throttle, ok, err := t.repo.Attempt(key.scope, key.subject, key.limit, t.LockoutDuration, now)
+		if err != nil {
+			log.Printf("Error checking login throttle for %s %s: %v", key.scope, key.subject, err)
+			continue
+		}
+		if ok {
+			counted = append(counted, key)
+			continue
+		}
+
+		// At the limit with attempts still in flight, the last of them
+		// decides whether a lockout follows
+		refused := time.Second
+		if throttle.LockedUntil != nil {
+			refused = max(refused, throttle.LockedUntil.Sub(now))
+		} else if throttle.NextAttemptAt != nil {
+			refused = max(refused, throttle.NextAttemptAt.Sub(now))
+		}
+		wait = max(wait, refused)
+	}
+
+	if wait > 0 {
+		for _, key := range counted {
+			t.release(key)
+		}
+	}
+	return wait
+}
+
+// AllowPasswordReset counts a password reset request for an email address
+// from an IP and reports whether a reset may be mailed. Requests are counted
+// whether or not the address is registered. A nil throttle allows
+// everything.
+func (t *LoginThrottle) AllowPasswordReset(email, ip string) bool {
+	if t == nil {
+		return true
+	}
+	return t.allowMail(
+		throttleKey{models.ThrottleScopeMailAddress, strings.ToLower(email), t.MaxMailsPerAddress},
+		throttleKey{models.ThrottleScopeMailIP, ip, t.MaxMailsPerIP},
+	)
+}
+
+// AllowAccountMail counts a verification or email change mail a signed-in
+// user asked for, to an address of their choosing, and reports whether it
+// may be sent. The address shares its allowance with password resets. A nil
+// throttle allows everything.
+func (t *LoginThrottle) AllowAccountMail(userID uint, email string) bool {
+	if t == nil {
+		return true
+	}
+	return t.allowMail(
+		throttleKey{models.ThrottleScopeMailAddress, strings.ToLower(email), t.MaxMailsPerAddress},
+		throttleKey{models.ThrottleScopeMailUser, strconv.FormatUint(uint64(userID), 10), t.MaxMailsPerUser},
+	)
+}
+
+// allowMail counts a mail against each key and reports whether all of them
+// had room for it. Counts are forgotten once a key has been quiet for
+// MailWindow.
+func (t *LoginThrottle) allowMail(keys ...throttleKey) bool {
+	now := time.Now()
+	var counted []throttleKey
+	allowed := true
+	for _, key := range keys {
+		_, ok, err := t.repo.Attempt(key.scope, key.subject, key.limit, t.MailWindow, now)
+		if err != nil {
+			log.Printf("Error checking mail throttle for %s %s: %v", key.scope, key.subject, err)
+			continue
+		}
+		if ok {
+			counted = append(counted, key)
+		} else {
+			allowed = false
+		}
+	}
+
+	// A refused mail does not use up the allowance of the other keys
+	if !allowed {
+		for _, key := range counted {
+			t.release(key)
+		}
+	}
+	return allowed
+}
+
+// backoff is how long to wait after the given number of failures
+func (t *LoginThrottle) backoff(failures int) time.Duration {
+	exponent := failures - backoffAfter
+	if exponent >= 16 {
+		return maxBackoff
+	}
+	return min(t.BackoffBase<<exponent, maxBackoff)
+}
+
+// RecordFailure settles a failed attempt, which Attempt already counted.
+// The username or IP backs off or, once it reaches its limit, is locked out.
+func (t *LoginThrottle) RecordFailure(username, ip string) {
+	if t == nil {
+		return
+	}
+
+	now := time.Now()
+	for _, key := range t.keys(username, ip) {
+		throttle, err := t.repo.Find(key.scope, key.subject)
+		if err != nil {
+			log.Printf("Error recording failed login for %s %s: %v", key.scope, key.subject, err)
+			continue
+		}
+
+		if throttle.Failures < key.limit {
+			if throttle.Failures >= backoffAfter {
+				if err := t.repo.Backoff(key.scope, key.subject, now.Add(t.backoff(throttle.Failures))); err != nil {
+					log.Printf("Error backing off %s %s: %v", key.scope, key.subject, err)
+				}
+			}
+			continue
+		}
+
+		until := now.Add(t.LockoutDuration)
+		locked, err := t.repo.Lock(key.scope, key.subject, until)
+		if err != nil {
+			log.Printf("Error locking out %s %s: %v", key.scope, key.subject, err)
+			continue
+		}
+		if !locked {
+			continue
+		}
+		log.Printf("Locked out %s %s after %d failed logins", key.scope, key.subject, throttle.Failures)
+		t.repo.CreateLockoutEvent(&models.LockoutEvent{
+			Scope:       key.scope,
+			Subject:     key.subject,
+			Failures:    throttle.Failures,
+			LockedUntil: until,
+		})
+	}
+}
+
+// RecordSuccess settles an attempt that fully succeeded, clearing the
+// failures of the username. The IP only gets the attempt back, so one
+// working account does not buy more guesses at others.
+func (t *LoginThrottle) RecordSuccess(username, ip string) {
+	if t == nil {
+		return
+	}
+	if err := t.repo.Reset(models.ThrottleScopeAccount, strings.ToLower(username)); err != nil {
+		log.Printf("Error resetting login throttle for %s: %v", username, err)
+	}
+	t.release(throttleKey{scope: models.ThrottleScopeIP, subject: ip})
+}
+
+// RecordPartialSuccess settles an attempt that passed one step of a login
+// with another to come, such as a password awaiting its second factor. The
+// IP gets the attempt back; the username's stays counted until the login
+// succeeds, so guessing codes wears down the same allowance as passwords.
+func (t *LoginThrottle) RecordPartialSuccess(ip string) {
+	if t == nil {
+		return
+	}
+	t.release(throttleKey{scope: models.ThrottleScopeIP, subject: ip})
+}
+
+func (t *LoginThrottle) release(key throttleKey) {
+	if err := t.repo.Release(key.scope, key.subject); err != nil {
+		log.Printf("Error releasing login attempt for %s %s: %v", key.scope, key.subject, err)
+	}
+}
+
+// Unlock lifts a lockout early on behalf of an admin. It reports whether
+// a lockout was in force.
+func (t *LoginThrottle) Unlock(scope, subject string, adminID uint) (bool, error) {
+	if scope == models.ThrottleScopeAccount {
+		subject = strings.ToLower(subject)
+	}
+	if err := t.repo.Reset(scope, subject); err != nil {
+		return false, err
+	}
+	lifted, err := t.repo.MarkUnlocked(scope, subject, adminID, time.Now())
+	return lifted > 0, err
+}
+
+// LockoutEvents returns recent lockouts for admins to review
+func (t *LoginThrottle) LockoutEvents(activeOnly bool, limit int) ([]models.LockoutEvent, error) {
+	return t.repo.FindLockoutEvents(activeOnly, limit)
+}
@@ -0,0 +1,407 @@
+package handlers
+
+import (
+	"GoChatApp/middleware"
+	"GoChatApp/models"
+	"GoChatApp/repositories"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// setupThrottledRouter serves login with a throttle and the lockout admin
+// routes
+func setupThrottledRouter(db *gorm.DB) (*gin.Engine, *LoginThrottle) {
+	userRepo := repositories.NewUserRepository(db)
+	sessionRepo := repositories.NewSessionRepository(db)
+	handler := NewAuthHandler(userRepo, sessionRepo, repositories.NewAccountTokenRepository(db), repositories.NewRecoveryCodeRepository(db), repositories.NewPersonalAccessTokenRepository(db), &recordingMailer{}, nil)
+	handler.Throttle = NewLoginThrottle(repositories.NewLoginThrottleRepository(db))
+	handler.Throttle.MaxFailures = 5
+	handler.Throttle.MaxFailuresPerIP = 20
+	handler.Throttle.BackoffBase = 0
+	admin := NewAdminHandler(handler.Throttle, userRepo, sessionRepo, repositories.NewPersonalAccessTokenRepository(db), nil)
+
+	router := gin.New()
+	router.POST("/register", handler.Register)
+	router.POST("/login", handler.Login)
+	router.POST("/login/2fa", handler.VerifyTwoFactor)
+
+	twoFactor := router.Group("/2fa")
+	twoFactor.Use(middleware.AuthMiddleware(sessionRepo, nil))
+	twoFactor.POST("/setup", handler.SetupTwoFactor)
+	twoFactor.POST("/confirm", handler.ConfirmTwoFactor)
+	twoFactor.POST("/disable", handler.DisableTwoFactor)
+
+	protected := router.Group("/admin")
+	protected.Use(middleware.AuthMiddleware(sessionRepo, nil), middleware.RequireRole(models.RoleModerator))
+	protected.GET("/lockouts", admin.GetLockouts)
+	protected.POST("/lockouts/unlock", admin.Unlock)
+	return router, handler.Throttle
+}
+
+// loginAs attempts a login and returns the status code
+func loginAs(router *gin.Engine, username, password string) int {
+	w, _ := doJSON(router, "POST", "/login", "", map[string]string{"username": username, "password": password})
+	return w.Code
+}
+
+func TestLoginThrottle_LocksOutAccount(t *testing.T) {
+	db := setupTestDB(t)
+	router, _ := setupThrottledRouter(db)
+	registerSession(t, router, "target")
+
+	for i := 0; i < 5; i++ {
+		if code := loginAs(router, "target", "guess"); code != http.StatusUnauthorized {
+			t.Fatalf("Attempt %d: expected status 401, got %d", i+1, code)
+		}
+	}
+
+	// Even the right password is refused while locked out
+	w, _ := doJSON(router, "POST", "/login", "", map[string]string{"username": "Target", "password": "password123"})
+	if w.Code != http.StatusTooManyRequests {
+		t.Fatalf("Expected status 429, got %d", w.Code)
+	}
+	if w.Header().Get("Retry-After") == "" {
+		t.Error("Expected a Retry-After header")
+	}
+}
+
+func TestLoginThrottle_ParallelGuessesStayUnderLimit(t *testing.T) {
+	db := setupTestDB(t)
+	router, _ := setupThrottledRouter(db)
+	registerSession(t, router, "swarmed")
+
+	var wg sync.WaitGroup
+	codes := make(chan int, 20)
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			codes <- loginAs(router, "swarmed", "guess")
+		}()
+	}
+	wg.Wait()
+	close(codes)
+
+	checked := 0
+	for code := range codes {
+		if code == http.StatusUnauthorized {
+			checked++
+		}
+	}
+	if checked == 0 || checked > 5 {
+		t.Errorf("Expected at most 5 passwords to be checked, got %d", checked)
+	}
+}
+
+func TestLoginThrottle_CountsWrongCodes(t *testing.T) {
+	db := setupTestDB(t)
+	router, _ := setupThrottledRouter(db)
+	accessToken, _ := registerSession(t, router, "guarded")
+	enrollTwoFactor(t, router, accessToken)
+
+	// Each correct password stays counted until a code is right, and each
+	// wrong code is a failure: 1 + 2 + 1 + 1 reaches the limit of 5
+	for _, guesses := range []int{2, 1} {
+		challenge := startChallenge(t, router, "guarded")
+		for i := 0; i < guesses; i++ {
+			w, _ := doJSON(router, "POST", "/login/2fa", "", map[string]string{"challenge_token": challenge, "code": "000000"})
+			if w.Code != http.StatusUnauthorized {
+				t.Fatalf("Expected status 401 for a wrong code, got %d", w.Code)
+			}
+		}
+	}
+
+	if code := loginAs(router, "guarded", "password123"); code != http.StatusTooManyRequests {
+		t.Errorf("Expected wrong codes to lock the account out, got %d", code)
+	}
+}
+
+func TestLoginThrottle_CountsDisableTwoFactorGuesses(t *testing.T) {
+	db := setupTestDB(t)
+	router, _ := setupThrottledRouter(db)
+	accessToken, _ := registerSession(t, router, "hijacked")
+	_, _, codes := enrollTwoFactor(t, router, accessToken)
+
+	for i := 0; i < 5; i++ {
+		if w, _ := doJSON(router, "POST", "/2fa/disable", accessToken, map[string]string{"password": "guess", "code": codes[0]}); w.Code != http.StatusForbidden {
+			t.Fatalf("Attempt %d: expected status 403, got %d", i+1, w.Code)
+		}
+	}
+
+	w, _ := doJSON(router, "POST", "/2fa/disable", accessToken, map[string]string{"password": "password123", "code": codes[0]})
+	if w.Code != http.StatusTooManyRequests || w.Header().Get("Retry-After") == "" {
+		t.Errorf("Expected status 429 with Retry-After, got %d", w.Code)
+	}
+}
+
+func TestLoginThrottle_CountsDisableTwoFactorWrongCodes(t *testing.T) {
+	db := setupTestDB(t)
+	router, _ := setupThrottledRouter(db)
+	accessToken, _ := registerSession(t, router, "stolen")
+	enrollTwoFactor(t, router, accessToken)
+
+	// Knowing the password does not reset the count between code guesses
+	locked := false
+	for i := 0; i < 5 && !locked; i++ {
+		w, _ := doJSON(router, "POST", "/2fa/disable", accessToken, map[string]string{"password": "password123", "code": "000000"})
+		switch w.Code {
+		case http.StatusForbidden:
+		case http.StatusTooManyRequests:
+			locked = true
+		default:
+			t.Fatalf("Attempt %d: expected status 403 or 429, got %d", i+1, w.Code)
+		}
+	}
+
+	if code := loginAs(router, "stolen", "password123"); code != http.StatusTooManyRequests {
+		t.Errorf("Expected wrong codes to lock the account out, got %d", code)
+	}
+}
+
+func TestLoginThrottle_UnknownUsernameLooksTheSame(t *testing.T) {
+	db := setupTestDB(t)
+	router, _ := setupThrottledRouter(db)
+	registerSession(t, router, "real")
+
+	for _, username := range []string{"real", "ghost"} {
+		var codes []int
+		for i := 0; i < 6; i++ {
+			codes = append(codes, loginAs(router, username, "guess"))
+		}
+		if codes[0] != http.StatusUnauthorized || codes[5] != http.StatusTooManyRequests {
+			t.Errorf("%s: unexpected status codes %v", username, codes)
+		}
+	}
+}
+
+func TestLoginThrottle_SuccessResetsCount(t *testing.T) {
+	db := setupTestDB(t)
+	router, _ := setupThrottledRouter(db)
+	registerSession(t, router, "typo")
+
+	for round := 0; round < 3; round++ {
+		for i := 0; i < 4; i++ {
+			loginAs(router, "typo", "guess")
+		}
+		if code := loginAs(router, "typo", "password123"); code != http.StatusOK {
+			t.Fatalf("Round %d: expected the right password to work, got %d", round, code)
+		}
+	}
+}
+
+func TestLoginThrottle_PerIPLimit(t *testing.T) {
+	db := setupTestDB(t)
+	router, _ := setupThrottledRouter(db)
+	registerSession(t, router, "bystander")
+
+	// Spraying many usernames from one IP trips the IP limit
+	for i := 0; i < 20; i++ {
+		loginAs(router, "user"+string(rune('a'+i)), "guess")
+	}
+	if code := loginAs(router, "bystander", "password123"); code != http.StatusTooManyRequests {
+		t.Errorf("Expected the IP to be locked out, got %d", code)
+	}
+}
+
+func TestLoginThrottle_SpoofedForwardedForIgnored(t *testing.T) {
+	db := setupTestDB(t)
+	router, _ := setupThrottledRouter(db)
+	router.SetTrustedProxies(nil)
+
+	// A new X-Forwarded-For on every guess still counts against the peer
+	for i := 0; i < 3; i++ {
+		body := strings.NewReader(`{"username":"anyone","password":"guess"}`)
+		req := httptest.NewRequest("POST", "/login", body)
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("X-Forwarded-For", fmt.Sprintf("203.0.113.%d", i+1))
+		router.ServeHTTP(httptest.NewRecorder(), req)
+	}
+
+	var throttles []models.LoginThrottle
+	db.Where("scope = ?", models.ThrottleScopeIP).Find(&throttles)
+	if len(throttles) != 1 || throttles[0].Subject != "192.0.2.1" || throttles[0].Failures != 3 {
+		t.Errorf("Expected 3 failures counted for the peer address, got %+v", throttles)
+	}
+}
+
+func TestLoginThrottle_Backoff(t *testing.T) {
+	db := setupTestDB(t)
+	router, throttle := setupThrottledRouter(db)
+	throttle.BackoffBase = time.Hour
+	registerSession(t, router, "slow")
+
+	for i := 0; i < backoffAfter; i++ {
+		if code := loginAs(router, "slow", "guess"); code != http.StatusUnauthorized {
+			t.Fatalf("Attempt %d: expected status 401, got %d", i+1, code)
+		}
+	}
+	if code := loginAs(router, "slow", "password123"); code != http.StatusTooManyRequests {
+		t.Errorf("Expected to wait after %d failures, got %d", backoffAfter, code)
+	}
+}
+
+func TestLoginThrottle_AdminUnlock(t *testing.T) {
+	db := setupTestDB(t)
+	router, _ := setupThrottledRouter(db)
+	registerSession(t, router, "moderator")
+	userToken, _ := registerSession(t, router, "locked")
+	moderator, _ := repositories.NewUserRepository(db).FindByUsername("moderator")
+	repositories.NewUserRepository(db).SetRole(moderator.ID, models.RoleModerator)
+	adminToken, _ := loginSession(t, router, "moderator")
+
+	for i := 0; i < 5; i++ {
+		loginAs(router, "locked", "guess")
+	}
+
+	if w, _ := doJSON(router, "GET", "/admin/lockouts", userToken, nil); w.Code != http.StatusForbidden {
+		t.Errorf("Expected status 403 for a regular user, got %d", w.Code)
+	}
+
+	w, response := doJSON(router, "GET", "/admin/lockouts?active=true", adminToken, nil)
+	lockouts := response["lockouts"].([]interface{})
+	if w.Code != http.StatusOK || len(lockouts) != 1 || lockouts[0].(map[string]interface{})["subject"] != "locked" {
+		t.Fatalf("Expected the lockout to be listed, got %d %v", w.Code, response)
+	}
+
+	if w, _ := doJSON(router, "POST", "/admin/lockouts/unlock", adminToken, map[string]string{}); w.Code != http.StatusBadRequest {
+		t.Errorf("Expected status 400 without a username or IP, got %d", w.Code)
+	}
+	w, response = doJSON(router, "POST", "/admin/lockouts/unlock", adminToken, map[string]string{"username": "locked"})
+	if w.Code != http.StatusOK || response["was_locked"] != true {
+		t.Fatalf("Expected the lockout to be lifted, got %d %v", w.Code, response)
+	}
+
+	if code := loginAs(router, "locked", "password123"); code != http.StatusOK {
+		t.Errorf("Expected to log in after the unlock, got %d", code)
+	}
+}
+
+func TestLoginThrottle_LimitsPasswordResets(t *testing.T) {
+	db := setupTestDB(t)
+	mail := &recordingMailer{}
+	handler := NewAuthHandler(repositories.NewUserRepository(db), repositories.NewSessionRepository(db), repositories.NewAccountTokenRepository(db), repositories.NewRecoveryCodeRepository(db), repositories.NewPersonalAccessTokenRepository(db), mail, nil)
+	handler.Throttle = NewLoginThrottle(repositories.NewLoginThrottleRepository(db))
+	handler.Throttle.MaxMailsPerAddress = 2
+	handler.Throttle.MaxMailsPerIP = 3
+
+	router := gin.New()
+	router.SetTrustedProxies(nil)
+	router.POST("/register", handler.Register)
+	router.POST("/password/forgot", handler.ForgotPassword)
+	registerSession(t, router, "flooded")
+	mail.waitForMessage(t, "flooded@example.com", "Confirm")
+
+	// Over the limit the answer stays the same, but nothing more is mailed
+	before := mail.count()
+	for i := 0; i < 4; i++ {
+		if w, _ := doJSON(router, "POST", "/password/forgot", "", map[string]string{"email": "flooded@example.com"}); w.Code != http.StatusAccepted {
+			t.Fatalf("Request %d: expected status 202, got %d", i+1, w.Code)
+		}
+	}
+	time.Sleep(20 * time.Millisecond)
+	if sent := mail.count() - before; sent != 2 {
+		t.Errorf("Expected 2 reset mails for the address, got %d", sent)
+	}
+
+	// The IP runs out too, whatever the address or forwarded IP
+	req := httptest.NewRequest("POST", "/password/forgot", strings.NewReader(`{"email":"other@example.com"}`))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-Forwarded-For", "203.0.113.9")
+	router.ServeHTTP(httptest.NewRecorder(), req)
+	var throttle models.LoginThrottle
+	db.Where("scope = ? AND subject = ?", models.ThrottleScopeMailIP, "192.0.2.1").First(&throttle)
+	if throttle.Failures != 3 {
+		t.Errorf("Expected 3 requests counted for the IP, got %d", throttle.Failures)
+	}
+	if handler.Throttle.AllowPasswordReset("third@example.com", "192.0.2.1") {
+		t.Error("Expected the IP to be out of reset requests")
+	}
+
+	// Password reset requests are not failed logins
+	var logins int64
+	db.Model(&models.LoginThrottle{}).Where("scope IN ?", []string{models.ThrottleScopeAccount, models.ThrottleScopeIP}).Count(&logins)
+	if logins != 0 {
+		t.Errorf("Expected no login counters, got %d", logins)
+	}
+}
+
+// setupMailThrottledRouter serves the routes that mail a signed-in user,
+// with a throttle allowing two mails per user and address
+func setupMailThrottledRouter(db *gorm.DB) (*gin.Engine, *recordingMailer) {
+	mail := &recordingMailer{}
+	sessionRepo := repositories.NewSessionRepository(db)
+	handler := NewAuthHandler(repositories.NewUserRepository(db), sessionRepo, repositories.NewAccountTokenRepository(db), repositories.NewRecoveryCodeRepository(db), repositories.NewPersonalAccessTokenRepository(db), mail, nil)
+	handler.Throttle = NewLoginThrottle(repositories.NewLoginThrottleRepository(db))
+	handler.Throttle.MaxMailsPerAddress = 2
+	handler.Throttle.MaxMailsPerUser = 2
+
+	router := gin.New()
+	router.POST("/register", handler.Register)
+
+	protected := router.Group("/")
+	protected.Use(middleware.AuthMiddleware(sessionRepo, nil))
+	protected.POST("/email/verify/resend", handler.ResendVerification)
+	protected.PUT("/users/me/email", handler.ChangeEmail)
+	return router, mail
+}
+
+func TestLoginThrottle_LimitsVerificationMail(t *testing.T) {
+	db := setupTestDB(t)
+	router, mail := setupMailThrottledRouter(db)
+	accessToken, _ := registerSession(t, router, "impatient")
+	mail.waitForMessage(t, "impatient@example.com", "Confirm")
+
+	before := mail.count()
+	for i := 0; i < 2; i++ {
+		if w, _ := doJSON(router, "POST", "/email/verify/resend", accessToken, nil); w.Code != http.StatusAccepted {
+			t.Fatalf("Request %d: expected status 202, got %d", i+1, w.Code)
+		}
+	}
+	if w, _ := doJSON(router, "POST", "/email/verify/resend", accessToken, nil); w.Code != http.StatusTooManyRequests {
+		t.Errorf("Expected status 429 over the limit, got %d", w.Code)
+	}
+	time.Sleep(20 * time.Millisecond)
+	if sent := mail.count() - before; sent != 2 {
+		t.Errorf("Expected 2 verification mails, got %d", sent)
+	}
+}
+
+func TestLoginThrottle_LimitsEmailChangeMail(t *testing.T) {
+	db := setupTestDB(t)
+	router, mail := setupMailThrottledRouter(db)
+	accessToken, _ := registerSession(t, router, "mover")
+	mail.waitForMessage(t, "mover@example.com", "Confirm")
+
+	// Changing to a new address each time still runs out per user
+	change := func(email string) int {
+		w, _ := doJSON(router, "PUT", "/users/me/email", accessToken, map[string]string{"email": email, "current_password": "password123"})
+		return w.Code
+	}
+	for i := 0; i < 2; i++ {
+		if code := change(fmt.Sprintf("victim%d@example.com", i)); code != http.StatusOK {
+			t.Fatalf("Request %d: expected status 200, got %d", i+1, code)
+		}
+	}
+	if code := change("victim9@example.com"); code != http.StatusTooManyRequests {
+		t.Errorf("Expected status 429 over the per-user limit, got %d", code)
+	}
+
+	// ...and per address, whoever asks
+	other, _ := registerSession(t, router, "other")
+	w, _ := doJSON(router, "PUT", "/users/me/email", other, map[string]string{"email": "victim0@example.com", "current_password": "password123"})
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d", w.Code)
+	}
+	w, _ = doJSON(router, "PUT", "/users/me/email", other, map[string]string{"email": "victim0@example.com", "current_password": "password123"})
+	if w.Code != http.StatusTooManyRequests {
+		t.Errorf("Expected status 429 over the per-address limit, got %d", w.Code)
+	}
+}
@@ -1,6 +1,7 @@
 package handlers
 
 import (
+	"GoChatApp/events"
 	"GoChatApp/models"
 	"GoChatApp/repositories"
 	"net/http"
@@ -11,10 +12,12 @@ import (
 
 type MessageHandler struct {
 	messageRepo *repositories.MessageRepository
+	roomRepo    *repositories.RoomRepository
+	bus         *events.Bus
 }
 
-func NewMessageHandler(messageRepo *repositories.MessageRepository) *MessageHandler {
-	return &MessageHandler{messageRepo: messageRepo}
+func NewMessageHandler(messageRepo *repositories.MessageRepository, roomRepo *repositories.RoomRepository, bus *events.Bus) *MessageHandler {
+	return &MessageHandler{messageRepo: messageRepo, roomRepo: roomRepo, bus: bus}
 }
 
 // GetMessages returns all messages with pagination
@@ -61,6 +64,10 @@ func (h *MessageHandler) SendMessage(c *gin.Context) {
 		return
 	}
 
+	if !checkRoomAccess(c, h.roomRepo, input.RoomID, userID.(uint)) {
+		return
+	}
+
 	// Create message
 	message := models.Message{
 		UserID:  userID.(uint),
@@ -76,10 +83,11 @@ func (h *MessageHandler) SendMessage(c *gin.Context) {
 	// Fetch the message with user and room preloaded
 	createdMessage, err := h.messageRepo.FindByID(message.ID)
 	if err != nil {
-		c.JSON(http.StatusCreated, gin.H{"message": message})
-		return
+		createdMessage = &message
 	}
 
+	h.bus.Publish(events.MessageCreated{Message: createdMessage})
+
 	c.JSON(http.StatusCreated, gin.H{"message": createdMessage})
 }
 
@@ -0,0 +1,299 @@
+package handlers
+
+import (
+	"GoChatApp/events"
+	"GoChatApp/models"
+	"GoChatApp/repositories"
+	"GoChatApp/sso"
+	"crypto/subtle"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// ssoLoginTTL is how long the web app has to exchange the token it is
+// handed after a provider login
+const ssoLoginTTL = time.Minute
+
+// oidcStateTTL is how long a user has to sign in at the provider
+const oidcStateTTL = 10 * time.Minute
+
+// oidcCookie keeps the state of a provider login in the user's browser
+const oidcCookie = "oidc_login"
+
+// OIDCHandler signs users in through OpenID Connect providers. Users are
+// linked by the provider's subject, or on first login by a verified email
+// address, and get the same sessions as a password login.
+type OIDCHandler struct {
+	auth         *AuthHandler
+	identityRepo *repositories.UserIdentityRepository
+	providers    map[string]*sso.Provider
+}
+
+func NewOIDCHandler(auth *AuthHandler, identityRepo *repositories.UserIdentityRepository, providers map[string]*sso.Provider) *OIDCHandler {
+	return &OIDCHandler{
+		auth:         auth,
+		identityRepo: identityRepo,
+		providers:    providers,
+	}
+}
+
+// GetProviders lists the configured providers for the login page
+func (h *OIDCHandler) GetProviders(c *gin.Context) {
+	providers := make([]gin.H, 0, len(h.providers))
+	for _, provider := range h.providers {
+		providers = append(providers, gin.H{
+			"name":         provider.Name,
+			"display_name": provider.DisplayName,
+			"login_url":    "/api/auth/oidc/" + provider.Name + "/login",
+		})
+	}
+	sort.Slice(providers, func(i, j int) bool {
+		return providers[i]["name"].(string) < providers[j]["name"].(string)
+	})
+
+	c.JSON(http.StatusOK, gin.H{"providers": providers})
+}
+
+// Login sends the browser to the provider. The state, nonce and PKCE
+// verifier stay behind in a cookie for the callback.
+func (h *OIDCHandler) Login(c *gin.Context) {
+	provider, ok := h.providers[c.Param("provider")]
+	if !ok {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Unknown identity provider"})
+		return
+	}
+
+	authURL, login, err := provider.AuthCodeURL(c.Request.Context())
+	if err != nil {
+		log.Printf("Error starting %s login: %v", provider.Name, err)
+		h.fail(c, "The identity provider is unavailable")
+		return
+	}
+
+	h.setCookie(c, provider, strings.Join([]string{login.State, login.Nonce, login.Verifier}, "."), int(oidcStateTTL.Seconds()))
+	c.Redirect(http.StatusFound, authURL)
+}
+
+// Callback finishes a provider login. It links or creates the user, then
+// sends the browser back to the web app with a short-lived token that
+// Exchange turns into a session.
+func (h *OIDCHandler) Callback(c *gin.Context) {
+	provider, ok := h.providers[c.Param("provider")]
+	if !ok {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Unknown identity provider"})
+		return
+	}
+
+	// The login state is good for one callback
+	value, _ := c.Cookie(oidcCookie)
+	h.setCookie(c, provider, "", -1)
+
+	if reason := c.Query("error"); reason != "" {
+		h.fail(c, "Sign-in was cancelled or refused: "+reason)
+		return
+	}
+
+	parts := strings.Split(value, ".")
+	state := c.Query("state")
+	if len(parts) != 3 || state == "" || subtle.ConstantTimeCompare([]byte(parts[0]), []byte(state)) != 1 {
+		h.fail(c, "Sign-in expired, please try again")
+		return
+	}
+	login := &sso.Login{State: parts[0], Nonce: parts[1], Verifier: parts[2]}
+
+	identity, err := provider.Exchange(c.Request.Context(), login, c.Query("code"))
+	if err != nil {
+		log.Printf("Error finishing %s login: %v", provider.Name, err)
+		h.fail(c, "Sign-in failed, please try again")
+		return
+	}
+	if identity.Email == "" || !identity.EmailVerified {
+		h.fail(c, "Your identity provider has not verified your email address")
+		return
+	}
+
+	user, err := h.findOrCreateUser(provider.Name, identity)
+	if err != nil {
+		log.Printf("Error linking %s account %s: %v", provider.Name, identity.Subject, err)
+		h.fail(c, "Sign-in failed, please try again")
+		return
+	}
+
+	token, err := h.auth.issueAccountToken(user, models.TokenPurposeSSOLogin, ssoLoginTTL)
+	if err != nil {
+		h.fail(c, "Sign-in failed, please try again")
+		return
+	}
+	c.Redirect(http.StatusFound, h.auth.AppURL+"/sso/callback?token="+token)
+}
+
+// Exchange trades the token from Callback for a session, or for a
+// two-factor challenge if the user has it on. The answer is the same as
+// from POST /login.
+func (h *OIDCHandler) Exchange(c *gin.Context) {
+	var input struct {
+		Token string `json:"token" binding:"required"`
+	}
+
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	token, ok := h.auth.redeemAccountToken(models.TokenPurposeSSOLogin, input.Token)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid or expired token"})
+		return
+	}
+	user, err := h.auth.userRepo.FindByID(token.UserID)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid or expired token"})
+		return
+	}
+	if accountDisabled(c, user) {
+		return
+	}
+
+	if user.TOTPEnabledAt != nil {
+		h.auth.startTwoFactorChallenge(c, user)
+		return
+	}
+
+	// Start a session for this device
+	response, err := h.auth.startSession(c, user)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate token"})
+		return
+	}
+
+	response["user"] = userPayload(user)
+	c.JSON(http.StatusOK, response)
+}
+
+// findOrCreateUser returns the user linked to a provider account. On first
+// login the account is linked to the user with the same email address, or
+// a new user is created.
+func (h *OIDCHandler) findOrCreateUser(provider string, identity *sso.Identity) (*models.User, error) {
+	link, err := h.identityRepo.FindByProviderSubject(provider, identity.Subject)
+	if err == nil {
+		return h.auth.userRepo.FindByID(link.UserID)
+	}
+	if err != gorm.ErrRecordNotFound {
+		return nil, err
+	}
+
+	user, err := h.auth.userRepo.FindByEmail(identity.Email)
+	switch {
+	case err == nil:
+		if err := h.claimAccount(user); err != nil {
+			return nil, err
+		}
+	case err == gorm.ErrRecordNotFound:
+		if user, err = h.createUser(identity); err != nil {
+			return nil, err
+		}
+	default:
+		return nil, err
+	}
+
+	err = h.identityRepo.Create(&models.UserIdentity{
+		UserID:   user.ID,
+		Provider: provider,
+		Subject:  identity.Subject,
+		Email:    identity.Email,
+	})
+	return user, err
+}
+
+// claimAccount prepares an existing account to be linked by its email
+// address. If the address was never verified, whoever registered it may
+// not own it, so their password, two-factor secret and sessions are
+// cleared before the provider's user takes over.
+func (h *OIDCHandler) claimAccount(user *models.User) error {
+	if user.EmailVerifiedAt != nil {
+		return nil
+	}
+
+	if err := h.auth.userRepo.UpdatePassword(user.ID, ""); err != nil {
+		return err
+	}
+	if err := h.auth.userRepo.DisableTOTP(user.ID); err != nil {
+		return err
+	}
+	if err := h.auth.codeRepo.DeleteForUser(user.ID); err != nil {
+		return err
+	}
+	if err := h.auth.sessionRepo.RevokeAllForUser(user.ID); err != nil {
+		return err
+	}
+	h.auth.bus.Publish(events.SessionRevoked{UserID: user.ID})
+
+	now := time.Now()
+	user.PasswordHash = ""
+	user.TOTPEnabledAt = nil
+	user.EmailVerifiedAt = &now
+	return h.auth.userRepo.MarkEmailVerified(user.ID, now)
+}
+
+// createUser creates a user for a provider account. They have no password
+// until they set one with a password reset.
+func (h *OIDCHandler) createUser(identity *sso.Identity) (*models.User, error) {
+	username, err := h.freeUsername(identity)
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	user := &models.User{
+		Username:        username,
+		Email:           identity.Email,
+		EmailVerifiedAt: &now,
+	}
+	return user, h.auth.userRepo.Create(user)
+}
+
+// freeUsername picks an unused username from the provider's preferred
+// username or the email address, adding a number if it is taken
+func (h *OIDCHandler) freeUsername(identity *sso.Identity) (string, error) {
+	base := identity.PreferredUsername
+	if base == "" {
+		base, _, _ = strings.Cut(identity.Email, "@")
+	}
+
+	for i := 1; i <= 100; i++ {
+		candidate := base
+		if i > 1 {
+			candidate = fmt.Sprintf("%s%d", base, i)
+		}
+		_, err := h.auth.userRepo.FindByUsername(candidate)
+		if err == gorm.ErrRecordNotFound {
+			return candidate, nil
+		}
+		if err != nil {
+			return "", err
+		}
+	}
+	return "", fmt.Errorf("no free username for %q", base)
+}
+
+// setCookie sets or, with a negative maxAge, clears the login state cookie.
+// It is scoped to the provider's routes and sent on the provider's
+// top-level redirect back.
+func (h *OIDCHandler) setCookie(c *gin.Context, provider *sso.Provider, value string, maxAge int) {
+	c.SetSameSite(http.SameSiteLaxMode)
+	secure := strings.HasPrefix(h.auth.AppURL, "https://")
+	c.SetCookie(oidcCookie, value, maxAge, "/api/auth/oidc/"+provider.Name, "", secure, true)
+}
+
+// fail sends the browser back to the web app with an error to show
+func (h *OIDCHandler) fail(c *gin.Context, message string) {
+	c.Redirect(http.StatusFound, h.auth.AppURL+"/sso/callback?error="+url.QueryEscape(message))
+}
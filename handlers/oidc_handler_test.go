@@ -0,0 +1,330 @@
+package handlers
+
+import (
+	"GoChatApp/repositories"
+	"GoChatApp/sso"
+	"GoChatApp/utils"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/golang-jwt/jwt/v5"
+	"gorm.io/gorm"
+)
+
+// mockIdP is a minimal OpenID Connect provider that approves every
+// authorization request for its current user and enforces PKCE
+type mockIdP struct {
+	*httptest.Server
+	t       *testing.T
+	key     *rsa.PrivateKey
+	keyring *utils.Keyring
+
+	mu       sync.Mutex
+	requests map[string]url.Values // Authorization requests by code
+	claims   jwt.MapClaims         // Claims of the signed-in user
+}
+
+func newMockIdP(t *testing.T) *mockIdP {
+	t.Helper()
+	private, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("Failed to generate key: %v", err)
+	}
+	key, err := utils.ParsePrivateKeyPEM(pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(private)}))
+	if err != nil {
+		t.Fatalf("Failed to parse key: %v", err)
+	}
+
+	idp := &mockIdP{t: t, key: private, keyring: utils.NewKeyring(key), requests: map[string]url.Values{}}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/openid-configuration", idp.discovery)
+	mux.HandleFunc("/authorize", idp.authorize)
+	mux.HandleFunc("/token", idp.token)
+	mux.HandleFunc("/jwks", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(idp.keyring.JWKS())
+	})
+	idp.Server = httptest.NewServer(mux)
+	t.Cleanup(idp.Close)
+	return idp
+}
+
+// signIn sets who the provider vouches for
+func (idp *mockIdP) signIn(subject, email string, verified bool) {
+	idp.mu.Lock()
+	defer idp.mu.Unlock()
+	idp.claims = jwt.MapClaims{
+		"sub":                subject,
+		"email":              email,
+		"email_verified":     verified,
+		"preferred_username": strings.Split(email, "@")[0],
+	}
+}
+
+func (idp *mockIdP) discovery(w http.ResponseWriter, r *http.Request) {
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"issuer":                                idp.URL,
+		"authorization_endpoint":                idp.URL + "/authorize",
+		"token_endpoint":                        idp.URL + "/token",
+		"jwks_uri":                              idp.URL + "/jwks",
+		"response_types_supported":              []string{"code"},
+		"subject_types_supported":               []string{"public"},
+		"id_token_signing_alg_values_supported": []string{"RS256"},
+		"code_challenge_methods_supported":      []string{"S256"},
+	})
+}
+
+func (idp *mockIdP) authorize(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	if query.Get("response_type") != "code" || query.Get("code_challenge_method") != "S256" || query.Get("code_challenge") == "" {
+		http.Error(w, "authorization code flow with PKCE required", http.StatusBadRequest)
+		return
+	}
+
+	code, _, _ := utils.GenerateOpaqueToken()
+	idp.mu.Lock()
+	idp.requests[code] = query
+	idp.mu.Unlock()
+
+	redirect, _ := url.Parse(query.Get("redirect_uri"))
+	redirect.RawQuery = url.Values{"code": {code}, "state": {query.Get("state")}}.Encode()
+	http.Redirect(w, r, redirect.String(), http.StatusFound)
+}
+
+func (idp *mockIdP) token(w http.ResponseWriter, r *http.Request) {
+	r.ParseForm()
+	idp.mu.Lock()
+	request, ok := idp.requests[r.PostForm.Get("code")]
+	delete(idp.requests, r.PostForm.Get("code"))
+	claims := jwt.MapClaims{}
+	for k, v := range idp.claims {
+		claims[k] = v
+	}
+	idp.mu.Unlock()
+
+	sum := sha256.Sum256([]byte(r.PostForm.Get("code_verifier")))
+	if !ok || base64.RawURLEncoding.EncodeToString(sum[:]) != request.Get("code_challenge") {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write([]byte(`{"error":"invalid_grant"}`))
+		return
+	}
+	if clientID, _, _ := r.BasicAuth(); clientID != request.Get("client_id") {
+		http.Error(w, `{"error":"invalid_client"}`, http.StatusUnauthorized)
+		return
+	}
+
+	claims["iss"] = idp.URL
+	claims["aud"] = request.Get("client_id")
+	claims["nonce"] = request.Get("nonce")
+	claims["iat"] = time.Now().Unix()
+	claims["exp"] = time.Now().Add(time.Minute).Unix()
+	idToken := jwt.NewWithClaims(jwt.SigningMethodRS256, claims)
+	idToken.Header["kid"] = idp.keyring.SigningKey().ID
+	signed, err := idToken.SignedString(idp.key)
+	if err != nil {
+		idp.t.Errorf("Failed to sign id_token: %v", err)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"access_token": "access",
+		"token_type":   "Bearer",
+		"expires_in":   60,
+		"id_token":     signed,
+	})
+}
+
+// setupOIDCRouter serves the SSO routes for a provider named corp
+func setupOIDCRouter(db *gorm.DB, idp *mockIdP) *gin.Engine {
+	sessionRepo := repositories.NewSessionRepository(db)
+	auth := NewAuthHandler(repositories.NewUserRepository(db), sessionRepo, repositories.NewAccountTokenRepository(db), repositories.NewRecoveryCodeRepository(db), repositories.NewPersonalAccessTokenRepository(db), &recordingMailer{}, nil)
+	auth.AppURL = "http://chat.test"
+	provider := sso.NewProvider("corp", idp.URL, "chat-app", "client-secret", "http://chat.test/api/auth/oidc/corp/callback")
+	handler := NewOIDCHandler(auth, repositories.NewUserIdentityRepository(db), map[string]*sso.Provider{"corp": provider})
+
+	router := gin.New()
+	router.POST("/register", auth.Register)
+	router.POST("/login", auth.Login)
+	router.GET("/api/auth/oidc/providers", handler.GetProviders)
+	router.GET("/api/auth/oidc/:provider/login", handler.Login)
+	router.GET("/api/auth/oidc/:provider/callback", handler.Callback)
+	router.POST("/api/auth/oidc/exchange", handler.Exchange)
+	return router
+}
+
+// ssoRedirect signs in at the provider the way a browser would and returns
+// where the callback sends the browser back to in the web app. tamper may
+// alter the login state cookie before the callback.
+func ssoRedirect(t *testing.T, router *gin.Engine, tamper func(*http.Cookie)) *url.URL {
+	t.Helper()
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest("GET", "/api/auth/oidc/corp/login", nil))
+	if w.Code != http.StatusFound {
+		t.Fatalf("Expected a redirect to the provider, got %d %s", w.Code, w.Body.String())
+	}
+	cookies := w.Result().Cookies()
+	if len(cookies) != 1 || !cookies[0].HttpOnly {
+		t.Fatalf("Expected an HttpOnly login state cookie, got %v", cookies)
+	}
+	if tamper != nil {
+		tamper(cookies[0])
+	}
+
+	noRedirect := &http.Client{CheckRedirect: func(*http.Request, []*http.Request) error { return http.ErrUseLastResponse }}
+	resp, err := noRedirect.Get(w.Header().Get("Location"))
+	if err != nil {
+		t.Fatalf("Failed to reach the provider: %v", err)
+	}
+	resp.Body.Close()
+	callback, _ := url.Parse(resp.Header.Get("Location"))
+
+	req := httptest.NewRequest("GET", callback.RequestURI(), nil)
+	req.AddCookie(cookies[0])
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	if w.Code != http.StatusFound {
+		t.Fatalf("Expected a redirect to the web app, got %d %s", w.Code, w.Body.String())
+	}
+	back, _ := url.Parse(w.Header().Get("Location"))
+	if back.Host != "chat.test" || back.Path != "/sso/callback" {
+		t.Fatalf("Unexpected redirect %s", back)
+	}
+	return back
+}
+
+// ssoLogin signs in through the provider and returns the session response
+func ssoLogin(t *testing.T, router *gin.Engine) map[string]interface{} {
+	t.Helper()
+	back := ssoRedirect(t, router, nil)
+	if back.Query().Get("error") != "" {
+		t.Fatalf("Sign-in failed: %s", back.Query().Get("error"))
+	}
+
+	w, response := doJSON(router, "POST", "/api/auth/oidc/exchange", "", map[string]string{"token": back.Query().Get("token")})
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d. Body: %s", w.Code, w.Body.String())
+	}
+	return response
+}
+
+func TestOIDC_FirstLoginCreatesUser(t *testing.T) {
+	db := setupTestDB(t)
+	idp := newMockIdP(t)
+	router := setupOIDCRouter(db, idp)
+	idp.signIn("subject-1", "grace@corp.example", true)
+
+	response := ssoLogin(t, router)
+	user := response["user"].(map[string]interface{})
+	if user["username"] != "grace" || user["email"] != "grace@corp.example" || user["email_verified"] != true {
+		t.Errorf("Unexpected user %v", user)
+	}
+
+	// The access token is an ordinary one
+	claims, err := utils.ValidateToken(response["token"].(string))
+	if err != nil || claims.SessionID == 0 {
+		t.Errorf("Expected a session access token, got %v %v", claims, err)
+	}
+
+	// The next login finds the same user, even after the address changes
+	idp.signIn("subject-1", "grace.hopper@corp.example", true)
+	again := ssoLogin(t, router)
+	if again["user"].(map[string]interface{})["id"] != user["id"] {
+		t.Errorf("Expected the linked user, got %v", again["user"])
+	}
+
+	// Tokens handed to the web app work once
+	if w, _ := doJSON(router, "POST", "/api/auth/oidc/exchange", "", map[string]string{"token": "unknown"}); w.Code != http.StatusUnauthorized {
+		t.Errorf("Expected status 401 for an unknown token, got %d", w.Code)
+	}
+}
+
+func TestOIDC_LinksUserByVerifiedEmail(t *testing.T) {
+	db := setupTestDB(t)
+	idp := newMockIdP(t)
+	router := setupOIDCRouter(db, idp)
+
+	// Someone registered the address first but never confirmed it
+	registerSession(t, router, "squatter")
+	idp.signIn("subject-2", "squatter@example.com", true)
+
+	response := ssoLogin(t, router)
+	if response["user"].(map[string]interface{})["username"] != "squatter" {
+		t.Errorf("Expected the existing account to be linked, got %v", response["user"])
+	}
+
+	// Their password no longer opens it
+	if w, _ := doJSON(router, "POST", "/login", "", map[string]string{"username": "squatter", "password": "password123"}); w.Code != http.StatusUnauthorized {
+		t.Errorf("Expected the unverified password to be cleared, got %d", w.Code)
+	}
+}
+
+func TestOIDC_RejectsUnverifiedEmail(t *testing.T) {
+	db := setupTestDB(t)
+	idp := newMockIdP(t)
+	router := setupOIDCRouter(db, idp)
+	idp.signIn("subject-3", "unverified@corp.example", false)
+
+	back := ssoRedirect(t, router, nil)
+	if back.Query().Get("error") == "" || back.Query().Get("token") != "" {
+		t.Errorf("Expected an error, got %s", back)
+	}
+	if _, err := repositories.NewUserRepository(db).FindByEmail("unverified@corp.example"); err == nil {
+		t.Error("Expected no user to be created")
+	}
+}
+
+func TestOIDC_RejectsForgedState(t *testing.T) {
+	db := setupTestDB(t)
+	idp := newMockIdP(t)
+	router := setupOIDCRouter(db, idp)
+	idp.signIn("subject-4", "target@corp.example", true)
+
+	tests := []struct {
+		name   string
+		tamper func(*http.Cookie)
+	}{
+		{"state", func(c *http.Cookie) { c.Value = "forged" + c.Value }},
+		{"verifier", func(c *http.Cookie) { c.Value += "x" }},
+		{"nonce", func(c *http.Cookie) {
+			parts := strings.Split(c.Value, ".")
+			parts[1] = "forged"
+			c.Value = strings.Join(parts, ".")
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			back := ssoRedirect(t, router, tt.tamper)
+			if back.Query().Get("error") == "" || back.Query().Get("token") != "" {
+				t.Errorf("Expected an error, got %s", back)
+			}
+		})
+	}
+}
+
+func TestOIDC_GetProviders(t *testing.T) {
+	db := setupTestDB(t)
+	router := setupOIDCRouter(db, newMockIdP(t))
+
+	w, response := doJSON(router, "GET", "/api/auth/oidc/providers", "", nil)
+	providers := response["providers"].([]interface{})
+	if w.Code != http.StatusOK || len(providers) != 1 || providers[0].(map[string]interface{})["login_url"] != "/api/auth/oidc/corp/login" {
+		t.Errorf("Unexpected providers %d %v", w.Code, response)
+	}
+
+	if w, _ := doJSON(router, "GET", "/api/auth/oidc/unknown/login", "", nil); w.Code != http.StatusNotFound {
+		t.Errorf("Expected status 404 for an unknown provider, got %d", w.Code)
+	}
+}
@@ -0,0 +1,115 @@
+package handlers
+
+import (
+	"GoChatApp/repositories"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+type PresenceHandler struct {
+	hub      *Hub
+	userRepo *repositories.UserRepository
+	roomRepo *repositories.RoomRepository
+}
+
+func NewPresenceHandler(hub *Hub, userRepo *repositories.UserRepository, roomRepo *repositories.RoomRepository) *PresenceHandler {
+	return &PresenceHandler{hub: hub, userRepo: userRepo, roomRepo: roomRepo}
+}
+
+// UserPresence is a user's current status as returned by the API
+type UserPresence struct {
+	UserID     uint       `json:"user_id"`
+	Username   string     `json:"username"`
+	Status     string     `json:"status"`
+	LastSeenAt *time.Time `json:"last_seen_at"`
+}
+
+// GetPresence returns the status of the requested users, or of everyone
+// currently online or away when no user_ids are given. Only the caller and
+// users sharing a room with them are included; the rest are left out.
+func (h *PresenceHandler) GetPresence(c *gin.Context) {
+	var userIDs []uint
+	if idsStr := c.Query("user_ids"); idsStr != "" {
+		for _, idStr := range strings.Split(idsStr, ",") {
+			id, err := strconv.ParseUint(strings.TrimSpace(idStr), 10, 32)
+			if err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid user ID: " + idStr})
+				return
+			}
+			userIDs = append(userIDs, uint(id))
+		}
+	} else {
+		userIDs = h.hub.OnlineUserIDs()
+	}
+
+	userID, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return
+	}
+
+	// Presence is only shared between users who share a room
+	roommates, err := h.roomRepo.FindRoommateIDs(userID.(uint))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch users"})
+		return
+	}
+	visible := map[uint]bool{userID.(uint): true}
+	for _, id := range roommates {
+		visible[id] = true
+	}
+	shared := make([]uint, 0, len(userIDs))
+	for _, id := range userIDs {
+		if visible[id] {
+			shared = append(shared, id)
+		}
+	}
+
+	users, err := h.userRepo.FindByIDs(shared)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch users"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"presence": h.hub.PresenceOfUsers(users, false)})
+}
+
+// GetRoomOnline returns the members of a room who are online or away
+func (h *PresenceHandler) GetRoomOnline(c *gin.Context) {
+	roomID, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid room ID"})
+		return
+	}
+
+	userID, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return
+	}
+
+	room, err := h.roomRepo.FindByID(uint(roomID))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Room not found"})
+		return
+	}
+
+	if room.Type != "public" {
+		isMember, err := h.roomRepo.IsMember(room.ID, userID.(uint))
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to check membership"})
+			return
+		}
+		if !isMember {
+			c.JSON(http.StatusForbidden, gin.H{"error": "Not a member of this room"})
+			return
+		}
+	}
+
+	online := h.hub.PresenceOfUsers(room.Members, true)
+	c.JSON(http.StatusOK, gin.H{"room_id": room.ID, "online": online, "count": len(online)})
+}
@@ -0,0 +1,140 @@
+package handlers
+
+import (
+	"GoChatApp/models"
+	"GoChatApp/repositories"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestPresenceHandler_GetRoomOnline(t *testing.T) {
+	db := setupTestDB(t)
+	userRepo := repositories.NewUserRepository(db)
+	roomRepo := repositories.NewRoomRepository(db)
+	messageRepo := repositories.NewMessageRepository(db)
+
+	alice := &models.User{Username: "alice", Email: "alice@example.com", PasswordHash: "hash"}
+	bob := &models.User{Username: "bob", Email: "bob@example.com", PasswordHash: "hash"}
+	userRepo.Create(alice)
+	userRepo.Create(bob)
+	room := &models.Room{Name: "Online Room", Type: "private", CreatedBy: alice.ID}
+	roomRepo.Create(room)
+	roomRepo.AddMember(room.ID, alice.ID)
+	roomRepo.AddMember(room.ID, bob.ID)
+
+	wsHandler := NewWebSocketHandler(messageRepo, roomRepo, userRepo, nil, NewMemoryBroker())
+	server := setupWebSocketServer(t, wsHandler)
+	dialWebSocket(t, server, alice)
+	waitFor(t, func() bool { return wsHandler.Hub.PresenceOf(alice.ID) == PresenceOnline })
+
+	handler := NewPresenceHandler(wsHandler.Hub, userRepo, roomRepo)
+	router := gin.New()
+	router.GET("/rooms/:id/online", func(c *gin.Context) {
+		c.Set("user_id", bob.ID)
+		handler.GetRoomOnline(c)
+	})
+
+	req := httptest.NewRequest("GET", "/rooms/1/online", nil)
+	w := httptest.NewRecorder()
+
+	router.ServeHTTP(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d. Body: %s", w.Code, w.Body.String())
+	}
+
+	var response struct {
+		Online []UserPresence `json:"online"`
+	}
+	json.Unmarshal(w.Body.Bytes(), &response)
+	if len(response.Online) != 1 || response.Online[0].UserID != alice.ID {
+		t.Errorf("Expected only alice online, got %+v", response.Online)
+	}
+}
+
+func TestPresenceHandler_GetRoomOnline_NotMember(t *testing.T) {
+	db := setupTestDB(t)
+	userRepo := repositories.NewUserRepository(db)
+	roomRepo := repositories.NewRoomRepository(db)
+
+	outsider := &models.User{Username: "outsider", Email: "outsider@example.com", PasswordHash: "hash"}
+	userRepo.Create(outsider)
+	room := &models.Room{Name: "Private Room", Type: "private"}
+	roomRepo.Create(room)
+
+	handler := NewPresenceHandler(NewHub(nil, nil, nil, nil, NewMemoryBroker()), userRepo, roomRepo)
+	router := gin.New()
+	router.GET("/rooms/:id/online", func(c *gin.Context) {
+		c.Set("user_id", outsider.ID)
+		handler.GetRoomOnline(c)
+	})
+
+	req := httptest.NewRequest("GET", "/rooms/1/online", nil)
+	w := httptest.NewRecorder()
+
+	router.ServeHTTP(w, req)
+
+	if w.Code != http.StatusForbidden {
+		t.Errorf("Expected status 403, got %d", w.Code)
+	}
+}
+
+func TestPresenceHandler_GetPresence_OnlyRoommates(t *testing.T) {
+	db := setupTestDB(t)
+	userRepo := repositories.NewUserRepository(db)
+	roomRepo := repositories.NewRoomRepository(db)
+
+	alice := &models.User{Username: "alice", Email: "alice@example.com", PasswordHash: "hash"}
+	bob := &models.User{Username: "bob", Email: "bob@example.com", PasswordHash: "hash"}
+	carol := &models.User{Username: "carol", Email: "carol@example.com", PasswordHash: "hash"}
+	userRepo.Create(alice)
+	userRepo.Create(bob)
+	userRepo.Create(carol)
+	room := &models.Room{Name: "Shared Room", Type: "private", CreatedBy: alice.ID}
+	roomRepo.Create(room)
+	roomRepo.AddMember(room.ID, alice.ID)
+	roomRepo.AddMember(room.ID, bob.ID)
+
+	wsHandler := NewWebSocketHandler(nil, roomRepo, userRepo, nil, NewMemoryBroker())
+	server := setupWebSocketServer(t, wsHandler)
+	for _, user := range []*models.User{alice, bob, carol} {
+		dialWebSocket(t, server, user)
+	}
+	waitFor(t, func() bool { return len(wsHandler.Hub.OnlineUserIDs()) == 3 })
+
+	handler := NewPresenceHandler(wsHandler.Hub, userRepo, roomRepo)
+	router := gin.New()
+	router.GET("/presence", func(c *gin.Context) {
+		c.Set("user_id", bob.ID)
+		handler.GetPresence(c)
+	})
+
+	presenceOf := func(url string) map[uint]string {
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest("GET", url, nil))
+		if w.Code != http.StatusOK {
+			t.Fatalf("Expected status 200, got %d. Body: %s", w.Code, w.Body.String())
+		}
+		var response struct {
+			Presence []UserPresence `json:"presence"`
+		}
+		json.Unmarshal(w.Body.Bytes(), &response)
+		statuses := make(map[uint]string)
+		for _, p := range response.Presence {
+			statuses[p.UserID] = p.Status
+		}
+		return statuses
+	}
+
+	if statuses := presenceOf("/presence"); len(statuses) != 2 || statuses[alice.ID] != PresenceOnline || statuses[bob.ID] != PresenceOnline {
+		t.Errorf("Expected only bob and his roommate alice, got %v", statuses)
+	}
+	if statuses := presenceOf("/presence?user_ids=" + strconv.Itoa(int(carol.ID))); len(statuses) != 0 {
+		t.Errorf("Expected carol to be hidden from bob, got %v", statuses)
+	}
+}
@@ -0,0 +1,250 @@
+package handlers
+
+import (
+	"GoChatApp/events"
+	"GoChatApp/models"
+	"GoChatApp/utils"
+	"log"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/gin-gonic/gin"
+)
+
+// GetMe returns the signed-in user's own account and profile
+func (h *AuthHandler) GetMe(c *gin.Context) {
+	user, ok := h.currentUser(c)
+	if !ok {
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"user": userPayload(user)})
+}
+
+// UpdateMe changes the signed-in user's profile. Only the fields given are
+// changed; an empty string clears one. Users sharing a room with them are
+// told, so their cached names and avatars refresh.
+func (h *AuthHandler) UpdateMe(c *gin.Context) {
+	var input struct {
+		DisplayName *string `json:"display_name" binding:"omitempty,max=50"`
+		Bio         *string `json:"bio" binding:"omitempty,max=500"`
+		Avatar      *string `json:"avatar" binding:"omitempty,max=500"`
+		Timezone    *string `json:"timezone" binding:"omitempty,max=64"`
+		Pronouns    *string `json:"pronouns" binding:"omitempty,max=40"`
+	}
+
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	user, ok := h.currentUser(c)
+	if !ok {
+		return
+	}
+
+	if input.DisplayName != nil {
+		name := strings.TrimSpace(*input.DisplayName)
+		if strings.IndexFunc(name, unicode.IsControl) >= 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Display name must not contain control characters"})
+			return
+		}
+		user.DisplayName = name
+	}
+	if input.Bio != nil {
+		user.Bio = strings.TrimSpace(*input.Bio)
+	}
+	if input.Avatar != nil {
+		avatar := strings.TrimSpace(*input.Avatar)
+		if avatar != "" && !validAvatarURL(avatar) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Avatar must be an http(s) URL or an uploaded file"})
+			return
+		}
+		user.Avatar = avatar
+	}
+	if input.Timezone != nil {
+		timezone := strings.TrimSpace(*input.Timezone)
+		if timezone != "" && !validTimezone(timezone) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Unknown timezone: " + timezone})
+			return
+		}
+		user.Timezone = timezone
+	}
+	if input.Pronouns != nil {
+		user.Pronouns = strings.TrimSpace(*input.Pronouns)
+	}
+
+	if err := h.userRepo.UpdateProfile(user); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update profile"})
+		return
+	}
+	h.bus.Publish(events.UserUpdated{User: user})
+
+	c.JSON(http.StatusOK, gin.H{"user": userPayload(user)})
+}
+
+// ChangePassword sets a new password after checking the current one. The
+// user's other sessions are signed out and their personal access tokens
+// revoked; the session making the change stays.
+func (h *AuthHandler) ChangePassword(c *gin.Context) {
+	var input struct {
+		CurrentPassword string `json:"current_password" binding:"required"`
+		NewPassword     string `json:"new_password" binding:"required"`
+	}
+
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	user, ok := h.currentUser(c)
+	if !ok || !h.checkCurrentPassword(c, user, input.CurrentPassword) {
+		return
+	}
+
+	if err := h.PasswordPolicy.Check(input.NewPassword, user.Username); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	hashedPassword, err := utils.HashPassword(input.NewPassword)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to change password"})
+		return
+	}
+	if err := h.userRepo.UpdatePassword(user.ID, hashedPassword); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to change password"})
+		return
+	}
+
+	// Reset links mailed before the change should not undo it
+	if err := h.tokenRepo.InvalidateForUser(user.ID, models.TokenPurposePasswordReset); err != nil {
+		log.Printf("Error invalidating password resets of user %d: %v", user.ID, err)
+	}
+
+	sessionID, _ := c.Get("session_id")
+	currentID, _ := sessionID.(uint)
+	sessions, err := h.sessionRepo.FindActiveByUser(user.ID)
+	if err != nil {
+		log.Printf("Error fetching sessions of user %d: %v", user.ID, err)
+	}
+	for i := range sessions {
+		if sessions[i].ID == currentID {
+			continue
+		}
+		if err := h.revokeSession(&sessions[i]); err != nil {
+			log.Printf("Error revoking session %d: %v", sessions[i].ID, err)
+		}
+	}
+	if err := h.accessTokenRepo.RevokeAllForUser(user.ID); err != nil {
+		log.Printf("Error revoking access tokens of user %d: %v", user.ID, err)
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Password changed"})
+}
+
+// ChangeEmail starts moving the account to a new address after checking
+// the password. The account keeps its current address until the user opens
+// the link mailed to the new one, and the current address is told about
+// the request.
+func (h *AuthHandler) ChangeEmail(c *gin.Context) {
+	var input struct {
+		Email           string `json:"email" binding:"required,email"`
+		CurrentPassword string `json:"current_password" binding:"required"`
+	}
+
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	user, ok := h.currentUser(c)
+	if !ok || !h.checkCurrentPassword(c, user, input.CurrentPassword) {
+		return
+	}
+
+	if strings.EqualFold(input.Email, user.Email) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "That is already your email address"})
+		return
+	}
+	if _, err := h.userRepo.FindByEmail(input.Email); err == nil {
+		c.JSON(http.StatusConflict, gin.H{"error": "Email already exists"})
+		return
+	}
+	if !h.Throttle.AllowAccountMail(user.ID, input.Email) {
+		tooManyMails(c)
+		return
+	}
+
+	if err := h.userRepo.SetPendingEmail(user.ID, input.Email); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to change email"})
+		return
+	}
+	user.PendingEmail = input.Email
+
+	if err := h.sendEmailChange(user, input.Email); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to send confirmation email"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "Check your new address for a link to confirm the change",
+		"user":    userPayload(user),
+	})
+}
+
+// checkCurrentPassword confirms the user knows their password before a
+// sensitive change, answering the request itself if not. Wrong guesses
+// count against the account and IP just as failed logins do, so a stolen
+// access token cannot be used to guess the password.
+func (h *AuthHandler) checkCurrentPassword(c *gin.Context, user *models.User, password string) bool {
+	if !h.checkCurrentPasswordStep(c, user, password) {
+		return false
+	}
+	h.Throttle.RecordSuccess(user.Username, c.ClientIP())
+	return true
+}
+
+// checkCurrentPasswordStep is checkCurrentPassword for a change that also
+// needs a second factor. A correct password only hands back the IP's
+// attempt; the account's stays counted until the whole check succeeds, so
+// the password cannot be used to reset the count between code guesses.
+func (h *AuthHandler) checkCurrentPasswordStep(c *gin.Context, user *models.User, password string) bool {
+	if user.PasswordHash == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Your account has no password; set one with a password reset first"})
+		return false
+	}
+	if wait := h.Throttle.Attempt(user.Username, c.ClientIP()); wait > 0 {
+		tooManyAttempts(c, wait)
+		return false
+	}
+	if !utils.CheckPassword(user.PasswordHash, password) {
+		h.Throttle.RecordFailure(user.Username, c.ClientIP())
+		c.JSON(http.StatusForbidden, gin.H{"error": "Current password is incorrect"})
+		return false
+	}
+	h.Throttle.RecordPartialSuccess(c.ClientIP())
+	return true
+}
+
+// validAvatarURL reports whether an avatar is an absolute http(s) URL or a
+// file served from our uploads
+func validAvatarURL(avatar string) bool {
+	if strings.HasPrefix(avatar, "/uploads/") {
+		return !strings.Contains(avatar, "..")
+	}
+	u, err := url.Parse(avatar)
+	return err == nil && (u.Scheme == "http" || u.Scheme == "https") && u.Host != ""
+}
+
+// validTimezone reports whether a name is an IANA timezone
+func validTimezone(name string) bool {
+	if name == "Local" {
+		return false
+	}
+	_, err := time.LoadLocation(name)
+	return err == nil
+}
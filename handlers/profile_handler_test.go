@@ -0,0 +1,225 @@
+package handlers
+
+import (
+	"GoChatApp/events"
+	"GoChatApp/middleware"
+	"GoChatApp/repositories"
+	"net/http"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// setupProfileRouter serves the /users/me routes along with sign-in
+func setupProfileRouter(db *gorm.DB, bus *events.Bus) (*gin.Engine, *recordingMailer) {
+	mail := &recordingMailer{}
+	sessionRepo := repositories.NewSessionRepository(db)
+	handler := NewAuthHandler(repositories.NewUserRepository(db), sessionRepo, repositories.NewAccountTokenRepository(db), repositories.NewRecoveryCodeRepository(db), repositories.NewPersonalAccessTokenRepository(db), mail, bus)
+	handler.Throttle = NewLoginThrottle(repositories.NewLoginThrottleRepository(db))
+
+	router := gin.New()
+	router.POST("/register", handler.Register)
+	router.POST("/login", handler.Login)
+	router.POST("/email/verify", handler.VerifyEmail)
+
+	protected := router.Group("/")
+	protected.Use(middleware.AuthMiddleware(sessionRepo, nil))
+	protected.GET("/sessions", handler.GetSessions)
+	protected.GET("/users/me", handler.GetMe)
+	protected.PATCH("/users/me", handler.UpdateMe)
+	protected.PUT("/users/me/password", handler.ChangePassword)
+	protected.PUT("/users/me/email", handler.ChangeEmail)
+	return router, mail
+}
+
+func TestProfile_UpdateMe(t *testing.T) {
+	db := setupTestDB(t)
+	bus := events.NewBus()
+	var mu sync.Mutex
+	var published []events.UserUpdated
+	bus.Subscribe(func(event events.Event) {
+		if e, ok := event.(events.UserUpdated); ok {
+			mu.Lock()
+			published = append(published, e)
+			mu.Unlock()
+		}
+	})
+	router, _ := setupProfileRouter(db, bus)
+	token, _ := registerSession(t, router, "profiled")
+
+	w, response := doJSON(router, "PATCH", "/users/me", token, map[string]string{
+		"display_name": "  Pro Filed ",
+		"bio":          "Likes Go",
+		"avatar":       "/uploads/me.png",
+		"timezone":     "Europe/Paris",
+		"pronouns":     "they/them",
+	})
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d. Body: %s", w.Code, w.Body.String())
+	}
+	user := response["user"].(map[string]interface{})
+	if user["display_name"] != "Pro Filed" || user["timezone"] != "Europe/Paris" || user["pronouns"] != "they/them" {
+		t.Errorf("Unexpected profile: %v", user)
+	}
+
+	// Fields left out are kept; an empty string clears one
+	w, response = doJSON(router, "PATCH", "/users/me", token, map[string]string{"bio": ""})
+	user = response["user"].(map[string]interface{})
+	if w.Code != http.StatusOK || user["bio"] != "" || user["display_name"] != "Pro Filed" {
+		t.Errorf("Expected only the bio to be cleared, got %d %v", w.Code, user)
+	}
+
+	_, response = doJSON(router, "GET", "/users/me", token, nil)
+	if user := response["user"].(map[string]interface{}); user["avatar"] != "/uploads/me.png" || user["email"] != "profiled@example.com" {
+		t.Errorf("Expected the saved profile, got %v", user)
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	if len(published) != 2 || published[0].User.DisplayName != "Pro Filed" {
+		t.Errorf("Expected a user_updated event per change, got %+v", published)
+	}
+}
+
+func TestProfile_UpdateMeValidation(t *testing.T) {
+	db := setupTestDB(t)
+	router, _ := setupProfileRouter(db, nil)
+	token, _ := registerSession(t, router, "picky")
+
+	tests := []struct {
+		name string
+		body map[string]string
+	}{
+		{"long display name", map[string]string{"display_name": strings.Repeat("a", 51)}},
+		{"control character", map[string]string{"display_name": "bad\x07name"}},
+		{"long bio", map[string]string{"bio": strings.Repeat("a", 501)}},
+		{"unknown timezone", map[string]string{"timezone": "Mars/Olympus"}},
+		{"javascript avatar", map[string]string{"avatar": "javascript:alert(1)"}},
+		{"relative avatar", map[string]string{"avatar": "../secret.png"}},
+		{"long pronouns", map[string]string{"pronouns": strings.Repeat("a", 41)}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if w, _ := doJSON(router, "PATCH", "/users/me", token, tt.body); w.Code != http.StatusBadRequest {
+				t.Errorf("Expected status 400, got %d", w.Code)
+			}
+		})
+	}
+}
+
+func TestProfile_ChangePassword(t *testing.T) {
+	db := setupTestDB(t)
+	router, _ := setupProfileRouter(db, nil)
+	token, _ := registerSession(t, router, "rotator")
+	otherDevice, _ := loginSession(t, router, "rotator")
+
+	if w, _ := doJSON(router, "PUT", "/users/me/password", token, map[string]string{"current_password": "wrong", "new_password": "brand new secret"}); w.Code != http.StatusForbidden {
+		t.Errorf("Expected status 403 for a wrong current password, got %d", w.Code)
+	}
+	if w, _ := doJSON(router, "PUT", "/users/me/password", token, map[string]string{"current_password": "password123", "new_password": "short"}); w.Code != http.StatusBadRequest {
+		t.Errorf("Expected the password policy to apply, got %d", w.Code)
+	}
+
+	w, _ := doJSON(router, "PUT", "/users/me/password", token, map[string]string{"current_password": "password123", "new_password": "brand new secret"})
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d. Body: %s", w.Code, w.Body.String())
+	}
+
+	if code := loginAs(router, "rotator", "password123"); code != http.StatusUnauthorized {
+		t.Errorf("Expected the old password to stop working, got %d", code)
+	}
+	if code := loginAs(router, "rotator", "brand new secret"); code != http.StatusOK {
+		t.Errorf("Expected the new password to work, got %d", code)
+	}
+	if w, _ := doJSON(router, "GET", "/sessions", otherDevice, nil); w.Code != http.StatusUnauthorized {
+		t.Errorf("Expected other sessions to be signed out, got %d", w.Code)
+	}
+	if w, _ := doJSON(router, "GET", "/sessions", token, nil); w.Code != http.StatusOK {
+		t.Errorf("Expected the current session to stay, got %d", w.Code)
+	}
+}
+
+func TestProfile_CurrentPasswordIsThrottled(t *testing.T) {
+	db := setupTestDB(t)
+	router, _ := setupProfileRouter(db, nil)
+	token, _ := registerSession(t, router, "stolen")
+
+	for i := 0; i < backoffAfter; i++ {
+		if w, _ := doJSON(router, "PUT", "/users/me/password", token, map[string]string{"current_password": "guess", "new_password": "brand new secret"}); w.Code != http.StatusForbidden {
+			t.Fatalf("Attempt %d: expected status 403, got %d", i+1, w.Code)
+		}
+	}
+
+	// Guessing through either endpoint slows down the next attempt
+	w, _ := doJSON(router, "PUT", "/users/me/email", token, map[string]string{"email": "thief@example.com", "current_password": "password123"})
+	if w.Code != http.StatusTooManyRequests || w.Header().Get("Retry-After") == "" {
+		t.Errorf("Expected status 429 with Retry-After, got %d", w.Code)
+	}
+}
+
+func TestProfile_ChangeEmail(t *testing.T) {
+	db := setupTestDB(t)
+	router, mail := setupProfileRouter(db, nil)
+	userRepo := repositories.NewUserRepository(db)
+	token, _ := registerSession(t, router, "mover")
+	registerSession(t, router, "neighbour")
+
+	first := mail.waitForToken(t, "mover@example.com", "Confirm")
+	if w, _ := doJSON(router, "POST", "/email/verify", "", map[string]string{"token": first}); w.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d", w.Code)
+	}
+
+	if w, _ := doJSON(router, "PUT", "/users/me/email", token, map[string]string{"email": "moved@example.com", "current_password": "wrong"}); w.Code != http.StatusForbidden {
+		t.Errorf("Expected status 403 for a wrong password, got %d", w.Code)
+	}
+	if w, _ := doJSON(router, "PUT", "/users/me/email", token, map[string]string{"email": "neighbour@example.com", "current_password": "password123"}); w.Code != http.StatusConflict {
+		t.Errorf("Expected status 409 for a taken address, got %d", w.Code)
+	}
+
+	w, response := doJSON(router, "PUT", "/users/me/email", token, map[string]string{"email": "moved@example.com", "current_password": "password123"})
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d. Body: %s", w.Code, w.Body.String())
+	}
+	if user := response["user"].(map[string]interface{}); user["email"] != "mover@example.com" || user["pending_email"] != "moved@example.com" || user["email_verified"] != true {
+		t.Errorf("Expected the old address to stay until confirmed, got %v", user)
+	}
+	mail.waitForMessage(t, "mover@example.com", "being changed")
+
+	// The pending address is not reserved; whoever confirms first gets it
+	second := mail.waitForToken(t, "moved@example.com", "Confirm")
+	if w, _ := doJSON(router, "POST", "/email/verify", "", map[string]string{"token": second}); w.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d", w.Code)
+	}
+	user, _ := userRepo.FindByUsername("mover")
+	if user.Email != "moved@example.com" || user.PendingEmail != "" || user.EmailVerifiedAt == nil {
+		t.Errorf("Expected the new address to be applied and verified, got %s %q %v", user.Email, user.PendingEmail, user.EmailVerifiedAt)
+	}
+}
+
+func TestProfile_ChangeEmailLosesToRegistration(t *testing.T) {
+	db := setupTestDB(t)
+	router, mail := setupProfileRouter(db, nil)
+	userRepo := repositories.NewUserRepository(db)
+	token, _ := registerSession(t, router, "slowpoke")
+
+	if w, _ := doJSON(router, "PUT", "/users/me/email", token, map[string]string{"email": "wanted@example.com", "current_password": "password123"}); w.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d", w.Code)
+	}
+	confirm := mail.waitForToken(t, "wanted@example.com", "Confirm your new")
+
+	// Someone registers the address before the link is opened
+	w, _ := doJSON(router, "POST", "/register", "", map[string]string{"username": "quick", "password": "password123", "email": "wanted@example.com"})
+	if w.Code != http.StatusCreated {
+		t.Fatalf("Expected the pending address to stay free to register, got %d", w.Code)
+	}
+
+	if w, _ := doJSON(router, "POST", "/email/verify", "", map[string]string{"token": confirm}); w.Code != http.StatusConflict {
+		t.Errorf("Expected status 409 for a taken address, got %d", w.Code)
+	}
+	if user, _ := userRepo.FindByUsername("slowpoke"); user.Email != "slowpoke@example.com" {
+		t.Errorf("Expected the address to be kept, got %s", user.Email)
+	}
+}
@@ -1,6 +1,7 @@
 package handlers
 
 import (
+	"GoChatApp/events"
 	"GoChatApp/repositories"
 	"net/http"
 	"strconv"
@@ -10,10 +11,13 @@ import (
 
 type ReactionHandler struct {
 	reactionRepo *repositories.ReactionRepository
+	messageRepo  *repositories.MessageRepository
+	roomRepo     *repositories.RoomRepository
+	bus          *events.Bus
 }
 
-func NewReactionHandler(reactionRepo *repositories.ReactionRepository) *ReactionHandler {
-	return &ReactionHandler{reactionRepo: reactionRepo}
+func NewReactionHandler(reactionRepo *repositories.ReactionRepository, messageRepo *repositories.MessageRepository, roomRepo *repositories.RoomRepository, bus *events.Bus) *ReactionHandler {
+	return &ReactionHandler{reactionRepo: reactionRepo, messageRepo: messageRepo, roomRepo: roomRepo, bus: bus}
 }
 
 // ToggleReaction adds or removes a reaction (toggle behavior)
@@ -40,12 +44,30 @@ func (h *ReactionHandler) ToggleReaction(c *gin.Context) {
 		return
 	}
 
+	// Reacting needs the same access to the room as posting in it
+	message, err := h.messageRepo.FindByID(uint(messageID))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Message not found"})
+		return
+	}
+	if !checkRoomAccess(c, h.roomRepo, message.RoomID, userID.(uint)) {
+		return
+	}
+
 	added, err := h.reactionRepo.Toggle(uint(messageID), userID.(uint), input.Emoji)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to toggle reaction"})
 		return
 	}
 
+	h.bus.Publish(events.ReactionToggled{
+		MessageID: uint(messageID),
+		UserID:    userID.(uint),
+		Username:  c.GetString("username"),
+		Emoji:     input.Emoji,
+		Added:     added,
+	})
+
 	action := "removed"
 	if added {
 		action = "added"
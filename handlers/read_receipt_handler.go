@@ -1,19 +1,24 @@
 package handlers
 
 import (
+	"GoChatApp/events"
 	"GoChatApp/repositories"
 	"net/http"
 	"strconv"
+	"time"
 
 	"github.com/gin-gonic/gin"
 )
 
 type ReadReceiptHandler struct {
 	receiptRepo *repositories.ReadReceiptRepository
+	messageRepo *repositories.MessageRepository
+	roomRepo    *repositories.RoomRepository
+	bus         *events.Bus
 }
 
-func NewReadReceiptHandler(receiptRepo *repositories.ReadReceiptRepository) *ReadReceiptHandler {
-	return &ReadReceiptHandler{receiptRepo: receiptRepo}
+func NewReadReceiptHandler(receiptRepo *repositories.ReadReceiptRepository, messageRepo *repositories.MessageRepository, roomRepo *repositories.RoomRepository, bus *events.Bus) *ReadReceiptHandler {
+	return &ReadReceiptHandler{receiptRepo: receiptRepo, messageRepo: messageRepo, roomRepo: roomRepo, bus: bus}
 }
 
 // MarkAsRead marks messages as read up to a specific message ID
@@ -34,11 +39,29 @@ func (h *ReadReceiptHandler) MarkAsRead(c *gin.Context) {
 		return
 	}
 
+	if !checkRoomAccess(c, h.roomRepo, input.RoomID, userID.(uint)) {
+		return
+	}
+
+	// The receipt is broadcast to the room, so the message has to be one of its own
+	message, err := h.messageRepo.FindByID(input.MessageID)
+	if err != nil || message.RoomID != input.RoomID {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Message not found"})
+		return
+	}
+
 	if err := h.receiptRepo.MarkAsRead(userID.(uint), input.RoomID, input.MessageID); err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to mark as read"})
 		return
 	}
 
+	h.bus.Publish(events.ReadReceiptUpdated{
+		RoomID:    input.RoomID,
+		UserID:    userID.(uint),
+		MessageID: input.MessageID,
+		ReadAt:    time.Now(),
+	})
+
 	c.JSON(http.StatusOK, gin.H{"message": "Marked as read"})
 }
 
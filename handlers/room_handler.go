@@ -1,20 +1,43 @@
 package handlers
 
 import (
+	"GoChatApp/events"
 	"GoChatApp/models"
 	"GoChatApp/repositories"
+	"log"
 	"net/http"
 	"strconv"
 
 	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
 )
 
 type RoomHandler struct {
 	roomRepo *repositories.RoomRepository
+	bus      *events.Bus
 }
 
-func NewRoomHandler(roomRepo *repositories.RoomRepository) *RoomHandler {
-	return &RoomHandler{roomRepo: roomRepo}
+func NewRoomHandler(roomRepo *repositories.RoomRepository, bus *events.Bus) *RoomHandler {
+	return &RoomHandler{roomRepo: roomRepo, bus: bus}
+}
+
+// checkRoomAccess confirms a user may post in a room, the same rule the
+// WebSocket hub applies, answering the request itself if not
+func checkRoomAccess(c *gin.Context, roomRepo *repositories.RoomRepository, roomID, userID uint) bool {
+	allowed, err := roomRepo.CanAccess(roomID, userID)
+	if err == gorm.ErrRecordNotFound {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Room not found"})
+		return false
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to check membership"})
+		return false
+	}
+	if !allowed {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Not a member of this room"})
+		return false
+	}
+	return true
 }
 
 // GetRooms returns all rooms
@@ -88,6 +111,12 @@ func (h *RoomHandler) CreateRoom(c *gin.Context) {
 		return
 	}
 
+	h.bus.Publish(events.RoomMemberJoined{
+		RoomID:   room.ID,
+		UserID:   userID.(uint),
+		Username: c.GetString("username"),
+	})
+
 	// Fetch room with relations
 	createdRoom, err := h.roomRepo.FindByID(room.ID)
 	if err != nil {
@@ -120,6 +149,20 @@ func (h *RoomHandler) JoinRoom(c *gin.Context) {
 		return
 	}
 
+	// Rooms that are not public take an invite, except for their creator
+	invited := false
+	if room.Type != "public" && room.CreatedBy != userID.(uint) {
+		invited, err = h.roomRepo.HasInvite(uint(roomID), userID.(uint))
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to check invite"})
+			return
+		}
+		if !invited {
+			c.JSON(http.StatusForbidden, gin.H{"error": "This room is invite only"})
+			return
+		}
+	}
+
 	// Check if already a member
 	isMember, err := h.roomRepo.IsMember(uint(roomID), userID.(uint))
 	if err != nil {
@@ -136,6 +179,17 @@ func (h *RoomHandler) JoinRoom(c *gin.Context) {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to join room"})
 		return
 	}
+	if invited {
+		if err := h.roomRepo.DeleteInvite(uint(roomID), userID.(uint)); err != nil {
+			log.Printf("Error deleting invite of user %d to room %d: %v", userID.(uint), roomID, err)
+		}
+	}
+
+	h.bus.Publish(events.RoomMemberJoined{
+		RoomID:   uint(roomID),
+		UserID:   userID.(uint),
+		Username: c.GetString("username"),
+	})
 
 	c.JSON(http.StatusOK, gin.H{"message": "Joined room successfully", "room": room})
 }
@@ -179,5 +233,136 @@ func (h *RoomHandler) LeaveRoom(c *gin.Context) {
 		return
 	}
 
+	h.bus.Publish(events.RoomMemberLeft{
+		RoomID:   uint(roomID),
+		UserID:   userID.(uint),
+		Username: c.GetString("username"),
+	})
+
 	c.JSON(http.StatusOK, gin.H{"message": "Left room successfully"})
 }
+
+// InviteMember lets a user join a room that is not public (room creator
+// only)
+func (h *RoomHandler) InviteMember(c *gin.Context) {
+	roomID, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid room ID"})
+		return
+	}
+
+	var input struct {
+		UserID uint `json:"user_id" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	userID, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return
+	}
+
+	room, err := h.roomRepo.FindByID(uint(roomID))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Room not found"})
+		return
+	}
+
+	if room.CreatedBy != userID.(uint) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Only the room creator can invite members"})
+		return
+	}
+
+	if room.Type == "public" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Anyone can join a public room"})
+		return
+	}
+
+	isMember, err := h.roomRepo.IsMember(uint(roomID), input.UserID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to check membership"})
+		return
+	}
+	if isMember {
+		c.JSON(http.StatusConflict, gin.H{"error": "User is already a member of this room"})
+		return
+	}
+
+	invite := &models.RoomInvite{RoomID: uint(roomID), UserID: input.UserID, InvitedBy: userID.(uint)}
+	if err := h.roomRepo.AddInvite(invite); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to invite member"})
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{"message": "Member invited"})
+}
+
+// KickMember removes another user from a room (room creator only)
+func (h *RoomHandler) KickMember(c *gin.Context) {
+	roomID, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid room ID"})
+		return
+	}
+
+	memberID, err := strconv.ParseUint(c.Param("user_id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid user ID"})
+		return
+	}
+
+	userID, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return
+	}
+
+	room, err := h.roomRepo.FindByID(uint(roomID))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Room not found"})
+		return
+	}
+
+	if room.CreatedBy != userID.(uint) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Only the room creator can remove members"})
+		return
+	}
+
+	if uint(memberID) == userID.(uint) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Use leave to remove yourself"})
+		return
+	}
+
+	isMember, err := h.roomRepo.IsMember(uint(roomID), uint(memberID))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to check membership"})
+		return
+	}
+	if !isMember {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "User is not a member of this room"})
+		return
+	}
+
+	if err := h.roomRepo.RemoveMember(uint(roomID), uint(memberID)); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to remove member"})
+		return
+	}
+
+	var memberName string
+	for _, member := range room.Members {
+		if member.ID == uint(memberID) {
+			memberName = member.Username
+		}
+	}
+	h.bus.Publish(events.RoomMemberLeft{
+		RoomID:   uint(roomID),
+		UserID:   uint(memberID),
+		Username: memberName,
+		Removed:  true,
+	})
+
+	c.JSON(http.StatusOK, gin.H{"message": "Member removed"})
+}
@@ -1,6 +1,7 @@
 package handlers
 
 import (
+	"GoChatApp/events"
 	"GoChatApp/models"
 	"GoChatApp/repositories"
 	"bytes"
@@ -15,7 +16,7 @@ import (
 func TestRoomHandler_GetRooms(t *testing.T) {
 	db := setupTestDB(t)
 	roomRepo := repositories.NewRoomRepository(db)
-	handler := NewRoomHandler(roomRepo)
+	handler := NewRoomHandler(roomRepo, nil)
 
 	// Create some rooms
 	roomRepo.Create(&models.Room{Name: "Room 1", Type: "public"})
@@ -44,7 +45,7 @@ func TestRoomHandler_GetRooms(t *testing.T) {
 func TestRoomHandler_GetRoom(t *testing.T) {
 	db := setupTestDB(t)
 	roomRepo := repositories.NewRoomRepository(db)
-	handler := NewRoomHandler(roomRepo)
+	handler := NewRoomHandler(roomRepo, nil)
 
 	room := &models.Room{Name: "Test Room", Type: "public"}
 	roomRepo.Create(room)
@@ -65,7 +66,7 @@ func TestRoomHandler_GetRoom(t *testing.T) {
 func TestRoomHandler_GetRoom_NotFound(t *testing.T) {
 	db := setupTestDB(t)
 	roomRepo := repositories.NewRoomRepository(db)
-	handler := NewRoomHandler(roomRepo)
+	handler := NewRoomHandler(roomRepo, nil)
 
 	router := gin.New()
 	router.GET("/rooms/:id", handler.GetRoom)
@@ -83,7 +84,7 @@ func TestRoomHandler_GetRoom_NotFound(t *testing.T) {
 func TestRoomHandler_CreateRoom_Success(t *testing.T) {
 	db := setupTestDB(t)
 	roomRepo := repositories.NewRoomRepository(db)
-	handler := NewRoomHandler(roomRepo)
+	handler := NewRoomHandler(roomRepo, nil)
 
 	router := gin.New()
 	router.POST("/rooms", func(c *gin.Context) {
@@ -111,7 +112,7 @@ func TestRoomHandler_CreateRoom_Success(t *testing.T) {
 func TestRoomHandler_CreateRoom_Unauthorized(t *testing.T) {
 	db := setupTestDB(t)
 	roomRepo := repositories.NewRoomRepository(db)
-	handler := NewRoomHandler(roomRepo)
+	handler := NewRoomHandler(roomRepo, nil)
 
 	router := gin.New()
 	router.POST("/rooms", handler.CreateRoom) // No user_id in context
@@ -136,7 +137,7 @@ func TestRoomHandler_JoinRoom_Success(t *testing.T) {
 	db := setupTestDB(t)
 	roomRepo := repositories.NewRoomRepository(db)
 	userRepo := repositories.NewUserRepository(db)
-	handler := NewRoomHandler(roomRepo)
+	handler := NewRoomHandler(roomRepo, nil)
 
 	// Create user and room
 	user := &models.User{Username: "joiner", Email: "join@example.com", PasswordHash: "hash"}
@@ -171,7 +172,7 @@ func TestRoomHandler_JoinRoom_AlreadyMember(t *testing.T) {
 	db := setupTestDB(t)
 	roomRepo := repositories.NewRoomRepository(db)
 	userRepo := repositories.NewUserRepository(db)
-	handler := NewRoomHandler(roomRepo)
+	handler := NewRoomHandler(roomRepo, nil)
 
 	user := &models.User{Username: "member", Email: "member@example.com", PasswordHash: "hash"}
 	userRepo.Create(user)
@@ -200,7 +201,7 @@ func TestRoomHandler_LeaveRoom_Success(t *testing.T) {
 	db := setupTestDB(t)
 	roomRepo := repositories.NewRoomRepository(db)
 	userRepo := repositories.NewUserRepository(db)
-	handler := NewRoomHandler(roomRepo)
+	handler := NewRoomHandler(roomRepo, nil)
 
 	user := &models.User{Username: "leaver", Email: "leave@example.com", PasswordHash: "hash"}
 	userRepo.Create(user)
@@ -235,7 +236,7 @@ func TestRoomHandler_LeaveRoom_NotMember(t *testing.T) {
 	db := setupTestDB(t)
 	roomRepo := repositories.NewRoomRepository(db)
 	userRepo := repositories.NewUserRepository(db)
-	handler := NewRoomHandler(roomRepo)
+	handler := NewRoomHandler(roomRepo, nil)
 
 	user := &models.User{Username: "nonmember", Email: "non@example.com", PasswordHash: "hash"}
 	userRepo.Create(user)
@@ -258,3 +259,171 @@ func TestRoomHandler_LeaveRoom_NotMember(t *testing.T) {
 		t.Errorf("Expected status 400, got %d", w.Code)
 	}
 }
+
+func TestRoomHandler_KickMember_Success(t *testing.T) {
+	db := setupTestDB(t)
+	roomRepo := repositories.NewRoomRepository(db)
+	userRepo := repositories.NewUserRepository(db)
+	handler := NewRoomHandler(roomRepo, nil)
+
+	owner := &models.User{Username: "owner", Email: "owner@example.com", PasswordHash: "hash"}
+	member := &models.User{Username: "member", Email: "member@example.com", PasswordHash: "hash"}
+	userRepo.Create(owner)
+	userRepo.Create(member)
+
+	room := &models.Room{Name: "Kick Room", Type: "private", CreatedBy: owner.ID}
+	roomRepo.Create(room)
+	roomRepo.AddMember(room.ID, owner.ID)
+	roomRepo.AddMember(room.ID, member.ID)
+
+	router := gin.New()
+	router.DELETE("/rooms/:id/members/:user_id", func(c *gin.Context) {
+		c.Set("user_id", owner.ID)
+		handler.KickMember(c)
+	})
+
+	req := httptest.NewRequest("DELETE", "/rooms/1/members/2", nil)
+	w := httptest.NewRecorder()
+
+	router.ServeHTTP(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Errorf("Expected status 200, got %d. Body: %s", w.Code, w.Body.String())
+	}
+
+	isMember, _ := roomRepo.IsMember(room.ID, member.ID)
+	if isMember {
+		t.Error("User should not be a member after being kicked")
+	}
+}
+
+func TestRoomHandler_KickMember_NotCreator(t *testing.T) {
+	db := setupTestDB(t)
+	roomRepo := repositories.NewRoomRepository(db)
+	userRepo := repositories.NewUserRepository(db)
+	handler := NewRoomHandler(roomRepo, nil)
+
+	owner := &models.User{Username: "owner", Email: "owner@example.com", PasswordHash: "hash"}
+	member := &models.User{Username: "member", Email: "member@example.com", PasswordHash: "hash"}
+	userRepo.Create(owner)
+	userRepo.Create(member)
+
+	room := &models.Room{Name: "Kick Room", Type: "private", CreatedBy: owner.ID}
+	roomRepo.Create(room)
+	roomRepo.AddMember(room.ID, owner.ID)
+	roomRepo.AddMember(room.ID, member.ID)
+
+	router := gin.New()
+	router.DELETE("/rooms/:id/members/:user_id", func(c *gin.Context) {
+		c.Set("user_id", member.ID)
+		handler.KickMember(c)
+	})
+
+	req := httptest.NewRequest("DELETE", "/rooms/1/members/1", nil)
+	w := httptest.NewRecorder()
+
+	router.ServeHTTP(w, req)
+
+	if w.Code != http.StatusForbidden {
+		t.Errorf("Expected status 403, got %d", w.Code)
+	}
+}
+
+func TestRoomHandler_JoinRoom_PrivateNeedsInvite(t *testing.T) {
+	db := setupTestDB(t)
+	userRepo := repositories.NewUserRepository(db)
+	roomRepo := repositories.NewRoomRepository(db)
+
+	owner := &models.User{Username: "owner", Email: "owner@example.com", PasswordHash: "hash"}
+	outsider := &models.User{Username: "outsider", Email: "outsider@example.com", PasswordHash: "hash"}
+	userRepo.Create(owner)
+	userRepo.Create(outsider)
+	room := &models.Room{Name: "Secret Room", Type: "private", CreatedBy: owner.ID}
+	roomRepo.Create(room)
+	roomRepo.AddMember(room.ID, owner.ID)
+
+	wsHandler := NewWebSocketHandler(repositories.NewMessageRepository(db), roomRepo, userRepo, nil, NewMemoryBroker())
+	bus := events.NewBus()
+	bus.Subscribe(wsHandler.Hub.HandleEvent)
+	handler := NewRoomHandler(roomRepo, bus)
+
+	router := gin.New()
+	wsHandler.AllowTokenQuery = true
+	router.GET("/ws", wsHandler.HandleWebSocket)
+	as := func(user *models.User, next gin.HandlerFunc) gin.HandlerFunc {
+		return func(c *gin.Context) {
+			c.Set("user_id", user.ID)
+			c.Set("username", user.Username)
+			next(c)
+		}
+	}
+	router.POST("/rooms/:id/join", as(outsider, handler.JoinRoom))
+	router.POST("/rooms/:id/invites", as(owner, handler.InviteMember))
+	server := httptest.NewServer(router)
+	defer server.Close()
+
+	conn := dialWebSocket(t, server, outsider)
+	readFrame(t, conn, EventReady)
+
+	resp, err := http.Post(server.URL+"/rooms/1/join", "application/json", nil)
+	if err != nil || resp.StatusCode != http.StatusForbidden {
+		t.Fatalf("Expected status 403 without an invite, got %v %v", err, resp)
+	}
+	if isMember, _ := roomRepo.IsMember(room.ID, outsider.ID); isMember {
+		t.Error("User should not be a member after a refused join")
+	}
+	wsHandler.Hub.mu.RLock()
+	for client := range wsHandler.Hub.Users[outsider.ID] {
+		if client.Rooms[room.ID] {
+			t.Error("Live connection should not be subscribed after a refused join")
+		}
+	}
+	wsHandler.Hub.mu.RUnlock()
+
+	body, _ := json.Marshal(map[string]uint{"user_id": outsider.ID})
+	resp, err = http.Post(server.URL+"/rooms/1/invites", "application/json", bytes.NewReader(body))
+	if err != nil || resp.StatusCode != http.StatusCreated {
+		t.Fatalf("Expected the invite to be created, got %v %v", err, resp)
+	}
+
+	resp, err = http.Post(server.URL+"/rooms/1/join", "application/json", nil)
+	if err != nil || resp.StatusCode != http.StatusOK {
+		t.Fatalf("Expected an invited user to join, got %v %v", err, resp)
+	}
+	if invited, _ := roomRepo.HasInvite(room.ID, outsider.ID); invited {
+		t.Error("The invite should be used up by joining")
+	}
+	readFrame(t, conn, EventRoomMemberJoined)
+}
+
+func TestRoomHandler_InviteMember_CreatorOnly(t *testing.T) {
+	db := setupTestDB(t)
+	userRepo := repositories.NewUserRepository(db)
+	roomRepo := repositories.NewRoomRepository(db)
+	handler := NewRoomHandler(roomRepo, nil)
+
+	owner := &models.User{Username: "owner", Email: "owner@example.com", PasswordHash: "hash"}
+	member := &models.User{Username: "member", Email: "member@example.com", PasswordHash: "hash"}
+	userRepo.Create(owner)
+	userRepo.Create(member)
+	room := &models.Room{Name: "Secret Room", Type: "private", CreatedBy: owner.ID}
+	roomRepo.Create(room)
+	roomRepo.AddMember(room.ID, member.ID)
+
+	router := gin.New()
+	router.POST("/rooms/:id/invites", func(c *gin.Context) {
+		c.Set("user_id", member.ID)
+		handler.InviteMember(c)
+	})
+
+	body, _ := json.Marshal(map[string]uint{"user_id": 99})
+	req := httptest.NewRequest("POST", "/rooms/1/invites", bytes.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+
+	router.ServeHTTP(w, req)
+
+	if w.Code != http.StatusForbidden {
+		t.Errorf("Expected status 403, got %d", w.Code)
+	}
+}
@@ -0,0 +1,212 @@
+package handlers
+
+import (
+	"GoChatApp/events"
+	"GoChatApp/models"
+	"GoChatApp/utils"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// sessionTTL is how long a login lasts. Refreshing rotates the refresh token
+// but does not extend the session.
+const sessionTTL = 30 * 24 * time.Hour
+
+// sessionResponse is a session as listed to its user
+type sessionResponse struct {
+	models.Session
+	Current bool `json:"current"` // The session making the request
+}
+
+// startSession creates a session for a user who just signed in and returns
+// its first access and refresh tokens
+func (h *AuthHandler) startSession(c *gin.Context, user *models.User) (gin.H, error) {
+	now := time.Now()
+	session := &models.Session{
+		UserID:     user.ID,
+		UserAgent:  c.Request.UserAgent(),
+		IP:         c.ClientIP(),
+		LastUsedAt: now,
+		ExpiresAt:  now.Add(sessionTTL),
+	}
+	if err := h.sessionRepo.Create(session); err != nil {
+		return nil, err
+	}
+	return h.issueTokens(user, session)
+}
+
+// issueTokens returns a new access token and the next refresh token of a session
+func (h *AuthHandler) issueTokens(user *models.User, session *models.Session) (gin.H, error) {
+	accessToken, err := utils.GenerateToken(user.ID, user.Username, user.Email, user.Role, session.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	refreshToken, hash, err := utils.GenerateOpaqueToken()
+	if err != nil {
+		return nil, err
+	}
+	if err := h.sessionRepo.CreateRefreshToken(session.ID, hash); err != nil {
+		return nil, err
+	}
+
+	return gin.H{
+		"token":         accessToken,
+		"refresh_token": refreshToken,
+		"expires_in":    int(utils.AccessTokenTTL.Seconds()),
+		"session_id":    session.ID,
+	}, nil
+}
+
+// RefreshToken exchanges a refresh token for a new access token and the
+// session's next refresh token. Presenting a refresh token that was already
+// exchanged means it was copied, so the whole session is revoked.
+func (h *AuthHandler) RefreshToken(c *gin.Context) {
+	var input struct {
+		RefreshToken string `json:"refresh_token" binding:"required"`
+	}
+
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	token, err := h.sessionRepo.FindRefreshToken(utils.HashOpaqueToken(input.RefreshToken))
+	if err != nil {
+		if err == gorm.ErrRecordNotFound {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid refresh token"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to refresh token"})
+		return
+	}
+
+	session, err := h.sessionRepo.FindByID(token.SessionID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to refresh token"})
+		return
+	}
+	if session.RevokedAt != nil || time.Now().After(session.ExpiresAt) {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Session revoked or expired"})
+		return
+	}
+
+	used, err := h.sessionRepo.UseRefreshToken(token.ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to refresh token"})
+		return
+	}
+	if !used {
+		log.Printf("Refresh token reused for session %d of user %d, revoking session", session.ID, session.UserID)
+		h.revokeSession(session)
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Refresh token reuse detected; session revoked"})
+		return
+	}
+
+	user, err := h.userRepo.FindByID(session.UserID)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Session revoked or expired"})
+		return
+	}
+	if accountDisabled(c, user) {
+		return
+	}
+
+	h.sessionRepo.Touch(session.ID, time.Now())
+
+	response, err := h.issueTokens(user, session)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate token"})
+		return
+	}
+	c.JSON(http.StatusOK, response)
+}
+
+// Logout revokes the session making the request
+func (h *AuthHandler) Logout(c *gin.Context) {
+	sessionID, exists := c.Get("session_id")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return
+	}
+
+	session, err := h.sessionRepo.FindByID(sessionID.(uint))
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Session revoked or expired"})
+		return
+	}
+
+	if err := h.revokeSession(session); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to log out"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Logged out"})
+}
+
+// GetSessions lists the user's active sessions
+func (h *AuthHandler) GetSessions(c *gin.Context) {
+	userID, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return
+	}
+	sessionID, _ := c.Get("session_id")
+	currentID, _ := sessionID.(uint)
+
+	sessions, err := h.sessionRepo.FindActiveByUser(userID.(uint))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch sessions"})
+		return
+	}
+
+	response := make([]sessionResponse, 0, len(sessions))
+	for _, session := range sessions {
+		response = append(response, sessionResponse{Session: session, Current: session.ID == currentID})
+	}
+
+	c.JSON(http.StatusOK, gin.H{"sessions": response})
+}
+
+// RevokeSession signs one of the user's devices out
+func (h *AuthHandler) RevokeSession(c *gin.Context) {
+	userID, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return
+	}
+
+	sessionID, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid session ID"})
+		return
+	}
+
+	// Other users' sessions are reported as missing, not forbidden
+	session, err := h.sessionRepo.FindByID(uint(sessionID))
+	if err != nil || session.UserID != userID.(uint) || session.RevokedAt != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Session not found"})
+		return
+	}
+
+	if err := h.revokeSession(session); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to revoke session"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Session revoked"})
+}
+
+// revokeSession revokes a session and closes its live connections
+func (h *AuthHandler) revokeSession(session *models.Session) error {
+	if err := h.sessionRepo.Revoke(session.ID); err != nil {
+		return err
+	}
+	h.bus.Publish(events.SessionRevoked{SessionID: session.ID, UserID: session.UserID})
+	return nil
+}
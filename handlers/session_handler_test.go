@@ -0,0 +1,208 @@
+package handlers
+
+import (
+	"GoChatApp/events"
+	"GoChatApp/middleware"
+	"GoChatApp/repositories"
+	"GoChatApp/utils"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gorilla/websocket"
+	"gorm.io/gorm"
+)
+
+// setupSessionRouter serves the auth and session routes the way SetupRoutes does
+func setupSessionRouter(db *gorm.DB, bus *events.Bus) *gin.Engine {
+	sessionRepo := repositories.NewSessionRepository(db)
+	handler := NewAuthHandler(repositories.NewUserRepository(db), sessionRepo, repositories.NewAccountTokenRepository(db), repositories.NewRecoveryCodeRepository(db), repositories.NewPersonalAccessTokenRepository(db), &recordingMailer{}, bus)
+
+	router := gin.New()
+	router.POST("/register", handler.Register)
+	router.POST("/login", handler.Login)
+	router.POST("/token/refresh", handler.RefreshToken)
+
+	protected := router.Group("/")
+	protected.Use(middleware.AuthMiddleware(sessionRepo, nil))
+	protected.POST("/logout", handler.Logout)
+	protected.GET("/sessions", handler.GetSessions)
+	protected.DELETE("/sessions/:id", handler.RevokeSession)
+	return router
+}
+
+// doJSON sends a request with an optional JSON body and bearer token
+func doJSON(router *gin.Engine, method, path, token string, body interface{}) (*httptest.ResponseRecorder, map[string]interface{}) {
+	var reader *bytes.Buffer
+	if body != nil {
+		jsonBody, _ := json.Marshal(body)
+		reader = bytes.NewBuffer(jsonBody)
+	} else {
+		reader = &bytes.Buffer{}
+	}
+
+	req := httptest.NewRequest(method, path, reader)
+	req.Header.Set("Content-Type", "application/json")
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	var response map[string]interface{}
+	json.Unmarshal(w.Body.Bytes(), &response)
+	return w, response
+}
+
+// registerSession registers a user and returns the tokens of their first session
+func registerSession(t *testing.T, router *gin.Engine, username string) (accessToken, refreshToken string) {
+	t.Helper()
+	w, response := doJSON(router, "POST", "/register", "", map[string]string{
+		"username": username,
+		"email":    username + "@example.com",
+		"password": "password123",
+	})
+	if w.Code != http.StatusCreated {
+		t.Fatalf("Failed to register: %d %s", w.Code, w.Body.String())
+	}
+	return response["token"].(string), response["refresh_token"].(string)
+}
+
+// loginSession signs an existing user in from another device
+func loginSession(t *testing.T, router *gin.Engine, username string) (accessToken, refreshToken string) {
+	t.Helper()
+	w, response := doJSON(router, "POST", "/login", "", map[string]string{
+		"username": username,
+		"password": "password123",
+	})
+	if w.Code != http.StatusOK {
+		t.Fatalf("Failed to log in: %d %s", w.Code, w.Body.String())
+	}
+	return response["token"].(string), response["refresh_token"].(string)
+}
+
+func TestSession_RefreshRotatesToken(t *testing.T) {
+	db := setupTestDB(t)
+	router := setupSessionRouter(db, nil)
+	_, refreshToken := registerSession(t, router, "rotator")
+
+	w, response := doJSON(router, "POST", "/token/refresh", "", map[string]string{"refresh_token": refreshToken})
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d. Body: %s", w.Code, w.Body.String())
+	}
+	next := response["refresh_token"].(string)
+	if next == refreshToken {
+		t.Error("Expected a new refresh token")
+	}
+
+	// The new access token belongs to the same session
+	if w, _ := doJSON(router, "GET", "/sessions", response["token"].(string), nil); w.Code != http.StatusOK {
+		t.Errorf("Expected refreshed token to be accepted, got %d", w.Code)
+	}
+
+	if w, _ := doJSON(router, "POST", "/token/refresh", "", map[string]string{"refresh_token": "unknown"}); w.Code != http.StatusUnauthorized {
+		t.Errorf("Expected status 401 for an unknown token, got %d", w.Code)
+	}
+}
+
+func TestSession_RefreshReuseRevokesSession(t *testing.T) {
+	db := setupTestDB(t)
+	router := setupSessionRouter(db, nil)
+	accessToken, stolen := registerSession(t, router, "victim")
+
+	// The legitimate client rotates first
+	_, response := doJSON(router, "POST", "/token/refresh", "", map[string]string{"refresh_token": stolen})
+	next := response["refresh_token"].(string)
+
+	// Replaying the old token gives the theft away
+	w, _ := doJSON(router, "POST", "/token/refresh", "", map[string]string{"refresh_token": stolen})
+	if w.Code != http.StatusUnauthorized {
+		t.Errorf("Expected status 401 on reuse, got %d", w.Code)
+	}
+
+	// Every token of the session stops working
+	if w, _ := doJSON(router, "POST", "/token/refresh", "", map[string]string{"refresh_token": next}); w.Code != http.StatusUnauthorized {
+		t.Errorf("Expected the latest refresh token to be revoked, got %d", w.Code)
+	}
+	if w, _ := doJSON(router, "GET", "/sessions", accessToken, nil); w.Code != http.StatusUnauthorized {
+		t.Errorf("Expected access tokens of the session to be rejected, got %d", w.Code)
+	}
+}
+
+func TestSession_LogoutRevokesOnlyCurrentSession(t *testing.T) {
+	db := setupTestDB(t)
+	router := setupSessionRouter(db, nil)
+	laptop, laptopRefresh := registerSession(t, router, "traveller")
+	phone, _ := loginSession(t, router, "traveller")
+
+	if w, _ := doJSON(router, "POST", "/logout", laptop, nil); w.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d", w.Code)
+	}
+
+	if w, _ := doJSON(router, "GET", "/sessions", laptop, nil); w.Code != http.StatusUnauthorized {
+		t.Errorf("Expected logged out token to be rejected, got %d", w.Code)
+	}
+	if w, _ := doJSON(router, "POST", "/token/refresh", "", map[string]string{"refresh_token": laptopRefresh}); w.Code != http.StatusUnauthorized {
+		t.Errorf("Expected logged out refresh token to be rejected, got %d", w.Code)
+	}
+
+	w, response := doJSON(router, "GET", "/sessions", phone, nil)
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected other device to stay signed in, got %d", w.Code)
+	}
+	sessions := response["sessions"].([]interface{})
+	if len(sessions) != 1 || sessions[0].(map[string]interface{})["current"] != true {
+		t.Errorf("Expected only the current session to be listed, got %v", sessions)
+	}
+}
+
+func TestSession_RevokeClosesSessionSockets(t *testing.T) {
+	db := setupTestDB(t)
+	userRepo := repositories.NewUserRepository(db)
+
+	wsHandler := NewWebSocketHandler(repositories.NewMessageRepository(db), repositories.NewRoomRepository(db), userRepo, nil, NewMemoryBroker())
+	wsServer := setupWebSocketServer(t, wsHandler)
+	bus := events.NewBus()
+	bus.Subscribe(wsHandler.Hub.HandleEvent)
+
+	router := setupSessionRouter(db, bus)
+	laptop, _ := registerSession(t, router, "owner")
+	phone, _ := loginSession(t, router, "owner")
+
+	dial := func(accessToken string) *websocket.Conn {
+		claims, _ := utils.ValidateToken(accessToken)
+		ticket, _ := wsHandler.Tickets.Issue(WSTicket{UserID: claims.UserID, Username: claims.Username, SessionID: claims.SessionID}, ticketTTL)
+		conn, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(wsServer.URL, "http")+"/ws?ticket="+ticket, nil)
+		if err != nil {
+			t.Fatalf("Failed to dial: %v", err)
+		}
+		t.Cleanup(func() { conn.Close() })
+		readFrame(t, &testConn{Conn: conn}, EventReady)
+		return conn
+	}
+	laptopConn := dial(laptop)
+	phoneConn := dial(phone)
+
+	phoneClaims, _ := utils.ValidateToken(phone)
+	intruder, _ := registerSession(t, router, "intruder")
+	if w, _ := doJSON(router, "DELETE", fmt.Sprintf("/sessions/%d", phoneClaims.SessionID), intruder, nil); w.Code != http.StatusNotFound {
+		t.Errorf("Expected status 404 for another user's session, got %d", w.Code)
+	}
+
+	if w, _ := doJSON(router, "DELETE", fmt.Sprintf("/sessions/%d", phoneClaims.SessionID), laptop, nil); w.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d", w.Code)
+	}
+
+	if code := expectClose(t, phoneConn); code != CloseSessionRevoked {
+		t.Errorf("Expected close code %d, got %d", CloseSessionRevoked, code)
+	}
+
+	// The laptop's socket is still live
+	wsHandler.Hub.SendToUser(phoneClaims.UserID, ErrorEvent{Type: EventError, Code: ErrCodeInternal, Message: "ping"})
+	readFrame(t, &testConn{Conn: laptopConn}, EventError)
+}
@@ -0,0 +1,226 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gorilla/websocket"
+)
+
+// sseKeepAlive is how often an idle stream gets a comment line, so proxies
+// do not time it out
+const sseKeepAlive = 30 * time.Second
+
+// sseCloseEvent is the data of the close event that ends a stream, carrying
+// the same codes a WebSocket close frame would
+type sseCloseEvent struct {
+	Code   int    `json:"code"`
+	Reason string `json:"reason"`
+}
+
+// HandleEvents streams the same frames as the WebSocket endpoint as
+// Server-Sent Events, for clients that cannot upgrade. Frames are sent over
+// the REST endpoints. Chat frames carry the message ID as the event ID, so a
+// reconnecting client resumes from Last-Event-ID.
+func (h *WebSocketHandler) HandleEvents(c *gin.Context) {
+	if !h.Hub.Accepting() {
+		c.Header("Retry-After", "5")
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "server is shutting down"})
+		return
+	}
+
+	// EventSource cannot set headers, so tickets come in ?ticket=
+	ticket, err := h.authenticate(c, "")
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+		return
+	}
+
+	deviceID, ok := deviceIDFrom(c)
+	if !ok {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid device_id"})
+		return
+	}
+
+	// Tickets are single use, so browsers resume by opening a new
+	// EventSource with last_event_id rather than reconnecting with the header
+	lastEventID := c.GetHeader("Last-Event-ID")
+	if lastEventID == "" {
+		lastEventID = c.Query("last_event_id")
+	}
+	var sinceMessageID uint64
+	if lastEventID != "" {
+		sinceMessageID, err = strconv.ParseUint(lastEventID, 10, 32)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid Last-Event-ID"})
+			return
+		}
+	}
+
+	c.Header("Content-Type", "text/event-stream")
+	c.Header("Cache-Control", "no-cache")
+	c.Header("Connection", "keep-alive")
+	c.Header("X-Accel-Buffering", "no") // Keep nginx from buffering the stream
+	c.Status(http.StatusOK)
+	c.Writer.Flush()
+
+	transport := newSSETransport(c.Writer)
+	client := h.connect(transport, ticket, deviceID, ProtocolV1, uint(sinceMessageID))
+
+	// The stream has no inbound side; it ends when the client goes away
+	go func() {
+		<-c.Request.Context().Done()
+		h.Hub.Unregister <- client
+	}()
+
+	client.WritePump()
+}
+
+// sseTransport writes frames as Server-Sent Events on a streaming response
+type sseTransport struct {
+	w          gin.ResponseWriter
+	controller *http.ResponseController
+
+	closed    chan struct{}
+	closeOnce sync.Once
+}
+
+func newSSETransport(w gin.ResponseWriter) *sseTransport {
+	return &sseTransport{
+		w:          w,
+		controller: http.NewResponseController(w),
+		closed:     make(chan struct{}),
+	}
+}
+
+func (t *sseTransport) Name() string {
+	return TransportSSE
+}
+
+// Close ends the stream, failing any write in progress
+func (t *sseTransport) Close() error {
+	t.closeOnce.Do(func() { close(t.closed) })
+	return t.controller.SetWriteDeadline(time.Now())
+}
+
+// WritePump writes queued frames as events until the hub closes the client,
+// then sends a close event with the client's close code
+func (t *sseTransport) WritePump(c *Client) {
+	ticker := time.NewTicker(sseKeepAlive)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case message, ok := <-c.Send:
+			t.controller.SetWriteDeadline(time.Now().Add(writeWait))
+			if !ok {
+				t.writeClose(c.closeCode, c.closeReason)
+				return
+			}
+
+			if err := t.writeEvent(message.JSON()); err != nil {
+				return
+			}
+			// Flush queued frames together. The hub may drop queued frames
+			// or close the buffer meanwhile, so never wait for one.
+			closed := false
+		batch:
+			for n := len(c.Send); n > 0; n-- {
+				select {
+				case message, ok := <-c.Send:
+					if !ok {
+						closed = true
+						break batch
+					}
+					if err := t.writeEvent(message.JSON()); err != nil {
+						return
+					}
+				default:
+					break batch
+				}
+			}
+			if err := t.controller.Flush(); err != nil {
+				return
+			}
+			if closed {
+				t.writeClose(c.closeCode, c.closeReason)
+				return
+			}
+
+		case <-ticker.C:
+			t.controller.SetWriteDeadline(time.Now().Add(writeWait))
+			if _, err := t.w.Write([]byte(": keepalive\n\n")); err != nil {
+				return
+			}
+			if err := t.controller.Flush(); err != nil {
+				return
+			}
+
+		case <-t.closed:
+			return
+		}
+	}
+}
+
+// writeEvent writes one frame as an event, with the message ID as the event
+// ID for chat frames
+func (t *sseTransport) writeEvent(frame []byte) error {
+	var buf bytes.Buffer
+	if id := frameMessageID(frame); id != 0 {
+		fmt.Fprintf(&buf, "id: %d\n", id)
+	}
+	for _, line := range bytes.Split(frame, []byte{'\n'}) {
+		buf.WriteString("data: ")
+		buf.Write(line)
+		buf.WriteByte('\n')
+	}
+	buf.WriteByte('\n')
+
+	_, err := t.w.Write(buf.Bytes())
+	return err
+}
+
+// writeClose ends the stream with a close event. On a server restart the
+// reconnect hint also becomes the stream's retry delay.
+func (t *sseTransport) writeClose(code int, reason string) {
+	if code == 0 {
+		return
+	}
+
+	var buf bytes.Buffer
+	if code == websocket.CloseServiceRestart {
+		var hint shutdownReason
+		if json.Unmarshal([]byte(reason), &hint) == nil && hint.ReconnectAfterMs > 0 {
+			fmt.Fprintf(&buf, "retry: %d\n", hint.ReconnectAfterMs)
+		}
+	}
+	data, _ := json.Marshal(sseCloseEvent{Code: code, Reason: reason})
+	fmt.Fprintf(&buf, "event: close\ndata: %s\n\n", data)
+
+	t.w.Write(buf.Bytes())
+	t.controller.Flush()
+}
+
+// frameMessageID returns the ID of the stored message a chat frame carries,
+// or 0 for any other frame
+func frameMessageID(frame []byte) uint {
+	if !bytes.Contains(frame, []byte(`"type":"chat"`)) {
+		return 0
+	}
+	var chat struct {
+		Type    string `json:"type"`
+		Message *struct {
+			ID uint `json:"id"`
+		} `json:"message"`
+	}
+	if err := json.Unmarshal(frame, &chat); err != nil || chat.Type != EventChat || chat.Message == nil {
+		return 0
+	}
+	return chat.Message.ID
+}
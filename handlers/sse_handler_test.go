@@ -0,0 +1,236 @@
+package handlers
+
+import (
+	"GoChatApp/models"
+	"GoChatApp/repositories"
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// sseEvent is one event read from a stream
+type sseEvent struct {
+	ID    string
+	Event string
+	Data  map[string]interface{}
+}
+
+// openEventStream opens the SSE endpoint as the given user
+func openEventStream(t *testing.T, server *httptest.Server, wsHandler *WebSocketHandler, user *models.User, lastEventID string) *bufio.Reader {
+	ticket, _ := wsHandler.Tickets.Issue(WSTicket{UserID: user.ID, Username: user.Username}, ticketTTL)
+
+	req, _ := http.NewRequest("GET", server.URL+"/events?ticket="+ticket, nil)
+	if lastEventID != "" {
+		req.Header.Set("Last-Event-ID", lastEventID)
+	}
+	client := &http.Client{Timeout: 5 * time.Second}
+	resp, err := client.Do(req)
+	if err != nil {
+		t.Fatalf("Failed to open event stream: %v", err)
+	}
+	t.Cleanup(func() { resp.Body.Close() })
+
+	if resp.StatusCode != http.StatusOK || resp.Header.Get("Content-Type") != "text/event-stream" {
+		t.Fatalf("Expected an event stream, got %d %s", resp.StatusCode, resp.Header.Get("Content-Type"))
+	}
+	return bufio.NewReader(resp.Body)
+}
+
+// readEvent reads events until one of the wanted type arrives. Close events
+// are wanted as "close".
+func readEvent(t *testing.T, reader *bufio.Reader, frameType string) sseEvent {
+	t.Helper()
+	for {
+		var event sseEvent
+		var data string
+		for {
+			line, err := reader.ReadString('\n')
+			if err != nil {
+				t.Fatalf("Stream ended waiting for %s: %v", frameType, err)
+			}
+			line = strings.TrimSuffix(line, "\n")
+			if line == "" {
+				break
+			}
+			field, value, _ := strings.Cut(line, ": ")
+			switch field {
+			case "id":
+				event.ID = value
+			case "event":
+				event.Event = value
+			case "data":
+				data += value
+			}
+		}
+		if data == "" {
+			continue // Keepalive comment
+		}
+		json.Unmarshal([]byte(data), &event.Data)
+
+		if event.Event == frameType || (event.Event == "" && event.Data["type"] == frameType) {
+			return event
+		}
+	}
+}
+
+func setupEventStreamServer(t *testing.T, wsHandler *WebSocketHandler) *httptest.Server {
+	router := gin.New()
+	router.GET("/events", wsHandler.HandleEvents)
+
+	server := httptest.NewServer(router)
+	t.Cleanup(server.Close)
+	return server
+}
+
+func TestSSE_StreamsRoomFrames(t *testing.T) {
+	db := setupTestDB(t)
+	userRepo := repositories.NewUserRepository(db)
+	roomRepo := repositories.NewRoomRepository(db)
+	messageRepo := repositories.NewMessageRepository(db)
+
+	user := &models.User{Username: "proxied", Email: "proxied@example.com", PasswordHash: "hash"}
+	userRepo.Create(user)
+	room := &models.Room{Name: "Behind Proxy", Type: "public", CreatedBy: user.ID}
+	roomRepo.Create(room)
+	roomRepo.AddMember(room.ID, user.ID)
+
+	wsHandler := NewWebSocketHandler(messageRepo, roomRepo, userRepo, nil, NewMemoryBroker())
+	server := setupEventStreamServer(t, wsHandler)
+	stream := openEventStream(t, server, wsHandler, user, "")
+
+	if session := readEvent(t, stream, EventSession); session.Data["transport"] != TransportSSE {
+		t.Errorf("Expected sse transport in session frame, got %v", session.Data)
+	}
+	readEvent(t, stream, EventReady)
+
+	// SSE clients count as online like any other connection
+	if status := wsHandler.Hub.PresenceOf(user.ID); status != PresenceOnline {
+		t.Errorf("Expected user online, got %s", status)
+	}
+
+	message := &models.Message{UserID: user.ID, RoomID: room.ID, Content: "hello over sse"}
+	messageRepo.Create(message)
+	wsHandler.Hub.sendRoomFrame(room.ID, message.ID, ChatMessageEvent{Type: EventChat, RoomID: room.ID, Message: message})
+
+	chat := readEvent(t, stream, EventChat)
+	if chat.ID != fmt.Sprint(message.ID) {
+		t.Errorf("Expected event ID %d, got %q", message.ID, chat.ID)
+	}
+}
+
+func TestSSE_ResumesFromLastEventID(t *testing.T) {
+	db := setupTestDB(t)
+	userRepo := repositories.NewUserRepository(db)
+	roomRepo := repositories.NewRoomRepository(db)
+	messageRepo := repositories.NewMessageRepository(db)
+
+	user := &models.User{Username: "resumer", Email: "resumer@example.com", PasswordHash: "hash"}
+	userRepo.Create(user)
+	room := &models.Room{Name: "Resume", Type: "public", CreatedBy: user.ID}
+	roomRepo.Create(room)
+	roomRepo.AddMember(room.ID, user.ID)
+
+	var messages []*models.Message
+	for i := 0; i < 3; i++ {
+		message := &models.Message{UserID: user.ID, RoomID: room.ID, Content: fmt.Sprintf("message %d", i)}
+		messageRepo.Create(message)
+		messages = append(messages, message)
+	}
+
+	wsHandler := NewWebSocketHandler(messageRepo, roomRepo, userRepo, nil, NewMemoryBroker())
+	server := setupEventStreamServer(t, wsHandler)
+	stream := openEventStream(t, server, wsHandler, user, fmt.Sprint(messages[0].ID))
+
+	readEvent(t, stream, EventReady)
+	for _, message := range messages[1:] {
+		if chat := readEvent(t, stream, EventChat); chat.ID != fmt.Sprint(message.ID) {
+			t.Errorf("Expected replayed message %d, got %q", message.ID, chat.ID)
+		}
+	}
+}
+
+func TestSSE_ResumesManyRoomsInOrder(t *testing.T) {
+	db := setupTestDB(t)
+	userRepo := repositories.NewUserRepository(db)
+	roomRepo := repositories.NewRoomRepository(db)
+	messageRepo := repositories.NewMessageRepository(db)
+
+	user := &models.User{Username: "returning", Email: "returning@example.com", PasswordHash: "hash"}
+	userRepo.Create(user)
+	var rooms []*models.Room
+	for i := 0; i < 4; i++ {
+		room := &models.Room{Name: fmt.Sprintf("Busy %d", i), Type: "public", CreatedBy: user.ID}
+		roomRepo.Create(room)
+		roomRepo.AddMember(room.ID, user.ID)
+		rooms = append(rooms, room)
+	}
+
+	// Missed messages interleave across the rooms
+	seen := &models.Message{UserID: user.ID, RoomID: rooms[0].ID, Content: "seen"}
+	messageRepo.Create(seen)
+	var newest uint
+	for i := 0; i < maxReplayMessages; i++ {
+		for _, room := range rooms {
+			message := &models.Message{UserID: user.ID, RoomID: room.ID, Content: "missed"}
+			messageRepo.Create(message)
+			newest = message.ID
+		}
+	}
+
+	wsHandler := NewWebSocketHandler(messageRepo, roomRepo, userRepo, nil, NewMemoryBroker())
+	server := setupEventStreamServer(t, wsHandler)
+	stream := openEventStream(t, server, wsHandler, user, fmt.Sprint(seen.ID))
+	readEvent(t, stream, EventReady)
+
+	for range rooms {
+		readEvent(t, stream, EventHistoryTruncated)
+	}
+
+	// Only the newest messages are replayed, oldest first across rooms
+	var lastID uint64
+	for i := 0; i < maxReplayMessages; i++ {
+		chat := readEvent(t, stream, EventChat)
+		id, _ := strconv.ParseUint(chat.ID, 10, 32)
+		if id <= lastID {
+			t.Fatalf("Expected replayed IDs to increase, got %d after %d", id, lastID)
+		}
+		lastID = id
+	}
+	if lastID != uint64(newest) {
+		t.Errorf("Expected the replay to end at message %d, got %d", newest, lastID)
+	}
+	if stats := wsHandler.Hub.Stats(); stats.SlowConsumersEvicted != 0 || stats.FramesDropped != 0 {
+		t.Errorf("Expected the resuming client to keep up, got %+v", stats)
+	}
+}
+
+func TestSSE_ClosedWithCode(t *testing.T) {
+	db := setupTestDB(t)
+	userRepo := repositories.NewUserRepository(db)
+
+	user := &models.User{Username: "revoked", Email: "revoked@example.com", PasswordHash: "hash"}
+	userRepo.Create(user)
+
+	wsHandler := NewWebSocketHandler(repositories.NewMessageRepository(db), repositories.NewRoomRepository(db), userRepo, nil, NewMemoryBroker())
+	server := setupEventStreamServer(t, wsHandler)
+	stream := openEventStream(t, server, wsHandler, user, "")
+	readEvent(t, stream, EventReady)
+
+	wsHandler.Hub.DisconnectUser(user.ID, CloseSessionRevoked, "session revoked")
+
+	closeEvent := readEvent(t, stream, "close")
+	if closeEvent.Data["code"] != float64(CloseSessionRevoked) {
+		t.Errorf("Expected close code %d, got %v", CloseSessionRevoked, closeEvent.Data)
+	}
+	if _, err := stream.ReadString('\n'); err == nil {
+		t.Error("Expected the stream to end after the close event")
+	}
+}
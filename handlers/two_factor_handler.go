@@ -0,0 +1,300 @@
+package handlers
+
+import (
+	"GoChatApp/models"
+	"GoChatApp/utils"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// challengeTTL is how long a user has to enter their code after their password
+const challengeTTL = 5 * time.Minute
+
+// maxChallengeAttempts is how many wrong codes a login challenge survives
+const maxChallengeAttempts = 5
+
+// recoveryCodeCount is how many recovery codes a user gets on enrollment
+const recoveryCodeCount = 10
+
+// SetupTwoFactor starts TOTP enrollment. It returns a new secret and its
+// otpauth URI for the authenticator app; two-factor login stays off until
+// a code is confirmed with ConfirmTwoFactor. The user gives their password,
+// so a stolen access token cannot enroll the thief's authenticator.
+func (h *AuthHandler) SetupTwoFactor(c *gin.Context) {
+	var input struct {
+		CurrentPassword string `json:"current_password" binding:"required"`
+	}
+
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	user, ok := h.currentUser(c)
+	if !ok {
+		return
+	}
+	if user.TOTPEnabledAt != nil {
+		c.JSON(http.StatusConflict, gin.H{"error": "Two-factor authentication is already enabled"})
+		return
+	}
+	if !h.checkCurrentPassword(c, user, input.CurrentPassword) {
+		return
+	}
+
+	secret, uri, err := utils.GenerateTOTPSecret(user.Username)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate secret"})
+		return
+	}
+	if err := h.userRepo.SetTOTPSecret(user.ID, secret); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to start two-factor setup"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"secret":      secret,
+		"otpauth_uri": uri,
+	})
+}
+
+// ConfirmTwoFactor turns on two-factor login once the user proves their
+// authenticator works, and returns their recovery codes. The codes are only
+// ever shown here.
+func (h *AuthHandler) ConfirmTwoFactor(c *gin.Context) {
+	var input struct {
+		Code string `json:"code" binding:"required"`
+	}
+
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	user, ok := h.currentUser(c)
+	if !ok {
+		return
+	}
+	if user.TOTPEnabledAt != nil {
+		c.JSON(http.StatusConflict, gin.H{"error": "Two-factor authentication is already enabled"})
+		return
+	}
+	if user.TOTPSecret == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Start two-factor setup first"})
+		return
+	}
+
+	step, valid := utils.ValidateTOTP(user.TOTPSecret, input.Code, time.Now())
+	if !valid {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid code"})
+		return
+	}
+
+	codes, err := utils.GenerateRecoveryCodes(recoveryCodeCount)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate recovery codes"})
+		return
+	}
+	hashes := make([]string, len(codes))
+	for i, code := range codes {
+		hashes[i] = utils.HashRecoveryCode(code)
+	}
+	if err := h.codeRepo.ReplaceForUser(user.ID, hashes); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to store recovery codes"})
+		return
+	}
+
+	// The confirming code cannot be replayed to sign in
+	if _, err := h.userRepo.UseTOTPStep(user.ID, step); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to enable two-factor authentication"})
+		return
+	}
+	if err := h.userRepo.EnableTOTP(user.ID, time.Now()); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to enable two-factor authentication"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message":        "Two-factor authentication enabled",
+		"recovery_codes": codes,
+	})
+}
+
+// DisableTwoFactor turns off two-factor login. The user signs in again to
+// do it, with their password and a code, so a stolen access token is not
+// enough.
+func (h *AuthHandler) DisableTwoFactor(c *gin.Context) {
+	var input struct {
+		Password string `json:"password" binding:"required"`
+		Code     string `json:"code" binding:"required"`
+	}
+
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	user, ok := h.currentUser(c)
+	if !ok {
+		return
+	}
+	if user.TOTPEnabledAt == nil {
+		c.JSON(http.StatusConflict, gin.H{"error": "Two-factor authentication is not enabled"})
+		return
+	}
+
+	if !h.checkCurrentPasswordStep(c, user, input.Password) {
+		return
+	}
+
+	// Wrong codes count against the account and IP just as failed logins do
+	if wait := h.Throttle.Attempt(user.Username, c.ClientIP()); wait > 0 {
+		tooManyAttempts(c, wait)
+		return
+	}
+	valid, err := h.checkSecondFactor(user, input.Code)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to verify code"})
+		return
+	}
+	if !valid {
+		h.Throttle.RecordFailure(user.Username, c.ClientIP())
+		c.JSON(http.StatusForbidden, gin.H{"error": "Invalid code"})
+		return
+	}
+	h.Throttle.RecordSuccess(user.Username, c.ClientIP())
+
+	if err := h.userRepo.DisableTOTP(user.ID); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to disable two-factor authentication"})
+		return
+	}
+	if err := h.codeRepo.DeleteForUser(user.ID); err != nil {
+		log.Printf("Error deleting recovery codes of user %d: %v", user.ID, err)
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Two-factor authentication disabled"})
+}
+
+// VerifyTwoFactor finishes a two-factor login, exchanging the challenge
+// token from Login and a TOTP or recovery code for a session
+func (h *AuthHandler) VerifyTwoFactor(c *gin.Context) {
+	var input struct {
+		ChallengeToken string `json:"challenge_token" binding:"required"`
+		Code           string `json:"code" binding:"required"`
+	}
+
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	challenge, err := h.tokenRepo.FindValid(models.TokenPurposeLoginChallenge, utils.HashOpaqueToken(input.ChallengeToken))
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid or expired challenge"})
+		return
+	}
+	user, err := h.userRepo.FindByID(challenge.UserID)
+	if err != nil || user.TOTPEnabledAt == nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid or expired challenge"})
+		return
+	}
+	if accountDisabled(c, user) {
+		return
+	}
+
+	// Wrong codes count against the account and IP just as wrong passwords do
+	if wait := h.Throttle.Attempt(user.Username, c.ClientIP()); wait > 0 {
+		tooManyAttempts(c, wait)
+		return
+	}
+
+	valid, err := h.checkSecondFactor(user, input.Code)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to verify code"})
+		return
+	}
+	if !valid {
+		h.Throttle.RecordFailure(user.Username, c.ClientIP())
+
+		// Too many wrong codes and the password has to be entered again
+		attempts, err := h.tokenRepo.RecordFailedAttempt(challenge.ID)
+		if err != nil || attempts >= maxChallengeAttempts {
+			h.tokenRepo.Use(challenge.ID)
+		}
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid code"})
+		return
+	}
+
+	if used, err := h.tokenRepo.Use(challenge.ID); err != nil || !used {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid or expired challenge"})
+		return
+	}
+	h.Throttle.RecordSuccess(user.Username, c.ClientIP())
+
+	// Start a session for this device
+	response, err := h.startSession(c, user)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate token"})
+		return
+	}
+
+	response["user"] = userPayload(user)
+	c.JSON(http.StatusOK, response)
+}
+
+// startTwoFactorChallenge answers a correct password from a user with
+// two-factor login on, handing out the challenge token that VerifyTwoFactor
+// takes along with their code
+func (h *AuthHandler) startTwoFactorChallenge(c *gin.Context, user *models.User) {
+	token, hash, err := utils.GenerateOpaqueToken()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate token"})
+		return
+	}
+	err = h.tokenRepo.Create(&models.AccountToken{
+		UserID:    user.ID,
+		Purpose:   models.TokenPurposeLoginChallenge,
+		TokenHash: hash,
+		Email:     user.Email,
+		ExpiresAt: time.Now().Add(challengeTTL),
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate token"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"two_factor_required": true,
+		"challenge_token":     token,
+		"expires_in":          int(challengeTTL.Seconds()),
+	})
+}
+
+// checkSecondFactor checks a TOTP code, or failing that a recovery code.
+// Either works only once.
+func (h *AuthHandler) checkSecondFactor(user *models.User, code string) (bool, error) {
+	if step, ok := utils.ValidateTOTP(user.TOTPSecret, code, time.Now()); ok {
+		return h.userRepo.UseTOTPStep(user.ID, step)
+	}
+	return h.codeRepo.Use(user.ID, utils.HashRecoveryCode(code))
+}
+
+// currentUser loads the authenticated user, answering the request itself if
+// it cannot
+func (h *AuthHandler) currentUser(c *gin.Context) (*models.User, bool) {
+	userID, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return nil, false
+	}
+
+	user, err := h.userRepo.FindByID(userID.(uint))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+		return nil, false
+	}
+	return user, true
+}
@@ -0,0 +1,197 @@
+package handlers
+
+import (
+	"GoChatApp/middleware"
+	"GoChatApp/models"
+	"GoChatApp/repositories"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/pquerna/otp/totp"
+	"gorm.io/gorm"
+)
+
+// setupTwoFactorRouter serves login and the two-factor routes
+func setupTwoFactorRouter(db *gorm.DB) *gin.Engine {
+	sessionRepo := repositories.NewSessionRepository(db)
+	handler := NewAuthHandler(repositories.NewUserRepository(db), sessionRepo, repositories.NewAccountTokenRepository(db), repositories.NewRecoveryCodeRepository(db), repositories.NewPersonalAccessTokenRepository(db), &recordingMailer{}, nil)
+
+	router := gin.New()
+	router.POST("/register", handler.Register)
+	router.POST("/login", handler.Login)
+	router.POST("/login/2fa", handler.VerifyTwoFactor)
+
+	protected := router.Group("/")
+	protected.Use(middleware.AuthMiddleware(sessionRepo, nil))
+	protected.POST("/2fa/setup", handler.SetupTwoFactor)
+	protected.POST("/2fa/confirm", handler.ConfirmTwoFactor)
+	protected.POST("/2fa/disable", handler.DisableTwoFactor)
+	return router
+}
+
+// enrollTwoFactor turns on two-factor login and returns the secret, the
+// code it was confirmed with and the recovery codes
+func enrollTwoFactor(t *testing.T, router *gin.Engine, accessToken string) (secret, confirmed string, recovery []string) {
+	t.Helper()
+	w, response := doJSON(router, "POST", "/2fa/setup", accessToken, map[string]string{"current_password": "password123"})
+	if w.Code != http.StatusOK {
+		t.Fatalf("Failed to start setup: %d %s", w.Code, w.Body.String())
+	}
+	secret = response["secret"].(string)
+
+	confirmed, _ = totp.GenerateCode(secret, time.Now())
+	w, response = doJSON(router, "POST", "/2fa/confirm", accessToken, map[string]string{"code": confirmed})
+	if w.Code != http.StatusOK {
+		t.Fatalf("Failed to confirm: %d %s", w.Code, w.Body.String())
+	}
+
+	for _, code := range response["recovery_codes"].([]interface{}) {
+		recovery = append(recovery, code.(string))
+	}
+	return secret, confirmed, recovery
+}
+
+// startChallenge logs in with the password and returns the challenge token
+func startChallenge(t *testing.T, router *gin.Engine, username string) string {
+	t.Helper()
+	w, response := doJSON(router, "POST", "/login", "", map[string]string{"username": username, "password": "password123"})
+	if w.Code != http.StatusOK || response["two_factor_required"] != true {
+		t.Fatalf("Expected a two-factor challenge, got %d %s", w.Code, w.Body.String())
+	}
+	if _, ok := response["token"]; ok {
+		t.Fatal("Expected no access token before the second factor")
+	}
+	return response["challenge_token"].(string)
+}
+
+func TestTwoFactor_LoginWithCode(t *testing.T) {
+	db := setupTestDB(t)
+	router := setupTwoFactorRouter(db)
+	accessToken, _ := registerSession(t, router, "careful")
+
+	// Codes are checked before enabling
+	doJSON(router, "POST", "/2fa/setup", accessToken, map[string]string{"current_password": "password123"})
+	if w, _ := doJSON(router, "POST", "/2fa/confirm", accessToken, map[string]string{"code": "000000"}); w.Code != http.StatusBadRequest {
+		t.Errorf("Expected a wrong code to be rejected, got %d", w.Code)
+	}
+
+	secret, confirmed, codes := enrollTwoFactor(t, router, accessToken)
+	if len(codes) != recoveryCodeCount {
+		t.Errorf("Expected %d recovery codes, got %d", recoveryCodeCount, len(codes))
+	}
+
+	// The confirming code cannot be replayed
+	challenge := startChallenge(t, router, "careful")
+	if w, _ := doJSON(router, "POST", "/login/2fa", "", map[string]string{"challenge_token": challenge, "code": confirmed}); w.Code != http.StatusUnauthorized {
+		t.Errorf("Expected a used code to be rejected, got %d", w.Code)
+	}
+
+	// A code from the next period works
+	code, _ := totp.GenerateCode(secret, time.Now().Add(30*time.Second))
+	w, response := doJSON(router, "POST", "/login/2fa", "", map[string]string{"challenge_token": challenge, "code": code})
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d. Body: %s", w.Code, w.Body.String())
+	}
+	if response["token"] == nil || response["refresh_token"] == nil {
+		t.Error("Expected session tokens")
+	}
+	if user := response["user"].(map[string]interface{}); user["two_factor_enabled"] != true {
+		t.Errorf("Expected two_factor_enabled, got %v", user)
+	}
+
+	// Challenges are single use
+	if w, _ := doJSON(router, "POST", "/login/2fa", "", map[string]string{"challenge_token": challenge, "code": codes[0]}); w.Code != http.StatusUnauthorized {
+		t.Errorf("Expected a used challenge to be rejected, got %d", w.Code)
+	}
+}
+
+func TestTwoFactor_RecoveryCodesAreSingleUse(t *testing.T) {
+	db := setupTestDB(t)
+	router := setupTwoFactorRouter(db)
+	accessToken, _ := registerSession(t, router, "phoneless")
+	_, _, codes := enrollTwoFactor(t, router, accessToken)
+
+	challenge := startChallenge(t, router, "phoneless")
+	if w, _ := doJSON(router, "POST", "/login/2fa", "", map[string]string{"challenge_token": challenge, "code": codes[0]}); w.Code != http.StatusOK {
+		t.Fatalf("Expected a recovery code to work, got %d", w.Code)
+	}
+
+	challenge = startChallenge(t, router, "phoneless")
+	if w, _ := doJSON(router, "POST", "/login/2fa", "", map[string]string{"challenge_token": challenge, "code": codes[0]}); w.Code != http.StatusUnauthorized {
+		t.Errorf("Expected a used recovery code to be rejected, got %d", w.Code)
+	}
+}
+
+func TestTwoFactor_ChallengeAttemptsLimited(t *testing.T) {
+	db := setupTestDB(t)
+	router := setupTwoFactorRouter(db)
+	accessToken, _ := registerSession(t, router, "guessed")
+	_, _, codes := enrollTwoFactor(t, router, accessToken)
+
+	challenge := startChallenge(t, router, "guessed")
+	for i := 0; i < maxChallengeAttempts; i++ {
+		doJSON(router, "POST", "/login/2fa", "", map[string]string{"challenge_token": challenge, "code": "123456"})
+	}
+
+	if w, _ := doJSON(router, "POST", "/login/2fa", "", map[string]string{"challenge_token": challenge, "code": codes[0]}); w.Code != http.StatusUnauthorized {
+		t.Errorf("Expected the challenge to be used up, got %d", w.Code)
+	}
+}
+
+func TestTwoFactor_DisableRequiresReauthentication(t *testing.T) {
+	db := setupTestDB(t)
+	router := setupTwoFactorRouter(db)
+	accessToken, _ := registerSession(t, router, "relaxed")
+	_, _, codes := enrollTwoFactor(t, router, accessToken)
+
+	if w, _ := doJSON(router, "POST", "/2fa/disable", accessToken, map[string]string{"password": "wrong", "code": codes[0]}); w.Code != http.StatusForbidden {
+		t.Errorf("Expected a wrong password to be rejected, got %d", w.Code)
+	}
+	if w, _ := doJSON(router, "POST", "/2fa/disable", accessToken, map[string]string{"password": "password123", "code": "000000"}); w.Code != http.StatusForbidden {
+		t.Errorf("Expected a wrong code to be rejected, got %d", w.Code)
+	}
+	if w, _ := doJSON(router, "POST", "/2fa/disable", accessToken, map[string]string{"password": "password123", "code": codes[1]}); w.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d", w.Code)
+	}
+
+	// The password alone signs in again
+	w, response := doJSON(router, "POST", "/login", "", map[string]string{"username": "relaxed", "password": "password123"})
+	if w.Code != http.StatusOK || response["token"] == nil {
+		t.Errorf("Expected a plain login, got %d %s", w.Code, w.Body.String())
+	}
+}
+
+func TestTwoFactor_SetupRequiresPassword(t *testing.T) {
+	db := setupTestDB(t)
+	router := setupTwoFactorRouter(db)
+	accessToken, _ := registerSession(t, router, "owner")
+
+	if w, _ := doJSON(router, "POST", "/2fa/setup", accessToken, nil); w.Code != http.StatusBadRequest {
+		t.Errorf("Expected a missing password to be rejected, got %d", w.Code)
+	}
+	if w, _ := doJSON(router, "POST", "/2fa/setup", accessToken, map[string]string{"current_password": "wrong"}); w.Code != http.StatusForbidden {
+		t.Errorf("Expected a wrong password to be rejected, got %d", w.Code)
+	}
+
+	var user models.User
+	db.Where("username = ?", "owner").First(&user)
+	if user.TOTPSecret != "" {
+		t.Error("Expected no secret to be stored without the password")
+	}
+}
+
+func TestTwoFactor_DisableWithoutPassword(t *testing.T) {
+	db := setupTestDB(t)
+	router := setupTwoFactorRouter(db)
+	accessToken, _ := registerSession(t, router, "federated")
+	_, _, codes := enrollTwoFactor(t, router, accessToken)
+
+	// Accounts made through single sign-on have no password to check
+	db.Model(&models.User{}).Where("username = ?", "federated").Update("password_hash", "")
+
+	if w, _ := doJSON(router, "POST", "/2fa/disable", accessToken, map[string]string{"password": "anything", "code": codes[0]}); w.Code != http.StatusBadRequest {
+		t.Errorf("Expected status 400 for an account without a password, got %d", w.Code)
+	}
+}
@@ -0,0 +1,86 @@
+package handlers
+
+import (
+	"encoding/json"
+	"sync"
+)
+
+// Kinds of broker messages
+const (
+	BrokerKindAll        = "all"         // Frame for every connected client
+	BrokerKindRoom       = "room"        // Frame for subscribers of RoomID
+	BrokerKindUser       = "user"        // Frame for every connection of UserID, or DeviceID only
+	BrokerKindUsers      = "users"       // Frame for every connection of each of UserIDs
+	BrokerKindRevokeRoom = "revoke_room" // Cut UserID's subscriptions to RoomID
+	BrokerKindJoinRoom   = "join_room"   // Subscribe UserID's connections to RoomID
+	BrokerKindPresence   = "presence"    // UserID's status on Instance changed
+	BrokerKindTyping     = "typing"      // UserID started or stopped typing in RoomID
+	BrokerKindDisconnect = "disconnect"  // Close every connection of UserID
+
+	BrokerKindPresenceSnapshot = "presence_snapshot" // Every status held by Instance, sent as a heartbeat
+	BrokerKindPresenceSync     = "presence_sync"     // Instance started and wants everyone's snapshot
+)
+
+// BrokerMessage is what travels between hub instances. Every hub delivers
+// the messages it receives to its own local clients.
+type BrokerMessage struct {
+	Kind      string          `json:"kind"`
+	RoomID    uint            `json:"room_id,omitempty"`
+	UserID    uint            `json:"user_id,omitempty"`
+	UserIDs   []uint          `json:"user_ids,omitempty"`
+	MessageID uint            `json:"message_id,omitempty"` // Stored message carried by the frame, 0 if none
+	DeviceID  string          `json:"device_id,omitempty"`  // Single device of UserID, empty for all
+	SessionID uint            `json:"session_id,omitempty"` // Single session of UserID, 0 for all
+	Instance  string          `json:"instance,omitempty"`   // Publishing instance, for presence
+	Payload   json.RawMessage `json:"payload,omitempty"`
+}
+
+// Broker fans hub traffic out to every server instance, including the one
+// that published it. Publish must not be called while holding Hub.mu, since
+// a broker may deliver synchronously.
+type Broker interface {
+	Publish(msg BrokerMessage) error
+	Subscribe(handler func(BrokerMessage)) error
+	Close() error
+}
+
+// MemoryBroker delivers messages within a single process
+type MemoryBroker struct {
+	mu       sync.RWMutex
+	handlers []func(BrokerMessage)
+}
+
+// NewMemoryBroker creates a broker for single-instance deployments
+func NewMemoryBroker() *MemoryBroker {
+	return &MemoryBroker{}
+}
+
+// Publish delivers a message to every subscriber before returning
+func (b *MemoryBroker) Publish(msg BrokerMessage) error {
+	b.mu.RLock()
+	handlers := b.handlers
+	b.mu.RUnlock()
+
+	for _, handler := range handlers {
+		handler(msg)
+	}
+	return nil
+}
+
+// Subscribe registers a handler for published messages
+func (b *MemoryBroker) Subscribe(handler func(BrokerMessage)) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.handlers = append(b.handlers, handler)
+	return nil
+}
+
+// Close drops all subscribers
+func (b *MemoryBroker) Close() error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.handlers = nil
+	return nil
+}
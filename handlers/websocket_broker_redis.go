@@ -0,0 +1,76 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// defaultRedisChannel is the pub/sub channel shared by all hub instances
+const defaultRedisChannel = "gochat:hub"
+
+// RedisBroker shares hub traffic between server instances over Redis pub/sub
+type RedisBroker struct {
+	client  *redis.Client
+	channel string
+	pubsub  *redis.PubSub
+}
+
+// NewRedisBroker connects to Redis at the given URL (redis://host:port/db)
+func NewRedisBroker(url string) (*RedisBroker, error) {
+	opts, err := redis.ParseURL(url)
+	if err != nil {
+		return nil, err
+	}
+
+	client := redis.NewClient(opts)
+	if err := client.Ping(context.Background()).Err(); err != nil {
+		client.Close()
+		return nil, err
+	}
+
+	return &RedisBroker{client: client, channel: defaultRedisChannel}, nil
+}
+
+// Publish sends a message to every subscribed instance
+func (b *RedisBroker) Publish(msg BrokerMessage) error {
+	data, err := json.Marshal(msg)
+	if err != nil {
+		return err
+	}
+	return b.client.Publish(context.Background(), b.channel, data).Err()
+}
+
+// Subscribe starts delivering published messages to handler. It returns once
+// the subscription is active so no messages published afterwards are missed.
+func (b *RedisBroker) Subscribe(handler func(BrokerMessage)) error {
+	ctx := context.Background()
+	pubsub := b.client.Subscribe(ctx, b.channel)
+	if _, err := pubsub.Receive(ctx); err != nil {
+		pubsub.Close()
+		return err
+	}
+	b.pubsub = pubsub
+
+	go func() {
+		for redisMsg := range pubsub.Channel() {
+			var msg BrokerMessage
+			if err := json.Unmarshal([]byte(redisMsg.Payload), &msg); err != nil {
+				log.Printf("Error decoding broker message: %v", err)
+				continue
+			}
+			handler(msg)
+		}
+	}()
+	return nil
+}
+
+// Close stops the subscription and closes the connection
+func (b *RedisBroker) Close() error {
+	if b.pubsub != nil {
+		b.pubsub.Close()
+	}
+	return b.client.Close()
+}
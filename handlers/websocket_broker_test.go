@@ -0,0 +1,346 @@
+package handlers
+
+import (
+	"GoChatApp/events"
+	"GoChatApp/models"
+	"GoChatApp/repositories"
+	"encoding/json"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+)
+
+// startTestHub creates a hub on the given broker and starts it
+func startTestHub(t *testing.T, broker Broker) *Hub {
+	hub := NewHub(nil, nil, nil, nil, broker)
+	if err := broker.Subscribe(hub.deliver); err != nil {
+		t.Fatalf("Failed to subscribe hub: %v", err)
+	}
+	go hub.Run()
+	return hub
+}
+
+// registerTestClient registers a socketless client with the hub
+func registerTestClient(hub *Hub, userID uint, username string) *Client {
+	return registerBufferedClient(hub, userID, username, 256)
+}
+
+// registerBufferedClient registers a socketless client whose send buffer
+// holds size frames
+func registerBufferedClient(hub *Hub, userID uint, username string, size int) *Client {
+	client := &Client{
+		Hub:             hub,
+		Send:            make(chan *Frame, size),
+		UserID:          userID,
+		Username:        username,
+		Rooms:           make(map[uint]bool),
+		replaying:       make(map[uint][]RoomMessage),
+		replayedThrough: make(map[uint]uint),
+		typing:          make(map[uint]time.Time),
+	}
+	hub.Register <- client
+	return client
+}
+
+// expectFrame waits for a frame of the given type on a client's send buffer
+func expectFrame(t *testing.T, client *Client, frameType string) map[string]interface{} {
+	t.Helper()
+	timeout := time.After(2 * time.Second)
+	for {
+		select {
+		case data := <-client.Send:
+			var frame map[string]interface{}
+			if err := json.Unmarshal(data.JSON(), &frame); err != nil {
+				t.Fatalf("Invalid frame %s: %v", data.JSON(), err)
+			}
+			if frame["type"] == frameType {
+				return frame
+			}
+		case <-timeout:
+			t.Fatalf("Timed out waiting for %q frame", frameType)
+		}
+	}
+}
+
+// expectNoFrame checks that no frame of the given type arrives shortly
+func expectNoFrame(t *testing.T, client *Client, frameType string) {
+	t.Helper()
+	timeout := time.After(200 * time.Millisecond)
+	for {
+		select {
+		case data := <-client.Send:
+			var frame map[string]interface{}
+			json.Unmarshal(data.JSON(), &frame)
+			if frame["type"] == frameType {
+				t.Fatalf("Unexpected %q frame: %s", frameType, data.JSON())
+			}
+		case <-timeout:
+			return
+		}
+	}
+}
+
+// recordingBroker is a MemoryBroker that keeps what was published
+type recordingBroker struct {
+	*MemoryBroker
+	mu   sync.Mutex
+	sent []BrokerMessage
+}
+
+func (b *recordingBroker) Publish(msg BrokerMessage) error {
+	b.mu.Lock()
+	b.sent = append(b.sent, msg)
+	b.mu.Unlock()
+	return b.MemoryBroker.Publish(msg)
+}
+
+// published returns the messages of the given kind published so far
+func (b *recordingBroker) published(kind string) []BrokerMessage {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	var msgs []BrokerMessage
+	for _, msg := range b.sent {
+		if msg.Kind == kind {
+			msgs = append(msgs, msg)
+		}
+	}
+	return msgs
+}
+
+// waitFor polls a condition until it holds or the test times out
+func waitFor(t *testing.T, condition func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(2 * time.Second)
+	for !condition() {
+		if time.Now().After(deadline) {
+			t.Fatal("Timed out waiting for condition")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestMemoryBroker_DeliversToAllSubscribers(t *testing.T) {
+	broker := NewMemoryBroker()
+
+	var got []BrokerMessage
+	broker.Subscribe(func(msg BrokerMessage) { got = append(got, msg) })
+	broker.Subscribe(func(msg BrokerMessage) { got = append(got, msg) })
+
+	broker.Publish(BrokerMessage{Kind: BrokerKindAll, Payload: []byte(`{"type":"ping"}`)})
+
+	if len(got) != 2 {
+		t.Fatalf("Expected 2 deliveries, got %d", len(got))
+	}
+	if string(got[0].Payload) != `{"type":"ping"}` {
+		t.Errorf("Unexpected payload %s", got[0].Payload)
+	}
+}
+
+func TestRedisBroker_SharesHubAcrossInstances(t *testing.T) {
+	redisServer := miniredis.RunT(t)
+
+	brokerA, err := NewRedisBroker("redis://" + redisServer.Addr())
+	if err != nil {
+		t.Fatalf("Failed to create broker A: %v", err)
+	}
+	defer brokerA.Close()
+	brokerB, err := NewRedisBroker("redis://" + redisServer.Addr())
+	if err != nil {
+		t.Fatalf("Failed to create broker B: %v", err)
+	}
+	defer brokerB.Close()
+
+	hubA := startTestHub(t, brokerA)
+	hubB := startTestHub(t, brokerB)
+
+	alice := registerTestClient(hubA, 1, "alice")
+	bob := registerTestClient(hubB, 2, "bob")
+
+	// Presence announced on one instance reaches the other
+	waitFor(t, func() bool { return hubA.PresenceOf(bob.UserID) == PresenceOnline })
+	waitFor(t, func() bool { return hubB.PresenceOf(alice.UserID) == PresenceOnline })
+
+	// Room traffic
+	hubB.JoinRoom(bob, 7, 0)
+	expectFrame(t, bob, EventRoomUserJoined)
+	hubA.BroadcastToRoom(7, []byte(`{"type":"chat","room_id":7}`))
+	if frame := expectFrame(t, bob, EventChat); frame["room_id"] != float64(7) {
+		t.Errorf("Expected room 7 chat, got %v", frame)
+	}
+	expectNoFrame(t, alice, EventChat)
+
+	// User-targeted traffic
+	hubA.BroadcastToUser(2, []byte(`{"type":"notice"}`))
+	expectFrame(t, bob, "notice")
+	expectNoFrame(t, alice, "notice")
+
+	// Several users at once
+	hubB.SendToUsers([]uint{1, 2}, map[string]string{"type": "group_notice"})
+	expectFrame(t, alice, "group_notice")
+	expectFrame(t, bob, "group_notice")
+
+	// Membership revoked on one instance cuts the subscription on the other
+	hubA.RemoveUserFromRoom(2, 7)
+	expectFrame(t, bob, EventRoomUserLeft)
+	time.Sleep(50 * time.Millisecond)
+	if hubB.IsSubscribed(bob, 7) {
+		t.Error("Subscription should be cut on every instance")
+	}
+}
+
+func TestRedisBroker_NewInstanceLearnsPresence(t *testing.T) {
+	redisServer := miniredis.RunT(t)
+
+	brokerA, err := NewRedisBroker("redis://" + redisServer.Addr())
+	if err != nil {
+		t.Fatalf("Failed to create broker A: %v", err)
+	}
+	defer brokerA.Close()
+	hubA := startTestHub(t, brokerA)
+	alice := registerTestClient(hubA, 1, "alice")
+	waitFor(t, func() bool { return hubA.PresenceOf(alice.UserID) == PresenceOnline })
+
+	// An instance started later asks for the statuses it missed
+	brokerB, err := NewRedisBroker("redis://" + redisServer.Addr())
+	if err != nil {
+		t.Fatalf("Failed to create broker B: %v", err)
+	}
+	defer brokerB.Close()
+	hubB := startTestHub(t, brokerB)
+	waitFor(t, func() bool { return hubB.PresenceOf(alice.UserID) == PresenceOnline })
+}
+
+func TestHub_PresenceExpiresWithoutHeartbeat(t *testing.T) {
+	broker := NewMemoryBroker()
+	hub := startTestHub(t, broker)
+	bob := registerTestClient(hub, 2, "bob")
+	waitFor(t, func() bool { return hub.PresenceOf(bob.UserID) == PresenceOnline })
+
+	// Another instance announces alice, then crashes
+	online, _ := json.Marshal(PresenceEvent{Type: EventPresence, UserID: 1, Username: "alice", Status: PresenceOnline})
+	broker.Publish(BrokerMessage{Kind: BrokerKindPresence, UserID: 1, Instance: "crashed", Payload: online})
+	if status := hub.PresenceOf(1); status != PresenceOnline {
+		t.Fatalf("Expected alice online, got %s", status)
+	}
+
+	hub.expirePresence(time.Now().Add(presenceTTL / 2))
+	if status := hub.PresenceOf(1); status != PresenceOnline {
+		t.Errorf("Expected alice online within the TTL, got %s", status)
+	}
+
+	// This instance's own heartbeat keeps bob, but alice is dropped
+	hub.presenceMu.RLock()
+	aliceExpiry := hub.presence[1]["crashed"].expiresAt
+	hub.presenceMu.RUnlock()
+	time.Sleep(10 * time.Millisecond)
+	hub.publishPresenceSnapshot()
+	hub.expirePresence(aliceExpiry)
+	if status := hub.PresenceOf(1); status != PresenceOffline {
+		t.Errorf("Expected alice offline once her instance went quiet, got %s", status)
+	}
+	if status := hub.PresenceOf(bob.UserID); status != PresenceOnline {
+		t.Errorf("Expected bob to stay online, got %s", status)
+	}
+}
+
+func TestHub_ExpiredPresenceRecordsLastSeen(t *testing.T) {
+	userRepo := repositories.NewUserRepository(setupTestDB(t))
+	alice := &models.User{Username: "alice", Email: "alice@example.com", PasswordHash: "hash"}
+	userRepo.Create(alice)
+
+	broker := NewMemoryBroker()
+	hub := NewHub(nil, nil, userRepo, nil, broker)
+	if err := broker.Subscribe(hub.deliver); err != nil {
+		t.Fatalf("Failed to subscribe hub: %v", err)
+	}
+
+	// The instance holding alice's socket crashes before saying goodbye
+	online, _ := json.Marshal(PresenceEvent{Type: EventPresence, UserID: alice.ID, Username: "alice", Status: PresenceOnline})
+	broker.Publish(BrokerMessage{Kind: BrokerKindPresence, UserID: alice.ID, Instance: "crashed", Payload: online})
+	hub.presenceMu.RLock()
+	expiry := hub.presence[alice.ID]["crashed"].expiresAt
+	hub.presenceMu.RUnlock()
+
+	hub.expirePresence(expiry)
+	stored, err := userRepo.FindByID(alice.ID)
+	if err != nil {
+		t.Fatalf("Failed to load alice: %v", err)
+	}
+	if stored.LastSeenAt == nil || !stored.LastSeenAt.Equal(expiry.Add(-presenceTTL)) {
+		t.Errorf("Expected last_seen_at at alice's last heartbeat, got %v", stored.LastSeenAt)
+	}
+}
+
+func TestHub_OnlyActivityFramesKeepUserOnline(t *testing.T) {
+	hub := startTestHub(t, NewMemoryBroker())
+	alice := registerTestClient(hub, 1, "alice")
+	waitFor(t, func() bool { return hub.PresenceOf(alice.UserID) == PresenceOnline })
+
+	idle := func() {
+		hub.mu.Lock()
+		alice.lastActive = time.Now().Add(-awayAfter)
+		hub.mu.Unlock()
+	}
+
+	// Heartbeats from old clients, garbage and unknown frames are not activity
+	idle()
+	alice.handleFrame([]byte(`{"type":"ping"}`))
+	alice.handleFrame([]byte(`not json`))
+	hub.refreshPresence()
+	if status := hub.PresenceOf(alice.UserID); status != PresenceAway {
+		t.Fatalf("Expected alice away, got %s", status)
+	}
+
+	alice.handleFrame([]byte(`{"type":"activity"}`))
+	if status := hub.PresenceOf(alice.UserID); status != PresenceOnline {
+		t.Errorf("Expected an activity frame to bring alice back, got %s", status)
+	}
+}
+
+func TestHub_PresenceSnapshotReplacesInstanceStatuses(t *testing.T) {
+	broker := NewMemoryBroker()
+	hub := startTestHub(t, broker)
+
+	snapshot := func(users ...PresenceEvent) {
+		payload, _ := json.Marshal(users)
+		broker.Publish(BrokerMessage{Kind: BrokerKindPresenceSnapshot, Instance: "other", Payload: payload})
+	}
+
+	snapshot(PresenceEvent{UserID: 1, Username: "alice", Status: PresenceOnline}, PresenceEvent{UserID: 2, Username: "bob", Status: PresenceAway})
+	if hub.PresenceOf(1) != PresenceOnline || hub.PresenceOf(2) != PresenceAway {
+		t.Fatalf("Expected the snapshot's statuses, got %s %s", hub.PresenceOf(1), hub.PresenceOf(2))
+	}
+
+	// A user missing from the next snapshot went offline there
+	snapshot(PresenceEvent{UserID: 2, Username: "bob", Status: PresenceOnline})
+	if hub.PresenceOf(1) != PresenceOffline || hub.PresenceOf(2) != PresenceOnline {
+		t.Errorf("Expected alice offline and bob online, got %s %s", hub.PresenceOf(1), hub.PresenceOf(2))
+	}
+}
+
+func TestHub_DirectMessageEventReachesParticipantsOnly(t *testing.T) {
+	hub := startTestHub(t, NewMemoryBroker())
+	alice := registerTestClient(hub, 1, "alice")
+	bob := registerTestClient(hub, 2, "bob")
+	carol := registerTestClient(hub, 3, "carol")
+
+	hub.HandleEvent(events.DirectMessageSent{
+		Message:        &models.DirectMessage{ID: 5, ConversationID: 9, SenderID: 1, Content: "psst"},
+		ParticipantIDs: []uint{1, 2},
+	})
+
+	expectFrame(t, alice, EventDirectMessage)
+	if frame := expectFrame(t, bob, EventDirectMessage); frame["conversation_id"] != float64(9) {
+		t.Errorf("Expected conversation 9, got %v", frame)
+	}
+	expectNoFrame(t, carol, EventDirectMessage)
+}
+
+func TestRedisBroker_InvalidURL(t *testing.T) {
+	if _, err := NewRedisBroker("not a url"); err == nil {
+		t.Error("Expected error for invalid Redis URL")
+	}
+}
@@ -1,11 +1,13 @@
 package handlers
 
 import (
+	"GoChatApp/models"
 	"encoding/json"
 	"log"
 	"time"
 
 	"github.com/gorilla/websocket"
+	"gorm.io/gorm"
 )
 
 const (
@@ -20,31 +22,73 @@ const (
 
 	// Maximum message size allowed from peer
 	maxMessageSize = 512
+
+	// Frames smaller than this are sent uncompressed
+	minCompressSize = 256
 )
 
-// MessagePayload represents the structure of incoming messages
-type MessagePayload struct {
-	Type    string `json:"type"`
-	Content string `json:"content"`
-	RoomID  uint   `json:"room_id,omitempty"`
+// Transport carries a client's frames to its device. The hub only deals with
+// Clients, so room fan-out, presence and eviction behave the same whichever
+// transport a client is connected over.
+type Transport interface {
+	// Name identifies the transport in the session frame
+	Name() string
+
+	// WritePump writes frames from client.Send until the hub closes it, then
+	// passes the client's close code on to the peer
+	WritePump(client *Client)
+
+	// Close drops the connection without flushing
+	Close() error
+}
+
+// Transport names
+const (
+	TransportWebSocket = "websocket"
+	TransportSSE       = "sse"
+)
+
+// WritePump writes the client's frames through its transport until the hub
+// closes the client
+func (c *Client) WritePump() {
+	defer func() {
+		if c.writerDone != nil {
+			close(c.writerDone)
+		}
+	}()
+	c.Transport.WritePump(c)
+}
+
+// websocketTransport carries frames over a WebSocket connection, which also
+// carries the client's inbound frames
+type websocketTransport struct {
+	conn *websocket.Conn
+}
+
+func (t *websocketTransport) Name() string {
+	return TransportWebSocket
+}
+
+func (t *websocketTransport) Close() error {
+	return t.conn.Close()
 }
 
 // ReadPump pumps messages from the WebSocket connection to the hub
-func (c *Client) ReadPump() {
+func (t *websocketTransport) ReadPump(c *Client) {
 	defer func() {
 		c.Hub.Unregister <- c
-		c.Conn.Close()
+		t.conn.Close()
 	}()
 
-	c.Conn.SetReadLimit(maxMessageSize)
-	c.Conn.SetReadDeadline(time.Now().Add(pongWait))
-	c.Conn.SetPongHandler(func(string) error {
-		c.Conn.SetReadDeadline(time.Now().Add(pongWait))
+	t.conn.SetReadLimit(maxMessageSize)
+	t.conn.SetReadDeadline(time.Now().Add(pongWait))
+	t.conn.SetPongHandler(func(string) error {
+		t.conn.SetReadDeadline(time.Now().Add(pongWait))
 		return nil
 	})
 
 	for {
-		_, message, err := c.Conn.ReadMessage()
+		messageType, message, err := t.conn.ReadMessage()
 		if err != nil {
 			if websocket.IsUnexpectedCloseError(err, websocket.CloseGoingAway, websocket.CloseAbnormalClosure) {
 				log.Printf("WebSocket error: %v", err)
@@ -52,99 +96,263 @@ func (c *Client) ReadPump() {
 			break
 		}
 
-		// Parse the incoming message
-		var payload MessagePayload
-		if err := json.Unmarshal(message, &payload); err != nil {
-			log.Printf("Error parsing message: %v", err)
-			continue
+		// Binary frames are MessagePack; handle them as their JSON equivalent
+		if messageType == websocket.BinaryMessage {
+			if message, err = msgpackToJSON(message); err != nil {
+				c.sendError(ErrCodeMalformedMsgpack, "frame is not valid MessagePack", "")
+				continue
+			}
 		}
+		c.handleFrame(message)
+	}
+}
 
-		// Handle different message types
-		switch payload.Type {
-		case "join_room":
-			if payload.RoomID > 0 {
-				c.Hub.JoinRoom(c, payload.RoomID)
-			}
-		case "leave_room":
-			if payload.RoomID > 0 {
-				c.Hub.LeaveRoom(c, payload.RoomID)
-			}
-		case "chat", "typing", "stop_typing":
-			// Create a broadcast message with user info
-			broadcastMsg := map[string]interface{}{
-				"type":      payload.Type,
-				"content":   payload.Content,
-				"user_id":   c.UserID,
-				"username":  c.Username,
-				"timestamp": time.Now(),
-			}
+// handleFrame decodes a single inbound frame and dispatches it by type.
+// Only frames the user caused count as activity for presence; malformed
+// and unknown frames do not keep an idle user online.
+func (c *Client) handleFrame(message []byte) {
+	var envelope InboundEnvelope
+	if err := json.Unmarshal(message, &envelope); err != nil {
+		c.sendError(ErrCodeMalformedJSON, "frame is not valid JSON", "")
+		return
+	}
 
-			if payload.RoomID > 0 {
-				broadcastMsg["room_id"] = payload.RoomID
-				// Send to specific room
-				if msgBytes, err := json.Marshal(broadcastMsg); err == nil {
-					c.Hub.RoomBroadcast <- RoomMessage{RoomID: payload.RoomID, Message: msgBytes}
-				}
-			} else {
-				// Broadcast to all (global chat)
-				if msgBytes, err := json.Marshal(broadcastMsg); err == nil {
-					c.Hub.Broadcast <- msgBytes
-				}
-			}
-		default:
-			// For unknown types, broadcast to all
-			broadcastMsg := map[string]interface{}{
-				"type":      payload.Type,
-				"content":   payload.Content,
-				"user_id":   c.UserID,
-				"username":  c.Username,
-				"timestamp": time.Now(),
-			}
-			if msgBytes, err := json.Marshal(broadcastMsg); err == nil {
-				c.Hub.Broadcast <- msgBytes
-			}
+	switch envelope.Type {
+	case EventJoinRoom:
+		var event JoinRoomEvent
+		if !c.decodeEvent(message, &event) {
+			return
+		}
+		c.Hub.touch(c)
+		if event.RoomID == 0 {
+			c.sendError(ErrCodeInvalidPayload, "room_id is required", event.Type)
+			return
+		}
+		if !c.authorizeRoom(event.RoomID, event.Type, "") {
+			return
+		}
+		c.Hub.JoinRoom(c, event.RoomID, event.SinceMessageID)
+	case EventLeaveRoom:
+		var event LeaveRoomEvent
+		if !c.decodeEvent(message, &event) {
+			return
 		}
+		if event.RoomID == 0 {
+			c.sendError(ErrCodeInvalidPayload, "room_id is required", event.Type)
+			return
+		}
+		c.Hub.LeaveRoom(c, event.RoomID)
+	case EventChat:
+		var event ChatEvent
+		if !c.decodeEvent(message, &event) {
+			return
+		}
+		c.Hub.touch(c)
+		c.handleChat(event)
+	case EventTyping, EventStopTyping:
+		var event TypingEvent
+		if !c.decodeEvent(message, &event) {
+			return
+		}
+		if event.Type == EventTyping {
+			c.Hub.touch(c)
+		}
+		c.handleTyping(event)
+	case EventActivity:
+		c.Hub.touch(c)
+	default:
+		c.sendError(ErrCodeUnknownType, "unknown frame type", envelope.Type)
+	}
+}
+
+// decodeEvent decodes a frame into its typed event, reporting an error frame on failure
+func (c *Client) decodeEvent(message []byte, event interface{}) bool {
+	if err := json.Unmarshal(message, event); err != nil {
+		var envelope InboundEnvelope
+		json.Unmarshal(message, &envelope)
+		c.sendError(ErrCodeInvalidPayload, "frame does not match its type", envelope.Type)
+		return false
+	}
+	return true
+}
+
+// authorizeRoom checks that the user may access a room, sending an error
+// frame when it may not
+func (c *Client) authorizeRoom(roomID uint, ref, nonce string) bool {
+	allowed, err := c.Hub.CanAccessRoom(c.UserID, roomID)
+	if err == gorm.ErrRecordNotFound {
+		c.sendErrorWithNonce(ErrCodeNotFound, "room not found", ref, nonce)
+		return false
+	}
+	if err != nil {
+		log.Printf("Error checking access to room %d for %s: %v", roomID, c.Username, err)
+		c.sendErrorWithNonce(ErrCodeInternal, "failed to check room access", ref, nonce)
+		return false
 	}
+	if !allowed {
+		c.sendErrorWithNonce(ErrCodeForbidden, "not a member of this room", ref, nonce)
+		return false
+	}
+	return true
+}
+
+// handleTyping starts or stops the user's typing indicator in a room
+func (c *Client) handleTyping(event TypingEvent) {
+	if event.RoomID == 0 {
+		c.sendError(ErrCodeInvalidPayload, "room_id is required", event.Type)
+		return
+	}
+	if !c.Hub.IsSubscribed(c, event.RoomID) {
+		c.sendError(ErrCodeForbidden, "join the room before sending to it", event.Type)
+		return
+	}
+
+	if event.Type == EventTyping {
+		c.Hub.StartTyping(c, event.RoomID)
+	} else {
+		c.Hub.StopTyping(c, event.RoomID)
+	}
+}
+
+// handleChat persists a chat message, broadcasts the stored row to the room
+// and acknowledges it to the sender
+func (c *Client) handleChat(payload ChatEvent) {
+	if payload.RoomID == 0 {
+		c.sendNack(payload.Nonce, "room_id is required")
+		return
+	}
+	if payload.Content == "" {
+		c.sendNack(payload.Nonce, "content is required")
+		return
+	}
+	if !c.Hub.IsSubscribed(c, payload.RoomID) {
+		c.sendErrorWithNonce(ErrCodeForbidden, "join the room before sending to it", payload.Type, payload.Nonce)
+		return
+	}
+	// Membership may have changed since the room was joined
+	if !c.authorizeRoom(payload.RoomID, payload.Type, payload.Nonce) {
+		return
+	}
+
+	message := models.Message{
+		UserID:  c.UserID,
+		RoomID:  payload.RoomID,
+		Content: payload.Content,
+	}
+	if err := c.Hub.messageRepo.Create(&message); err != nil {
+		log.Printf("Error saving message from %s: %v", c.Username, err)
+		c.sendNack(payload.Nonce, "failed to save message")
+		return
+	}
+
+	// Fetch the message with user and room preloaded
+	createdMessage, err := c.Hub.messageRepo.FindByID(message.ID)
+	if err != nil {
+		createdMessage = &message
+		createdMessage.User = models.User{ID: c.UserID, Username: c.Username}
+	}
+
+	c.sendJSON(AckEvent{
+		Type:      EventAck,
+		Nonce:     payload.Nonce,
+		MessageID: createdMessage.ID,
+		CreatedAt: createdMessage.CreatedAt,
+	})
+
+	// Sending the message ends the typing indicator
+	c.Hub.StopTyping(c, payload.RoomID)
+
+	broadcastMsg := ChatMessageEvent{
+		Type:    EventChat,
+		RoomID:  createdMessage.RoomID,
+		Message: createdMessage,
+	}
+	if msgBytes, err := json.Marshal(broadcastMsg); err == nil {
+		c.Hub.RoomBroadcast <- RoomMessage{RoomID: createdMessage.RoomID, MessageID: createdMessage.ID, Message: msgBytes}
+	}
+}
+
+// sendNack tells the sender that a frame could not be processed
+func (c *Client) sendNack(nonce, reason string) {
+	c.sendJSON(NackEvent{
+		Type:   EventNack,
+		Nonce:  nonce,
+		Reason: reason,
+	})
+}
+
+// sendError reports a frame that could not be processed
+func (c *Client) sendError(code, message, ref string) {
+	c.sendErrorWithNonce(code, message, ref, "")
+}
+
+// sendErrorWithNonce reports a frame that could not be processed, echoing its nonce
+func (c *Client) sendErrorWithNonce(code, message, ref, nonce string) {
+	c.sendJSON(ErrorEvent{
+		Type:    EventError,
+		Code:    code,
+		Message: message,
+		Ref:     ref,
+		Nonce:   nonce,
+	})
+}
+
+// queue encodes a frame onto the send buffer; the caller must hold Hub.mu
+// so the channel cannot be closed underneath it
+func (c *Client) queue(v interface{}) {
+	msgBytes, err := json.Marshal(v)
+	if err != nil {
+		log.Printf("Error encoding frame for %s: %v", c.Username, err)
+		return
+	}
+	c.Hub.enqueueLocked(c, newFrame(msgBytes))
+}
+
+// sendJSON queues a frame for this client only
+func (c *Client) sendJSON(v interface{}) {
+	c.Hub.mu.RLock()
+	defer c.Hub.mu.RUnlock()
+
+	c.queue(v)
 }
 
 // WritePump pumps messages from the hub to the WebSocket connection
-func (c *Client) WritePump() {
+func (t *websocketTransport) WritePump(c *Client) {
 	ticker := time.NewTicker(pingPeriod)
 	defer func() {
 		ticker.Stop()
-		c.Conn.Close()
+		t.conn.Close()
 	}()
 
 	for {
 		select {
-		case message, ok := <-c.Send:
-			c.Conn.SetWriteDeadline(time.Now().Add(writeWait))
+		case frame, ok := <-c.Send:
+			t.conn.SetWriteDeadline(time.Now().Add(writeWait))
 			if !ok {
-				// The hub closed the channel
-				c.Conn.WriteMessage(websocket.CloseMessage, []byte{})
+				// The hub closed the channel, possibly with a reason
+				var closeMsg []byte
+				if c.closeCode != 0 {
+					closeMsg = websocket.FormatCloseMessage(c.closeCode, c.closeReason)
+				}
+				t.conn.WriteMessage(websocket.CloseMessage, closeMsg)
 				return
 			}
 
-			w, err := c.Conn.NextWriter(websocket.TextMessage)
+			// Prepared once per protocol and shared by every recipient
+			prepared, err := frame.Prepared(c.Protocol)
 			if err != nil {
-				return
+				log.Printf("Error encoding frame for %s: %v", c.Username, err)
+				continue
 			}
-			w.Write(message)
-
-			// Add queued messages to the current WebSocket message
-			n := len(c.Send)
-			for i := 0; i < n; i++ {
-				w.Write([]byte{'\n'})
-				w.Write(<-c.Send)
-			}
-
-			if err := w.Close(); err != nil {
+			// Deflating tiny frames costs more than it saves
+			t.conn.EnableWriteCompression(len(frame.JSON()) >= minCompressSize)
+			if err := t.conn.WritePreparedMessage(prepared); err != nil {
 				return
 			}
 
 		case <-ticker.C:
-			c.Conn.SetWriteDeadline(time.Now().Add(writeWait))
-			if err := c.Conn.WriteMessage(websocket.PingMessage, nil); err != nil {
+			t.conn.SetWriteDeadline(time.Now().Add(writeWait))
+			if err := t.conn.WriteMessage(websocket.PingMessage, nil); err != nil {
 				return
 			}
 		}
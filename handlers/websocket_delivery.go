@@ -0,0 +1,154 @@
+package handlers
+
+import (
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// SlowConsumerPolicy decides what happens when a client's send buffer is full
+type SlowConsumerPolicy string
+
+const (
+	// Drop the oldest queued frame to make room for the new one
+	SlowConsumerDropOldest SlowConsumerPolicy = "drop_oldest"
+
+	// Close the connection with 1013 so the client reconnects and resyncs
+	SlowConsumerDisconnect SlowConsumerPolicy = "disconnect"
+)
+
+// ParseSlowConsumerPolicy parses a policy name, defaulting to disconnect
+func ParseSlowConsumerPolicy(name string) (SlowConsumerPolicy, error) {
+	switch SlowConsumerPolicy(name) {
+	case "", SlowConsumerDisconnect:
+		return SlowConsumerDisconnect, nil
+	case SlowConsumerDropOldest:
+		return SlowConsumerDropOldest, nil
+	}
+	return "", fmt.Errorf("unknown slow consumer policy %q", name)
+}
+
+// HubStats counts delivery problems since the hub started
+type HubStats struct {
+	Clients              int    `json:"clients"`
+	Policy               string `json:"slow_consumer_policy"`
+	FramesDropped        uint64 `json:"frames_dropped"`
+	SlowConsumersEvicted uint64 `json:"slow_consumers_evicted"`
+}
+
+// Stats returns the hub's delivery counters
+func (h *Hub) Stats() HubStats {
+	h.mu.RLock()
+	clients := len(h.Clients)
+	h.mu.RUnlock()
+
+	return HubStats{
+		Clients:              clients,
+		Policy:               string(h.SlowConsumerPolicy),
+		FramesDropped:        h.framesDropped.Load(),
+		SlowConsumersEvicted: h.slowConsumersEvicted.Load(),
+	}
+}
+
+// enqueueLocked puts a frame on a client's send buffer, applying the slow
+// consumer policy when it is full. The caller must hold h.mu (read or write)
+// so the buffer cannot be closed underneath it.
+func (h *Hub) enqueueLocked(client *Client, frame *Frame) {
+	if client.closed {
+		return
+	}
+
+	select {
+	case client.Send <- frame:
+		return
+	default:
+	}
+
+	if h.SlowConsumerPolicy == SlowConsumerDropOldest {
+		select {
+		case <-client.Send:
+		default:
+		}
+		h.framesDropped.Add(1)
+		select {
+		case client.Send <- frame:
+		default:
+			// Another sender took the freed slot
+			h.framesDropped.Add(1)
+		}
+		return
+	}
+
+	// Evicting needs the write lock, which the caller may not hold
+	if client.evicting.CompareAndSwap(false, true) {
+		go h.evict(client)
+	}
+}
+
+// evict disconnects a client that cannot keep up
+func (h *Hub) evict(client *Client) {
+	if h.removeClient(client, websocket.CloseTryAgainLater, "send buffer full") {
+		h.slowConsumersEvicted.Add(1)
+		log.Printf("Evicted slow client %s (ID: %d)", client.Username, client.UserID)
+	}
+}
+
+// removeClient drops a client from the hub and closes its send buffer. It
+// runs at most once per client and reports whether it did. A non-zero
+// closeCode is sent to the peer before the connection closes.
+func (h *Hub) removeClient(client *Client, closeCode int, closeReason string) bool {
+	var typingRooms []uint
+
+	h.mu.Lock()
+	if _, ok := h.Clients[client]; !ok {
+		h.mu.Unlock()
+		return false
+	}
+
+	for roomID := range client.typing {
+		typingRooms = append(typingRooms, roomID)
+	}
+	client.typing = make(map[uint]time.Time)
+
+	// Remove client from all rooms
+	for roomID := range client.Rooms {
+		if room, exists := h.Rooms[roomID]; exists {
+			delete(room, client)
+			if len(room) == 0 {
+				delete(h.Rooms, roomID)
+			}
+		}
+	}
+	delete(h.Clients, client)
+	if devices := h.Users[client.UserID]; devices != nil {
+		delete(devices, client)
+		if len(devices) == 0 {
+			delete(h.Users, client.UserID)
+		}
+	}
+
+	if client.expiry != nil {
+		client.expiry.Stop()
+	}
+	client.closed = true
+	client.closeCode = closeCode
+	client.closeReason = closeReason
+	close(client.Send)
+	log.Printf("Client unregistered: %s (ID: %d). Total clients: %d", client.Username, client.UserID, len(h.Clients))
+
+	presenceEvent, changed := h.presenceChangeLocked(client.UserID, client.Username)
+	h.mu.Unlock()
+
+	// Clear indicators left on by the closed connection
+	for _, roomID := range typingRooms {
+		h.publishTyping(EventStopTyping, roomID, client.UserID, client.Username, time.Time{})
+	}
+
+	// Announce the user going offline (only when their last connection closes)
+	if changed {
+		h.publishPresence(presenceEvent)
+	}
+	return true
+}
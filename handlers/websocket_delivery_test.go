@@ -0,0 +1,79 @@
+package handlers
+
+import (
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+func TestHub_SlowConsumerIsEvictedOnce(t *testing.T) {
+	hub := startTestHub(t, NewMemoryBroker())
+	client := registerBufferedClient(hub, 1, "slow", 1)
+	expectFrame(t, client, EventPresence)
+
+	hub.BroadcastToAll([]byte(`{"type":"one"}`))
+	hub.BroadcastToAll([]byte(`{"type":"two"}`))
+	hub.BroadcastToAll([]byte(`{"type":"three"}`))
+
+	waitFor(t, func() bool { return hub.Stats().Clients == 0 })
+
+	// The connection going away afterwards must not close Send again
+	hub.Unregister <- client
+	time.Sleep(50 * time.Millisecond)
+
+	if evicted := hub.Stats().SlowConsumersEvicted; evicted != 1 {
+		t.Errorf("Expected 1 eviction, got %d", evicted)
+	}
+	if client.closeCode != websocket.CloseTryAgainLater {
+		t.Errorf("Expected close code 1013, got %d", client.closeCode)
+	}
+
+	<-client.Send // The frame queued before the buffer filled up
+	if _, ok := <-client.Send; ok {
+		t.Error("Send should be closed after eviction")
+	}
+}
+
+func TestHub_SlowConsumerDropsOldest(t *testing.T) {
+	hub := startTestHub(t, NewMemoryBroker())
+	hub.SlowConsumerPolicy = SlowConsumerDropOldest
+	client := registerBufferedClient(hub, 1, "slow", 2)
+	expectFrame(t, client, EventPresence)
+
+	hub.BroadcastToAll([]byte(`{"type":"one"}`))
+	hub.BroadcastToAll([]byte(`{"type":"two"}`))
+	hub.BroadcastToAll([]byte(`{"type":"three"}`))
+
+	if got := string((<-client.Send).JSON()); got != `{"type":"two"}` {
+		t.Errorf("Expected oldest frame dropped, got %s first", got)
+	}
+	if got := string((<-client.Send).JSON()); got != `{"type":"three"}` {
+		t.Errorf("Expected newest frame kept, got %s", got)
+	}
+
+	stats := hub.Stats()
+	if stats.FramesDropped != 1 || stats.SlowConsumersEvicted != 0 || stats.Clients != 1 {
+		t.Errorf("Unexpected stats %+v", stats)
+	}
+}
+
+func TestParseSlowConsumerPolicy(t *testing.T) {
+	tests := []struct {
+		name    string
+		want    SlowConsumerPolicy
+		wantErr bool
+	}{
+		{"", SlowConsumerDisconnect, false},
+		{"disconnect", SlowConsumerDisconnect, false},
+		{"drop_oldest", SlowConsumerDropOldest, false},
+		{"block", "", true},
+	}
+
+	for _, tt := range tests {
+		got, err := ParseSlowConsumerPolicy(tt.name)
+		if (err != nil) != tt.wantErr || got != tt.want {
+			t.Errorf("ParseSlowConsumerPolicy(%q) = %v, %v", tt.name, got, err)
+		}
+	}
+}
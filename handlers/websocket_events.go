@@ -0,0 +1,240 @@
+package handlers
+
+import (
+	"GoChatApp/models"
+	"time"
+)
+
+// Protocol versions negotiated through the Sec-WebSocket-Protocol header.
+// Clients that do not ask for a subprotocol get ProtocolV1.
+const (
+	ProtocolV1            = "gochat.v1"
+	ProtocolV1MessagePack = "gochat.v1.msgpack" // Same frames, as binary MessagePack
+)
+
+// supportedProtocols lists protocol versions in order of preference
+var supportedProtocols = []string{ProtocolV1, ProtocolV1MessagePack}
+
+// Inbound event types (client -> server)
+const (
+	EventJoinRoom   = "join_room"
+	EventLeaveRoom  = "leave_room"
+	EventChat       = "chat"
+	EventTyping     = "typing"
+	EventStopTyping = "stop_typing"
+	EventActivity   = "activity"
+)
+
+// Outbound event types (server -> client)
+const (
+	EventAck            = "ack"
+	EventNack           = "nack"
+	EventError          = "error"
+	EventSession        = "session"
+	EventReady          = "ready"
+	EventPresence       = "presence"
+	EventRoomUserJoined = "room_user_joined"
+	EventRoomUserLeft   = "room_user_left"
+
+	EventHistoryTruncated = "history_truncated"
+	EventTypingSnapshot   = "typing_snapshot"
+
+	// Changes made over REST
+	EventReaction         = "reaction"
+	EventReadReceipt      = "read_receipt"
+	EventDirectMessage    = "direct_message"
+	EventRoomMemberJoined = "room_member_joined"
+	EventRoomMemberLeft   = "room_member_left"
+	EventUserUpdated      = "user_updated"
+)
+
+// Error codes carried by error frames
+const (
+	ErrCodeMalformedJSON    = "malformed_json"
+	ErrCodeMalformedMsgpack = "malformed_msgpack"
+	ErrCodeUnknownType      = "unknown_type"
+	ErrCodeInvalidPayload   = "invalid_payload"
+	ErrCodeForbidden        = "forbidden"
+	ErrCodeNotFound         = "not_found"
+	ErrCodeInternal         = "internal_error"
+)
+
+// InboundEnvelope is decoded first to find out which event a frame carries
+type InboundEnvelope struct {
+	Type string `json:"type"`
+}
+
+// JoinRoomEvent subscribes the connection to a room. SinceMessageID is the
+// last message the client saw; anything newer is replayed before live traffic.
+type JoinRoomEvent struct {
+	Type           string `json:"type"`
+	RoomID         uint   `json:"room_id"`
+	SinceMessageID uint   `json:"since_message_id,omitempty"`
+}
+
+// LeaveRoomEvent unsubscribes the connection from a room
+type LeaveRoomEvent struct {
+	Type   string `json:"type"`
+	RoomID uint   `json:"room_id"`
+}
+
+// ChatEvent sends a chat message to a room
+type ChatEvent struct {
+	Type    string `json:"type"`
+	RoomID  uint   `json:"room_id"`
+	Content string `json:"content"`
+	Nonce   string `json:"nonce,omitempty"` // Client-chosen ID echoed back in ack/nack frames
+}
+
+// TypingEvent starts or stops a typing indicator in a room
+type TypingEvent struct {
+	Type   string `json:"type"`
+	RoomID uint   `json:"room_id"`
+}
+
+// ChatMessageEvent carries a stored chat message to room subscribers
+type ChatMessageEvent struct {
+	Type     string          `json:"type"`
+	RoomID   uint            `json:"room_id"`
+	Message  *models.Message `json:"message"`
+	Replayed bool            `json:"replayed,omitempty"` // Sent from history on join, not live
+}
+
+// HistoryTruncatedEvent marks a replay that did not cover the whole gap.
+// Messages after SinceMessageID and before FirstMessageID were skipped.
+type HistoryTruncatedEvent struct {
+	Type           string `json:"type"`
+	RoomID         uint   `json:"room_id"`
+	SinceMessageID uint   `json:"since_message_id"`
+	FirstMessageID uint   `json:"first_message_id"`
+}
+
+// AckEvent confirms to the sender that a chat message was stored
+type AckEvent struct {
+	Type      string    `json:"type"`
+	Nonce     string    `json:"nonce"`
+	MessageID uint      `json:"message_id"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// NackEvent tells the sender that a chat message was not stored
+type NackEvent struct {
+	Type   string `json:"type"`
+	Nonce  string `json:"nonce"`
+	Reason string `json:"reason"`
+}
+
+// ErrorEvent reports a frame the server could not process
+type ErrorEvent struct {
+	Type    string `json:"type"`
+	Code    string `json:"code"`
+	Message string `json:"message"`
+	Ref     string `json:"ref,omitempty"`   // Type of the offending frame, if known
+	Nonce   string `json:"nonce,omitempty"` // Nonce of the offending chat frame, if any
+}
+
+// SessionEvent is the first frame on every connection
+type SessionEvent struct {
+	Type      string `json:"type"`
+	DeviceID  string `json:"device_id"`
+	Protocol  string `json:"protocol"`
+	Transport string `json:"transport"` // websocket or sse
+}
+
+// ReadyEvent describes a new connection's automatic subscriptions
+type ReadyEvent struct {
+	Type     string         `json:"type"`
+	Rooms    []ReadyRoom    `json:"rooms"`
+	Presence []UserPresence `json:"presence"` // The user and everyone sharing a room with them
+}
+
+// ReadyRoom is a room a connection was subscribed to on connect
+type ReadyRoom struct {
+	ID          uint         `json:"id"`
+	Name        string       `json:"name"`
+	Type        string       `json:"type"`
+	UnreadCount int64        `json:"unread_count"`
+	Typing      []TypingUser `json:"typing"`
+}
+
+// PresenceEvent announces a change in a user's status to users sharing a room
+type PresenceEvent struct {
+	Type       string     `json:"type"`
+	UserID     uint       `json:"user_id"`
+	Username   string     `json:"username"`
+	Status     string     `json:"status"`                 // online, away or offline
+	LastSeenAt *time.Time `json:"last_seen_at,omitempty"` // Set when going offline
+}
+
+// RoomMembershipEvent announces a user joining or leaving a room, either its
+// live subscription (room_user_*) or its membership (room_member_*)
+type RoomMembershipEvent struct {
+	Type     string `json:"type"`
+	RoomID   uint   `json:"room_id"`
+	UserID   uint   `json:"user_id"`
+	Username string `json:"username"`
+}
+
+// UserUpdatedEvent carries a user's new public profile to the users who
+// share a room with them, so cached names and avatars can refresh
+type UserUpdatedEvent struct {
+	Type        string `json:"type"`
+	UserID      uint   `json:"user_id"`
+	Username    string `json:"username"`
+	DisplayName string `json:"display_name"`
+	Avatar      string `json:"avatar"`
+	Bio         string `json:"bio"`
+	Timezone    string `json:"timezone"`
+	Pronouns    string `json:"pronouns"`
+}
+
+// TypingNotifyEvent relays a typing indicator to room subscribers
+type TypingNotifyEvent struct {
+	Type      string     `json:"type"`
+	RoomID    uint       `json:"room_id"`
+	UserID    uint       `json:"user_id"`
+	Username  string     `json:"username"`
+	Timestamp time.Time  `json:"timestamp"`
+	ExpiresAt *time.Time `json:"expires_at,omitempty"` // When the indicator lapses unless refreshed, typing only
+}
+
+// TypingSnapshotEvent tells a client joining a room who is already typing
+type TypingSnapshotEvent struct {
+	Type   string       `json:"type"`
+	RoomID uint         `json:"room_id"`
+	Users  []TypingUser `json:"users"`
+}
+
+// TypingUser is one entry of a typing snapshot
+type TypingUser struct {
+	UserID    uint      `json:"user_id"`
+	Username  string    `json:"username"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+// ReactionEvent announces a reaction added to or removed from a message
+type ReactionEvent struct {
+	Type      string `json:"type"`
+	RoomID    uint   `json:"room_id"`
+	MessageID uint   `json:"message_id"`
+	UserID    uint   `json:"user_id"`
+	Username  string `json:"username"`
+	Emoji     string `json:"emoji"`
+	Added     bool   `json:"added"`
+}
+
+// ReadReceiptEvent announces how far a user has read in a room
+type ReadReceiptEvent struct {
+	Type      string    `json:"type"`
+	RoomID    uint      `json:"room_id"`
+	UserID    uint      `json:"user_id"`
+	MessageID uint      `json:"message_id"`
+	ReadAt    time.Time `json:"read_at"`
+}
+
+// DirectMessageEvent carries a stored direct message to both participants
+type DirectMessageEvent struct {
+	Type           string                `json:"type"`
+	ConversationID uint                  `json:"conversation_id"`
+	Message        *models.DirectMessage `json:"message"`
+}
@@ -0,0 +1,110 @@
+package handlers
+
+import (
+	"GoChatApp/events"
+	"encoding/json"
+	"log"
+)
+
+// HandleEvent fans a domain event out to connected clients as a typed frame.
+// It is subscribed to the event bus so REST changes show up live. The user
+// behind a change counts as active, as if they had sent a frame.
+func (h *Hub) HandleEvent(event events.Event) {
+	switch e := event.(type) {
+	case events.MessageCreated:
+		h.touchUser(e.Message.UserID)
+		h.sendRoomFrame(e.Message.RoomID, e.Message.ID, ChatMessageEvent{
+			Type:    EventChat,
+			RoomID:  e.Message.RoomID,
+			Message: e.Message,
+		})
+	case events.ReactionToggled:
+		h.touchUser(e.UserID)
+		message, err := h.messageRepo.FindByID(e.MessageID)
+		if err != nil {
+			log.Printf("Error finding room of message %d: %v", e.MessageID, err)
+			return
+		}
+		h.sendRoomFrame(message.RoomID, 0, ReactionEvent{
+			Type:      EventReaction,
+			RoomID:    message.RoomID,
+			MessageID: e.MessageID,
+			UserID:    e.UserID,
+			Username:  e.Username,
+			Emoji:     e.Emoji,
+			Added:     e.Added,
+		})
+	case events.ReadReceiptUpdated:
+		h.touchUser(e.UserID)
+		h.sendRoomFrame(e.RoomID, 0, ReadReceiptEvent{
+			Type:      EventReadReceipt,
+			RoomID:    e.RoomID,
+			UserID:    e.UserID,
+			MessageID: e.MessageID,
+			ReadAt:    e.ReadAt,
+		})
+	case events.DirectMessageSent:
+		h.touchUser(e.Message.SenderID)
+		frame := DirectMessageEvent{
+			Type:           EventDirectMessage,
+			ConversationID: e.Message.ConversationID,
+			Message:        e.Message,
+		}
+		if err := h.SendToUsers(e.ParticipantIDs, frame); err != nil {
+			log.Printf("Error sending direct message %d: %v", e.Message.ID, err)
+		}
+	case events.RoomMemberJoined:
+		// Subscribe the user's connections so they see the announcement too
+		h.AddUserToRoom(e.UserID, e.RoomID)
+		h.sendRoomFrame(e.RoomID, 0, RoomMembershipEvent{
+			Type:     EventRoomMemberJoined,
+			RoomID:   e.RoomID,
+			UserID:   e.UserID,
+			Username: e.Username,
+		})
+	case events.RoomMemberLeft:
+		// Cut the user's live subscriptions before telling the room
+		h.RemoveUserFromRoom(e.UserID, e.RoomID)
+		h.sendRoomFrame(e.RoomID, 0, RoomMembershipEvent{
+			Type:     EventRoomMemberLeft,
+			RoomID:   e.RoomID,
+			UserID:   e.UserID,
+			Username: e.Username,
+		})
+	case events.UserUpdated:
+		h.touchUser(e.User.ID)
+		frame := UserUpdatedEvent{
+			Type:        EventUserUpdated,
+			UserID:      e.User.ID,
+			Username:    e.User.Username,
+			DisplayName: e.User.DisplayName,
+			Avatar:      e.User.Avatar,
+			Bio:         e.User.Bio,
+			Timezone:    e.User.Timezone,
+			Pronouns:    e.User.Pronouns,
+		}
+		// The user's own devices refresh too
+		recipients := []uint{e.User.ID}
+		roommates, err := h.roomRepo.FindRoommateIDs(e.User.ID)
+		if err != nil {
+			log.Printf("Error finding roommates of user %d: %v", e.User.ID, err)
+		}
+		if err := h.SendToUsers(append(recipients, roommates...), frame); err != nil {
+			log.Printf("Error sending profile update of user %d: %v", e.User.ID, err)
+		}
+	case events.SessionRevoked:
+		if err := h.DisconnectSession(e.UserID, e.SessionID, CloseSessionRevoked, "session revoked"); err != nil {
+			log.Printf("Error disconnecting session %d: %v", e.SessionID, err)
+		}
+	}
+}
+
+// sendRoomFrame encodes a frame and broadcasts it to a room
+func (h *Hub) sendRoomFrame(roomID, messageID uint, frame interface{}) {
+	msgBytes, err := json.Marshal(frame)
+	if err != nil {
+		log.Printf("Error encoding frame for room %d: %v", roomID, err)
+		return
+	}
+	h.broadcastRoomMessage(RoomMessage{RoomID: roomID, MessageID: messageID, Message: msgBytes})
+}
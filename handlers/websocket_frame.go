@@ -0,0 +1,120 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/json"
+	"sync"
+
+	"github.com/gorilla/websocket"
+	"github.com/vmihailenco/msgpack/v5"
+)
+
+// Frame is an outbound frame shared by every client it is delivered to. It
+// is encoded as JSON once and transcoded to MessagePack at most once, and
+// each WebSocket encoding is prepared (and compressed) once, however many
+// clients receive it.
+type Frame struct {
+	json []byte
+
+	msgpackOnce sync.Once
+	msgpack     []byte
+	msgpackErr  error
+
+	preparedMu sync.Mutex
+	prepared   map[string]*websocket.PreparedMessage // By protocol
+}
+
+// newFrame wraps a JSON-encoded frame
+func newFrame(jsonBytes []byte) *Frame {
+	return &Frame{json: jsonBytes}
+}
+
+// JSON returns the frame as JSON
+func (f *Frame) JSON() []byte {
+	return f.json
+}
+
+// MessagePack returns the frame as MessagePack, transcoding it on first use
+func (f *Frame) MessagePack() ([]byte, error) {
+	f.msgpackOnce.Do(func() {
+		f.msgpack, f.msgpackErr = jsonToMsgpack(f.json)
+	})
+	return f.msgpack, f.msgpackErr
+}
+
+// Prepared returns the frame as a WebSocket message for the given protocol.
+// Gorilla compresses a prepared message once for all connections that
+// negotiated permessage-deflate.
+func (f *Frame) Prepared(protocol string) (*websocket.PreparedMessage, error) {
+	f.preparedMu.Lock()
+	defer f.preparedMu.Unlock()
+
+	if pm, ok := f.prepared[protocol]; ok {
+		return pm, nil
+	}
+
+	messageType, data := websocket.TextMessage, f.json
+	if protocol == ProtocolV1MessagePack {
+		var err error
+		if data, err = f.MessagePack(); err != nil {
+			return nil, err
+		}
+		messageType = websocket.BinaryMessage
+	}
+
+	pm, err := websocket.NewPreparedMessage(messageType, data)
+	if err != nil {
+		return nil, err
+	}
+	if f.prepared == nil {
+		f.prepared = make(map[string]*websocket.PreparedMessage)
+	}
+	f.prepared[protocol] = pm
+	return pm, nil
+}
+
+// jsonToMsgpack transcodes a JSON document to MessagePack. Integers stay
+// integers; timestamps stay RFC 3339 strings.
+func jsonToMsgpack(data []byte) ([]byte, error) {
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+
+	var value interface{}
+	if err := decoder.Decode(&value); err != nil {
+		return nil, err
+	}
+	return msgpack.Marshal(convertNumbers(value))
+}
+
+// convertNumbers replaces json.Numbers with the narrowest Go number type
+func convertNumbers(value interface{}) interface{} {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		for key, item := range v {
+			v[key] = convertNumbers(item)
+		}
+	case []interface{}:
+		for i, item := range v {
+			v[i] = convertNumbers(item)
+		}
+	case json.Number:
+		if n, err := v.Int64(); err == nil {
+			return n
+		}
+		if n, err := v.Float64(); err == nil {
+			return n
+		}
+		return v.String()
+	}
+	return value
+}
+
+// msgpackToJSON transcodes an inbound MessagePack frame to JSON so it can be
+// handled like any other frame
+func msgpackToJSON(data []byte) ([]byte, error) {
+	var value interface{}
+	if err := msgpack.Unmarshal(data, &value); err != nil {
+		return nil, err
+	}
+	return json.Marshal(value)
+}
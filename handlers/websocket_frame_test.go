@@ -0,0 +1,291 @@
+package handlers
+
+import (
+	"GoChatApp/models"
+	"GoChatApp/repositories"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gorilla/websocket"
+	"github.com/vmihailenco/msgpack/v5"
+)
+
+// benchChatFrame is a chat frame the size of a typical room message
+func benchChatFrame(t testing.TB) []byte {
+	message := &models.Message{
+		ID:        4242,
+		UserID:    7,
+		RoomID:    3,
+		Content:   strings.Repeat("Did everyone see the release notes for this week? ", 4),
+		User:      models.User{ID: 7, Username: "alice", Email: "alice@example.com"},
+		CreatedAt: time.Date(2026, 1, 2, 15, 4, 5, 0, time.UTC),
+		UpdatedAt: time.Date(2026, 1, 2, 15, 4, 5, 0, time.UTC),
+	}
+	data, err := json.Marshal(ChatMessageEvent{Type: EventChat, RoomID: 3, Message: message})
+	if err != nil {
+		t.Fatalf("Failed to encode frame: %v", err)
+	}
+	return data
+}
+
+func TestFrame_MessagePackKeepsTypes(t *testing.T) {
+	frame := newFrame(benchChatFrame(t))
+
+	data, err := frame.MessagePack()
+	if err != nil {
+		t.Fatalf("Transcoding failed: %v", err)
+	}
+	var decoded struct {
+		Type    string `msgpack:"type"`
+		RoomID  uint   `msgpack:"room_id"`
+		Message struct {
+			ID        uint   `msgpack:"id"`
+			CreatedAt string `msgpack:"created_at"`
+		} `msgpack:"message"`
+	}
+	if err := msgpack.Unmarshal(data, &decoded); err != nil {
+		t.Fatalf("Invalid MessagePack: %v", err)
+	}
+	if decoded.Type != EventChat || decoded.RoomID != 3 || decoded.Message.ID != 4242 {
+		t.Errorf("Unexpected frame %+v", decoded)
+	}
+	if decoded.Message.CreatedAt != "2026-01-02T15:04:05Z" {
+		t.Errorf("Expected RFC 3339 timestamp, got %q", decoded.Message.CreatedAt)
+	}
+	if len(data) >= len(frame.JSON()) {
+		t.Errorf("Expected MessagePack (%d bytes) to be smaller than JSON (%d bytes)", len(data), len(frame.JSON()))
+	}
+}
+
+func TestFrame_EncodedOncePerFormat(t *testing.T) {
+	frame := newFrame(benchChatFrame(t))
+
+	first, _ := frame.MessagePack()
+	second, _ := frame.MessagePack()
+	if &first[0] != &second[0] {
+		t.Error("Expected MessagePack encoding to be reused")
+	}
+
+	a, _ := frame.Prepared(ProtocolV1MessagePack)
+	b, _ := frame.Prepared(ProtocolV1MessagePack)
+	c, _ := frame.Prepared(ProtocolV1)
+	if a != b {
+		t.Error("Expected prepared message to be reused per protocol")
+	}
+	if a == c {
+		t.Error("Expected a separate prepared message per protocol")
+	}
+}
+
+func TestWebSocket_MessagePackWithDeflate(t *testing.T) {
+	db := setupTestDB(t)
+	userRepo := repositories.NewUserRepository(db)
+
+	user := &models.User{Username: "mobile", Email: "mobile@example.com", PasswordHash: "hash"}
+	userRepo.Create(user)
+
+	wsHandler := NewWebSocketHandler(repositories.NewMessageRepository(db), repositories.NewRoomRepository(db), userRepo, nil, NewMemoryBroker())
+	server := setupWebSocketServer(t, wsHandler)
+	ticket, _ := wsHandler.Tickets.Issue(WSTicket{UserID: user.ID, Username: user.Username}, ticketTTL)
+
+	dialer := websocket.Dialer{Subprotocols: []string{ProtocolV1MessagePack}, EnableCompression: true}
+	conn, resp, err := dialer.Dial("ws"+strings.TrimPrefix(server.URL, "http")+"/ws?ticket="+ticket, nil)
+	if err != nil {
+		t.Fatalf("Failed to dial: %v", err)
+	}
+	defer conn.Close()
+
+	if conn.Subprotocol() != ProtocolV1MessagePack {
+		t.Errorf("Expected protocol %s, got %q", ProtocolV1MessagePack, conn.Subprotocol())
+	}
+	if !strings.Contains(resp.Header.Get("Sec-WebSocket-Extensions"), "permessage-deflate") {
+		t.Errorf("Expected permessage-deflate to be negotiated, got %q", resp.Header.Get("Sec-WebSocket-Extensions"))
+	}
+
+	readMsgpack := func(frameType string) map[string]interface{} {
+		t.Helper()
+		conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+		for {
+			messageType, data, err := conn.ReadMessage()
+			if err != nil {
+				t.Fatalf("Failed to read %s: %v", frameType, err)
+			}
+			if messageType != websocket.BinaryMessage {
+				t.Fatalf("Expected a binary frame, got %q", data)
+			}
+			var frame map[string]interface{}
+			if err := msgpack.Unmarshal(data, &frame); err != nil {
+				t.Fatalf("Invalid MessagePack: %v", err)
+			}
+			if frame["type"] == frameType {
+				return frame
+			}
+		}
+	}
+
+	readMsgpack(EventSession)
+	readMsgpack(EventReady)
+
+	// Inbound binary frames are MessagePack too
+	inbound, _ := msgpack.Marshal(map[string]interface{}{"type": "bogus"})
+	conn.WriteMessage(websocket.BinaryMessage, inbound)
+	if frame := readMsgpack(EventError); frame["code"] != ErrCodeUnknownType {
+		t.Errorf("Expected unknown_type error, got %v", frame)
+	}
+
+	// Large frames come through compressed and intact
+	wsHandler.Hub.BroadcastToAll(benchChatFrame(t))
+	if frame := readMsgpack(EventChat); frame["room_id"] == nil {
+		t.Errorf("Expected a chat frame, got %v", frame)
+	}
+}
+
+// countingConn counts the bytes read from a connection
+type countingConn struct {
+	net.Conn
+	read *atomic.Int64
+}
+
+func (c countingConn) Read(p []byte) (int, error) {
+	n, err := c.Conn.Read(p)
+	c.read.Add(int64(n))
+	return n, err
+}
+
+// BenchmarkBroadcast measures the bytes each client receives per broadcast
+// (wire-bytes/op) and the time to deliver one chat frame to 50 clients, per
+// encoding and with or without permessage-deflate
+func BenchmarkBroadcast(b *testing.B) {
+	gin.SetMode(gin.TestMode)
+	const clients = 50
+
+	for _, protocol := range []string{ProtocolV1, ProtocolV1MessagePack} {
+		for _, compress := range []bool{false, true} {
+			name := fmt.Sprintf("%s/deflate=%t", protocol, compress)
+			b.Run(name, func(b *testing.B) {
+				benchmarkBroadcast(b, protocol, compress, clients)
+			})
+		}
+	}
+}
+
+func benchmarkBroadcast(b *testing.B, protocol string, compress bool, clients int) {
+	// Connection logs would drown the results
+	log.SetOutput(io.Discard)
+	defer log.SetOutput(os.Stderr)
+
+	wsHandler := NewWebSocketHandler(nil, nil, nil, nil, NewMemoryBroker())
+	router := gin.New()
+	wsHandler.AllowTokenQuery = true
+	router.GET("/ws", wsHandler.HandleWebSocket)
+	server := httptest.NewServer(router)
+	defer server.Close()
+
+	var wireBytes atomic.Int64
+	var received sync.WaitGroup
+	marker := []byte("release notes")
+
+	dialer := websocket.Dialer{
+		Subprotocols:      []string{protocol},
+		EnableCompression: compress,
+		NetDialContext: func(ctx context.Context, network, addr string) (net.Conn, error) {
+			conn, err := (&net.Dialer{}).DialContext(ctx, network, addr)
+			if err != nil {
+				return nil, err
+			}
+			return countingConn{Conn: conn, read: &wireBytes}, nil
+		},
+	}
+
+	conns := make([]*websocket.Conn, 0, clients)
+	for i := 0; i < clients; i++ {
+		ticket, _ := wsHandler.Tickets.Issue(WSTicket{UserID: uint(i + 1), Username: fmt.Sprintf("user%d", i)}, ticketTTL)
+		conn, _, err := dialer.Dial("ws"+strings.TrimPrefix(server.URL, "http")+"/ws?ticket="+ticket, nil)
+		if err != nil {
+			b.Fatalf("Failed to dial: %v", err)
+		}
+		conns = append(conns, conn)
+
+		go func() {
+			for {
+				_, data, err := conn.ReadMessage()
+				if err != nil {
+					return
+				}
+				if strings.Contains(string(data), string(marker)) {
+					received.Done()
+				}
+			}
+		}()
+	}
+
+	frame := benchChatFrame(b)
+	broadcast := func() {
+		received.Add(clients)
+		wsHandler.Hub.BroadcastToAll(frame)
+		received.Wait()
+	}
+
+	// Let connection setup traffic settle before counting
+	broadcast()
+	wireBytes.Store(0)
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		broadcast()
+	}
+	b.StopTimer()
+
+	// Wait for the hub to see every client go before logging resumes
+	for _, conn := range conns {
+		conn.Close()
+	}
+	for deadline := time.Now().Add(2 * time.Second); wsHandler.Hub.Stats().Clients > 0 && time.Now().Before(deadline); {
+		time.Sleep(time.Millisecond)
+	}
+
+	b.ReportMetric(float64(wireBytes.Load())/float64(b.N*clients), "wire-bytes/op")
+}
+
+// BenchmarkFrameEncoding compares encoding a broadcast for each of 50
+// clients with encoding it once per format
+func BenchmarkFrameEncoding(b *testing.B) {
+	const clients = 50
+	data := benchChatFrame(b)
+
+	b.Run("per-client", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			for c := 0; c < clients; c++ {
+				if _, err := jsonToMsgpack(data); err != nil {
+					b.Fatal(err)
+				}
+			}
+		}
+	})
+
+	b.Run("shared", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			frame := newFrame(data)
+			for c := 0; c < clients; c++ {
+				if _, err := frame.Prepared(ProtocolV1MessagePack); err != nil {
+					b.Fatal(err)
+				}
+			}
+		}
+	})
+}
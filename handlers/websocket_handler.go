@@ -1,17 +1,31 @@
 package handlers
 
 import (
+	"GoChatApp/repositories"
 	"GoChatApp/utils"
+	"encoding/json"
+	"errors"
 	"log"
 	"net/http"
+	"regexp"
+	"sync"
+	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/gorilla/websocket"
 )
 
+// validDeviceID limits client-chosen device IDs to short, log-safe strings
+var validDeviceID = regexp.MustCompile(`^[A-Za-z0-9._-]{1,64}$`)
+
 var upgrader = websocket.Upgrader{
-	ReadBufferSize:  1024,
-	WriteBufferSize: 1024,
+	// Inbound frames are small; outbound ones are written in larger chunks
+	// from buffers shared between connections while they are idle
+	ReadBufferSize:    1024,
+	WriteBufferSize:   4096,
+	WriteBufferPool:   &sync.Pool{},
+	EnableCompression: true, // permessage-deflate, when the client offers it
+	Subprotocols:      supportedProtocols,
 	CheckOrigin: func(r *http.Request) bool {
 		// Allow all origins for development (adjust for production)
 		return true
@@ -20,34 +34,60 @@ var upgrader = websocket.Upgrader{
 
 type WebSocketHandler struct {
 	Hub *Hub
+
+	// Single-use tickets redeemed when a connection is upgraded
+	Tickets TicketStore
+
+	// Accept access tokens in ?token= from clients not yet moved to
+	// tickets. Off by default: the token ends up in proxy logs.
+	AllowTokenQuery bool
+
+	// Checks the session behind tokens sent in ?token=, skipped if nil
+	Sessions *repositories.SessionRepository
 }
 
-func NewWebSocketHandler() *WebSocketHandler {
-	hub := NewHub()
+func NewWebSocketHandler(messageRepo *repositories.MessageRepository, roomRepo *repositories.RoomRepository, userRepo *repositories.UserRepository, receiptRepo *repositories.ReadReceiptRepository, broker Broker) *WebSocketHandler {
+	hub := NewHub(messageRepo, roomRepo, userRepo, receiptRepo, broker)
+	if err := broker.Subscribe(hub.deliver); err != nil {
+		log.Printf("Failed to subscribe hub to broker: %v", err)
+	}
 	go hub.Run() // Start the hub in a goroutine
 	return &WebSocketHandler{
-		Hub: hub,
+		Hub:     hub,
+		Tickets: NewMemoryTicketStore(),
 	}
 }
 
 // HandleWebSocket handles WebSocket connections
 func (h *WebSocketHandler) HandleWebSocket(c *gin.Context) {
-	// Get JWT token from query parameter (WebSocket doesn't support headers easily)
-	token := c.Query("token")
-	if token == "" {
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "token required"})
+	// Refuse before redeeming the ticket so the client can retry with it
+	if !h.Hub.Accepting() {
+		c.Header("Retry-After", "5")
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "server is shutting down"})
 		return
 	}
 
-	// Validate JWT token
-	claims, err := utils.ValidateToken(token)
+	// Tickets can also ride in Sec-WebSocket-Protocol, next to the version
+	protocolTicket, requested := splitTicketProtocol(websocket.Subprotocols(c.Request))
+
+	ticket, err := h.authenticate(c, protocolTicket)
 	if err != nil {
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "invalid or expired token"})
+		c.JSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
 		return
 	}
 
-	userID := claims.UserID
-	username := claims.Username
+	// Devices that send a stable ID keep it across reconnects
+	deviceID, ok := deviceIDFrom(c)
+	if !ok {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid device_id"})
+		return
+	}
+
+	// Clients that ask for a protocol version must ask for one we speak
+	if len(requested) > 0 && !supportsProtocol(requested) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "unsupported protocol version", "supported": supportedProtocols})
+		return
+	}
 
 	// Upgrade HTTP connection to WebSocket
 	conn, err := upgrader.Upgrade(c.Writer, c.Request, nil)
@@ -56,20 +96,152 @@ func (h *WebSocketHandler) HandleWebSocket(c *gin.Context) {
 		return
 	}
 
-	// Create new client
-	client := &Client{
-		Hub:      h.Hub,
-		Conn:     conn,
-		Send:     make(chan []byte, 256),
-		UserID:   userID,
-		Username: username,
-		Rooms:    make(map[uint]bool),
+	protocol := conn.Subprotocol()
+	if protocol == "" {
+		protocol = ProtocolV1
 	}
 
-	// Register client with hub
-	h.Hub.Register <- client
+	transport := &websocketTransport{conn: conn}
+	client := h.connect(transport, ticket, deviceID, protocol, 0)
 
 	// Start client's read and write pumps in separate goroutines
 	go client.WritePump()
-	go client.ReadPump()
+	go transport.ReadPump(client)
+}
+
+// connect registers a new client with the hub, sending it the session frame
+// and subscribing it to the user's rooms. Messages newer than
+// sinceMessageID are replayed when it is not 0.
+func (h *WebSocketHandler) connect(transport Transport, ticket WSTicket, deviceID, protocol string, sinceMessageID uint) *Client {
+	client := &Client{
+		Hub:       h.Hub,
+		Transport: transport,
+		Send:      make(chan *Frame, 256),
+		UserID:    ticket.UserID,
+		Username:  ticket.Username,
+		DeviceID:  deviceID,
+		SessionID: ticket.SessionID,
+		Rooms:     make(map[uint]bool),
+		Protocol:  protocol,
+
+		ExpiresAt: ticket.TokenExpiresAt,
+
+		replaying:       make(map[uint][]RoomMessage),
+		replayedThrough: make(map[uint]uint),
+		typing:          make(map[uint]time.Time),
+		writerDone:      make(chan struct{}),
+	}
+
+	// Tell the device how it is identified before any other frame
+	session := SessionEvent{Type: EventSession, DeviceID: deviceID, Protocol: protocol, Transport: transport.Name()}
+	if msgBytes, err := json.Marshal(session); err == nil {
+		client.Send <- newFrame(msgBytes)
+	}
+
+	// Register client with hub, subscribed to the user's rooms and told
+	// about them in the ready frame
+	h.Hub.AutoSubscribe(client, sinceMessageID)
+	return client
+}
+
+// deviceIDFrom returns the device ID a client sent, or a new one when it
+// sent none. It reports false for IDs that are not allowed.
+func deviceIDFrom(c *gin.Context) (string, bool) {
+	deviceID := c.Query("device_id")
+	if deviceID == "" {
+		return newRandomID(), true
+	}
+	return deviceID, validDeviceID.MatchString(deviceID)
+}
+
+// IssueTicket issues a short-lived, single-use ticket for opening a
+// WebSocket, so the long-lived token never appears in a URL
+func (h *WebSocketHandler) IssueTicket(c *gin.Context) {
+	userID, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return
+	}
+	username, _ := c.Get("username")
+	sessionID, _ := c.Get("session_id")
+
+	// Sockets live as long as the session, not the short-lived access
+	// token; revoking the session closes them
+	ticket := WSTicket{UserID: userID.(uint), Username: username.(string)}
+	ticket.SessionID, _ = sessionID.(uint)
+	if expiresAt, ok := c.Get("session_expires_at"); ok {
+		ticket.TokenExpiresAt = expiresAt.(time.Time)
+	} else if expiresAt, ok := c.Get("token_expires_at"); ok {
+		ticket.TokenExpiresAt = expiresAt.(time.Time)
+	}
+
+	id, err := h.Tickets.Issue(ticket, ticketTTL)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to issue ticket"})
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{
+		"ticket":     id,
+		"expires_at": time.Now().Add(ticketTTL),
+	})
+}
+
+// authenticate redeems the ticket sent with an upgrade request. Clients that
+// have not moved to tickets may send a token in ?token= if AllowTokenQuery
+// is set.
+func (h *WebSocketHandler) authenticate(c *gin.Context, protocolTicket string) (WSTicket, error) {
+	ticketID := c.Query("ticket")
+	if ticketID == "" {
+		ticketID = protocolTicket
+	}
+	if ticketID != "" {
+		ticket, err := h.Tickets.Redeem(ticketID)
+		if err != nil {
+			if err != ErrTicketInvalid {
+				log.Printf("Error redeeming WebSocket ticket: %v", err)
+			}
+			return WSTicket{}, ErrTicketInvalid
+		}
+		return ticket, nil
+	}
+
+	token := c.Query("token")
+	if token == "" || !h.AllowTokenQuery {
+		return WSTicket{}, errors.New("ticket required")
+	}
+	claims, err := utils.ValidateToken(token)
+	if err != nil {
+		return WSTicket{}, errors.New("invalid or expired token")
+	}
+	if h.Sessions != nil {
+		if _, err := h.Sessions.FindActive(claims.SessionID); err != nil {
+			return WSTicket{}, errors.New("session revoked or expired")
+		}
+	}
+	log.Printf("User %d connected with a token in ?token=; move the client to tickets", claims.UserID)
+
+	// Unlike a ticket's, the connection only lasts as long as the token
+	ticket := WSTicket{UserID: claims.UserID, Username: claims.Username, SessionID: claims.SessionID}
+	if claims.ExpiresAt != nil {
+		ticket.TokenExpiresAt = claims.ExpiresAt.Time
+	}
+	return ticket, nil
+}
+
+// GetStats returns connection and slow consumer counters
+func (h *WebSocketHandler) GetStats(c *gin.Context) {
+	c.JSON(http.StatusOK, h.Hub.Stats())
+}
+
+// supportsProtocol reports whether any of the requested subprotocols is supported
+func supportsProtocol(requested []string) bool {
+	for _, p := range requested {
+		for _, supported := range supportedProtocols {
+			if p == supported {
+				return true
+			}
+		}
+	}
+	return false
 }
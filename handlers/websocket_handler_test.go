@@ -0,0 +1,1118 @@
+package handlers
+
+import (
+	"GoChatApp/events"
+	"GoChatApp/models"
+	"GoChatApp/repositories"
+	"GoChatApp/utils"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gorilla/websocket"
+)
+
+// setupWebSocketServer starts a test server with the WebSocket endpoint mounted
+func setupWebSocketServer(t *testing.T, handler *WebSocketHandler) *httptest.Server {
+	// Tests dial with ?token= for brevity
+	handler.AllowTokenQuery = true
+	router := gin.New()
+	router.GET("/ws", handler.HandleWebSocket)
+
+	server := httptest.NewServer(router)
+	t.Cleanup(server.Close)
+	return server
+}
+
+// testConn wraps a client connection and keeps frames that arrived batched
+// together so they can be read one at a time
+type testConn struct {
+	*websocket.Conn
+	pending []map[string]interface{}
+}
+
+// dialWebSocket connects to the test server as the given user
+func dialWebSocket(t *testing.T, server *httptest.Server, user *models.User) *testConn {
+	return dialDevice(t, server, user, "")
+}
+
+// dialDevice connects to the test server as the given user from a device
+func dialDevice(t *testing.T, server *httptest.Server, user *models.User, deviceID string) *testConn {
+	token, err := utils.GenerateToken(user.ID, user.Username, user.Email, "user", 0)
+	if err != nil {
+		t.Fatalf("Failed to generate token: %v", err)
+	}
+
+	url := "ws" + strings.TrimPrefix(server.URL, "http") + "/ws?token=" + token
+	if deviceID != "" {
+		url += "&device_id=" + deviceID
+	}
+	conn, _, err := websocket.DefaultDialer.Dial(url, nil)
+	if err != nil {
+		t.Fatalf("Failed to dial WebSocket: %v", err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	return &testConn{Conn: conn}
+}
+
+// readFrame reads frames until one of the wanted type arrives; an empty
+// type takes the next frame
+func readFrame(t *testing.T, conn *testConn, frameType string) map[string]interface{} {
+	t.Helper()
+	conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+	for {
+		for len(conn.pending) > 0 {
+			frame := conn.pending[0]
+			conn.pending = conn.pending[1:]
+			if frameType == "" || frame["type"] == frameType {
+				return frame
+			}
+		}
+
+		_, data, err := conn.ReadMessage()
+		if err != nil {
+			t.Fatalf("Failed waiting for %q frame: %v", frameType, err)
+		}
+		// WritePump may batch several frames into one message
+		for _, line := range bytes.Split(data, []byte{'\n'}) {
+			var frame map[string]interface{}
+			if err := json.Unmarshal(line, &frame); err != nil {
+				t.Fatalf("Invalid frame %s: %v", line, err)
+			}
+			conn.pending = append(conn.pending, frame)
+		}
+	}
+}
+
+func TestWebSocket_ChatIsPersistedAndAcked(t *testing.T) {
+	db := setupTestDB(t)
+	userRepo := repositories.NewUserRepository(db)
+	roomRepo := repositories.NewRoomRepository(db)
+	messageRepo := repositories.NewMessageRepository(db)
+
+	user := &models.User{Username: "sender", Email: "sender@example.com", PasswordHash: "hash"}
+	userRepo.Create(user)
+	room := &models.Room{Name: "Socket Room", Type: "public"}
+	roomRepo.Create(room)
+
+	server := setupWebSocketServer(t, NewWebSocketHandler(messageRepo, roomRepo, userRepo, nil, NewMemoryBroker()))
+	conn := dialWebSocket(t, server, user)
+
+	conn.WriteJSON(map[string]interface{}{"type": "join_room", "room_id": room.ID})
+	readFrame(t, conn, EventRoomUserJoined)
+
+	conn.WriteJSON(map[string]interface{}{
+		"type":    "chat",
+		"room_id": room.ID,
+		"content": "hello over the socket",
+		"nonce":   "abc-123",
+	})
+
+	ack := readFrame(t, conn, "ack")
+	if ack["nonce"] != "abc-123" {
+		t.Errorf("Expected nonce abc-123, got %v", ack["nonce"])
+	}
+	if ack["message_id"] == nil || ack["created_at"] == nil {
+		t.Fatalf("Ack should contain message_id and created_at, got %v", ack)
+	}
+
+	chat := readFrame(t, conn, "chat")
+	message, ok := chat["message"].(map[string]interface{})
+	if !ok {
+		t.Fatalf("Chat frame should contain the stored message, got %v", chat)
+	}
+	if message["id"] != ack["message_id"] {
+		t.Errorf("Broadcast message id %v does not match ack %v", message["id"], ack["message_id"])
+	}
+	if sender, _ := message["user"].(map[string]interface{}); sender["username"] != "sender" {
+		t.Errorf("Broadcast message should include the user, got %v", message["user"])
+	}
+
+	stored, err := messageRepo.FindByID(uint(ack["message_id"].(float64)))
+	if err != nil {
+		t.Fatalf("Message was not persisted: %v", err)
+	}
+	if stored.Content != "hello over the socket" {
+		t.Errorf("Expected persisted content, got %q", stored.Content)
+	}
+}
+
+func TestWebSocket_ChatWithoutRoomIsNacked(t *testing.T) {
+	db := setupTestDB(t)
+	userRepo := repositories.NewUserRepository(db)
+	messageRepo := repositories.NewMessageRepository(db)
+
+	user := &models.User{Username: "sender", Email: "sender@example.com", PasswordHash: "hash"}
+	userRepo.Create(user)
+
+	server := setupWebSocketServer(t, NewWebSocketHandler(messageRepo, repositories.NewRoomRepository(db), userRepo, nil, NewMemoryBroker()))
+	conn := dialWebSocket(t, server, user)
+
+	conn.WriteJSON(map[string]interface{}{"type": "chat", "content": "nowhere", "nonce": "n1"})
+
+	nack := readFrame(t, conn, "nack")
+	if nack["nonce"] != "n1" {
+		t.Errorf("Expected nonce n1, got %v", nack["nonce"])
+	}
+	if nack["reason"] == "" || nack["reason"] == nil {
+		t.Error("Nack should contain a reason")
+	}
+}
+
+func TestWebSocket_ErrorFrames(t *testing.T) {
+	db := setupTestDB(t)
+	userRepo := repositories.NewUserRepository(db)
+	messageRepo := repositories.NewMessageRepository(db)
+
+	user := &models.User{Username: "sender", Email: "sender@example.com", PasswordHash: "hash"}
+	userRepo.Create(user)
+
+	server := setupWebSocketServer(t, NewWebSocketHandler(messageRepo, repositories.NewRoomRepository(db), userRepo, nil, NewMemoryBroker()))
+	conn := dialWebSocket(t, server, user)
+
+	tests := []struct {
+		name  string
+		frame string
+		code  string
+	}{
+		{"malformed json", `{"type":`, ErrCodeMalformedJSON},
+		{"unknown type", `{"type":"shout","content":"hi"}`, ErrCodeUnknownType},
+		{"wrong field type", `{"type":"join_room","room_id":"one"}`, ErrCodeInvalidPayload},
+		{"missing room", `{"type":"join_room"}`, ErrCodeInvalidPayload},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			conn.WriteMessage(websocket.TextMessage, []byte(tt.frame))
+
+			frame := readFrame(t, conn, EventError)
+			if frame["code"] != tt.code {
+				t.Errorf("Expected code %s, got %v", tt.code, frame["code"])
+			}
+		})
+	}
+}
+
+func TestWebSocket_UnknownTypeIsNotBroadcast(t *testing.T) {
+	db := setupTestDB(t)
+	userRepo := repositories.NewUserRepository(db)
+	messageRepo := repositories.NewMessageRepository(db)
+
+	sender := &models.User{Username: "sender", Email: "sender@example.com", PasswordHash: "hash"}
+	other := &models.User{Username: "other", Email: "other@example.com", PasswordHash: "hash"}
+	userRepo.Create(sender)
+	userRepo.Create(other)
+
+	server := setupWebSocketServer(t, NewWebSocketHandler(messageRepo, repositories.NewRoomRepository(db), userRepo, nil, NewMemoryBroker()))
+	senderConn := dialWebSocket(t, server, sender)
+	otherConn := dialWebSocket(t, server, other)
+	readFrame(t, otherConn, EventPresence)
+
+	senderConn.WriteMessage(websocket.TextMessage, []byte(`{"type":"shout","content":"hi"}`))
+	readFrame(t, senderConn, EventError)
+
+	otherConn.SetReadDeadline(time.Now().Add(200 * time.Millisecond))
+	for {
+		_, data, err := otherConn.ReadMessage()
+		if err != nil {
+			break
+		}
+		if bytes.Contains(data, []byte("shout")) {
+			t.Fatalf("Unknown frame type was broadcast: %s", data)
+		}
+	}
+}
+
+func TestWebSocket_ProtocolNegotiation(t *testing.T) {
+	db := setupTestDB(t)
+	userRepo := repositories.NewUserRepository(db)
+	messageRepo := repositories.NewMessageRepository(db)
+
+	user := &models.User{Username: "sender", Email: "sender@example.com", PasswordHash: "hash"}
+	userRepo.Create(user)
+	token, _ := utils.GenerateToken(user.ID, user.Username, user.Email, "user", 0)
+
+	server := setupWebSocketServer(t, NewWebSocketHandler(messageRepo, repositories.NewRoomRepository(db), userRepo, nil, NewMemoryBroker()))
+	url := "ws" + strings.TrimPrefix(server.URL, "http") + "/ws?token=" + token
+
+	dialer := websocket.Dialer{Subprotocols: []string{ProtocolV1}}
+	conn, _, err := dialer.Dial(url, nil)
+	if err != nil {
+		t.Fatalf("Failed to dial with supported protocol: %v", err)
+	}
+	if conn.Subprotocol() != ProtocolV1 {
+		t.Errorf("Expected negotiated protocol %s, got %q", ProtocolV1, conn.Subprotocol())
+	}
+	conn.Close()
+
+	dialer = websocket.Dialer{Subprotocols: []string{"gochat.v99"}}
+	_, resp, err := dialer.Dial(url, nil)
+	if err == nil {
+		t.Fatal("Expected unsupported protocol to be rejected")
+	}
+	if resp == nil || resp.StatusCode != http.StatusBadRequest {
+		t.Errorf("Expected status 400 for unsupported protocol, got %v", resp)
+	}
+}
+
+func TestWebSocket_PrivateRoomRequiresMembership(t *testing.T) {
+	db := setupTestDB(t)
+	userRepo := repositories.NewUserRepository(db)
+	roomRepo := repositories.NewRoomRepository(db)
+	messageRepo := repositories.NewMessageRepository(db)
+
+	member := &models.User{Username: "member", Email: "member@example.com", PasswordHash: "hash"}
+	outsider := &models.User{Username: "outsider", Email: "outsider@example.com", PasswordHash: "hash"}
+	userRepo.Create(member)
+	userRepo.Create(outsider)
+	room := &models.Room{Name: "Secret", Type: "private", CreatedBy: member.ID}
+	roomRepo.Create(room)
+	roomRepo.AddMember(room.ID, member.ID)
+
+	server := setupWebSocketServer(t, NewWebSocketHandler(messageRepo, roomRepo, userRepo, nil, NewMemoryBroker()))
+	memberConn := dialWebSocket(t, server, member)
+	outsiderConn := dialWebSocket(t, server, outsider)
+
+	outsiderConn.WriteJSON(map[string]interface{}{"type": EventJoinRoom, "room_id": room.ID})
+	if frame := readFrame(t, outsiderConn, EventError); frame["code"] != ErrCodeForbidden {
+		t.Errorf("Expected forbidden for outsider join, got %v", frame["code"])
+	}
+
+	outsiderConn.WriteJSON(map[string]interface{}{"type": EventChat, "room_id": room.ID, "content": "let me in", "nonce": "x"})
+	frame := readFrame(t, outsiderConn, EventError)
+	if frame["code"] != ErrCodeForbidden || frame["nonce"] != "x" {
+		t.Errorf("Expected forbidden with nonce for outsider chat, got %v", frame)
+	}
+
+	outsiderConn.WriteJSON(map[string]interface{}{"type": EventTyping, "room_id": room.ID})
+	if frame := readFrame(t, outsiderConn, EventError); frame["code"] != ErrCodeForbidden {
+		t.Errorf("Expected forbidden for outsider typing, got %v", frame["code"])
+	}
+
+	memberConn.WriteJSON(map[string]interface{}{"type": EventJoinRoom, "room_id": room.ID})
+	readFrame(t, memberConn, EventRoomUserJoined)
+
+	messages, _ := messageRepo.FindByRoomID(room.ID, 10, 0)
+	if len(messages) != 0 {
+		t.Errorf("Outsider should not be able to post, found %d messages", len(messages))
+	}
+}
+
+func TestWebSocket_UnknownRoomIsNotFound(t *testing.T) {
+	db := setupTestDB(t)
+	userRepo := repositories.NewUserRepository(db)
+	roomRepo := repositories.NewRoomRepository(db)
+	messageRepo := repositories.NewMessageRepository(db)
+
+	user := &models.User{Username: "sender", Email: "sender@example.com", PasswordHash: "hash"}
+	userRepo.Create(user)
+
+	server := setupWebSocketServer(t, NewWebSocketHandler(messageRepo, roomRepo, userRepo, nil, NewMemoryBroker()))
+	conn := dialWebSocket(t, server, user)
+
+	conn.WriteJSON(map[string]interface{}{"type": EventJoinRoom, "room_id": 42})
+	if frame := readFrame(t, conn, EventError); frame["code"] != ErrCodeNotFound {
+		t.Errorf("Expected not_found, got %v", frame["code"])
+	}
+}
+
+func TestWebSocket_LeavingRoomCutsSubscription(t *testing.T) {
+	db := setupTestDB(t)
+	userRepo := repositories.NewUserRepository(db)
+	roomRepo := repositories.NewRoomRepository(db)
+	messageRepo := repositories.NewMessageRepository(db)
+
+	user := &models.User{Username: "leaver", Email: "leaver@example.com", PasswordHash: "hash"}
+	userRepo.Create(user)
+	room := &models.Room{Name: "Private", Type: "private", CreatedBy: user.ID}
+	roomRepo.Create(room)
+	roomRepo.AddMember(room.ID, user.ID)
+
+	wsHandler := NewWebSocketHandler(messageRepo, roomRepo, userRepo, nil, NewMemoryBroker())
+	bus := events.NewBus()
+	bus.Subscribe(wsHandler.Hub.HandleEvent)
+	roomHandler := NewRoomHandler(roomRepo, bus)
+
+	router := gin.New()
+	wsHandler.AllowTokenQuery = true
+	router.GET("/ws", wsHandler.HandleWebSocket)
+	router.POST("/rooms/:id/leave", func(c *gin.Context) {
+		c.Set("user_id", user.ID)
+		roomHandler.LeaveRoom(c)
+	})
+	server := httptest.NewServer(router)
+	defer server.Close()
+
+	conn := dialWebSocket(t, server, user)
+	conn.WriteJSON(map[string]interface{}{"type": EventJoinRoom, "room_id": room.ID})
+	readFrame(t, conn, EventRoomUserJoined)
+
+	resp, err := http.Post(server.URL+"/rooms/1/leave", "application/json", nil)
+	if err != nil || resp.StatusCode != http.StatusOK {
+		t.Fatalf("Leave failed: %v %v", err, resp)
+	}
+
+	left := readFrame(t, conn, EventRoomUserLeft)
+	if left["user_id"] != float64(user.ID) {
+		t.Errorf("Expected room_user_left for the leaver, got %v", left)
+	}
+
+	conn.WriteJSON(map[string]interface{}{"type": EventChat, "room_id": room.ID, "content": "still here?"})
+	if frame := readFrame(t, conn, EventError); frame["code"] != ErrCodeForbidden {
+		t.Errorf("Expected forbidden after leaving, got %v", frame["code"])
+	}
+}
+
+func TestWebSocket_JoinReplaysMissedMessages(t *testing.T) {
+	db := setupTestDB(t)
+	userRepo := repositories.NewUserRepository(db)
+	roomRepo := repositories.NewRoomRepository(db)
+	messageRepo := repositories.NewMessageRepository(db)
+
+	user := &models.User{Username: "sleeper", Email: "sleeper@example.com", PasswordHash: "hash"}
+	userRepo.Create(user)
+	room := &models.Room{Name: "Busy", Type: "public"}
+	roomRepo.Create(room)
+
+	var ids []uint
+	for i := 0; i < 4; i++ {
+		msg := &models.Message{UserID: user.ID, RoomID: room.ID, Content: "missed"}
+		messageRepo.Create(msg)
+		ids = append(ids, msg.ID)
+	}
+
+	server := setupWebSocketServer(t, NewWebSocketHandler(messageRepo, roomRepo, userRepo, nil, NewMemoryBroker()))
+	conn := dialWebSocket(t, server, user)
+
+	conn.WriteJSON(map[string]interface{}{"type": EventJoinRoom, "room_id": room.ID, "since_message_id": ids[1]})
+
+	for _, want := range ids[2:] {
+		frame := readFrame(t, conn, EventChat)
+		message := frame["message"].(map[string]interface{})
+		if message["id"] != float64(want) {
+			t.Errorf("Expected replayed message %d, got %v", want, message["id"])
+		}
+		if frame["replayed"] != true {
+			t.Errorf("Replayed frame should be marked replayed, got %v", frame)
+		}
+	}
+
+	// Live traffic resumes after the replay
+	conn.WriteJSON(map[string]interface{}{"type": EventChat, "room_id": room.ID, "content": "back online"})
+	frame := readFrame(t, conn, EventChat)
+	if frame["replayed"] != nil {
+		t.Errorf("Live frame should not be marked replayed, got %v", frame)
+	}
+	if message := frame["message"].(map[string]interface{}); message["content"] != "back online" {
+		t.Errorf("Expected live message after replay, got %v", message["content"])
+	}
+}
+
+func TestWebSocket_JoinReplayIsTruncated(t *testing.T) {
+	db := setupTestDB(t)
+	userRepo := repositories.NewUserRepository(db)
+	roomRepo := repositories.NewRoomRepository(db)
+	messageRepo := repositories.NewMessageRepository(db)
+
+	user := &models.User{Username: "sleeper", Email: "sleeper@example.com", PasswordHash: "hash"}
+	userRepo.Create(user)
+	room := &models.Room{Name: "Busy", Type: "public"}
+	roomRepo.Create(room)
+
+	first := &models.Message{UserID: user.ID, RoomID: room.ID, Content: "seen"}
+	messageRepo.Create(first)
+	for i := 0; i < maxReplayMessages+5; i++ {
+		messageRepo.Create(&models.Message{UserID: user.ID, RoomID: room.ID, Content: "missed"})
+	}
+
+	server := setupWebSocketServer(t, NewWebSocketHandler(messageRepo, roomRepo, userRepo, nil, NewMemoryBroker()))
+	conn := dialWebSocket(t, server, user)
+
+	conn.WriteJSON(map[string]interface{}{"type": EventJoinRoom, "room_id": room.ID, "since_message_id": first.ID})
+
+	marker := readFrame(t, conn, EventHistoryTruncated)
+	if marker["since_message_id"] != float64(first.ID) {
+		t.Errorf("Expected since_message_id %d, got %v", first.ID, marker["since_message_id"])
+	}
+
+	replayed := 0
+	for replayed < maxReplayMessages {
+		frame := readFrame(t, conn, EventChat)
+		if replayed == 0 && frame["message"].(map[string]interface{})["id"] != marker["first_message_id"] {
+			t.Errorf("First replayed message should match first_message_id %v", marker["first_message_id"])
+		}
+		replayed++
+	}
+}
+
+func TestWebSocket_PresenceSurvivesOtherTabs(t *testing.T) {
+	db := setupTestDB(t)
+	userRepo := repositories.NewUserRepository(db)
+	roomRepo := repositories.NewRoomRepository(db)
+	messageRepo := repositories.NewMessageRepository(db)
+
+	alice := &models.User{Username: "alice", Email: "alice@example.com", PasswordHash: "hash"}
+	bob := &models.User{Username: "bob", Email: "bob@example.com", PasswordHash: "hash"}
+	userRepo.Create(alice)
+	userRepo.Create(bob)
+	room := &models.Room{Name: "Presence Room", Type: "public"}
+	roomRepo.Create(room)
+	roomRepo.AddMember(room.ID, alice.ID)
+	roomRepo.AddMember(room.ID, bob.ID)
+
+	handler := NewWebSocketHandler(messageRepo, roomRepo, userRepo, nil, NewMemoryBroker())
+	server := setupWebSocketServer(t, handler)
+
+	bobConn := dialWebSocket(t, server, bob)
+	readFrame(t, bobConn, EventPresence)
+
+	firstTab := dialWebSocket(t, server, alice)
+	if frame := readFrame(t, bobConn, EventPresence); frame["user_id"] != float64(alice.ID) || frame["status"] != PresenceOnline {
+		t.Fatalf("Expected alice online, got %v", frame)
+	}
+	dialWebSocket(t, server, alice)
+	waitFor(t, func() bool {
+		handler.Hub.mu.RLock()
+		defer handler.Hub.mu.RUnlock()
+		return len(handler.Hub.Clients) == 3
+	})
+
+	// Closing one tab leaves alice online through the other
+	firstTab.Close()
+	waitFor(t, func() bool {
+		handler.Hub.mu.RLock()
+		defer handler.Hub.mu.RUnlock()
+		return len(handler.Hub.Clients) == 2
+	})
+	if status := handler.Hub.PresenceOf(alice.ID); status != PresenceOnline {
+		t.Fatalf("Expected alice to stay online, got %s", status)
+	}
+	stored, _ := userRepo.FindByID(alice.ID)
+	if stored.LastSeenAt != nil {
+		t.Error("Last seen should not be recorded while another tab is open")
+	}
+}
+
+func TestWebSocket_ChatEndsTyping(t *testing.T) {
+	db := setupTestDB(t)
+	userRepo := repositories.NewUserRepository(db)
+	roomRepo := repositories.NewRoomRepository(db)
+	messageRepo := repositories.NewMessageRepository(db)
+
+	alice := &models.User{Username: "alice", Email: "alice@example.com", PasswordHash: "hash"}
+	bob := &models.User{Username: "bob", Email: "bob@example.com", PasswordHash: "hash"}
+	userRepo.Create(alice)
+	userRepo.Create(bob)
+	room := &models.Room{Name: "Typing Room", Type: "public"}
+	roomRepo.Create(room)
+
+	server := setupWebSocketServer(t, NewWebSocketHandler(messageRepo, roomRepo, userRepo, nil, NewMemoryBroker()))
+	aliceConn := dialWebSocket(t, server, alice)
+	bobConn := dialWebSocket(t, server, bob)
+
+	bobConn.WriteJSON(map[string]interface{}{"type": "join_room", "room_id": room.ID})
+	readFrame(t, bobConn, EventTypingSnapshot)
+	aliceConn.WriteJSON(map[string]interface{}{"type": "join_room", "room_id": room.ID})
+	readFrame(t, aliceConn, EventTypingSnapshot)
+
+	aliceConn.WriteJSON(map[string]interface{}{"type": "typing", "room_id": room.ID})
+	readFrame(t, bobConn, EventTyping)
+
+	aliceConn.WriteJSON(map[string]interface{}{"type": "chat", "room_id": room.ID, "content": "done typing"})
+	if frame := readFrame(t, bobConn, EventStopTyping); frame["user_id"] != float64(alice.ID) {
+		t.Errorf("Expected alice to stop typing, got %v", frame)
+	}
+	readFrame(t, bobConn, EventChat)
+}
+
+func TestWebSocket_RESTChangesAreFannedOut(t *testing.T) {
+	db := setupTestDB(t)
+	userRepo := repositories.NewUserRepository(db)
+	roomRepo := repositories.NewRoomRepository(db)
+	messageRepo := repositories.NewMessageRepository(db)
+
+	poster := &models.User{Username: "integration", Email: "bot@example.com", PasswordHash: "hash"}
+	reader := &models.User{Username: "reader", Email: "reader@example.com", PasswordHash: "hash"}
+	userRepo.Create(poster)
+	userRepo.Create(reader)
+	room := &models.Room{Name: "REST Room", Type: "public"}
+	roomRepo.Create(room)
+
+	wsHandler := NewWebSocketHandler(messageRepo, roomRepo, userRepo, nil, NewMemoryBroker())
+	bus := events.NewBus()
+	bus.Subscribe(wsHandler.Hub.HandleEvent)
+	messageHandler := NewMessageHandler(messageRepo, roomRepo, bus)
+	reactionHandler := NewReactionHandler(repositories.NewReactionRepository(db), messageRepo, roomRepo, bus)
+	receiptHandler := NewReadReceiptHandler(repositories.NewReadReceiptRepository(db), messageRepo, roomRepo, bus)
+
+	router := gin.New()
+	wsHandler.AllowTokenQuery = true
+	router.GET("/ws", wsHandler.HandleWebSocket)
+	authed := router.Group("/", func(c *gin.Context) {
+		c.Set("user_id", poster.ID)
+		c.Set("username", poster.Username)
+	})
+	authed.POST("/messages", messageHandler.SendMessage)
+	authed.POST("/messages/:id/reactions", reactionHandler.ToggleReaction)
+	authed.POST("/receipts", receiptHandler.MarkAsRead)
+	server := httptest.NewServer(router)
+	defer server.Close()
+
+	conn := dialWebSocket(t, server, reader)
+	conn.WriteJSON(map[string]interface{}{"type": EventJoinRoom, "room_id": room.ID})
+	readFrame(t, conn, EventRoomUserJoined)
+
+	post := func(path string, body map[string]interface{}) {
+		data, _ := json.Marshal(body)
+		resp, err := http.Post(server.URL+path, "application/json", bytes.NewReader(data))
+		if err != nil {
+			t.Fatalf("POST %s failed: %v", path, err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode >= 300 {
+			t.Fatalf("POST %s returned %d", path, resp.StatusCode)
+		}
+	}
+
+	post("/messages", map[string]interface{}{"room_id": room.ID, "content": "posted over REST"})
+	chat := readFrame(t, conn, EventChat)
+	message, _ := chat["message"].(map[string]interface{})
+	if message["content"] != "posted over REST" {
+		t.Fatalf("Expected REST message live, got %v", chat)
+	}
+	messageID := uint(message["id"].(float64))
+
+	post(fmt.Sprintf("/messages/%d/reactions", messageID), map[string]interface{}{"emoji": "👍"})
+	if frame := readFrame(t, conn, EventReaction); frame["emoji"] != "👍" || frame["added"] != true {
+		t.Errorf("Expected reaction added, got %v", frame)
+	}
+
+	post("/receipts", map[string]interface{}{"room_id": room.ID, "message_id": messageID})
+	if frame := readFrame(t, conn, EventReadReceipt); frame["user_id"] != float64(poster.ID) {
+		t.Errorf("Expected read receipt from poster, got %v", frame)
+	}
+}
+
+func TestWebSocket_RESTChangesNeedRoomAccess(t *testing.T) {
+	db := setupTestDB(t)
+	userRepo := repositories.NewUserRepository(db)
+	roomRepo := repositories.NewRoomRepository(db)
+	messageRepo := repositories.NewMessageRepository(db)
+	reactionRepo := repositories.NewReactionRepository(db)
+	receiptRepo := repositories.NewReadReceiptRepository(db)
+
+	outsider := &models.User{Username: "outsider", Email: "outsider@example.com", PasswordHash: "hash"}
+	member := &models.User{Username: "member", Email: "member@example.com", PasswordHash: "hash"}
+	userRepo.Create(outsider)
+	userRepo.Create(member)
+	room := &models.Room{Name: "Private Room", Type: "private", CreatedBy: member.ID}
+	roomRepo.Create(room)
+	roomRepo.AddMember(room.ID, member.ID)
+	existing := &models.Message{UserID: member.ID, RoomID: room.ID, Content: "members only"}
+	messageRepo.Create(existing)
+
+	wsHandler := NewWebSocketHandler(messageRepo, roomRepo, userRepo, nil, NewMemoryBroker())
+	bus := events.NewBus()
+	bus.Subscribe(wsHandler.Hub.HandleEvent)
+	messageHandler := NewMessageHandler(messageRepo, roomRepo, bus)
+	reactionHandler := NewReactionHandler(reactionRepo, messageRepo, roomRepo, bus)
+	receiptHandler := NewReadReceiptHandler(receiptRepo, messageRepo, roomRepo, bus)
+
+	router := gin.New()
+	wsHandler.AllowTokenQuery = true
+	router.GET("/ws", wsHandler.HandleWebSocket)
+	authed := router.Group("/", func(c *gin.Context) {
+		c.Set("user_id", outsider.ID)
+		c.Set("username", outsider.Username)
+	})
+	authed.POST("/messages", messageHandler.SendMessage)
+	authed.POST("/messages/:id/reactions", reactionHandler.ToggleReaction)
+	authed.POST("/receipts", receiptHandler.MarkAsRead)
+	server := httptest.NewServer(router)
+	defer server.Close()
+
+	conn := dialWebSocket(t, server, member)
+	conn.WriteJSON(map[string]interface{}{"type": EventJoinRoom, "room_id": room.ID})
+	readFrame(t, conn, EventRoomUserJoined)
+
+	expectForbidden := func(path string, body map[string]interface{}) {
+		data, _ := json.Marshal(body)
+		resp, err := http.Post(server.URL+path, "application/json", bytes.NewReader(data))
+		if err != nil {
+			t.Fatalf("POST %s failed: %v", path, err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusForbidden {
+			t.Errorf("POST %s: expected 403, got %d", path, resp.StatusCode)
+		}
+	}
+
+	expectForbidden("/messages", map[string]interface{}{"room_id": room.ID, "content": "let me in"})
+	expectForbidden(fmt.Sprintf("/messages/%d/reactions", existing.ID), map[string]interface{}{"emoji": "👍"})
+	expectForbidden("/receipts", map[string]interface{}{"room_id": room.ID, "message_id": existing.ID})
+
+	if messages, _ := messageRepo.FindByRoomID(room.ID, 50, 0); len(messages) != 1 {
+		t.Errorf("Expected only the member's message stored, got %d", len(messages))
+	}
+	if reactions, _ := reactionRepo.FindByMessageID(existing.ID); len(reactions) != 0 {
+		t.Errorf("Expected no reactions stored, got %d", len(reactions))
+	}
+	if receipt, _ := receiptRepo.GetLastRead(outsider.ID, room.ID); receipt != nil {
+		t.Error("Expected no read receipt stored for the outsider")
+	}
+
+	// Nothing reached the member's socket either
+	conn.SetReadDeadline(time.Now().Add(200 * time.Millisecond))
+	for {
+		_, data, err := conn.ReadMessage()
+		if err != nil {
+			break
+		}
+		for _, frameType := range []string{EventChat, EventReaction, EventReadReceipt} {
+			if bytes.Contains(data, []byte(`"type":"`+frameType+`"`)) {
+				t.Errorf("Unexpected frame %s", data)
+			}
+		}
+	}
+}
+
+func TestWebSocket_ReceiptNeedsMessageFromRoom(t *testing.T) {
+	db := setupTestDB(t)
+	userRepo := repositories.NewUserRepository(db)
+	roomRepo := repositories.NewRoomRepository(db)
+	messageRepo := repositories.NewMessageRepository(db)
+	receiptRepo := repositories.NewReadReceiptRepository(db)
+
+	reader := &models.User{Username: "reader", Email: "reader@example.com", PasswordHash: "hash"}
+	userRepo.Create(reader)
+	lobby := &models.Room{Name: "Lobby", Type: "public"}
+	secret := &models.Room{Name: "Secret", Type: "private"}
+	roomRepo.Create(lobby)
+	roomRepo.Create(secret)
+	elsewhere := &models.Message{UserID: reader.ID, RoomID: secret.ID, Content: "not in the lobby"}
+	messageRepo.Create(elsewhere)
+
+	bus := events.NewBus()
+	receiptHandler := NewReadReceiptHandler(receiptRepo, messageRepo, roomRepo, bus)
+	router := gin.New()
+	router.POST("/receipts", func(c *gin.Context) {
+		c.Set("user_id", reader.ID)
+		receiptHandler.MarkAsRead(c)
+	})
+
+	for _, messageID := range []uint{elsewhere.ID, elsewhere.ID + 100} {
+		w, _ := doJSON(router, "POST", "/receipts", "", map[string]interface{}{"room_id": lobby.ID, "message_id": messageID})
+		if w.Code != http.StatusNotFound {
+			t.Errorf("Message %d: expected 404, got %d", messageID, w.Code)
+		}
+	}
+	if receipt, _ := receiptRepo.GetLastRead(reader.ID, lobby.ID); receipt != nil {
+		t.Error("Expected no read receipt stored for a foreign message")
+	}
+}
+
+func TestWebSocket_ProfileUpdatesReachRoommates(t *testing.T) {
+	db := setupTestDB(t)
+	userRepo := repositories.NewUserRepository(db)
+	roomRepo := repositories.NewRoomRepository(db)
+
+	alice := &models.User{Username: "alice", Email: "alice@example.com", PasswordHash: "hash"}
+	bob := &models.User{Username: "bob", Email: "bob@example.com", PasswordHash: "hash"}
+	carol := &models.User{Username: "carol", Email: "carol@example.com", PasswordHash: "hash"}
+	userRepo.Create(alice)
+	userRepo.Create(bob)
+	userRepo.Create(carol)
+	room := &models.Room{Name: "Shared Room", Type: "private", CreatedBy: alice.ID}
+	roomRepo.Create(room)
+	roomRepo.AddMember(room.ID, alice.ID)
+	roomRepo.AddMember(room.ID, bob.ID)
+
+	broker := &recordingBroker{MemoryBroker: NewMemoryBroker()}
+	handler := NewWebSocketHandler(nil, roomRepo, userRepo, nil, broker)
+	server := setupWebSocketServer(t, handler)
+	bus := events.NewBus()
+	bus.Subscribe(handler.Hub.HandleEvent)
+
+	own := dialWebSocket(t, server, alice)
+	roommate := dialWebSocket(t, server, bob)
+	stranger := dialWebSocket(t, server, carol)
+	waitFor(t, func() bool {
+		return len(handler.Hub.UserDevices(alice.ID)) == 1 && len(handler.Hub.UserDevices(bob.ID)) == 1 && len(handler.Hub.UserDevices(carol.ID)) == 1
+	})
+
+	alice.DisplayName = "Alice A."
+	alice.Pronouns = "she/her"
+	bus.Publish(events.UserUpdated{User: alice})
+
+	frame := readFrame(t, roommate, EventUserUpdated)
+	if frame["user_id"] != float64(alice.ID) || frame["display_name"] != "Alice A." || frame["pronouns"] != "she/her" {
+		t.Errorf("Expected alice's new profile, got %v", frame)
+	}
+	if _, ok := frame["email"]; ok {
+		t.Error("Profile updates should not carry the email address")
+	}
+	readFrame(t, own, EventUserUpdated)
+
+	// One frame is published for everyone
+	if sent := broker.published(BrokerKindUsers); len(sent) != 1 || len(sent[0].UserIDs) != 2 {
+		t.Errorf("Expected a single publish for alice and bob, got %+v", sent)
+	}
+
+	// Frames reach a user in order, so anything for carol arrives first
+	handler.Hub.SendToUser(carol.ID, map[string]string{"type": "after"})
+	for {
+		frame := readFrame(t, stranger, "")
+		if frame["type"] == EventUserUpdated {
+			t.Fatal("Profile update reached a user sharing no room")
+		}
+		if frame["type"] == "after" {
+			break
+		}
+	}
+}
+
+func TestWebSocket_SendToUserReachesEveryDevice(t *testing.T) {
+	db := setupTestDB(t)
+	userRepo := repositories.NewUserRepository(db)
+
+	user := &models.User{Username: "multi", Email: "multi@example.com", PasswordHash: "hash"}
+	userRepo.Create(user)
+
+	handler := NewWebSocketHandler(nil, nil, userRepo, nil, NewMemoryBroker())
+	server := setupWebSocketServer(t, handler)
+
+	phone := dialDevice(t, server, user, "phone")
+	if frame := readFrame(t, phone, EventSession); frame["device_id"] != "phone" {
+		t.Fatalf("Expected phone session, got %v", frame)
+	}
+	laptop := dialWebSocket(t, server, user)
+	if frame := readFrame(t, laptop, EventSession); frame["device_id"] == "" {
+		t.Fatal("Devices without an ID should be given one")
+	}
+	waitFor(t, func() bool { return len(handler.Hub.UserDevices(user.ID)) == 2 })
+
+	// The second device does not disturb the first
+	handler.Hub.SendToUser(user.ID, map[string]string{"type": "notice"})
+	readFrame(t, phone, "notice")
+	readFrame(t, laptop, "notice")
+
+	handler.Hub.SendToDevice(user.ID, "phone", map[string]string{"type": "phone_only"})
+	handler.Hub.SendToUser(user.ID, map[string]string{"type": "after"})
+	readFrame(t, phone, "phone_only")
+	readFrame(t, laptop, "after")
+	for _, frame := range laptop.pending {
+		if frame["type"] == "phone_only" {
+			t.Error("Device-addressed frame reached another device")
+		}
+	}
+}
+
+func TestWebSocket_InvalidDeviceID(t *testing.T) {
+	db := setupTestDB(t)
+	userRepo := repositories.NewUserRepository(db)
+
+	user := &models.User{Username: "device", Email: "device@example.com", PasswordHash: "hash"}
+	userRepo.Create(user)
+
+	server := setupWebSocketServer(t, NewWebSocketHandler(nil, nil, userRepo, nil, NewMemoryBroker()))
+
+	token, _ := utils.GenerateToken(user.ID, user.Username, user.Email, "user", 0)
+	url := "ws" + strings.TrimPrefix(server.URL, "http") + "/ws?token=" + token + "&device_id=bad%20id"
+	_, resp, err := websocket.DefaultDialer.Dial(url, nil)
+	if err == nil {
+		t.Fatal("Expected dial to fail for an invalid device ID")
+	}
+	if resp == nil || resp.StatusCode != http.StatusBadRequest {
+		t.Errorf("Expected status 400, got %v", resp)
+	}
+}
+
+func TestWebSocket_ConnectSubscribesToMemberRooms(t *testing.T) {
+	db := setupTestDB(t)
+	userRepo := repositories.NewUserRepository(db)
+	roomRepo := repositories.NewRoomRepository(db)
+	messageRepo := repositories.NewMessageRepository(db)
+	receiptRepo := repositories.NewReadReceiptRepository(db)
+
+	user := &models.User{Username: "member", Email: "member@example.com", PasswordHash: "hash"}
+	friend := &models.User{Username: "friend", Email: "friend@example.com", PasswordHash: "hash"}
+	userRepo.Create(user)
+	userRepo.Create(friend)
+	busy := &models.Room{Name: "Busy", Type: "private"}
+	quiet := &models.Room{Name: "Quiet", Type: "public"}
+	other := &models.Room{Name: "Not Mine", Type: "public"}
+	roomRepo.Create(busy)
+	roomRepo.Create(quiet)
+	roomRepo.Create(other)
+	roomRepo.AddMember(busy.ID, user.ID)
+	roomRepo.AddMember(busy.ID, friend.ID)
+	roomRepo.AddMember(quiet.ID, user.ID)
+
+	seen := &models.Message{UserID: friend.ID, RoomID: busy.ID, Content: "seen"}
+	messageRepo.Create(seen)
+	messageRepo.Create(&models.Message{UserID: friend.ID, RoomID: busy.ID, Content: "new 1"})
+	messageRepo.Create(&models.Message{UserID: friend.ID, RoomID: busy.ID, Content: "new 2"})
+	receiptRepo.MarkAsRead(user.ID, busy.ID, seen.ID)
+
+	handler := NewWebSocketHandler(messageRepo, roomRepo, userRepo, receiptRepo, NewMemoryBroker())
+	server := setupWebSocketServer(t, handler)
+
+	conn := dialWebSocket(t, server, user)
+	ready := readFrame(t, conn, EventReady)
+
+	rooms, _ := ready["rooms"].([]interface{})
+	if len(rooms) != 2 {
+		t.Fatalf("Expected the 2 member rooms, got %v", ready["rooms"])
+	}
+	first := rooms[0].(map[string]interface{})
+	if first["id"] != float64(busy.ID) || first["unread_count"] != float64(2) {
+		t.Errorf("Expected 2 unread in busy room, got %v", first)
+	}
+	presence, _ := ready["presence"].([]interface{})
+	if len(presence) != 2 {
+		t.Errorf("Expected presence for the user and their roommate, got %v", ready["presence"])
+	}
+
+	// Room traffic arrives without a join_room frame
+	handler.Hub.BroadcastToRoom(busy.ID, []byte(`{"type":"chat","room_id":1}`))
+	readFrame(t, conn, EventChat)
+}
+
+func TestWebSocket_RESTJoinSubscribesLiveConnections(t *testing.T) {
+	db := setupTestDB(t)
+	userRepo := repositories.NewUserRepository(db)
+	roomRepo := repositories.NewRoomRepository(db)
+	messageRepo := repositories.NewMessageRepository(db)
+
+	user := &models.User{Username: "joiner", Email: "joiner@example.com", PasswordHash: "hash"}
+	userRepo.Create(user)
+	room := &models.Room{Name: "Later", Type: "public"}
+	roomRepo.Create(room)
+
+	wsHandler := NewWebSocketHandler(messageRepo, roomRepo, userRepo, nil, NewMemoryBroker())
+	bus := events.NewBus()
+	bus.Subscribe(wsHandler.Hub.HandleEvent)
+	roomHandler := NewRoomHandler(roomRepo, bus)
+
+	router := gin.New()
+	wsHandler.AllowTokenQuery = true
+	router.GET("/ws", wsHandler.HandleWebSocket)
+	router.POST("/rooms/:id/join", func(c *gin.Context) {
+		c.Set("user_id", user.ID)
+		c.Set("username", user.Username)
+		roomHandler.JoinRoom(c)
+	})
+	server := httptest.NewServer(router)
+	defer server.Close()
+
+	conn := dialWebSocket(t, server, user)
+	if rooms := readFrame(t, conn, EventReady)["rooms"].([]interface{}); len(rooms) != 0 {
+		t.Fatalf("Expected no rooms before joining, got %v", rooms)
+	}
+
+	resp, err := http.Post(server.URL+"/rooms/1/join", "application/json", nil)
+	if err != nil || resp.StatusCode != http.StatusOK {
+		t.Fatalf("Join failed: %v %v", err, resp)
+	}
+
+	readFrame(t, conn, EventTypingSnapshot)
+	if frame := readFrame(t, conn, EventRoomMemberJoined); frame["user_id"] != float64(user.ID) {
+		t.Errorf("Expected own room_member_joined, got %v", frame)
+	}
+
+	// The live connection now receives the room's traffic
+	wsHandler.Hub.BroadcastToRoom(room.ID, []byte(`{"type":"chat","room_id":1}`))
+	readFrame(t, conn, EventChat)
+}
+
+func TestWebSocket_TicketIsSingleUse(t *testing.T) {
+	db := setupTestDB(t)
+	userRepo := repositories.NewUserRepository(db)
+
+	user := &models.User{Username: "ticketed", Email: "ticketed@example.com", PasswordHash: "hash"}
+	userRepo.Create(user)
+
+	wsHandler := NewWebSocketHandler(repositories.NewMessageRepository(db), repositories.NewRoomRepository(db), userRepo, nil, NewMemoryBroker())
+	router := gin.New()
+	router.GET("/ws", wsHandler.HandleWebSocket)
+	router.POST("/ws/ticket", func(c *gin.Context) {
+		c.Set("user_id", user.ID)
+		c.Set("username", user.Username)
+		wsHandler.IssueTicket(c)
+	})
+	server := httptest.NewServer(router)
+	defer server.Close()
+
+	resp, err := http.Post(server.URL+"/ws/ticket", "application/json", nil)
+	if err != nil || resp.StatusCode != http.StatusCreated {
+		t.Fatalf("Issuing ticket failed: %v %v", err, resp)
+	}
+	var issued struct {
+		Ticket string `json:"ticket"`
+	}
+	json.NewDecoder(resp.Body).Decode(&issued)
+	resp.Body.Close()
+
+	url := "ws" + strings.TrimPrefix(server.URL, "http") + "/ws?ticket=" + issued.Ticket
+	conn, _, err := websocket.DefaultDialer.Dial(url, nil)
+	if err != nil {
+		t.Fatalf("Failed to dial with ticket: %v", err)
+	}
+	defer conn.Close()
+	if frame := readFrame(t, &testConn{Conn: conn}, EventSession); frame["device_id"] == "" {
+		t.Errorf("Expected a session frame, got %v", frame)
+	}
+
+	_, resp, err = websocket.DefaultDialer.Dial(url, nil)
+	if err == nil {
+		t.Fatal("Expected a redeemed ticket to be rejected")
+	}
+	if resp == nil || resp.StatusCode != http.StatusUnauthorized {
+		t.Errorf("Expected status 401 for a reused ticket, got %v", resp)
+	}
+}
+
+func TestWebSocket_TicketInSubprotocol(t *testing.T) {
+	db := setupTestDB(t)
+	userRepo := repositories.NewUserRepository(db)
+
+	user := &models.User{Username: "header", Email: "header@example.com", PasswordHash: "hash"}
+	userRepo.Create(user)
+
+	wsHandler := NewWebSocketHandler(repositories.NewMessageRepository(db), repositories.NewRoomRepository(db), userRepo, nil, NewMemoryBroker())
+	server := setupWebSocketServer(t, wsHandler)
+	ticket, _ := wsHandler.Tickets.Issue(WSTicket{UserID: user.ID, Username: user.Username}, ticketTTL)
+
+	dialer := websocket.Dialer{Subprotocols: []string{ProtocolV1, ticketProtocolPrefix + ticket}}
+	conn, _, err := dialer.Dial("ws"+strings.TrimPrefix(server.URL, "http")+"/ws", nil)
+	if err != nil {
+		t.Fatalf("Failed to dial with ticket subprotocol: %v", err)
+	}
+	defer conn.Close()
+
+	// The ticket is never echoed back as the negotiated protocol
+	if conn.Subprotocol() != ProtocolV1 {
+		t.Errorf("Expected negotiated protocol %s, got %q", ProtocolV1, conn.Subprotocol())
+	}
+}
+
+func TestWebSocket_TokenQueryIsOptIn(t *testing.T) {
+	db := setupTestDB(t)
+	userRepo := repositories.NewUserRepository(db)
+	sessionRepo := repositories.NewSessionRepository(db)
+
+	user := &models.User{Username: "legacy", Email: "legacy@example.com", PasswordHash: "hash"}
+	userRepo.Create(user)
+	session := &models.Session{UserID: user.ID, ExpiresAt: time.Now().Add(30 * 24 * time.Hour)}
+	sessionRepo.Create(session)
+	token, _ := utils.GenerateToken(user.ID, user.Username, user.Email, "user", session.ID)
+
+	wsHandler := NewWebSocketHandler(repositories.NewMessageRepository(db), repositories.NewRoomRepository(db), userRepo, nil, NewMemoryBroker())
+	wsHandler.Sessions = sessionRepo
+	router := gin.New()
+	router.GET("/ws", wsHandler.HandleWebSocket)
+	server := httptest.NewServer(router)
+	defer server.Close()
+	url := "ws" + strings.TrimPrefix(server.URL, "http") + "/ws?token=" + token
+
+	_, resp, err := websocket.DefaultDialer.Dial(url, nil)
+	if err == nil || resp == nil || resp.StatusCode != http.StatusUnauthorized {
+		t.Fatalf("Expected status 401 for ?token= by default, got %v %v", err, resp)
+	}
+
+	wsHandler.AllowTokenQuery = true
+	conn, _, err := websocket.DefaultDialer.Dial(url, nil)
+	if err != nil {
+		t.Fatalf("Failed to dial with ?token= allowed: %v", err)
+	}
+	defer conn.Close()
+	readFrame(t, &testConn{Conn: conn}, EventSession)
+
+	// The connection ends with the access token, not the 30-day session
+	wsHandler.Hub.mu.RLock()
+	for client := range wsHandler.Hub.Users[user.ID] {
+		if time.Until(client.ExpiresAt) > utils.AccessTokenTTL {
+			t.Errorf("Connection lasts until %v, past the access token", client.ExpiresAt)
+		}
+	}
+	wsHandler.Hub.mu.RUnlock()
+}
+
+// expectClose reads until the server closes the connection and returns the code
+func expectClose(t *testing.T, conn *websocket.Conn) int {
+	t.Helper()
+	conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+	for {
+		if _, _, err := conn.ReadMessage(); err != nil {
+			if closeErr, ok := err.(*websocket.CloseError); ok {
+				return closeErr.Code
+			}
+			t.Fatalf("Expected a close frame, got %v", err)
+		}
+	}
+}
+
+func TestWebSocket_ClosedWhenTokenExpires(t *testing.T) {
+	db := setupTestDB(t)
+	userRepo := repositories.NewUserRepository(db)
+
+	user := &models.User{Username: "expiring", Email: "expiring@example.com", PasswordHash: "hash"}
+	userRepo.Create(user)
+
+	wsHandler := NewWebSocketHandler(repositories.NewMessageRepository(db), repositories.NewRoomRepository(db), userRepo, nil, NewMemoryBroker())
+	server := setupWebSocketServer(t, wsHandler)
+	ticket, _ := wsHandler.Tickets.Issue(WSTicket{
+		UserID:         user.ID,
+		Username:       user.Username,
+		TokenExpiresAt: time.Now().Add(200 * time.Millisecond),
+	}, ticketTTL)
+
+	conn, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(server.URL, "http")+"/ws?ticket="+ticket, nil)
+	if err != nil {
+		t.Fatalf("Failed to dial with ticket: %v", err)
+	}
+	defer conn.Close()
+
+	if code := expectClose(t, conn); code != CloseTokenExpired {
+		t.Errorf("Expected close code %d, got %d", CloseTokenExpired, code)
+	}
+}
+
+func TestWebSocket_DisconnectUser(t *testing.T) {
+	db := setupTestDB(t)
+	userRepo := repositories.NewUserRepository(db)
+
+	alice := &models.User{Username: "alice", Email: "alice@example.com", PasswordHash: "hash"}
+	bob := &models.User{Username: "bob", Email: "bob@example.com", PasswordHash: "hash"}
+	userRepo.Create(alice)
+	userRepo.Create(bob)
+
+	wsHandler := NewWebSocketHandler(repositories.NewMessageRepository(db), repositories.NewRoomRepository(db), userRepo, nil, NewMemoryBroker())
+	server := setupWebSocketServer(t, wsHandler)
+	phone := dialDevice(t, server, alice, "phone")
+	laptop := dialDevice(t, server, alice, "laptop")
+	other := dialWebSocket(t, server, bob)
+	for _, conn := range []*testConn{phone, laptop, other} {
+		readFrame(t, conn, EventReady)
+	}
+
+	if err := wsHandler.Hub.DisconnectUser(alice.ID, CloseSessionRevoked, "session revoked"); err != nil {
+		t.Fatalf("DisconnectUser failed: %v", err)
+	}
+
+	for _, conn := range []*testConn{phone, laptop} {
+		if code := expectClose(t, conn.Conn); code != CloseSessionRevoked {
+			t.Errorf("Expected close code %d, got %d", CloseSessionRevoked, code)
+		}
+	}
+
+	// Other users stay connected
+	wsHandler.Hub.BroadcastToUser(bob.ID, []byte(`{"type":"chat"}`))
+	readFrame(t, other, EventChat)
+}
@@ -1,29 +1,75 @@
 package handlers
 
 import (
+	"GoChatApp/models"
+	"GoChatApp/repositories"
+	"crypto/rand"
+	"encoding/hex"
 	"encoding/json"
 	"log"
+	"sort"
 	"sync"
+	"sync/atomic"
+	"time"
 
 	"github.com/gorilla/websocket"
 )
 
-// Client represents a WebSocket client
+// Client represents a connected device, over WebSocket or SSE
 type Client struct {
-	Hub      *Hub
-	Conn     *websocket.Conn
-	Send     chan []byte
-	UserID   uint
-	Username string
-	Rooms    map[uint]bool // Rooms the client has joined
+	Hub       *Hub
+	Transport Transport // Connection the client's frames are written to
+	Send      chan *Frame
+	UserID    uint
+	Username  string
+	DeviceID  string        // Identifies the device, stable across reconnects when the client sends one
+	SessionID uint          // Login session the connection belongs to, 0 if unknown
+	Rooms     map[uint]bool // Rooms the client has joined
+	Protocol  string        // Negotiated protocol version
+
+	// When the credentials the connection was opened with expire, zero if never
+	ExpiresAt time.Time
+
+	// Closes the connection at ExpiresAt, guarded by Hub.mu
+	expiry *time.Timer
+
+	// Rooms to subscribe the client to as Run registers it, set by
+	// AutoSubscribe before the client is sent to Register
+	subscription *pendingSubscription
+
+	// Time of the last inbound frame, guarded by Hub.mu
+	lastActive time.Time
+
+	// Replay state per room, guarded by Hub.mu
+	replaying       map[uint][]RoomMessage // Live room frames held back while history is replayed
+	replayedThrough map[uint]uint          // Highest message ID replayed per room
+
+	// When a typing frame was last relayed per room, guarded by Hub.mu
+	typing map[uint]time.Time
+
+	// Set once Send is closed, guarded by Hub.mu. WritePump reads the close
+	// code after seeing Send closed.
+	closed      bool
+	closeCode   int
+	closeReason string
+
+	// Set when an eviction has been scheduled
+	evicting atomic.Bool
+
+	// Closed when WritePump returns, nil if it never ran
+	writerDone chan struct{}
 }
 
 // RoomMessage represents a message to be sent to a specific room
 type RoomMessage struct {
-	RoomID  uint
-	Message []byte
+	RoomID    uint
+	MessageID uint // Stored message carried by the frame, 0 if none
+	Message   []byte
 }
 
+// maxReplayMessages caps how many missed messages are replayed on join
+const maxReplayMessages = 100
+
 // Hub maintains the set of active clients and broadcasts messages to clients
 type Hub struct {
 	// Registered clients
@@ -32,6 +78,9 @@ type Hub struct {
 	// Clients organized by room
 	Rooms map[uint]map[*Client]bool
 
+	// Clients organized by user, one entry per device
+	Users map[uint]map[*Client]bool
+
 	// Inbound messages from clients
 	Broadcast chan []byte
 
@@ -46,205 +95,585 @@ type Hub struct {
 
 	// Mutex for thread-safe operations
 	mu sync.RWMutex
+
+	// Repository used to persist chat messages sent over the socket
+	messageRepo *repositories.MessageRepository
+
+	// Repository used to check room privacy and membership
+	roomRepo *repositories.RoomRepository
+
+	// Repository used to record when users were last seen
+	userRepo *repositories.UserRepository
+
+	// Repository used to count unread messages for the ready frame
+	receiptRepo *repositories.ReadReceiptRepository
+
+	// Broker that carries broadcasts to every server instance
+	broker Broker
+
+	// Identifies this instance in presence messages
+	instanceID string
+
+	// Status this instance last published per user, guarded by mu
+	localStatus map[uint]localPresence
+
+	// Status per user per instance, across all instances
+	presence   map[uint]map[string]presenceEntry
+	presenceMu sync.RWMutex
+
+	// Users typing per room, across all instances. typingMu is never held
+	// while acquiring mu.
+	typing   map[uint]map[uint]typingEntry
+	typingMu sync.Mutex
+
+	// What to do with clients whose send buffer is full
+	SlowConsumerPolicy SlowConsumerPolicy
+
+	// Set by Shutdown, guarded by mu. New connections are refused.
+	shuttingDown bool
+
+	// Delivery counters, see Stats
+	framesDropped        atomic.Uint64
+	slowConsumersEvicted atomic.Uint64
 }
 
 // NewHub creates a new Hub
-func NewHub() *Hub {
+func NewHub(messageRepo *repositories.MessageRepository, roomRepo *repositories.RoomRepository, userRepo *repositories.UserRepository, receiptRepo *repositories.ReadReceiptRepository, broker Broker) *Hub {
 	return &Hub{
+		messageRepo:   messageRepo,
+		roomRepo:      roomRepo,
+		userRepo:      userRepo,
+		receiptRepo:   receiptRepo,
+		broker:        broker,
+		instanceID:    newRandomID(),
+		localStatus:   make(map[uint]localPresence),
+		presence:      make(map[uint]map[string]presenceEntry),
+		typing:        make(map[uint]map[uint]typingEntry),
 		Clients:       make(map[*Client]bool),
 		Rooms:         make(map[uint]map[*Client]bool),
+		Users:         make(map[uint]map[*Client]bool),
 		Broadcast:     make(chan []byte, 256),
 		RoomBroadcast: make(chan RoomMessage, 256),
 		Register:      make(chan *Client),
 		Unregister:    make(chan *Client),
+
+		SlowConsumerPolicy: SlowConsumerDisconnect,
 	}
 }
 
+// newRandomID returns a random ID for a server instance or device
+func newRandomID() string {
+	b := make([]byte, 8)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
 // Run starts the hub and handles client registration, unregistration, and broadcasting
 func (h *Hub) Run() {
+	presenceTicker := time.NewTicker(presenceCheckPeriod)
+	defer presenceTicker.Stop()
+	typingTicker := time.NewTicker(typingSweepPeriod)
+	defer typingTicker.Stop()
+
+	// Learn who is online through the other instances
+	h.requestPresenceSync()
+
 	for {
 		select {
 		case client := <-h.Register:
 			h.mu.Lock()
+			if h.shuttingDown {
+				// Upgraded just as the hub shut down
+				client.closed = true
+				client.closeCode = websocket.CloseServiceRestart
+				client.closeReason = reconnectHint()
+				close(client.Send)
+				h.mu.Unlock()
+				continue
+			}
 			h.Clients[client] = true
+			if h.Users[client.UserID] == nil {
+				h.Users[client.UserID] = make(map[*Client]bool)
+			}
+			h.Users[client.UserID][client] = true
+			client.lastActive = time.Now()
+			h.scheduleExpiryLocked(client)
+			h.subscribeLocked(client)
+			presenceEvent, changed := h.presenceChangeLocked(client.UserID, client.Username)
+			log.Printf("Client registered: %s (ID: %d, device %s). Total clients: %d", client.Username, client.UserID, client.DeviceID, len(h.Clients))
 			h.mu.Unlock()
-			log.Printf("Client registered: %s (ID: %d). Total clients: %d", client.Username, client.UserID, len(h.Clients))
 
-			// Broadcast user join notification
-			joinMsg := map[string]interface{}{
-				"type":     "user_joined",
-				"user_id":  client.UserID,
-				"username": client.Username,
+			// Announce the user coming online (only for their first connection)
+			if changed {
+				h.publishPresence(presenceEvent)
 			}
-			if msgBytes, err := json.Marshal(joinMsg); err == nil {
-				h.BroadcastToAll(msgBytes)
+			if sub := client.subscription; sub != nil && sub.sinceMessageID > 0 {
+				go h.replaySubscription(client, sub)
 			}
 
 		case client := <-h.Unregister:
-			h.mu.Lock()
-			if _, ok := h.Clients[client]; ok {
-				// Remove client from all rooms
-				for roomID := range client.Rooms {
-					if room, exists := h.Rooms[roomID]; exists {
-						delete(room, client)
-						if len(room) == 0 {
-							delete(h.Rooms, roomID)
-						}
-					}
-				}
-				delete(h.Clients, client)
-				close(client.Send)
-				log.Printf("Client unregistered: %s (ID: %d). Total clients: %d", client.Username, client.UserID, len(h.Clients))
-
-				// Broadcast user leave notification
-				leaveMsg := map[string]interface{}{
-					"type":     "user_left",
-					"user_id":  client.UserID,
-					"username": client.Username,
-				}
-				if msgBytes, err := json.Marshal(leaveMsg); err == nil {
-					h.BroadcastToAll(msgBytes)
-				}
-			}
-			h.mu.Unlock()
+			// Already gone if the client was evicted
+			h.removeClient(client, 0, "")
+
+		case <-presenceTicker.C:
+			h.refreshPresence()
+
+		case now := <-typingTicker.C:
+			h.expireTyping(now)
 
 		case message := <-h.Broadcast:
 			h.BroadcastToAll(message)
 
 		case roomMsg := <-h.RoomBroadcast:
-			h.BroadcastToRoom(roomMsg.RoomID, roomMsg.Message)
+			h.broadcastRoomMessage(roomMsg)
 		}
 	}
 }
 
 // BroadcastToAll sends a message to all connected clients
 func (h *Hub) BroadcastToAll(message []byte) {
+	h.publish(BrokerMessage{Kind: BrokerKindAll, Payload: message})
+}
+
+// BroadcastToRoom sends a message to all clients in a specific room
+func (h *Hub) BroadcastToRoom(roomID uint, message []byte) {
+	h.broadcastRoomMessage(RoomMessage{RoomID: roomID, Message: message})
+}
+
+// BroadcastToUser sends a message to every connection of a user
+func (h *Hub) BroadcastToUser(userID uint, message []byte) {
+	h.publish(BrokerMessage{Kind: BrokerKindUser, UserID: userID, Payload: message})
+}
+
+// SendToUser sends an event to every device of a user on every instance
+func (h *Hub) SendToUser(userID uint, event interface{}) error {
+	msgBytes, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+	h.BroadcastToUser(userID, msgBytes)
+	return nil
+}
+
+// SendToUsers sends an event to every device of several users on every
+// instance, encoding and publishing it once
+func (h *Hub) SendToUsers(userIDs []uint, event interface{}) error {
+	msgBytes, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+	h.publish(BrokerMessage{Kind: BrokerKindUsers, UserIDs: userIDs, Payload: msgBytes})
+	return nil
+}
+
+// SendToDevice sends an event to a single device of a user
+func (h *Hub) SendToDevice(userID uint, deviceID string, event interface{}) error {
+	msgBytes, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+	h.publish(BrokerMessage{Kind: BrokerKindUser, UserID: userID, DeviceID: deviceID, Payload: msgBytes})
+	return nil
+}
+
+// broadcastRoomMessage publishes a room frame to every instance
+func (h *Hub) broadcastRoomMessage(roomMsg RoomMessage) {
+	h.publish(BrokerMessage{
+		Kind:      BrokerKindRoom,
+		RoomID:    roomMsg.RoomID,
+		MessageID: roomMsg.MessageID,
+		Payload:   roomMsg.Message,
+	})
+}
+
+// publish hands a message to the broker; it must not be called while holding h.mu
+func (h *Hub) publish(msg BrokerMessage) {
+	if err := h.broker.Publish(msg); err != nil {
+		log.Printf("Error publishing %s message: %v", msg.Kind, err)
+	}
+}
+
+// deliver handles a message from the broker for this instance's clients
+func (h *Hub) deliver(msg BrokerMessage) {
+	switch msg.Kind {
+	case BrokerKindAll:
+		h.deliverToAll(msg.Payload)
+	case BrokerKindRoom:
+		h.deliverToRoom(RoomMessage{RoomID: msg.RoomID, MessageID: msg.MessageID, Message: msg.Payload})
+	case BrokerKindUser:
+		h.deliverToUser(msg.UserID, msg.DeviceID, msg.Payload)
+	case BrokerKindUsers:
+		h.deliverToUsers(msg.UserIDs, msg.Payload)
+	case BrokerKindRevokeRoom:
+		h.revokeRoom(msg.UserID, msg.RoomID)
+	case BrokerKindJoinRoom:
+		h.subscribeUser(msg.UserID, msg.RoomID)
+	case BrokerKindPresence:
+		h.deliverPresence(msg)
+	case BrokerKindPresenceSnapshot:
+		h.deliverPresenceSnapshot(msg)
+	case BrokerKindPresenceSync:
+		h.deliverPresenceSync(msg)
+	case BrokerKindTyping:
+		h.deliverTyping(msg)
+	case BrokerKindDisconnect:
+		h.deliverDisconnect(msg)
+	default:
+		log.Printf("Ignoring broker message of unknown kind %q", msg.Kind)
+	}
+}
+
+// deliverToAll sends a message to all local clients
+func (h *Hub) deliverToAll(message []byte) {
 	h.mu.RLock()
 	defer h.mu.RUnlock()
 
+	frame := newFrame(message)
 	for client := range h.Clients {
-		select {
-		case client.Send <- message:
-		default:
-			// Client's send channel is full, close and remove client
-			close(client.Send)
-			delete(h.Clients, client)
+		h.enqueueLocked(client, frame)
+	}
+}
+
+// deliverToRoom sends a room frame to local subscribers, holding it back for
+// clients that are still replaying the room's history
+func (h *Hub) deliverToRoom(roomMsg RoomMessage) {
+	// Full lock: replay buffers and the room map may be modified
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if room, exists := h.Rooms[roomMsg.RoomID]; exists {
+		frame := newFrame(roomMsg.Message)
+		for client := range room {
+			if pending, replaying := client.replaying[roomMsg.RoomID]; replaying {
+				client.replaying[roomMsg.RoomID] = append(pending, roomMsg)
+				continue
+			}
+			// Already delivered by the replay
+			if roomMsg.MessageID != 0 && roomMsg.MessageID <= client.replayedThrough[roomMsg.RoomID] {
+				continue
+			}
+			h.enqueueLocked(client, frame)
 		}
 	}
 }
 
-// BroadcastToRoom sends a message to all clients in a specific room
-func (h *Hub) BroadcastToRoom(roomID uint, message []byte) {
+// deliverToUser sends a message to a user's local connections, or only to
+// the given device when deviceID is set
+func (h *Hub) deliverToUser(userID uint, deviceID string, message []byte) {
 	h.mu.RLock()
 	defer h.mu.RUnlock()
 
-	if room, exists := h.Rooms[roomID]; exists {
-		for client := range room {
-			select {
-			case client.Send <- message:
-			default:
-				close(client.Send)
-				delete(h.Clients, client)
-				delete(room, client)
-			}
+	frame := newFrame(message)
+	for client := range h.Users[userID] {
+		if deviceID != "" && client.DeviceID != deviceID {
+			continue
 		}
+		h.enqueueLocked(client, frame)
 	}
 }
 
-// JoinRoom adds a client to a room
-func (h *Hub) JoinRoom(client *Client, roomID uint) {
-	h.mu.Lock()
-	defer h.mu.Unlock()
+// deliverToUsers sends a message to the local connections of several users
+func (h *Hub) deliverToUsers(userIDs []uint, message []byte) {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
 
-	// Initialize room if it doesn't exist
-	if _, exists := h.Rooms[roomID]; !exists {
-		h.Rooms[roomID] = make(map[*Client]bool)
+	frame := newFrame(message)
+	seen := make(map[uint]bool, len(userIDs))
+	for _, userID := range userIDs {
+		if seen[userID] {
+			continue
+		}
+		seen[userID] = true
+		for client := range h.Users[userID] {
+			h.enqueueLocked(client, frame)
+		}
 	}
+}
 
-	h.Rooms[roomID][client] = true
-	client.Rooms[roomID] = true
+// UserDevices returns the device IDs a user is connected from on this instance
+func (h *Hub) UserDevices(userID uint) []string {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+
+	devices := make([]string, 0, len(h.Users[userID]))
+	for client := range h.Users[userID] {
+		devices = append(devices, client.DeviceID)
+	}
+	return devices
+}
+
+// JoinRoom adds a client to a room. When sinceMessageID is set, messages
+// stored after it are replayed before live delivery resumes.
+func (h *Hub) JoinRoom(client *Client, roomID uint, sinceMessageID uint) {
+	h.subscribe(client, roomID, sinceMessageID > 0)
+	if sinceMessageID > 0 {
+		h.replayHistory(client, []uint{roomID}, sinceMessageID)
+	}
+}
+
+// subscribe adds a client to a room and announces it to the room
+func (h *Hub) subscribe(client *Client, roomID uint, replay bool) {
+	h.mu.Lock()
+	if !h.addToRoomLocked(client, roomID) {
+		h.mu.Unlock()
+		return
+	}
+	if replay {
+		// Hold back live room traffic until the replay has been queued
+		client.replaying[roomID] = nil
+	}
+	client.queue(h.typingSnapshot(roomID))
+	h.mu.Unlock()
 
 	log.Printf("Client %s joined room %d", client.Username, roomID)
 
 	// Notify room members
-	joinMsg := map[string]interface{}{
-		"type":     "room_user_joined",
-		"room_id":  roomID,
-		"user_id":  client.UserID,
-		"username": client.Username,
+	joinMsg := RoomMembershipEvent{
+		Type:     EventRoomUserJoined,
+		RoomID:   roomID,
+		UserID:   client.UserID,
+		Username: client.Username,
 	}
 	if msgBytes, err := json.Marshal(joinMsg); err == nil {
-		for c := range h.Rooms[roomID] {
-			select {
-			case c.Send <- msgBytes:
-			default:
-			}
-		}
+		h.BroadcastToRoom(roomID, msgBytes)
 	}
 }
 
-// LeaveRoom removes a client from a room
-func (h *Hub) LeaveRoom(client *Client, roomID uint) {
+// replayHistory sends a client the messages it missed in some rooms, then
+// releases live frames that arrived in the meantime without duplicates.
+// Messages are replayed in ID order across the rooms, so a stream cut short
+// can resume from the last ID it saw. At most maxReplayMessages are
+// replayed in all, the newest; each room missing older ones gets a
+// history_truncated frame first.
+func (h *Hub) replayHistory(client *Client, roomIDs []uint, sinceMessageID uint) {
+	var messages []models.Message
+	truncated := make(map[uint]bool)
+	var loadErr error
+	for _, roomID := range roomIDs {
+		roomMessages, err := h.messageRepo.FindByRoomIDSince(roomID, sinceMessageID, maxReplayMessages+1)
+		if err != nil {
+			log.Printf("Error loading history for room %d: %v", roomID, err)
+			loadErr = err
+		}
+		if len(roomMessages) > maxReplayMessages {
+			roomMessages = roomMessages[1:]
+			truncated[roomID] = true
+		}
+		messages = append(messages, roomMessages...)
+	}
+
+	sort.Slice(messages, func(i, j int) bool { return messages[i].ID < messages[j].ID })
+	if excess := len(messages) - maxReplayMessages; excess > 0 {
+		for _, message := range messages[:excess] {
+			truncated[message.RoomID] = true
+		}
+		messages = messages[excess:]
+	}
+
 	h.mu.Lock()
 	defer h.mu.Unlock()
 
-	if room, exists := h.Rooms[roomID]; exists {
-		delete(room, client)
-		delete(client.Rooms, roomID)
+	// Rooms the client left, or every room if it disconnected, during the
+	// lookup are not replayed
+	pending := make(map[uint][]RoomMessage, len(roomIDs))
+	for _, roomID := range roomIDs {
+		if roomPending, replaying := client.replaying[roomID]; replaying {
+			pending[roomID] = roomPending
+			delete(client.replaying, roomID)
+		}
+	}
+	if len(pending) == 0 {
+		return
+	}
+
+	if loadErr != nil {
+		client.queue(ErrorEvent{Type: EventError, Code: ErrCodeInternal, Message: "failed to replay history", Ref: EventJoinRoom})
+	}
 
-		// Clean up empty rooms
-		if len(room) == 0 {
-			delete(h.Rooms, roomID)
+	// Rooms that kept none of their messages lost only ones older than
+	// everything replayed
+	firstID := make(map[uint]uint)
+	for _, message := range messages {
+		if firstID[message.RoomID] == 0 {
+			firstID[message.RoomID] = message.ID
 		}
+	}
+	for _, roomID := range roomIDs {
+		if _, ok := pending[roomID]; !ok || !truncated[roomID] {
+			continue
+		}
+		first, ok := firstID[roomID]
+		if !ok {
+			first = messages[0].ID
+		}
+		client.queue(HistoryTruncatedEvent{
+			Type:           EventHistoryTruncated,
+			RoomID:         roomID,
+			SinceMessageID: sinceMessageID,
+			FirstMessageID: first,
+		})
+	}
 
-		log.Printf("Client %s left room %d", client.Username, roomID)
+	lastID := make(map[uint]uint, len(pending))
+	for roomID := range pending {
+		lastID[roomID] = sinceMessageID
+	}
+	for i := range messages {
+		roomID := messages[i].RoomID
+		if _, ok := pending[roomID]; !ok {
+			continue
+		}
+		client.queue(ChatMessageEvent{
+			Type:     EventChat,
+			RoomID:   roomID,
+			Message:  &messages[i],
+			Replayed: true,
+		})
+		lastID[roomID] = messages[i].ID
+	}
 
-		// Notify remaining room members
-		leaveMsg := map[string]interface{}{
-			"type":     "room_user_left",
-			"room_id":  roomID,
-			"user_id":  client.UserID,
-			"username": client.Username,
+	for _, roomID := range roomIDs {
+		roomPending, ok := pending[roomID]
+		if !ok {
+			continue
 		}
-		if msgBytes, err := json.Marshal(leaveMsg); err == nil {
-			for c := range h.Rooms[roomID] {
-				select {
-				case c.Send <- msgBytes:
-				default:
-				}
+		client.replayedThrough[roomID] = lastID[roomID]
+		for _, roomMsg := range roomPending {
+			if roomMsg.MessageID != 0 && roomMsg.MessageID <= lastID[roomID] {
+				continue
 			}
+			h.enqueueLocked(client, newFrame(roomMsg.Message))
 		}
 	}
 }
 
-// GetConnectedUsers returns a list of currently connected users
-func (h *Hub) GetConnectedUsers() []map[string]interface{} {
-	h.mu.RLock()
-	defer h.mu.RUnlock()
+// LeaveRoom removes a client from a room
+func (h *Hub) LeaveRoom(client *Client, roomID uint) {
+	h.mu.Lock()
+	typing := h.takeTypingLocked(client, roomID)
+	left := h.leaveRoomLocked(client, roomID)
+	h.mu.Unlock()
 
-	users := make([]map[string]interface{}, 0, len(h.Clients))
-	for client := range h.Clients {
-		users = append(users, map[string]interface{}{
-			"user_id":  client.UserID,
-			"username": client.Username,
+	if typing {
+		h.publishTyping(EventStopTyping, roomID, client.UserID, client.Username, time.Time{})
+	}
+	if left {
+		h.announceLeave(client, roomID)
+	}
+}
+
+// AddUserToRoom subscribes every live connection of a user to a room on
+// every instance. It is called when the user becomes a member.
+func (h *Hub) AddUserToRoom(userID, roomID uint) {
+	h.publish(BrokerMessage{Kind: BrokerKindJoinRoom, UserID: userID, RoomID: roomID})
+}
+
+// RemoveUserFromRoom cuts every live subscription a user has to a room on
+// every instance. It is called when the user's membership is revoked.
+func (h *Hub) RemoveUserFromRoom(userID, roomID uint) {
+	h.publish(BrokerMessage{Kind: BrokerKindRevokeRoom, UserID: userID, RoomID: roomID})
+}
+
+// revokeRoom cuts a user's local subscriptions to a room
+func (h *Hub) revokeRoom(userID, roomID uint) {
+	var removed []*Client
+	typing := false
+
+	h.mu.Lock()
+	for client := range h.Rooms[roomID] {
+		if client.UserID != userID {
+			continue
+		}
+		if h.takeTypingLocked(client, roomID) {
+			typing = true
+		}
+		h.leaveRoomLocked(client, roomID)
+		removed = append(removed, client)
+
+		// Let the removed connection know it no longer receives room traffic
+		client.queue(RoomMembershipEvent{
+			Type:     EventRoomUserLeft,
+			RoomID:   roomID,
+			UserID:   client.UserID,
+			Username: client.Username,
 		})
 	}
-	return users
+	h.mu.Unlock()
+
+	// Every instance revokes its own connections, so clear the indicator locally
+	if typing {
+		h.typingMu.Lock()
+		delete(h.typing[roomID], userID)
+		h.typingMu.Unlock()
+	}
+
+	for _, client := range removed {
+		h.announceLeave(client, roomID)
+	}
 }
 
-// GetRoomUsers returns a list of users in a specific room
-func (h *Hub) GetRoomUsers(roomID uint) []map[string]interface{} {
+// IsSubscribed reports whether a client has joined a room
+func (h *Hub) IsSubscribed(client *Client, roomID uint) bool {
 	h.mu.RLock()
 	defer h.mu.RUnlock()
 
-	users := make([]map[string]interface{}, 0)
-	if room, exists := h.Rooms[roomID]; exists {
-		for client := range room {
-			users = append(users, map[string]interface{}{
-				"user_id":  client.UserID,
-				"username": client.Username,
-			})
-		}
+	return client.Rooms[roomID]
+}
+
+// CanAccessRoom reports whether a user may read and post in a room
+func (h *Hub) CanAccessRoom(userID, roomID uint) (bool, error) {
+	return h.roomRepo.CanAccess(roomID, userID)
+}
+
+// addToRoomLocked subscribes a client to a room's traffic and reports
+// whether it did; the caller must hold h.mu
+func (h *Hub) addToRoomLocked(client *Client, roomID uint) bool {
+	// A client that disconnected meanwhile must not linger in the room
+	if client.closed {
+		return false
+	}
+
+	// Initialize room if it doesn't exist
+	if _, exists := h.Rooms[roomID]; !exists {
+		h.Rooms[roomID] = make(map[*Client]bool)
+	}
+
+	h.Rooms[roomID][client] = true
+	client.Rooms[roomID] = true
+	return true
+}
+
+// leaveRoomLocked removes a client from a room and reports whether it was
+// subscribed; the caller must hold h.mu
+func (h *Hub) leaveRoomLocked(client *Client, roomID uint) bool {
+	room, exists := h.Rooms[roomID]
+	if !exists || !room[client] {
+		return false
+	}
+
+	delete(room, client)
+	delete(client.Rooms, roomID)
+	delete(client.replaying, roomID)
+	delete(client.replayedThrough, roomID)
+
+	// Clean up empty rooms
+	if len(room) == 0 {
+		delete(h.Rooms, roomID)
+	}
+
+	log.Printf("Client %s left room %d", client.Username, roomID)
+	return true
+}
+
+// announceLeave notifies remaining room members that a client left
+func (h *Hub) announceLeave(client *Client, roomID uint) {
+	leaveMsg := RoomMembershipEvent{
+		Type:     EventRoomUserLeft,
+		RoomID:   roomID,
+		UserID:   client.UserID,
+		Username: client.Username,
+	}
+	if msgBytes, err := json.Marshal(leaveMsg); err == nil {
+		h.BroadcastToRoom(roomID, msgBytes)
 	}
-	return users
 }
@@ -0,0 +1,384 @@
+package handlers
+
+import (
+	"encoding/json"
+	"log"
+	"time"
+)
+
+// Presence statuses
+const (
+	PresenceOnline  = "online"
+	PresenceAway    = "away"
+	PresenceOffline = "offline"
+)
+
+const (
+	// A user with no inbound frames on any connection for this long is away
+	awayAfter = 5 * time.Minute
+
+	// How often idle connections are checked, and how often each instance
+	// sends the statuses it holds to the others as a heartbeat
+	presenceCheckPeriod = 30 * time.Second
+
+	// How long an instance's statuses last without a heartbeat. A few
+	// periods, so one lost snapshot does not take users offline.
+	presenceTTL = 3 * presenceCheckPeriod
+)
+
+// presenceRank orders statuses so the most present one wins across instances
+var presenceRank = map[string]int{
+	PresenceOffline: 0,
+	PresenceAway:    1,
+	PresenceOnline:  2,
+}
+
+// touch records activity on a connection, bringing its user back online
+func (h *Hub) touch(client *Client) {
+	h.mu.Lock()
+	if _, ok := h.Clients[client]; !ok {
+		h.mu.Unlock()
+		return
+	}
+	client.lastActive = time.Now()
+	event, changed := h.presenceChangeLocked(client.UserID, client.Username)
+	h.mu.Unlock()
+
+	if changed {
+		h.publishPresence(event)
+	}
+}
+
+// touchUser records activity by a user outside their connections, such as a
+// message sent over REST, so clients that only receive (SSE) stay online
+func (h *Hub) touchUser(userID uint) {
+	h.mu.Lock()
+	devices := h.Users[userID]
+	if len(devices) == 0 {
+		h.mu.Unlock()
+		return
+	}
+	var username string
+	now := time.Now()
+	for client := range devices {
+		client.lastActive = now
+		username = client.Username
+	}
+	event, changed := h.presenceChangeLocked(userID, username)
+	h.mu.Unlock()
+
+	if changed {
+		h.publishPresence(event)
+	}
+}
+
+// refreshPresence moves idle users to away, sends the heartbeat snapshot
+// and drops statuses whose instance has gone quiet
+func (h *Hub) refreshPresence() {
+	var events []PresenceEvent
+
+	h.mu.Lock()
+	for userID, status := range h.localStatus {
+		username := status.username
+		if event, changed := h.presenceChangeLocked(userID, username); changed {
+			events = append(events, event)
+		}
+	}
+	h.mu.Unlock()
+
+	for _, event := range events {
+		h.publishPresence(event)
+	}
+
+	h.publishPresenceSnapshot()
+	h.expirePresence(time.Now())
+}
+
+// presenceEntry is a user's status on one instance
+type presenceEntry struct {
+	status    string
+	username  string
+	expiresAt time.Time
+}
+
+// localPresence is the status this instance last published for a user
+type localPresence struct {
+	status   string
+	username string
+}
+
+// presenceChangeLocked recomputes a user's status from this instance's
+// connections and reports whether it changed; the caller must hold h.mu
+func (h *Hub) presenceChangeLocked(userID uint, username string) (PresenceEvent, bool) {
+	status := h.localStatusLocked(userID, time.Now())
+
+	previous, known := h.localStatus[userID]
+	if (known && previous.status == status) || (!known && status == PresenceOffline) {
+		return PresenceEvent{}, false
+	}
+
+	if status == PresenceOffline {
+		delete(h.localStatus, userID)
+	} else {
+		h.localStatus[userID] = localPresence{status: status, username: username}
+	}
+
+	return PresenceEvent{
+		Type:     EventPresence,
+		UserID:   userID,
+		Username: username,
+		Status:   status,
+	}, true
+}
+
+// localStatusLocked derives a user's status from this instance's connections
+func (h *Hub) localStatusLocked(userID uint, now time.Time) string {
+	status := PresenceOffline
+	for client := range h.Users[userID] {
+		if now.Sub(client.lastActive) < awayAfter {
+			return PresenceOnline
+		}
+		status = PresenceAway
+	}
+	return status
+}
+
+// publishPresence shares a local status change with every instance,
+// recording last_seen_at when the user goes offline here
+func (h *Hub) publishPresence(event PresenceEvent) {
+	if event.Status == PresenceOffline {
+		now := time.Now()
+		event.LastSeenAt = &now
+		if h.userRepo != nil {
+			if err := h.userRepo.UpdateLastSeen(event.UserID, now); err != nil {
+				log.Printf("Error saving last seen for user %d: %v", event.UserID, err)
+			}
+		}
+	}
+
+	payload, err := json.Marshal(event)
+	if err != nil {
+		return
+	}
+	h.publish(BrokerMessage{
+		Kind:     BrokerKindPresence,
+		UserID:   event.UserID,
+		Instance: h.instanceID,
+		Payload:  payload,
+	})
+}
+
+// deliverPresence folds one instance's status for a user into the overall
+// status, notifying users who share a room when it changes
+func (h *Hub) deliverPresence(msg BrokerMessage) {
+	var event PresenceEvent
+	if err := json.Unmarshal(msg.Payload, &event); err != nil {
+		log.Printf("Error decoding presence message: %v", err)
+		return
+	}
+
+	h.presenceMu.Lock()
+	before := effectivePresence(h.presence[msg.UserID])
+	h.setPresenceLocked(msg.UserID, msg.Instance, event.Status, event.Username, time.Now().Add(presenceTTL))
+	after := effectivePresence(h.presence[msg.UserID])
+	h.presenceMu.Unlock()
+
+	if before != after {
+		h.announcePresence(event, after)
+	}
+}
+
+// setPresenceLocked records one instance's status for a user, forgetting it
+// when offline; the caller must hold h.presenceMu
+func (h *Hub) setPresenceLocked(userID uint, instance, status, username string, expiresAt time.Time) {
+	instances := h.presence[userID]
+	if status == PresenceOffline {
+		delete(instances, instance)
+		if len(instances) == 0 {
+			delete(h.presence, userID)
+		}
+		return
+	}
+	if instances == nil {
+		instances = make(map[string]presenceEntry)
+		h.presence[userID] = instances
+	}
+	instances[instance] = presenceEntry{status: status, username: username, expiresAt: expiresAt}
+}
+
+// announcePresence tells a user and everyone sharing a room with them that
+// their overall status is now status. Every instance announces to its own
+// connections.
+func (h *Hub) announcePresence(event PresenceEvent, status string) {
+	event.Type = EventPresence
+	event.Status = status
+	if status != PresenceOffline {
+		event.LastSeenAt = nil
+	}
+	payload, err := json.Marshal(event)
+	if err != nil {
+		return
+	}
+
+	recipients := []uint{event.UserID}
+	if h.roomRepo != nil {
+		roommates, err := h.roomRepo.FindRoommateIDs(event.UserID)
+		if err != nil {
+			log.Printf("Error finding roommates of user %d: %v", event.UserID, err)
+		}
+		recipients = append(recipients, roommates...)
+	}
+	h.deliverToUsers(recipients, payload)
+}
+
+// publishPresenceSnapshot shares every status this instance holds. Sent
+// each presenceCheckPeriod as a heartbeat, and when another instance asks.
+func (h *Hub) publishPresenceSnapshot() {
+	h.mu.RLock()
+	snapshot := make([]PresenceEvent, 0, len(h.localStatus))
+	for userID, status := range h.localStatus {
+		snapshot = append(snapshot, PresenceEvent{
+			Type:     EventPresence,
+			UserID:   userID,
+			Username: status.username,
+			Status:   status.status,
+		})
+	}
+	h.mu.RUnlock()
+
+	payload, err := json.Marshal(snapshot)
+	if err != nil {
+		return
+	}
+	h.publish(BrokerMessage{Kind: BrokerKindPresenceSnapshot, Instance: h.instanceID, Payload: payload})
+}
+
+// requestPresenceSync asks the other instances for their snapshots, so a
+// new instance does not report everyone offline until their next heartbeat
+func (h *Hub) requestPresenceSync() {
+	h.publish(BrokerMessage{Kind: BrokerKindPresenceSync, Instance: h.instanceID})
+}
+
+// deliverPresenceSync answers another instance's request for snapshots
+func (h *Hub) deliverPresenceSync(msg BrokerMessage) {
+	if msg.Instance == h.instanceID {
+		return
+	}
+	h.publishPresenceSnapshot()
+}
+
+// deliverPresenceSnapshot replaces everything known about an instance's
+// statuses with its snapshot, renewing their expiry. Users it no longer
+// lists are treated as gone offline there.
+func (h *Hub) deliverPresenceSnapshot(msg BrokerMessage) {
+	var snapshot []PresenceEvent
+	if err := json.Unmarshal(msg.Payload, &snapshot); err != nil {
+		log.Printf("Error decoding presence snapshot: %v", err)
+		return
+	}
+
+	listed := make(map[uint]PresenceEvent, len(snapshot))
+	for _, event := range snapshot {
+		listed[event.UserID] = event
+	}
+	expiresAt := time.Now().Add(presenceTTL)
+
+	var changes []PresenceEvent
+	var statuses []string
+	h.presenceMu.Lock()
+	for userID, instances := range h.presence {
+		entry, ok := instances[msg.Instance]
+		if _, still := listed[userID]; ok && !still {
+			listed[userID] = PresenceEvent{UserID: userID, Username: entry.username, Status: PresenceOffline}
+		}
+	}
+	for userID, event := range listed {
+		before := effectivePresence(h.presence[userID])
+		h.setPresenceLocked(userID, msg.Instance, event.Status, event.Username, expiresAt)
+		if after := effectivePresence(h.presence[userID]); after != before {
+			changes = append(changes, event)
+			statuses = append(statuses, after)
+		}
+	}
+	h.presenceMu.Unlock()
+
+	for i, event := range changes {
+		h.announcePresence(event, statuses[i])
+	}
+}
+
+// expirePresence drops statuses whose instance stopped sending heartbeats,
+// such as one that crashed. Every instance sweeps its own view.
+func (h *Hub) expirePresence(now time.Time) {
+	var changes []PresenceEvent
+	var statuses []string
+
+	h.presenceMu.Lock()
+	for userID, instances := range h.presence {
+		before := effectivePresence(instances)
+		expired := false
+		var username string
+		var lastSeen time.Time
+		for instance, entry := range instances {
+			if now.Before(entry.expiresAt) {
+				continue
+			}
+			delete(instances, instance)
+			expired = true
+			username = entry.username
+			lastSeen = entry.expiresAt.Add(-presenceTTL)
+		}
+		if !expired {
+			continue
+		}
+		if len(instances) == 0 {
+			delete(h.presence, userID)
+		}
+		if after := effectivePresence(instances); after != before {
+			changes = append(changes, PresenceEvent{UserID: userID, Username: username, LastSeenAt: &lastSeen})
+			statuses = append(statuses, after)
+		}
+	}
+	h.presenceMu.Unlock()
+
+	// The instance that lost the user never got to record when they left
+	for i, event := range changes {
+		if statuses[i] == PresenceOffline && h.userRepo != nil {
+			if err := h.userRepo.UpdateLastSeen(event.UserID, *event.LastSeenAt); err != nil {
+				log.Printf("Error saving last seen for user %d: %v", event.UserID, err)
+			}
+		}
+		h.announcePresence(event, statuses[i])
+	}
+}
+
+// effectivePresence picks the most present status across instances
+func effectivePresence(instances map[string]presenceEntry) string {
+	status := PresenceOffline
+	for _, entry := range instances {
+		if presenceRank[entry.status] > presenceRank[status] {
+			status = entry.status
+		}
+	}
+	return status
+}
+
+// PresenceOf returns a user's status across all instances
+func (h *Hub) PresenceOf(userID uint) string {
+	h.presenceMu.RLock()
+	defer h.presenceMu.RUnlock()
+
+	return effectivePresence(h.presence[userID])
+}
+
+// OnlineUserIDs returns every user who is online or away
+func (h *Hub) OnlineUserIDs() []uint {
+	h.presenceMu.RLock()
+	defer h.presenceMu.RUnlock()
+
+	ids := make([]uint, 0, len(h.presence))
+	for userID := range h.presence {
+		ids = append(ids, userID)
+	}
+	return ids
+}
@@ -0,0 +1,151 @@
+package handlers
+
+import (
+	"GoChatApp/models"
+	"log"
+)
+
+// pendingSubscription is what AutoSubscribe loads for Run to apply when it
+// registers a client
+type pendingSubscription struct {
+	ready          ReadyEvent
+	users          []models.User // The user and their roommates, for the ready frame's presence
+	sinceMessageID uint
+}
+
+// AutoSubscribe registers a new connection, subscribing it to every room
+// its user is a member of and queueing a ready frame describing those rooms
+// and the presence of the people in them. A connection resuming a stream
+// gets the messages newer than sinceMessageID replayed after the ready
+// frame. The rooms are loaded here and handed to Run with the client, so
+// the client is registered and subscribed under one lock.
+func (h *Hub) AutoSubscribe(client *Client, sinceMessageID uint) {
+	sub := &pendingSubscription{
+		ready: ReadyEvent{
+			Type:     EventReady,
+			Rooms:    []ReadyRoom{},
+			Presence: []UserPresence{},
+		},
+		sinceMessageID: sinceMessageID,
+	}
+
+	if h.roomRepo != nil {
+		rooms, err := h.roomRepo.FindByMember(client.UserID)
+		if err != nil {
+			log.Printf("Error loading rooms of user %d: %v", client.UserID, err)
+		}
+
+		roomIDs := make([]uint, len(rooms))
+		for i, room := range rooms {
+			roomIDs[i] = room.ID
+		}
+		unread := map[uint]int64{}
+		if h.receiptRepo != nil {
+			if counts, err := h.receiptRepo.GetUnreadCounts(client.UserID, roomIDs); err == nil {
+				unread = counts
+			} else {
+				log.Printf("Error counting unread messages of user %d: %v", client.UserID, err)
+			}
+		}
+
+		for _, room := range rooms {
+			sub.ready.Rooms = append(sub.ready.Rooms, ReadyRoom{
+				ID:          room.ID,
+				Name:        room.Name,
+				Type:        room.Type,
+				UnreadCount: unread[room.ID],
+			})
+		}
+		sub.users = h.presenceUsers(client.UserID)
+	}
+
+	client.subscription = sub
+	h.Register <- client
+}
+
+// subscribeLocked subscribes a client being registered to the rooms
+// AutoSubscribe loaded for it and queues its ready frame, so room traffic
+// never reaches the client before it; the caller must hold h.mu
+func (h *Hub) subscribeLocked(client *Client) {
+	sub := client.subscription
+	if sub == nil {
+		return
+	}
+
+	ready := &sub.ready
+	for i := range ready.Rooms {
+		h.addToRoomLocked(client, ready.Rooms[i].ID)
+		if sub.sinceMessageID > 0 {
+			// Hold back live room traffic until the replay has been queued
+			client.replaying[ready.Rooms[i].ID] = nil
+		}
+		ready.Rooms[i].Typing = h.typingSnapshot(ready.Rooms[i].ID).Users
+	}
+	if sub.users != nil {
+		ready.Presence = h.PresenceOfUsers(sub.users, false)
+	}
+	client.queue(*ready)
+}
+
+// replaySubscription replays the messages a resuming client missed in the
+// rooms it was subscribed to on registration
+func (h *Hub) replaySubscription(client *Client, sub *pendingSubscription) {
+	roomIDs := make([]uint, len(sub.ready.Rooms))
+	for i, room := range sub.ready.Rooms {
+		roomIDs[i] = room.ID
+	}
+	h.replayHistory(client, roomIDs, sub.sinceMessageID)
+}
+
+// presenceUsers loads a user and everyone sharing a room with them
+func (h *Hub) presenceUsers(userID uint) []models.User {
+	userIDs, err := h.roomRepo.FindRoommateIDs(userID)
+	if err != nil {
+		log.Printf("Error finding roommates of user %d: %v", userID, err)
+	}
+	userIDs = append(userIDs, userID)
+
+	if h.userRepo == nil {
+		return nil
+	}
+	users, err := h.userRepo.FindByIDs(userIDs)
+	if err != nil {
+		log.Printf("Error loading users for presence snapshot: %v", err)
+	}
+	return users
+}
+
+// PresenceOfUsers pairs users with their current status, optionally
+// leaving out those who are offline
+func (h *Hub) PresenceOfUsers(users []models.User, onlineOnly bool) []UserPresence {
+	result := make([]UserPresence, 0, len(users))
+	for _, user := range users {
+		status := h.PresenceOf(user.ID)
+		if onlineOnly && status == PresenceOffline {
+			continue
+		}
+		result = append(result, UserPresence{
+			UserID:     user.ID,
+			Username:   user.Username,
+			Status:     status,
+			LastSeenAt: user.LastSeenAt,
+		})
+	}
+	return result
+}
+
+// subscribeUser adds a user's local connections to a room they just became
+// a member of, sending each the room's typing snapshot
+func (h *Hub) subscribeUser(userID, roomID uint) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	for client := range h.Users[userID] {
+		if client.Rooms[roomID] {
+			continue
+		}
+		if h.addToRoomLocked(client, roomID) {
+			client.queue(h.typingSnapshot(roomID))
+		}
+	}
+}
@@ -0,0 +1,69 @@
+package handlers
+
+import (
+	"encoding/json"
+	"log"
+	"time"
+)
+
+// disconnectPayload is the close frame sent by a disconnect broker message
+type disconnectPayload struct {
+	Code   int    `json:"code"`
+	Reason string `json:"reason"`
+}
+
+// scheduleExpiryLocked arranges for a client to be closed with
+// CloseTokenExpired once its credentials expire. The caller must hold h.mu.
+func (h *Hub) scheduleExpiryLocked(client *Client) {
+	if client.ExpiresAt.IsZero() {
+		return
+	}
+	client.expiry = time.AfterFunc(time.Until(client.ExpiresAt), func() {
+		if h.removeClient(client, CloseTokenExpired, "token expired") {
+			log.Printf("Closed connection of %s (ID: %d): token expired", client.Username, client.UserID)
+		}
+	})
+}
+
+// DisconnectUser closes every connection of a user on every instance with
+// the given close code, e.g. CloseSessionRevoked after a logout
+func (h *Hub) DisconnectUser(userID uint, code int, reason string) error {
+	payload, err := json.Marshal(disconnectPayload{Code: code, Reason: reason})
+	if err != nil {
+		return err
+	}
+	return h.broker.Publish(BrokerMessage{Kind: BrokerKindDisconnect, UserID: userID, Payload: payload})
+}
+
+// DisconnectSession closes the connections of one login session on every
+// instance, leaving the user's other devices connected
+func (h *Hub) DisconnectSession(userID, sessionID uint, code int, reason string) error {
+	payload, err := json.Marshal(disconnectPayload{Code: code, Reason: reason})
+	if err != nil {
+		return err
+	}
+	return h.broker.Publish(BrokerMessage{Kind: BrokerKindDisconnect, UserID: userID, SessionID: sessionID, Payload: payload})
+}
+
+// deliverDisconnect closes a user's local connections, or those of a
+// single session
+func (h *Hub) deliverDisconnect(msg BrokerMessage) {
+	var payload disconnectPayload
+	if err := json.Unmarshal(msg.Payload, &payload); err != nil {
+		log.Printf("Error decoding disconnect of user %d: %v", msg.UserID, err)
+		return
+	}
+
+	h.mu.RLock()
+	clients := make([]*Client, 0, len(h.Users[msg.UserID]))
+	for client := range h.Users[msg.UserID] {
+		if msg.SessionID == 0 || client.SessionID == msg.SessionID {
+			clients = append(clients, client)
+		}
+	}
+	h.mu.RUnlock()
+
+	for _, client := range clients {
+		h.removeClient(client, payload.Code, payload.Reason)
+	}
+}
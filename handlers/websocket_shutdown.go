@@ -0,0 +1,74 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"math/rand/v2"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// Clients are asked to wait between these bounds before reconnecting after a
+// shutdown, so they do not all come back at the same moment
+const (
+	shutdownReconnectMin    = time.Second
+	shutdownReconnectJitter = 4 * time.Second
+)
+
+// shutdownReason is the close reason sent with 1012, telling the client
+// when to reconnect
+type shutdownReason struct {
+	ReconnectAfterMs int64 `json:"reconnect_after_ms"`
+}
+
+// Accepting reports whether the hub takes new connections
+func (h *Hub) Accepting() bool {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	return !h.shuttingDown
+}
+
+// Shutdown stops accepting connections and closes every open one with 1012
+// (service restart) and a hint of when to reconnect. Frames already queued
+// are written before the close frame. It returns once every connection is
+// flushed, or with ctx's error after cutting the ones that are not.
+func (h *Hub) Shutdown(ctx context.Context) error {
+	h.mu.Lock()
+	h.shuttingDown = true
+	clients := make([]*Client, 0, len(h.Clients))
+	for client := range h.Clients {
+		clients = append(clients, client)
+	}
+	h.mu.Unlock()
+
+	for _, client := range clients {
+		h.removeClient(client, websocket.CloseServiceRestart, reconnectHint())
+	}
+
+	for _, client := range clients {
+		if client.writerDone == nil {
+			continue
+		}
+		select {
+		case <-client.writerDone:
+		case <-ctx.Done():
+			// Cut the connections that could not be flushed in time
+			for _, client := range clients {
+				if client.Transport != nil {
+					client.Transport.Close()
+				}
+			}
+			return ctx.Err()
+		}
+	}
+	return nil
+}
+
+// reconnectHint returns a close reason asking the client to reconnect after
+// a randomized delay
+func reconnectHint() string {
+	delay := shutdownReconnectMin + rand.N(shutdownReconnectJitter)
+	reason, _ := json.Marshal(shutdownReason{ReconnectAfterMs: delay.Milliseconds()})
+	return string(reason)
+}
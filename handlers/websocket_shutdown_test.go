@@ -0,0 +1,109 @@
+package handlers
+
+import (
+	"GoChatApp/models"
+	"GoChatApp/repositories"
+	"context"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+func TestHub_ShutdownFlushesAndCloses(t *testing.T) {
+	db := setupTestDB(t)
+	userRepo := repositories.NewUserRepository(db)
+
+	user := &models.User{Username: "draining", Email: "draining@example.com", PasswordHash: "hash"}
+	userRepo.Create(user)
+
+	wsHandler := NewWebSocketHandler(repositories.NewMessageRepository(db), repositories.NewRoomRepository(db), userRepo, nil, NewMemoryBroker())
+	server := setupWebSocketServer(t, wsHandler)
+	conn := dialWebSocket(t, server, user)
+	readFrame(t, conn, EventReady)
+
+	// Queue a frame right before shutting down; it must not be lost
+	wsHandler.Hub.BroadcastToUser(user.ID, []byte(`{"type":"chat"}`))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	if err := wsHandler.Hub.Shutdown(ctx); err != nil {
+		t.Fatalf("Shutdown failed: %v", err)
+	}
+
+	readFrame(t, conn, EventChat)
+
+	conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+	_, _, err := conn.ReadMessage()
+	closeErr, ok := err.(*websocket.CloseError)
+	if !ok || closeErr.Code != websocket.CloseServiceRestart {
+		t.Fatalf("Expected close code 1012, got %v", err)
+	}
+	var reason shutdownReason
+	if err := json.Unmarshal([]byte(closeErr.Text), &reason); err != nil {
+		t.Fatalf("Expected a JSON reconnect hint, got %q", closeErr.Text)
+	}
+	minMs, maxMs := shutdownReconnectMin.Milliseconds(), (shutdownReconnectMin + shutdownReconnectJitter).Milliseconds()
+	if reason.ReconnectAfterMs < minMs || reason.ReconnectAfterMs > maxMs {
+		t.Errorf("Expected reconnect hint between %d and %d ms, got %d", minMs, maxMs, reason.ReconnectAfterMs)
+	}
+
+	// New connections are refused
+	url := "ws" + strings.TrimPrefix(server.URL, "http") + "/ws"
+	_, resp, err := websocket.DefaultDialer.Dial(url, nil)
+	if err == nil {
+		t.Fatal("Expected connections to be refused after shutdown")
+	}
+	if resp == nil || resp.StatusCode != http.StatusServiceUnavailable {
+		t.Errorf("Expected status 503 after shutdown, got %v", resp)
+	}
+}
+
+func TestHub_ClientRefusedAtShutdownJoinsNoRooms(t *testing.T) {
+	db := setupTestDB(t)
+	userRepo := repositories.NewUserRepository(db)
+	roomRepo := repositories.NewRoomRepository(db)
+
+	user := &models.User{Username: "late", Email: "late@example.com", PasswordHash: "hash"}
+	userRepo.Create(user)
+	room := &models.Room{Name: "Lobby", CreatedBy: user.ID}
+	roomRepo.Create(room)
+	roomRepo.AddMember(room.ID, user.ID)
+
+	hub := NewHub(repositories.NewMessageRepository(db), roomRepo, userRepo, nil, NewMemoryBroker())
+	go hub.Run()
+	if err := hub.Shutdown(context.Background()); err != nil {
+		t.Fatalf("Shutdown failed: %v", err)
+	}
+
+	// Upgraded just as the hub shut down
+	client := &Client{
+		Hub:             hub,
+		Send:            make(chan *Frame, 256),
+		UserID:          user.ID,
+		Username:        user.Username,
+		Rooms:           make(map[uint]bool),
+		replaying:       make(map[uint][]RoomMessage),
+		replayedThrough: make(map[uint]uint),
+		typing:          make(map[uint]time.Time),
+	}
+	hub.AutoSubscribe(client, 0)
+
+	timeout := time.After(2 * time.Second)
+	for open := true; open; {
+		select {
+		case _, open = <-client.Send:
+		case <-timeout:
+			t.Fatal("Expected the client to be closed")
+		}
+	}
+
+	hub.mu.RLock()
+	defer hub.mu.RUnlock()
+	if len(hub.Rooms[room.ID]) != 0 || len(client.Rooms) != 0 {
+		t.Errorf("Expected a refused client in no rooms, got %v", hub.Rooms[room.ID])
+	}
+}
@@ -0,0 +1,115 @@
+package handlers
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ticketTTL is how long a ticket can wait before it is redeemed
+const ticketTTL = 10 * time.Second
+
+// ticketProtocolPrefix marks a ticket carried in Sec-WebSocket-Protocol
+const ticketProtocolPrefix = "ticket."
+
+// Close codes sent when the credentials behind a connection stop being valid
+const (
+	CloseTokenExpired   = 4001 // The token the connection was opened with expired
+	CloseSessionRevoked = 4003 // The session was revoked, e.g. on logout
+)
+
+// ErrTicketInvalid is returned for unknown, expired or already used tickets
+var ErrTicketInvalid = errors.New("invalid or expired ticket")
+
+// WSTicket is what a ticket stands for until it is redeemed
+type WSTicket struct {
+	UserID         uint      `json:"user_id"`
+	Username       string    `json:"username"`
+	SessionID      uint      `json:"session_id,omitempty"`
+	TokenExpiresAt time.Time `json:"token_expires_at"` // Expiry of the session (or token) the ticket was issued for
+}
+
+// TicketStore holds single-use WebSocket tickets. Stores shared between
+// instances let a ticket issued by one be redeemed at another.
+type TicketStore interface {
+	Issue(ticket WSTicket, ttl time.Duration) (string, error)
+	Redeem(id string) (WSTicket, error)
+}
+
+type memoryTicket struct {
+	ticket    WSTicket
+	expiresAt time.Time
+}
+
+// MemoryTicketStore keeps tickets within a single process
+type MemoryTicketStore struct {
+	mu      sync.Mutex
+	tickets map[string]memoryTicket
+}
+
+// NewMemoryTicketStore creates a ticket store for single-instance deployments
+func NewMemoryTicketStore() *MemoryTicketStore {
+	return &MemoryTicketStore{tickets: make(map[string]memoryTicket)}
+}
+
+// Issue stores a ticket and returns its ID
+func (s *MemoryTicketStore) Issue(ticket WSTicket, ttl time.Duration) (string, error) {
+	id, err := newTicketID()
+	if err != nil {
+		return "", err
+	}
+	now := time.Now()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	// Drop tickets that were never redeemed
+	for key, stored := range s.tickets {
+		if now.After(stored.expiresAt) {
+			delete(s.tickets, key)
+		}
+	}
+	s.tickets[id] = memoryTicket{ticket: ticket, expiresAt: now.Add(ttl)}
+	return id, nil
+}
+
+// Redeem consumes a ticket, which cannot be used again
+func (s *MemoryTicketStore) Redeem(id string) (WSTicket, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	stored, ok := s.tickets[id]
+	if !ok {
+		return WSTicket{}, ErrTicketInvalid
+	}
+	delete(s.tickets, id)
+	if time.Now().After(stored.expiresAt) {
+		return WSTicket{}, ErrTicketInvalid
+	}
+	return stored.ticket, nil
+}
+
+// newTicketID returns an unguessable, URL and header safe ticket ID
+func newTicketID() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// splitTicketProtocol separates a ticket offered as a subprotocol from the
+// protocol versions the client asked for
+func splitTicketProtocol(requested []string) (ticket string, protocols []string) {
+	for _, p := range requested {
+		if strings.HasPrefix(p, ticketProtocolPrefix) {
+			ticket = strings.TrimPrefix(p, ticketProtocolPrefix)
+			continue
+		}
+		protocols = append(protocols, p)
+	}
+	return ticket, protocols
+}
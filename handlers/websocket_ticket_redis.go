@@ -0,0 +1,73 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// redisTicketPrefix namespaces ticket keys in Redis
+const redisTicketPrefix = "gochat:ticket:"
+
+// RedisTicketStore shares tickets between server instances, so the instance
+// that upgrades the connection need not be the one that issued the ticket
+type RedisTicketStore struct {
+	client *redis.Client
+}
+
+// NewRedisTicketStore connects to Redis at the given URL (redis://host:port/db)
+func NewRedisTicketStore(url string) (*RedisTicketStore, error) {
+	opts, err := redis.ParseURL(url)
+	if err != nil {
+		return nil, err
+	}
+
+	client := redis.NewClient(opts)
+	if err := client.Ping(context.Background()).Err(); err != nil {
+		client.Close()
+		return nil, err
+	}
+
+	return &RedisTicketStore{client: client}, nil
+}
+
+// Issue stores a ticket that Redis expires after ttl
+func (s *RedisTicketStore) Issue(ticket WSTicket, ttl time.Duration) (string, error) {
+	id, err := newTicketID()
+	if err != nil {
+		return "", err
+	}
+	data, err := json.Marshal(ticket)
+	if err != nil {
+		return "", err
+	}
+	if err := s.client.Set(context.Background(), redisTicketPrefix+id, data, ttl).Err(); err != nil {
+		return "", err
+	}
+	return id, nil
+}
+
+// Redeem atomically reads and deletes a ticket, so only one upgrade can use it
+func (s *RedisTicketStore) Redeem(id string) (WSTicket, error) {
+	data, err := s.client.GetDel(context.Background(), redisTicketPrefix+id).Bytes()
+	if errors.Is(err, redis.Nil) {
+		return WSTicket{}, ErrTicketInvalid
+	}
+	if err != nil {
+		return WSTicket{}, err
+	}
+
+	var ticket WSTicket
+	if err := json.Unmarshal(data, &ticket); err != nil {
+		return WSTicket{}, err
+	}
+	return ticket, nil
+}
+
+// Close closes the connection
+func (s *RedisTicketStore) Close() error {
+	return s.client.Close()
+}
@@ -0,0 +1,54 @@
+package handlers
+
+import (
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+)
+
+func TestMemoryTicketStore_Expires(t *testing.T) {
+	store := NewMemoryTicketStore()
+
+	id, err := store.Issue(WSTicket{UserID: 1, Username: "alice"}, time.Millisecond)
+	if err != nil {
+		t.Fatalf("Issue failed: %v", err)
+	}
+	time.Sleep(5 * time.Millisecond)
+
+	if _, err := store.Redeem(id); err != ErrTicketInvalid {
+		t.Errorf("Expected expired ticket to be invalid, got %v", err)
+	}
+}
+
+func TestRedisTicketStore_SingleUse(t *testing.T) {
+	redisServer := miniredis.RunT(t)
+	store, err := NewRedisTicketStore("redis://" + redisServer.Addr())
+	if err != nil {
+		t.Fatalf("Failed to connect to Redis: %v", err)
+	}
+	defer store.Close()
+
+	id, err := store.Issue(WSTicket{UserID: 1, Username: "alice"}, ticketTTL)
+	if err != nil {
+		t.Fatalf("Issue failed: %v", err)
+	}
+
+	ticket, err := store.Redeem(id)
+	if err != nil || ticket.UserID != 1 || ticket.Username != "alice" {
+		t.Fatalf("Expected alice's ticket, got %+v, %v", ticket, err)
+	}
+	if _, err := store.Redeem(id); err != ErrTicketInvalid {
+		t.Errorf("Expected redeemed ticket to be invalid, got %v", err)
+	}
+}
+
+func TestSplitTicketProtocol(t *testing.T) {
+	ticket, protocols := splitTicketProtocol([]string{ProtocolV1, "ticket.abc-_123"})
+	if ticket != "abc-_123" {
+		t.Errorf("Expected ticket abc-_123, got %q", ticket)
+	}
+	if len(protocols) != 1 || protocols[0] != ProtocolV1 {
+		t.Errorf("Expected only %s left, got %v", ProtocolV1, protocols)
+	}
+}
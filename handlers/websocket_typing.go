@@ -0,0 +1,171 @@
+package handlers
+
+import (
+	"encoding/json"
+	"log"
+	"time"
+)
+
+const (
+	// How long a typing indicator stays on without being refreshed
+	typingTTL = 6 * time.Second
+
+	// Repeated typing frames from a connection are relayed at most this often.
+	// Must be shorter than typingTTL so a steady typist never expires.
+	typingThrottle = 3 * time.Second
+
+	// How often expired typing indicators are cleared
+	typingSweepPeriod = time.Second
+)
+
+// typingEntry is a user currently typing in a room
+type typingEntry struct {
+	username  string
+	expiresAt time.Time
+}
+
+// StartTyping marks a client's user as typing in a room it has joined.
+// Frames arriving within typingThrottle of the last relayed one are dropped.
+func (h *Hub) StartTyping(client *Client, roomID uint) {
+	now := time.Now()
+
+	h.mu.Lock()
+	if !client.Rooms[roomID] {
+		h.mu.Unlock()
+		return
+	}
+	if last, typing := client.typing[roomID]; typing && now.Sub(last) < typingThrottle {
+		h.mu.Unlock()
+		return
+	}
+	client.typing[roomID] = now
+	h.mu.Unlock()
+
+	h.publishTyping(EventTyping, roomID, client.UserID, client.Username, now.Add(typingTTL))
+}
+
+// StopTyping clears a client's typing indicator in a room
+func (h *Hub) StopTyping(client *Client, roomID uint) {
+	h.mu.Lock()
+	typing := h.takeTypingLocked(client, roomID)
+	h.mu.Unlock()
+
+	if typing {
+		h.publishTyping(EventStopTyping, roomID, client.UserID, client.Username, time.Time{})
+	}
+}
+
+// takeTypingLocked forgets that a client is typing in a room and reports
+// whether it was; the caller must hold h.mu
+func (h *Hub) takeTypingLocked(client *Client, roomID uint) bool {
+	if _, typing := client.typing[roomID]; !typing {
+		return false
+	}
+	delete(client.typing, roomID)
+	return true
+}
+
+// publishTyping shares a typing change with every instance
+func (h *Hub) publishTyping(eventType string, roomID, userID uint, username string, expiresAt time.Time) {
+	event := TypingNotifyEvent{
+		Type:      eventType,
+		RoomID:    roomID,
+		UserID:    userID,
+		Username:  username,
+		Timestamp: time.Now(),
+	}
+	if eventType == EventTyping {
+		event.ExpiresAt = &expiresAt
+	}
+
+	payload, err := json.Marshal(event)
+	if err != nil {
+		return
+	}
+	h.publish(BrokerMessage{Kind: BrokerKindTyping, RoomID: roomID, UserID: userID, Payload: payload})
+}
+
+// deliverTyping records a typing change and relays it to local subscribers.
+// A stop for a user who is not typing (already expired) is not relayed.
+func (h *Hub) deliverTyping(msg BrokerMessage) {
+	var event TypingNotifyEvent
+	if err := json.Unmarshal(msg.Payload, &event); err != nil {
+		log.Printf("Error decoding typing message: %v", err)
+		return
+	}
+
+	h.typingMu.Lock()
+	users := h.typing[msg.RoomID]
+	if event.Type == EventTyping && event.ExpiresAt != nil {
+		if users == nil {
+			users = make(map[uint]typingEntry)
+			h.typing[msg.RoomID] = users
+		}
+		users[msg.UserID] = typingEntry{username: event.Username, expiresAt: *event.ExpiresAt}
+	} else {
+		if _, typing := users[msg.UserID]; !typing {
+			h.typingMu.Unlock()
+			return
+		}
+		delete(users, msg.UserID)
+		if len(users) == 0 {
+			delete(h.typing, msg.RoomID)
+		}
+	}
+	h.typingMu.Unlock()
+
+	h.deliverToRoom(RoomMessage{RoomID: msg.RoomID, Message: msg.Payload})
+}
+
+// expireTyping clears indicators that were not refreshed in time. Every
+// instance sweeps its own view, so the stops are delivered locally only.
+func (h *Hub) expireTyping(now time.Time) {
+	var expired []TypingNotifyEvent
+
+	h.typingMu.Lock()
+	for roomID, users := range h.typing {
+		for userID, entry := range users {
+			if now.Before(entry.expiresAt) {
+				continue
+			}
+			delete(users, userID)
+			expired = append(expired, TypingNotifyEvent{
+				Type:      EventStopTyping,
+				RoomID:    roomID,
+				UserID:    userID,
+				Username:  entry.username,
+				Timestamp: now,
+			})
+		}
+		if len(users) == 0 {
+			delete(h.typing, roomID)
+		}
+	}
+	h.typingMu.Unlock()
+
+	for _, event := range expired {
+		if msgBytes, err := json.Marshal(event); err == nil {
+			h.deliverToRoom(RoomMessage{RoomID: event.RoomID, Message: msgBytes})
+		}
+	}
+}
+
+// typingSnapshot lists the users currently typing in a room
+func (h *Hub) typingSnapshot(roomID uint) TypingSnapshotEvent {
+	h.typingMu.Lock()
+	defer h.typingMu.Unlock()
+
+	snapshot := TypingSnapshotEvent{
+		Type:   EventTypingSnapshot,
+		RoomID: roomID,
+		Users:  make([]TypingUser, 0, len(h.typing[roomID])),
+	}
+	for userID, entry := range h.typing[roomID] {
+		snapshot.Users = append(snapshot.Users, TypingUser{
+			UserID:    userID,
+			Username:  entry.username,
+			ExpiresAt: entry.expiresAt,
+		})
+	}
+	return snapshot
+}
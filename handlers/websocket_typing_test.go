@@ -0,0 +1,72 @@
+package handlers
+
+import (
+	"testing"
+	"time"
+)
+
+func TestTyping_ThrottledAndSnapshotted(t *testing.T) {
+	hub := startTestHub(t, NewMemoryBroker())
+	alice := registerTestClient(hub, 1, "alice")
+	bob := registerTestClient(hub, 2, "bob")
+	hub.JoinRoom(alice, 7, 0)
+	hub.JoinRoom(bob, 7, 0)
+
+	hub.StartTyping(alice, 7)
+	frame := expectFrame(t, bob, EventTyping)
+	if frame["user_id"] != float64(1) || frame["expires_at"] == nil {
+		t.Errorf("Expected alice typing with expiry, got %v", frame)
+	}
+
+	// Repeated frames within the throttle window are not relayed
+	hub.StartTyping(alice, 7)
+	expectNoFrame(t, bob, EventTyping)
+
+	// A late joiner learns who is typing
+	carol := registerTestClient(hub, 3, "carol")
+	hub.JoinRoom(carol, 7, 0)
+	snapshot := expectFrame(t, carol, EventTypingSnapshot)
+	users, _ := snapshot["users"].([]interface{})
+	if len(users) != 1 || users[0].(map[string]interface{})["username"] != "alice" {
+		t.Errorf("Expected alice in snapshot, got %v", snapshot)
+	}
+}
+
+func TestTyping_Expires(t *testing.T) {
+	hub := startTestHub(t, NewMemoryBroker())
+	alice := registerTestClient(hub, 1, "alice")
+	bob := registerTestClient(hub, 2, "bob")
+	hub.JoinRoom(alice, 7, 0)
+	hub.JoinRoom(bob, 7, 0)
+
+	hub.StartTyping(alice, 7)
+	expectFrame(t, bob, EventTyping)
+
+	hub.expireTyping(time.Now().Add(typingTTL))
+	if frame := expectFrame(t, bob, EventStopTyping); frame["user_id"] != float64(1) {
+		t.Errorf("Expected alice to stop typing, got %v", frame)
+	}
+	if snapshot := hub.typingSnapshot(7); len(snapshot.Users) != 0 {
+		t.Errorf("Expected nobody typing after expiry, got %v", snapshot.Users)
+	}
+
+	// An explicit stop after expiry is not relayed again
+	hub.StopTyping(alice, 7)
+	expectNoFrame(t, bob, EventStopTyping)
+}
+
+func TestTyping_ClearedOnDisconnect(t *testing.T) {
+	hub := startTestHub(t, NewMemoryBroker())
+	alice := registerTestClient(hub, 1, "alice")
+	bob := registerTestClient(hub, 2, "bob")
+	hub.JoinRoom(alice, 7, 0)
+	hub.JoinRoom(bob, 7, 0)
+
+	hub.StartTyping(alice, 7)
+	expectFrame(t, bob, EventTyping)
+
+	hub.Unregister <- alice
+	if frame := expectFrame(t, bob, EventStopTyping); frame["user_id"] != float64(1) {
+		t.Errorf("Expected alice to stop typing, got %v", frame)
+	}
+}
@@ -0,0 +1,39 @@
+package mailer
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// LogMailer logs messages instead of sending them, for development. Only
+// the recipient and subject are logged, since bodies carry live account
+// tokens; with a directory set each message is written there in full as an
+// .eml file.
+type LogMailer struct {
+	Dir string
+}
+
+// NewLogMailer creates a mailer that logs messages, writing them to dir if
+// it is not empty
+func NewLogMailer(dir string) *LogMailer {
+	return &LogMailer{Dir: dir}
+}
+
+// Send logs a message and writes it to Dir
+func (m *LogMailer) Send(ctx context.Context, msg Message) error {
+	if m.Dir == "" {
+		log.Printf("Mail to %s: %s (body not logged; set MAIL_DIR to keep it)", msg.To, msg.Subject)
+		return nil
+	}
+
+	if err := os.MkdirAll(m.Dir, 0o700); err != nil {
+		return err
+	}
+	path := filepath.Join(m.Dir, fmt.Sprintf("%d.eml", time.Now().UnixNano()))
+	log.Printf("Mail to %s: %s (written to %s)", msg.To, msg.Subject, path)
+	return os.WriteFile(path, format("GoChatApp <no-reply@localhost>", msg), 0o600)
+}
@@ -0,0 +1,55 @@
+package mailer
+
+import (
+	"context"
+	"errors"
+	"os"
+	"strconv"
+)
+
+// Message is a plain text email
+type Message struct {
+	To      string
+	Subject string
+	Body    string
+}
+
+// Mailer sends email
+type Mailer interface {
+	Send(ctx context.Context, msg Message) error
+}
+
+// NewFromEnv returns an SMTP mailer when SMTP_HOST is set, otherwise a
+// mailer that logs messages and writes them to MAIL_DIR if set. In
+// production mail carrying live reset links must really be sent, so the
+// log mailer is refused unless MAIL_LOG_ONLY is true.
+func NewFromEnv(production bool) (Mailer, error) {
+	host := os.Getenv("SMTP_HOST")
+	if host == "" {
+		if production && os.Getenv("MAIL_LOG_ONLY") != "true" {
+			return nil, errors.New("SMTP_HOST must be set in production; set MAIL_LOG_ONLY=true to only log mail")
+		}
+		return NewLogMailer(os.Getenv("MAIL_DIR")), nil
+	}
+
+	port := 587
+	if value := os.Getenv("SMTP_PORT"); value != "" {
+		var err error
+		if port, err = strconv.Atoi(value); err != nil {
+			return nil, err
+		}
+	}
+
+	from := os.Getenv("MAIL_FROM")
+	if from == "" {
+		from = "GoChatApp <no-reply@localhost>"
+	}
+
+	return &SMTPMailer{
+		Host:     host,
+		Port:     port,
+		Username: os.Getenv("SMTP_USERNAME"),
+		Password: os.Getenv("SMTP_PASSWORD"),
+		From:     from,
+	}, nil
+}
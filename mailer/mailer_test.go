@@ -0,0 +1,143 @@
+package mailer
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"log"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestLogMailer_WritesMessages(t *testing.T) {
+	dir := t.TempDir()
+	m := NewLogMailer(dir)
+
+	err := m.Send(context.Background(), Message{To: "alice@example.com", Subject: "Hello", Body: "Line one\nLine two"})
+	if err != nil {
+		t.Fatalf("Send() error = %v", err)
+	}
+
+	files, _ := filepath.Glob(filepath.Join(dir, "*.eml"))
+	if len(files) != 1 {
+		t.Fatalf("Expected one message file, got %d", len(files))
+	}
+	data, _ := os.ReadFile(files[0])
+	if !strings.Contains(string(data), "To: alice@example.com") || !strings.Contains(string(data), "Line one\r\nLine two") {
+		t.Errorf("Unexpected message file:\n%s", data)
+	}
+}
+
+func TestLogMailer_DoesNotLogBodies(t *testing.T) {
+	var logged bytes.Buffer
+	log.SetOutput(&logged)
+	t.Cleanup(func() { log.SetOutput(os.Stderr) })
+
+	m := NewLogMailer("")
+	if err := m.Send(context.Background(), Message{To: "alice@example.com", Subject: "Reset", Body: "token=secret"}); err != nil {
+		t.Fatalf("Send() error = %v", err)
+	}
+	if strings.Contains(logged.String(), "secret") || !strings.Contains(logged.String(), "alice@example.com") {
+		t.Errorf("Expected only the recipient and subject to be logged, got %q", logged.String())
+	}
+}
+
+func TestNewFromEnv_RequiresSMTPInProduction(t *testing.T) {
+	t.Setenv("SMTP_HOST", "")
+	t.Setenv("MAIL_LOG_ONLY", "")
+
+	if _, err := NewFromEnv(true); err == nil {
+		t.Error("Expected the log mailer to be refused in production")
+	}
+	if m, err := NewFromEnv(false); err != nil || m == nil {
+		t.Errorf("Expected the log mailer in development, got %v", err)
+	}
+
+	t.Setenv("MAIL_LOG_ONLY", "true")
+	if _, err := NewFromEnv(true); err != nil {
+		t.Errorf("Expected MAIL_LOG_ONLY to allow the log mailer, got %v", err)
+	}
+}
+
+// fakeSMTPServer accepts one message and sends its DATA on the channel
+func fakeSMTPServer(t *testing.T) (string, <-chan string) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Failed to listen: %v", err)
+	}
+	t.Cleanup(func() { listener.Close() })
+
+	received := make(chan string, 1)
+	go func() {
+		conn, err := listener.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+
+		reader := bufio.NewReader(conn)
+		reply := func(line string) { conn.Write([]byte(line + "\r\n")) }
+		reply("220 fake ESMTP")
+		for {
+			line, err := reader.ReadString('\n')
+			if err != nil {
+				return
+			}
+			switch command := strings.ToUpper(strings.Fields(line)[0]); command {
+			case "EHLO", "HELO":
+				reply("250 fake")
+			case "DATA":
+				reply("354 go ahead")
+				var data strings.Builder
+				for {
+					line, err := reader.ReadString('\n')
+					if err != nil || line == ".\r\n" {
+						break
+					}
+					data.WriteString(line)
+				}
+				received <- data.String()
+				reply("250 queued")
+			case "QUIT":
+				reply("221 bye")
+				return
+			default:
+				reply("250 ok")
+			}
+		}
+	}()
+	return listener.Addr().String(), received
+}
+
+func TestSMTPMailer_Send(t *testing.T) {
+	addr, received := fakeSMTPServer(t)
+	host, port, _ := net.SplitHostPort(addr)
+
+	portNumber, _ := strconv.Atoi(port)
+	m := &SMTPMailer{Host: host, Port: portNumber, From: "GoChatApp <no-reply@example.com>"}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	if err := m.Send(ctx, Message{To: "bob@example.com", Subject: "Reset", Body: "Your link"}); err != nil {
+		t.Fatalf("Send() error = %v", err)
+	}
+
+	data := <-received
+	for _, want := range []string{"From: GoChatApp <no-reply@example.com>", "To: bob@example.com", "Subject: Reset", "Your link"} {
+		if !strings.Contains(data, want) {
+			t.Errorf("Expected %q in message:\n%s", want, data)
+		}
+	}
+}
+
+func TestSMTPMailer_RejectsInvalidRecipient(t *testing.T) {
+	m := &SMTPMailer{Host: "127.0.0.1", Port: 1, From: "no-reply@example.com"}
+	if err := m.Send(context.Background(), Message{To: "not an address"}); err == nil {
+		t.Error("Expected an invalid recipient to be rejected before dialing")
+	}
+}
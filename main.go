@@ -2,15 +2,44 @@ package main
 
 import (
 	"GoChatApp/database"
+	"GoChatApp/events"
 	"GoChatApp/handlers"
+	"GoChatApp/mailer"
+	"GoChatApp/middleware"
 	"GoChatApp/repositories"
 	"GoChatApp/routes"
+	"GoChatApp/sso"
+	"GoChatApp/utils"
+	"context"
+	"errors"
+	"io"
 	"log"
+	"net/http"
+	"os"
+	"os/signal"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
 
 	"github.com/gin-gonic/gin"
 )
 
+// defaultDrainTimeout bounds how long shutdown waits for connections to drain
+const defaultDrainTimeout = 15 * time.Second
+
 func main() {
+	// Load token signing keys; release mode refuses the development secret
+	if err := utils.InitKeyring(gin.Mode() == gin.ReleaseMode); err != nil {
+		log.Fatal("Invalid token signing configuration:", err)
+	}
+
+	// Choose how new passwords are hashed; existing hashes of any kind
+	// still verify and are upgraded on login
+	if err := utils.InitPasswordHasher(); err != nil {
+		log.Fatal("Invalid password hashing configuration:", err)
+	}
+
 	// Initialize database
 	database.InitDB()
 
@@ -32,29 +61,174 @@ func main() {
 	dmRepo := repositories.NewDMRepository(db)
 	blockRepo := repositories.NewBlockRepository(db)
 	receiptRepo := repositories.NewReadReceiptRepository(db)
+	sessionRepo := repositories.NewSessionRepository(db)
+	tokenRepo := repositories.NewAccountTokenRepository(db)
+	codeRepo := repositories.NewRecoveryCodeRepository(db)
+	identityRepo := repositories.NewUserIdentityRepository(db)
+	throttleRepo := repositories.NewLoginThrottleRepository(db)
+	accessTokenRepo := repositories.NewPersonalAccessTokenRepository(db)
+
+	// Initialize the WebSocket broker (Redis when several instances share traffic)
+	var broker handlers.Broker = handlers.NewMemoryBroker()
+	if redisURL := os.Getenv("REDIS_URL"); redisURL != "" {
+		redisBroker, err := handlers.NewRedisBroker(redisURL)
+		if err != nil {
+			log.Fatal("Failed to connect to Redis:", err)
+		}
+		broker = redisBroker
+		log.Println("Using Redis broker for WebSocket traffic")
+	}
 
 	// Initialize handlers
-	authHandler := handlers.NewAuthHandler(userRepo)
+	wsHandler := handlers.NewWebSocketHandler(messageRepo, roomRepo, userRepo, receiptRepo, broker)
+
+	policy, err := handlers.ParseSlowConsumerPolicy(os.Getenv("WS_SLOW_CONSUMER_POLICY"))
+	if err != nil {
+		log.Fatal("Invalid WS_SLOW_CONSUMER_POLICY:", err)
+	}
+	wsHandler.Hub.SlowConsumerPolicy = policy
+	wsHandler.Sessions = sessionRepo
+	if value := os.Getenv("WS_ALLOW_TOKEN_QUERY"); value != "" {
+		if wsHandler.AllowTokenQuery, err = strconv.ParseBool(value); err != nil {
+			log.Fatal("Invalid WS_ALLOW_TOKEN_QUERY:", err)
+		}
+	}
+
+	// Tickets must be redeemable on whichever instance takes the upgrade
+	if redisURL := os.Getenv("REDIS_URL"); redisURL != "" {
+		tickets, err := handlers.NewRedisTicketStore(redisURL)
+		if err != nil {
+			log.Fatal("Failed to connect to Redis:", err)
+		}
+		wsHandler.Tickets = tickets
+	}
+
+	// Changes made over REST are fanned out to WebSocket clients
+	bus := events.NewBus()
+	bus.Subscribe(wsHandler.Hub.HandleEvent)
+
+	mail, err := mailer.NewFromEnv(gin.Mode() == gin.ReleaseMode)
+	if err != nil {
+		log.Fatal("Invalid mail configuration:", err)
+	}
+
+	authHandler := handlers.NewAuthHandler(userRepo, sessionRepo, tokenRepo, codeRepo, accessTokenRepo, mail, bus)
+	if appURL := os.Getenv("APP_URL"); appURL != "" {
+		authHandler.AppURL = strings.TrimSuffix(appURL, "/")
+	}
+	authHandler.Throttle = handlers.NewLoginThrottle(throttleRepo)
+	if value := os.Getenv("LOGIN_MAX_FAILURES"); value != "" {
+		if authHandler.Throttle.MaxFailures, err = strconv.Atoi(value); err != nil {
+			log.Fatal("Invalid LOGIN_MAX_FAILURES:", err)
+		}
+	}
+	if value := os.Getenv("LOGIN_MAX_FAILURES_PER_IP"); value != "" {
+		if authHandler.Throttle.MaxFailuresPerIP, err = strconv.Atoi(value); err != nil {
+			log.Fatal("Invalid LOGIN_MAX_FAILURES_PER_IP:", err)
+		}
+	}
+	if value := os.Getenv("LOGIN_LOCKOUT_DURATION"); value != "" {
+		if authHandler.Throttle.LockoutDuration, err = time.ParseDuration(value); err != nil {
+			log.Fatal("Invalid LOGIN_LOCKOUT_DURATION:", err)
+		}
+	}
+	if authHandler.PasswordPolicy, err = utils.LoadPasswordPolicy(); err != nil {
+		log.Fatal("Invalid password policy:", err)
+	}
+	providers, err := sso.LoadProviders(authHandler.AppURL)
+	if err != nil {
+		log.Fatal("Invalid OIDC configuration:", err)
+	}
+	oidcHandler := handlers.NewOIDCHandler(authHandler, identityRepo, providers)
 	userHandler := handlers.NewUserHandler(userRepo)
-	messageHandler := handlers.NewMessageHandler(messageRepo)
-	roomHandler := handlers.NewRoomHandler(roomRepo)
-	reactionHandler := handlers.NewReactionHandler(reactionRepo)
-	dmHandler := handlers.NewDMHandler(dmRepo)
+	messageHandler := handlers.NewMessageHandler(messageRepo, roomRepo, bus)
+	roomHandler := handlers.NewRoomHandler(roomRepo, bus)
+	reactionHandler := handlers.NewReactionHandler(reactionRepo, messageRepo, roomRepo, bus)
+	dmHandler := handlers.NewDMHandler(dmRepo, bus)
 	blockHandler := handlers.NewBlockHandler(blockRepo)
-	receiptHandler := handlers.NewReadReceiptHandler(receiptRepo)
+	receiptHandler := handlers.NewReadReceiptHandler(receiptRepo, messageRepo, roomRepo, bus)
 	uploadHandler := handlers.NewUploadHandler()
-	wsHandler := handlers.NewWebSocketHandler()
+	presenceHandler := handlers.NewPresenceHandler(wsHandler.Hub, userRepo, roomRepo)
+	adminHandler := handlers.NewAdminHandler(authHandler.Throttle, userRepo, sessionRepo, accessTokenRepo, bus)
+	accessTokenHandler := handlers.NewAccessTokenHandler(accessTokenRepo, userRepo)
+
+	limits, err := middleware.ParseUnverifiedLimits(os.Getenv("UNVERIFIED_LIMITS"))
+	if err != nil {
+		log.Fatal("Invalid UNVERIFIED_LIMITS:", err)
+	}
+	unverified := middleware.NewUnverifiedLimits(userRepo, limits)
+
+	// The users named in ADMIN_USER_IDS become the first admins; once there
+	// is an admin, roles are managed through the admin API
+	adminIDs, err := middleware.ParseAdminIDs(os.Getenv("ADMIN_USER_IDS"))
+	if err != nil {
+		log.Fatal("Invalid ADMIN_USER_IDS:", err)
+	}
+	if promoted, err := userRepo.BootstrapAdmins(adminIDs); err != nil {
+		log.Fatal("Failed to bootstrap admins:", err)
+	} else if promoted > 0 {
+		log.Printf("Made %d user(s) from ADMIN_USER_IDS admins", promoted)
+	}
 
-	// Setup router
+	// Setup router. Forwarded client IPs are only believed from the proxies
+	// in TRUSTED_PROXIES, so they cannot be spoofed around login throttling.
 	router := gin.Default()
+	proxies, err := middleware.ParseTrustedProxies(os.Getenv("TRUSTED_PROXIES"))
+	if err != nil {
+		log.Fatal("Invalid TRUSTED_PROXIES:", err)
+	}
+	if err := router.SetTrustedProxies(proxies); err != nil {
+		log.Fatal("Invalid TRUSTED_PROXIES:", err)
+	}
 
 	// Setup routes
-	routes.SetupRoutes(router, authHandler, userHandler, messageHandler, roomHandler,
-		reactionHandler, dmHandler, blockHandler, receiptHandler, uploadHandler, wsHandler)
+	routes.SetupRoutes(router, authHandler, oidcHandler, userHandler, messageHandler, roomHandler,
+		reactionHandler, dmHandler, blockHandler, receiptHandler, uploadHandler, wsHandler, presenceHandler, adminHandler, accessTokenHandler, sessionRepo, accessTokenRepo, unverified)
+
+	drainTimeout := defaultDrainTimeout
+	if value := os.Getenv("SHUTDOWN_TIMEOUT"); value != "" {
+		drainTimeout, err = time.ParseDuration(value)
+		if err != nil {
+			log.Fatal("Invalid SHUTDOWN_TIMEOUT:", err)
+		}
+	}
 
 	// Start server
-	log.Println("Server starting on :8080")
-	if err := router.Run(":8080"); err != nil {
-		log.Fatal("Failed to start server:", err)
+	server := &http.Server{Addr: ":8080", Handler: router}
+	go func() {
+		log.Println("Server starting on :8080")
+		if err := server.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			log.Fatal("Failed to start server:", err)
+		}
+	}()
+
+	// Wait for a deploy or Ctrl+C
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	<-ctx.Done()
+	stop()
+	log.Printf("Shutting down, draining connections for up to %s", drainTimeout)
+
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), drainTimeout)
+	defer cancel()
+
+	// Sockets are hijacked, so the HTTP server does not wait for them
+	if err := wsHandler.Hub.Shutdown(shutdownCtx); err != nil {
+		log.Printf("WebSocket connections not drained: %v", err)
+	}
+	if err := server.Shutdown(shutdownCtx); err != nil {
+		log.Printf("HTTP requests not drained: %v", err)
+	}
+
+	if err := broker.Close(); err != nil {
+		log.Printf("Error closing broker: %v", err)
+	}
+	if tickets, ok := wsHandler.Tickets.(io.Closer); ok {
+		if err := tickets.Close(); err != nil {
+			log.Printf("Error closing ticket store: %v", err)
+		}
+	}
+	if err := database.CloseDB(); err != nil {
+		log.Printf("Error closing database: %v", err)
 	}
+	log.Println("Server stopped")
 }
@@ -0,0 +1,50 @@
+package middleware
+
+import (
+	"GoChatApp/models"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ParseAdminIDs reads a comma-separated list of user IDs, as in the
+// ADMIN_USER_IDS setting that names the first admins
+func ParseAdminIDs(value string) ([]uint, error) {
+	var ids []uint
+	for _, field := range strings.Split(value, ",") {
+		field = strings.TrimSpace(field)
+		if field == "" {
+			continue
+		}
+		id, err := strconv.ParseUint(field, 10, 32)
+		if err != nil || id == 0 {
+			return nil, fmt.Errorf("invalid user ID %q", field)
+		}
+		ids = append(ids, uint(id))
+	}
+	return ids, nil
+}
+
+// RequireRole only lets users with at least the given global role through,
+// e.g. admins as well as moderators for RoleModerator. It must run after
+// AuthMiddleware.
+func RequireRole(min string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if _, exists := c.Get("user_id"); !exists {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+			c.Abort()
+			return
+		}
+
+		if !models.RoleAtLeast(c.GetString("role"), min) {
+			c.JSON(http.StatusForbidden, gin.H{"error": "Requires the " + min + " role"})
+			c.Abort()
+			return
+		}
+
+		c.Next()
+	}
+}
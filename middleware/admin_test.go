@@ -0,0 +1,58 @@
+package middleware
+
+import (
+	"GoChatApp/models"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestParseAdminIDs(t *testing.T) {
+	ids, err := ParseAdminIDs(" 1, 42 ,")
+	if err != nil || len(ids) != 2 || ids[0] != 1 || ids[1] != 42 {
+		t.Errorf("ParseAdminIDs() = %v, %v; want [1 42]", ids, err)
+	}
+	if ids, err := ParseAdminIDs(""); err != nil || len(ids) != 0 {
+		t.Errorf("ParseAdminIDs(\"\") = %v, %v; want none", ids, err)
+	}
+	if _, err := ParseAdminIDs("1,alice"); err == nil {
+		t.Error("ParseAdminIDs() should reject a username")
+	}
+}
+
+func TestRequireRole(t *testing.T) {
+	request := func(role, min string) int {
+		router := gin.New()
+		router.GET("/admin", func(c *gin.Context) {
+			c.Set("user_id", uint(1))
+			c.Set("role", role)
+			c.Next()
+		}, RequireRole(min), func(c *gin.Context) {
+			c.Status(http.StatusOK)
+		})
+
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest("GET", "/admin", nil))
+		return w.Code
+	}
+
+	tests := []struct {
+		role, min string
+		want      int
+	}{
+		{models.RoleAdmin, models.RoleAdmin, http.StatusOK},
+		{models.RoleAdmin, models.RoleModerator, http.StatusOK},
+		{models.RoleModerator, models.RoleModerator, http.StatusOK},
+		{models.RoleModerator, models.RoleAdmin, http.StatusForbidden},
+		{models.RoleUser, models.RoleModerator, http.StatusForbidden},
+		{"", models.RoleModerator, http.StatusForbidden},
+		{"", models.RoleUser, http.StatusOK},
+	}
+	for _, tt := range tests {
+		if code := request(tt.role, tt.min); code != tt.want {
+			t.Errorf("Role %q on a %s route: expected status %d, got %d", tt.role, tt.min, tt.want, code)
+		}
+	}
+}
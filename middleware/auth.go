@@ -1,15 +1,24 @@
 package middleware
 
 import (
+	"GoChatApp/models"
+	"GoChatApp/repositories"
 	"GoChatApp/utils"
 	"net/http"
 	"strings"
+	"time"
 
 	"github.com/gin-gonic/gin"
 )
 
-// AuthMiddleware validates JWT tokens
-func AuthMiddleware() gin.HandlerFunc {
+// AuthMiddleware validates JWT tokens and rejects tokens whose session has
+// been revoked or has expired. Without a session repository only the token
+// itself is checked.
+//
+// With an access token repository, personal access tokens are accepted as
+// well. Routes open to them must say which scope they need with
+// RequireScope; without an access token repository they are refused.
+func AuthMiddleware(sessions *repositories.SessionRepository, accessTokens *repositories.PersonalAccessTokenRepository) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		// Get token from Authorization header
 		authHeader := c.GetHeader("Authorization")
@@ -29,6 +38,11 @@ func AuthMiddleware() gin.HandlerFunc {
 
 		token := parts[1]
 
+		if strings.HasPrefix(token, models.AccessTokenPrefix) {
+			authenticateAccessToken(c, accessTokens, token)
+			return
+		}
+
 		// Validate token
 		claims, err := utils.ValidateToken(token)
 		if err != nil {
@@ -37,11 +51,62 @@ func AuthMiddleware() gin.HandlerFunc {
 			return
 		}
 
+		// Tokens outlive a logout, so the session behind them must still be active
+		if sessions != nil {
+			if claims.SessionID == 0 {
+				c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid or expired token"})
+				c.Abort()
+				return
+			}
+			session, err := sessions.FindActive(claims.SessionID)
+			if err != nil || session.UserID != claims.UserID {
+				c.JSON(http.StatusUnauthorized, gin.H{"error": "Session revoked or expired"})
+				c.Abort()
+				return
+			}
+			c.Set("session_expires_at", session.ExpiresAt)
+		}
+
 		// Set user info in context for handlers to use
 		c.Set("user_id", claims.UserID)
 		c.Set("username", claims.Username)
 		c.Set("email", claims.Email)
+		c.Set("role", claims.Role)
+		c.Set("session_id", claims.SessionID)
+		if claims.ExpiresAt != nil {
+			c.Set("token_expires_at", claims.ExpiresAt.Time)
+		}
 
 		c.Next()
 	}
 }
+
+// authenticateAccessToken lets a request through on a personal access token
+func authenticateAccessToken(c *gin.Context, accessTokens *repositories.PersonalAccessTokenRepository, token string) {
+	if accessTokens == nil {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Personal access tokens cannot be used here"})
+		c.Abort()
+		return
+	}
+
+	// Tokens of deleted or disabled accounts are refused
+	accessToken, err := accessTokens.FindActiveByHash(utils.HashOpaqueToken(token))
+	if err != nil || accessToken.User.ID == 0 || accessToken.User.DisabledAt != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid or expired token"})
+		c.Abort()
+		return
+	}
+	accessTokens.Touch(accessToken.ID, time.Now())
+
+	// Set user info in context for handlers to use
+	c.Set("user_id", accessToken.UserID)
+	c.Set("username", accessToken.User.Username)
+	c.Set("email", accessToken.User.Email)
+	c.Set("role", accessToken.User.Role)
+	c.Set("access_token", accessToken)
+	if accessToken.ExpiresAt != nil {
+		c.Set("token_expires_at", *accessToken.ExpiresAt)
+	}
+
+	c.Next()
+}
@@ -1,12 +1,19 @@
 package middleware
 
 import (
+	"GoChatApp/models"
+	"GoChatApp/repositories"
 	"GoChatApp/utils"
 	"net/http"
 	"net/http/httptest"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/gin-gonic/gin"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
 )
 
 func init() {
@@ -15,10 +22,10 @@ func init() {
 
 func TestAuthMiddleware_ValidToken(t *testing.T) {
 	// Generate a valid token
-	token, _ := utils.GenerateToken(1, "testuser", "test@example.com")
+	token, _ := utils.GenerateToken(1, "testuser", "test@example.com", "user", 0)
 
 	router := gin.New()
-	router.Use(AuthMiddleware())
+	router.Use(AuthMiddleware(nil, nil))
 	router.GET("/protected", func(c *gin.Context) {
 		userID, _ := c.Get("user_id")
 		username, _ := c.Get("username")
@@ -44,7 +51,7 @@ func TestAuthMiddleware_ValidToken(t *testing.T) {
 
 func TestAuthMiddleware_MissingHeader(t *testing.T) {
 	router := gin.New()
-	router.Use(AuthMiddleware())
+	router.Use(AuthMiddleware(nil, nil))
 	router.GET("/protected", func(c *gin.Context) {
 		c.JSON(http.StatusOK, gin.H{"message": "success"})
 	})
@@ -61,7 +68,7 @@ func TestAuthMiddleware_MissingHeader(t *testing.T) {
 
 func TestAuthMiddleware_InvalidFormat(t *testing.T) {
 	router := gin.New()
-	router.Use(AuthMiddleware())
+	router.Use(AuthMiddleware(nil, nil))
 	router.GET("/protected", func(c *gin.Context) {
 		c.JSON(http.StatusOK, gin.H{"message": "success"})
 	})
@@ -93,7 +100,7 @@ func TestAuthMiddleware_InvalidFormat(t *testing.T) {
 
 func TestAuthMiddleware_InvalidToken(t *testing.T) {
 	router := gin.New()
-	router.Use(AuthMiddleware())
+	router.Use(AuthMiddleware(nil, nil))
 	router.GET("/protected", func(c *gin.Context) {
 		c.JSON(http.StatusOK, gin.H{"message": "success"})
 	})
@@ -110,14 +117,14 @@ func TestAuthMiddleware_InvalidToken(t *testing.T) {
 }
 
 func TestAuthMiddleware_SetsContextValues(t *testing.T) {
-	token, _ := utils.GenerateToken(42, "contextuser", "context@example.com")
+	token, _ := utils.GenerateToken(42, "contextuser", "context@example.com", "user", 0)
 
 	var capturedUserID uint
 	var capturedUsername string
 	var capturedEmail string
 
 	router := gin.New()
-	router.Use(AuthMiddleware())
+	router.Use(AuthMiddleware(nil, nil))
 	router.GET("/protected", func(c *gin.Context) {
 		userID, _ := c.Get("user_id")
 		username, _ := c.Get("username")
@@ -146,3 +153,89 @@ func TestAuthMiddleware_SetsContextValues(t *testing.T) {
 		t.Errorf("Expected email 'context@example.com', got %s", capturedEmail)
 	}
 }
+
+func TestAuthMiddleware_RejectsRevokedSession(t *testing.T) {
+	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{Logger: logger.Default.LogMode(logger.Silent)})
+	if err != nil {
+		t.Fatalf("Failed to connect to test database: %v", err)
+	}
+	db.AutoMigrate(&models.Session{})
+	sessionRepo := repositories.NewSessionRepository(db)
+
+	session := &models.Session{UserID: 7, ExpiresAt: time.Now().Add(time.Hour)}
+	sessionRepo.Create(session)
+
+	router := gin.New()
+	router.Use(AuthMiddleware(sessionRepo, nil))
+	router.GET("/protected", func(c *gin.Context) {
+		c.JSON(http.StatusOK, gin.H{"message": "success"})
+	})
+
+	request := func(token string) int {
+		req := httptest.NewRequest("GET", "/protected", nil)
+		req.Header.Set("Authorization", "Bearer "+token)
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w.Code
+	}
+
+	token, _ := utils.GenerateToken(7, "device", "device@example.com", "user", session.ID)
+	if code := request(token); code != http.StatusOK {
+		t.Errorf("Expected status 200 for an active session, got %d", code)
+	}
+
+	sessionless, _ := utils.GenerateToken(7, "device", "device@example.com", "user", 0)
+	if code := request(sessionless); code != http.StatusUnauthorized {
+		t.Errorf("Expected status 401 for a token without a session, got %d", code)
+	}
+
+	sessionRepo.Revoke(session.ID)
+	if code := request(token); code != http.StatusUnauthorized {
+		t.Errorf("Expected status 401 after revocation, got %d", code)
+	}
+}
+
+func TestAuthMiddleware_PersonalAccessTokens(t *testing.T) {
+	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{Logger: logger.Default.LogMode(logger.Silent)})
+	if err != nil {
+		t.Fatalf("Failed to connect to test database: %v", err)
+	}
+	db.AutoMigrate(&models.User{}, &models.Session{}, &models.PersonalAccessToken{})
+	sessionRepo := repositories.NewSessionRepository(db)
+	tokenRepo := repositories.NewPersonalAccessTokenRepository(db)
+
+	user := &models.User{Username: "bot", Email: "bot@example.com"}
+	repositories.NewUserRepository(db).Create(user)
+	secret := models.AccessTokenPrefix + "secret"
+	tokenRepo.Create(&models.PersonalAccessToken{UserID: user.ID, Name: "ci", TokenHash: utils.HashOpaqueToken(secret)})
+
+	handler := func(c *gin.Context) {
+		c.JSON(http.StatusOK, gin.H{"user_id": c.GetUint("user_id"), "username": c.GetString("username")})
+	}
+	router := gin.New()
+	router.GET("/scoped", AuthMiddleware(sessionRepo, tokenRepo), handler)
+	router.GET("/sessions-only", AuthMiddleware(sessionRepo, nil), handler)
+
+	request := func(path, token string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("GET", path, nil)
+		req.Header.Set("Authorization", "Bearer "+token)
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w
+	}
+
+	w := request("/scoped", secret)
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status 200 for a personal access token, got %d", w.Code)
+	}
+	if !strings.Contains(w.Body.String(), `"username":"bot"`) {
+		t.Errorf("Expected the token's user in the context, got %s", w.Body.String())
+	}
+
+	if w := request("/scoped", models.AccessTokenPrefix+"wrong"); w.Code != http.StatusUnauthorized {
+		t.Errorf("Expected status 401 for an unknown token, got %d", w.Code)
+	}
+	if w := request("/sessions-only", secret); w.Code != http.StatusForbidden {
+		t.Errorf("Expected status 403 where tokens are not accepted, got %d", w.Code)
+	}
+}
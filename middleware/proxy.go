@@ -0,0 +1,29 @@
+package middleware
+
+import (
+	"fmt"
+	"net"
+	"strings"
+)
+
+// ParseTrustedProxies reads a comma-separated list of IPs and CIDRs, as in
+// the TRUSTED_PROXIES setting naming the reverse proxies whose
+// X-Forwarded-For and X-Real-IP headers are believed. An empty list trusts
+// no proxy, so the client IP is always the peer's address and cannot be
+// spoofed around login throttling.
+func ParseTrustedProxies(value string) ([]string, error) {
+	var proxies []string
+	for _, field := range strings.Split(value, ",") {
+		field = strings.TrimSpace(field)
+		if field == "" {
+			continue
+		}
+		if net.ParseIP(field) == nil {
+			if _, _, err := net.ParseCIDR(field); err != nil {
+				return nil, fmt.Errorf("invalid proxy address %q", field)
+			}
+		}
+		proxies = append(proxies, field)
+	}
+	return proxies, nil
+}
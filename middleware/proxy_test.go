@@ -0,0 +1,16 @@
+package middleware
+
+import "testing"
+
+func TestParseTrustedProxies(t *testing.T) {
+	proxies, err := ParseTrustedProxies(" 10.0.0.1, 172.16.0.0/12 ,::1,")
+	if err != nil || len(proxies) != 3 || proxies[1] != "172.16.0.0/12" {
+		t.Errorf("ParseTrustedProxies() = %v, %v; want 3 proxies", proxies, err)
+	}
+	if proxies, err := ParseTrustedProxies(""); err != nil || proxies != nil {
+		t.Errorf("ParseTrustedProxies(\"\") = %v, %v; want nil", proxies, err)
+	}
+	if _, err := ParseTrustedProxies("10.0.0.1,proxy.internal"); err == nil {
+		t.Error("ParseTrustedProxies() should reject a hostname")
+	}
+}
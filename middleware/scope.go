@@ -0,0 +1,28 @@
+package middleware
+
+import (
+	"GoChatApp/models"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// RequireScope rejects personal access tokens without the given scope.
+// Signed-in sessions have every scope. It must run after AuthMiddleware.
+func RequireScope(scope string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		value, exists := c.Get("access_token")
+		if !exists {
+			c.Next()
+			return
+		}
+
+		if !value.(*models.PersonalAccessToken).HasScope(scope) {
+			c.JSON(http.StatusForbidden, gin.H{"error": "Token lacks the " + scope + " scope"})
+			c.Abort()
+			return
+		}
+
+		c.Next()
+	}
+}
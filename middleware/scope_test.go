@@ -0,0 +1,43 @@
+package middleware
+
+import (
+	"GoChatApp/models"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestRequireScope(t *testing.T) {
+	tests := []struct {
+		name  string
+		token *models.PersonalAccessToken
+		want  int
+	}{
+		{"session", nil, http.StatusOK},
+		{"token with the scope", &models.PersonalAccessToken{Scopes: []string{models.ScopeRoomsRead, models.ScopeMessagesWrite}}, http.StatusOK},
+		{"token without the scope", &models.PersonalAccessToken{Scopes: []string{models.ScopeRoomsRead}}, http.StatusForbidden},
+		{"token without scopes", &models.PersonalAccessToken{}, http.StatusForbidden},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			router := gin.New()
+			router.POST("/messages", func(c *gin.Context) {
+				c.Set("user_id", uint(1))
+				if tt.token != nil {
+					c.Set("access_token", tt.token)
+				}
+			}, RequireScope(models.ScopeMessagesWrite), func(c *gin.Context) {
+				c.Status(http.StatusOK)
+			})
+
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, httptest.NewRequest("POST", "/messages", nil))
+			if w.Code != tt.want {
+				t.Errorf("Expected status %d, got %d", tt.want, w.Code)
+			}
+		})
+	}
+}
@@ -0,0 +1,94 @@
+package middleware
+
+import (
+	"GoChatApp/repositories"
+	"fmt"
+	"net/http"
+	"slices"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Features an account can be kept from until its email address is verified
+const (
+	FeatureRooms          = "rooms"           // Creating rooms
+	FeatureDirectMessages = "direct_messages" // Starting and sending direct messages
+	FeatureUploads        = "uploads"         // Uploading files
+)
+
+var knownFeatures = []string{FeatureRooms, FeatureDirectMessages, FeatureUploads}
+
+// DefaultUnverifiedLimits are the features unverified accounts are kept
+// from when nothing is configured
+var DefaultUnverifiedLimits = []string{FeatureDirectMessages, FeatureUploads}
+
+// UnverifiedLimits keeps accounts with an unverified email address from
+// using some features
+type UnverifiedLimits struct {
+	userRepo *repositories.UserRepository
+	limited  map[string]bool
+}
+
+// NewUnverifiedLimits keeps unverified accounts from the given features
+func NewUnverifiedLimits(userRepo *repositories.UserRepository, features []string) *UnverifiedLimits {
+	limited := make(map[string]bool, len(features))
+	for _, feature := range features {
+		limited[feature] = true
+	}
+	return &UnverifiedLimits{userRepo: userRepo, limited: limited}
+}
+
+// ParseUnverifiedLimits reads a comma-separated list of features, as in the
+// UNVERIFIED_LIMITS setting. Empty means the defaults and "none" means no
+// limits.
+func ParseUnverifiedLimits(value string) ([]string, error) {
+	switch strings.TrimSpace(value) {
+	case "":
+		return DefaultUnverifiedLimits, nil
+	case "none":
+		return nil, nil
+	}
+
+	var features []string
+	for _, feature := range strings.Split(value, ",") {
+		feature = strings.TrimSpace(feature)
+		if !slices.Contains(knownFeatures, feature) {
+			return nil, fmt.Errorf("unknown feature %q (want %s or none)", feature, strings.Join(knownFeatures, ", "))
+		}
+		features = append(features, feature)
+	}
+	return features, nil
+}
+
+// Require rejects requests from unverified accounts if the feature is
+// limited. It must run after AuthMiddleware.
+func (l *UnverifiedLimits) Require(feature string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if l == nil || !l.limited[feature] {
+			c.Next()
+			return
+		}
+
+		userID, exists := c.Get("user_id")
+		if !exists {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+			c.Abort()
+			return
+		}
+
+		user, err := l.userRepo.FindByID(userID.(uint))
+		if err != nil {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "User not found"})
+			c.Abort()
+			return
+		}
+		if user.EmailVerifiedAt == nil {
+			c.JSON(http.StatusForbidden, gin.H{"error": "Verify your email address to use this feature"})
+			c.Abort()
+			return
+		}
+
+		c.Next()
+	}
+}
@@ -0,0 +1,78 @@
+package middleware
+
+import (
+	"GoChatApp/models"
+	"GoChatApp/repositories"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+func TestParseUnverifiedLimits(t *testing.T) {
+	tests := []struct {
+		value   string
+		want    int
+		wantErr bool
+	}{
+		{"", len(DefaultUnverifiedLimits), false},
+		{"none", 0, false},
+		{"rooms, uploads", 2, false},
+		{"rooms,teleport", 0, true},
+	}
+
+	for _, tt := range tests {
+		features, err := ParseUnverifiedLimits(tt.value)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("ParseUnverifiedLimits(%q) error = %v, wantErr %v", tt.value, err, tt.wantErr)
+			continue
+		}
+		if len(features) != tt.want {
+			t.Errorf("ParseUnverifiedLimits(%q) = %v, want %d features", tt.value, features, tt.want)
+		}
+	}
+}
+
+func TestUnverifiedLimits_Require(t *testing.T) {
+	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{Logger: logger.Default.LogMode(logger.Silent)})
+	if err != nil {
+		t.Fatalf("Failed to connect to test database: %v", err)
+	}
+	db.AutoMigrate(&models.User{})
+	userRepo := repositories.NewUserRepository(db)
+
+	verifiedAt := time.Now()
+	unverified := &models.User{Username: "unverified", Email: "unverified@example.com", PasswordHash: "hash"}
+	verified := &models.User{Username: "verified", Email: "verified@example.com", PasswordHash: "hash", EmailVerifiedAt: &verifiedAt}
+	userRepo.Create(unverified)
+	userRepo.Create(verified)
+
+	limits := NewUnverifiedLimits(userRepo, []string{FeatureUploads})
+	request := func(userID uint, feature string) int {
+		router := gin.New()
+		router.POST("/action", func(c *gin.Context) {
+			c.Set("user_id", userID)
+			c.Next()
+		}, limits.Require(feature), func(c *gin.Context) {
+			c.JSON(http.StatusOK, gin.H{"message": "success"})
+		})
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest("POST", "/action", nil))
+		return w.Code
+	}
+
+	if code := request(unverified.ID, FeatureUploads); code != http.StatusForbidden {
+		t.Errorf("Expected status 403 for an unverified account, got %d", code)
+	}
+	if code := request(verified.ID, FeatureUploads); code != http.StatusOK {
+		t.Errorf("Expected status 200 for a verified account, got %d", code)
+	}
+	if code := request(unverified.ID, FeatureRooms); code != http.StatusOK {
+		t.Errorf("Expected features without a limit to stay open, got %d", code)
+	}
+}
@@ -0,0 +1,29 @@
+package models
+
+import (
+	"time"
+)
+
+// Purposes of account tokens
+const (
+	TokenPurposePasswordReset     = "password_reset"
+	TokenPurposeEmailVerification = "email_verification"
+	TokenPurposeEmailChange       = "email_change"
+	TokenPurposeLoginChallenge    = "login_challenge"
+	TokenPurposeSSOLogin          = "sso_login"
+)
+
+// AccountToken is a single-use token issued to a user, e.g. mailed to reset
+// their password or handed out to finish a two-factor login. Only its hash
+// is stored.
+type AccountToken struct {
+	ID        uint       `json:"id" gorm:"primaryKey"`
+	UserID    uint       `json:"user_id" gorm:"not null;index"`
+	Purpose   string     `json:"purpose" gorm:"not null"`
+	TokenHash string     `json:"-" gorm:"uniqueIndex;not null"`
+	Email     string     `json:"email"`    // Address the token was sent to
+	Attempts  int        `json:"attempts"` // Failed attempts to redeem it
+	ExpiresAt time.Time  `json:"expires_at"`
+	UsedAt    *time.Time `json:"used_at"`
+	CreatedAt time.Time  `json:"created_at"`
+}
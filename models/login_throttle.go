@@ -0,0 +1,45 @@
+package models
+
+import (
+	"time"
+)
+
+// Scopes failed logins are counted in
+const (
+	ThrottleScopeAccount = "account" // Per username, whether or not it exists
+	ThrottleScopeIP      = "ip"      // Per client IP
+)
+
+// Scopes account mail (password resets, verification and email change
+// links) is counted in
+const (
+	ThrottleScopeMailAddress = "mail_address" // Per recipient address, whether or not it is registered
+	ThrottleScopeMailIP      = "mail_ip"      // Per client IP asking for a password reset
+	ThrottleScopeMailUser    = "mail_user"    // Per signed-in user asking for a link
+)
+
+// LoginThrottle counts recent failed logins for a username or client IP.
+// Attempts count from the moment they start and are handed back when they
+// succeed.
+type LoginThrottle struct {
+	ID            uint       `json:"id" gorm:"primaryKey"`
+	Scope         string     `json:"scope" gorm:"not null;uniqueIndex:idx_throttle_scope_subject"`
+	Subject       string     `json:"subject" gorm:"not null;uniqueIndex:idx_throttle_scope_subject"` // Username, email or IP
+	Failures      int        `json:"failures"`
+	LastFailureAt time.Time  `json:"last_failure_at"`
+	LockedUntil   *time.Time `json:"locked_until"`
+	NextAttemptAt *time.Time `json:"next_attempt_at"` // Backing off until then
+}
+
+// LockoutEvent records a username or IP being locked out after too many
+// failed logins
+type LockoutEvent struct {
+	ID          uint       `json:"id" gorm:"primaryKey"`
+	Scope       string     `json:"scope" gorm:"not null;index:idx_lockout_scope_subject"`
+	Subject     string     `json:"subject" gorm:"not null;index:idx_lockout_scope_subject"`
+	Failures    int        `json:"failures"`
+	LockedUntil time.Time  `json:"locked_until"`
+	UnlockedAt  *time.Time `json:"unlocked_at"`
+	UnlockedBy  *uint      `json:"unlocked_by"` // Admin who lifted it early
+	CreatedAt   time.Time  `json:"created_at"`
+}
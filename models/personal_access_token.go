@@ -0,0 +1,54 @@
+package models
+
+import (
+	"slices"
+	"time"
+)
+
+// AccessTokenPrefix starts every personal access token, so they can be
+// told apart from JWTs and spotted by secret scanners
+const AccessTokenPrefix = "gcp_"
+
+// Scopes a personal access token can be granted
+const (
+	ScopeMessagesWrite      = "messages:write"      // Sending messages, reactions and read receipts
+	ScopeRoomsRead          = "rooms:read"          // Reading presence in rooms
+	ScopeRoomsWrite         = "rooms:write"         // Creating, joining and leaving rooms, and kicking members
+	ScopeConversationsRead  = "conversations:read"  // Reading direct messages
+	ScopeConversationsWrite = "conversations:write" // Starting conversations and sending direct messages
+	ScopeBlocksRead         = "blocks:read"         // Listing blocked users
+	ScopeBlocksWrite        = "blocks:write"        // Blocking and unblocking users
+	ScopeUploadsWrite       = "uploads:write"       // Uploading files
+)
+
+// AccessTokenScopes are all the scopes a token can be granted
+var AccessTokenScopes = []string{
+	ScopeMessagesWrite,
+	ScopeRoomsRead, ScopeRoomsWrite,
+	ScopeConversationsRead, ScopeConversationsWrite,
+	ScopeBlocksRead, ScopeBlocksWrite,
+	ScopeUploadsWrite,
+}
+
+// PersonalAccessToken is a long-lived token a user creates for scripts and
+// integrations. It acts as the user, but only on routes its scopes allow.
+// Only its hash is stored.
+type PersonalAccessToken struct {
+	ID         uint       `json:"id" gorm:"primaryKey"`
+	UserID     uint       `json:"user_id" gorm:"not null;index"`
+	User       User       `json:"-" gorm:"foreignKey:UserID"`
+	Name       string     `json:"name" gorm:"not null"`
+	Scopes     []string   `json:"scopes" gorm:"serializer:json"`
+	TokenHash  string     `json:"-" gorm:"uniqueIndex;not null"`
+	Hint       string     `json:"hint"`       // Start of the token, to recognise it by
+	ExpiresAt  *time.Time `json:"expires_at"` // Never expires if nil
+	LastUsedAt *time.Time `json:"last_used_at"`
+	RotatedAt  *time.Time `json:"rotated_at"`
+	RevokedAt  *time.Time `json:"revoked_at,omitempty"`
+	CreatedAt  time.Time  `json:"created_at"`
+}
+
+// HasScope reports whether the token was granted a scope
+func (t *PersonalAccessToken) HasScope(scope string) bool {
+	return slices.Contains(t.Scopes, scope)
+}
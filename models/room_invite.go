@@ -0,0 +1,12 @@
+package models
+
+import "time"
+
+// RoomInvite lets a user join a room that is not public
+type RoomInvite struct {
+	ID        uint      `json:"id" gorm:"primaryKey"`
+	RoomID    uint      `json:"room_id" gorm:"not null;uniqueIndex:idx_room_invite"`
+	UserID    uint      `json:"user_id" gorm:"not null;uniqueIndex:idx_room_invite"`
+	InvitedBy uint      `json:"invited_by" gorm:"not null"`
+	CreatedAt time.Time `json:"created_at"`
+}
@@ -0,0 +1,28 @@
+package models
+
+import (
+	"time"
+)
+
+// Session is a signed-in device. Access tokens name their session, so
+// revoking it cuts off every token issued for it.
+type Session struct {
+	ID         uint       `json:"id" gorm:"primaryKey"`
+	UserID     uint       `json:"user_id" gorm:"not null;index"`
+	UserAgent  string     `json:"user_agent"`
+	IP         string     `json:"ip"`
+	LastUsedAt time.Time  `json:"last_used_at"`
+	ExpiresAt  time.Time  `json:"expires_at"` // Refreshing does not extend a session
+	RevokedAt  *time.Time `json:"revoked_at,omitempty"`
+	CreatedAt  time.Time  `json:"created_at"`
+}
+
+// RefreshToken is one token in a session's rotation chain. Each token is
+// exchanged once; only its hash is stored.
+type RefreshToken struct {
+	ID        uint       `json:"id" gorm:"primaryKey"`
+	SessionID uint       `json:"session_id" gorm:"not null;index"`
+	TokenHash string     `json:"-" gorm:"uniqueIndex;not null"`
+	UsedAt    *time.Time `json:"used_at"` // Set when exchanged for the next token
+	CreatedAt time.Time  `json:"created_at"`
+}
@@ -1,18 +1,49 @@
 package models
 
 import (
+	"slices"
 	"time"
 
 	"gorm.io/gorm"
 )
 
+// Global roles, from least to most privileged
+const (
+	RoleUser      = "user"
+	RoleModerator = "moderator"
+	RoleAdmin     = "admin"
+)
+
+// Roles are all the roles a user can have, from least to most privileged
+var Roles = []string{RoleUser, RoleModerator, RoleAdmin}
+
+// RoleAtLeast reports whether a role grants at least the privileges of
+// another. An empty or unknown role counts as RoleUser.
+func RoleAtLeast(role, min string) bool {
+	return max(slices.Index(Roles, role), 0) >= slices.Index(Roles, min)
+}
+
+// User is an account. Its JSON is what any signed-in user may see; the
+// moderation fields are only shown to admins, by AdminHandler.
 type User struct {
-	ID           uint           `json:"id" gorm:"primaryKey"`
-	Username     string         `json:"username" gorm:"unique;not null"`
-	Email        string         `json:"email" gorm:"unique;not null"`
-	PasswordHash string         `json:"-" gorm:"not null"`
-	Avatar       string         `json:"avatar"`
-	CreatedAt    time.Time      `json:"created_at"`
-	UpdatedAt    time.Time      `json:"updated_at"`
-	DeletedAt    gorm.DeletedAt `json:"-" gorm:"index"`
+	ID              uint           `json:"id" gorm:"primaryKey"`
+	Username        string         `json:"username" gorm:"unique;not null"`
+	Email           string         `json:"email" gorm:"unique;not null"`
+	PasswordHash    string         `json:"-" gorm:"not null"`
+	Avatar          string         `json:"avatar"`
+	DisplayName     string         `json:"display_name"`
+	Bio             string         `json:"bio"`
+	Timezone        string         `json:"timezone"` // IANA name, e.g. Europe/Paris
+	Pronouns        string         `json:"pronouns"`
+	EmailVerifiedAt *time.Time     `json:"-"` // Nil until the address is confirmed
+	PendingEmail    string         `json:"-"` // Address being changed to, until it is confirmed
+	TOTPSecret      string         `json:"-"` // Set on enrollment, before it is confirmed
+	TOTPEnabledAt   *time.Time     `json:"-"` // Nil unless two-factor login is on
+	TOTPLastStep    int64          `json:"-"` // Time step of the last accepted code
+	Role            string         `json:"-" gorm:"not null;default:user;index"`
+	DisabledAt      *time.Time     `json:"-"` // Set while an admin has the account disabled
+	LastSeenAt      *time.Time     `json:"-"`
+	CreatedAt       time.Time      `json:"created_at"`
+	UpdatedAt       time.Time      `json:"updated_at"`
+	DeletedAt       gorm.DeletedAt `json:"-" gorm:"index"`
 }
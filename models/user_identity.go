@@ -0,0 +1,15 @@
+package models
+
+import (
+	"time"
+)
+
+// UserIdentity links a user to their account at an OpenID Connect provider
+type UserIdentity struct {
+	ID        uint      `json:"id" gorm:"primaryKey"`
+	UserID    uint      `json:"user_id" gorm:"not null;index"`
+	Provider  string    `json:"provider" gorm:"not null;uniqueIndex:idx_provider_subject"`
+	Subject   string    `json:"-" gorm:"not null;uniqueIndex:idx_provider_subject"` // The provider's stable user ID
+	Email     string    `json:"email"`                                              // Address the provider vouched for when linking
+	CreatedAt time.Time `json:"created_at"`
+}
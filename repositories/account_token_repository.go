@@ -0,0 +1,60 @@
+package repositories
+
+import (
+	"GoChatApp/models"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+type AccountTokenRepository struct {
+	db *gorm.DB
+}
+
+func NewAccountTokenRepository(db *gorm.DB) *AccountTokenRepository {
+	return &AccountTokenRepository{db: db}
+}
+
+// Create stores a new token
+func (r *AccountTokenRepository) Create(token *models.AccountToken) error {
+	return r.db.Create(token).Error
+}
+
+// FindValid finds an unused, unexpired token for a purpose by hash
+func (r *AccountTokenRepository) FindValid(purpose, tokenHash string) (*models.AccountToken, error) {
+	var token models.AccountToken
+	err := r.db.Where("purpose = ? AND token_hash = ? AND used_at IS NULL AND expires_at > ?", purpose, tokenHash, time.Now()).
+		First(&token).Error
+	return &token, err
+}
+
+// Use marks a token as used. It reports false if the token had already
+// been used, so a token cannot be redeemed twice even by racing requests.
+func (r *AccountTokenRepository) Use(id uint) (bool, error) {
+	result := r.db.Model(&models.AccountToken{}).
+		Where("id = ? AND used_at IS NULL", id).
+		Update("used_at", time.Now())
+	return result.RowsAffected == 1, result.Error
+}
+
+// InvalidateForUser uses up a user's outstanding tokens for a purpose, so
+// only the most recently mailed one works
+func (r *AccountTokenRepository) InvalidateForUser(userID uint, purpose string) error {
+	return r.db.Model(&models.AccountToken{}).
+		Where("user_id = ? AND purpose = ? AND used_at IS NULL", userID, purpose).
+		Update("used_at", time.Now()).Error
+}
+
+// RecordFailedAttempt counts a failed attempt to redeem a token and returns
+// the new count
+func (r *AccountTokenRepository) RecordFailedAttempt(id uint) (int, error) {
+	err := r.db.Model(&models.AccountToken{}).
+		Where("id = ?", id).
+		Update("attempts", gorm.Expr("attempts + 1")).Error
+	if err != nil {
+		return 0, err
+	}
+	var token models.AccountToken
+	err = r.db.Select("attempts").First(&token, id).Error
+	return token.Attempts, err
+}
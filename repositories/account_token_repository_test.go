@@ -0,0 +1,74 @@
+package repositories
+
+import (
+	"GoChatApp/models"
+	"testing"
+	"time"
+)
+
+func TestAccountTokenRepository_UseOnce(t *testing.T) {
+	db := setupTestDB(t)
+	repo := NewAccountTokenRepository(db)
+
+	token := &models.AccountToken{UserID: 1, Purpose: models.TokenPurposePasswordReset, TokenHash: "hash", ExpiresAt: time.Now().Add(time.Hour)}
+	repo.Create(token)
+
+	if _, err := repo.FindValid(models.TokenPurposeEmailVerification, "hash"); err == nil {
+		t.Error("FindValid() should not find a token for another purpose")
+	}
+	found, err := repo.FindValid(models.TokenPurposePasswordReset, "hash")
+	if err != nil {
+		t.Fatalf("FindValid() error = %v", err)
+	}
+
+	if used, err := repo.Use(found.ID); !used || err != nil {
+		t.Errorf("Use() = %v, %v; want true", used, err)
+	}
+	if used, _ := repo.Use(found.ID); used {
+		t.Error("Use() should fail for a token already used")
+	}
+	if _, err := repo.FindValid(models.TokenPurposePasswordReset, "hash"); err == nil {
+		t.Error("FindValid() should not find a used token")
+	}
+}
+
+func TestAccountTokenRepository_Expiry(t *testing.T) {
+	db := setupTestDB(t)
+	repo := NewAccountTokenRepository(db)
+
+	repo.Create(&models.AccountToken{UserID: 1, Purpose: models.TokenPurposePasswordReset, TokenHash: "expired", ExpiresAt: time.Now().Add(-time.Minute)})
+	if _, err := repo.FindValid(models.TokenPurposePasswordReset, "expired"); err == nil {
+		t.Error("FindValid() should not find an expired token")
+	}
+}
+
+func TestAccountTokenRepository_InvalidateForUser(t *testing.T) {
+	db := setupTestDB(t)
+	repo := NewAccountTokenRepository(db)
+
+	repo.Create(&models.AccountToken{UserID: 1, Purpose: models.TokenPurposePasswordReset, TokenHash: "first", ExpiresAt: time.Now().Add(time.Hour)})
+	repo.Create(&models.AccountToken{UserID: 1, Purpose: models.TokenPurposeEmailVerification, TokenHash: "other", ExpiresAt: time.Now().Add(time.Hour)})
+
+	if err := repo.InvalidateForUser(1, models.TokenPurposePasswordReset); err != nil {
+		t.Fatalf("InvalidateForUser() error = %v", err)
+	}
+	if _, err := repo.FindValid(models.TokenPurposePasswordReset, "first"); err == nil {
+		t.Error("InvalidateForUser() should use up outstanding tokens")
+	}
+	if _, err := repo.FindValid(models.TokenPurposeEmailVerification, "other"); err != nil {
+		t.Error("InvalidateForUser() should leave tokens for other purposes")
+	}
+}
+
+func TestAccountTokenRepository_RecordFailedAttempt(t *testing.T) {
+	db := setupTestDB(t)
+	repo := NewAccountTokenRepository(db)
+
+	token := &models.AccountToken{UserID: 1, Purpose: models.TokenPurposeLoginChallenge, TokenHash: "challenge", ExpiresAt: time.Now().Add(time.Minute)}
+	repo.Create(token)
+
+	repo.RecordFailedAttempt(token.ID)
+	if attempts, err := repo.RecordFailedAttempt(token.ID); attempts != 2 || err != nil {
+		t.Errorf("RecordFailedAttempt() = %d, %v; want 2", attempts, err)
+	}
+}
@@ -43,6 +43,13 @@ func (r *DMRepository) FindOrCreateConversation(user1ID, user2ID uint) (*models.
 	return &conv, nil
 }
 
+// FindConversationByID finds a conversation by ID
+func (r *DMRepository) FindConversationByID(id uint) (*models.Conversation, error) {
+	var conv models.Conversation
+	err := r.db.First(&conv, id).Error
+	return &conv, err
+}
+
 // GetUserConversations gets all conversations for a user
 func (r *DMRepository) GetUserConversations(userID uint) ([]models.Conversation, error) {
 	var convs []models.Conversation
@@ -34,6 +34,32 @@ func TestDMRepository_FindOrCreateConversation(t *testing.T) {
 	}
 }
 
+func TestDMRepository_FindConversationByID(t *testing.T) {
+	db := setupTestDB(t)
+	dmRepo := NewDMRepository(db)
+	userRepo := NewUserRepository(db)
+
+	user1 := &models.User{Username: "user1", Email: "user1@example.com", PasswordHash: "hash"}
+	user2 := &models.User{Username: "user2", Email: "user2@example.com", PasswordHash: "hash"}
+	userRepo.Create(user1)
+	userRepo.Create(user2)
+
+	conv, _ := dmRepo.FindOrCreateConversation(user2.ID, user1.ID)
+
+	found, err := dmRepo.FindConversationByID(conv.ID)
+	if err != nil {
+		t.Errorf("FindConversationByID() error = %v", err)
+		return
+	}
+	if found.User1ID != user1.ID || found.User2ID != user2.ID {
+		t.Errorf("FindConversationByID() users = %v, %v", found.User1ID, found.User2ID)
+	}
+
+	if _, err := dmRepo.FindConversationByID(999); err == nil {
+		t.Error("FindConversationByID() should fail for unknown conversation")
+	}
+}
+
 func TestDMRepository_GetUserConversations(t *testing.T) {
 	db := setupTestDB(t)
 	dmRepo := NewDMRepository(db)
@@ -0,0 +1,112 @@
+package repositories
+
+import (
+	"GoChatApp/models"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+type LoginThrottleRepository struct {
+	db *gorm.DB
+}
+
+func NewLoginThrottleRepository(db *gorm.DB) *LoginThrottleRepository {
+	return &LoginThrottleRepository{db: db}
+}
+
+// Find finds the failure count of a username or IP
+func (r *LoginThrottleRepository) Find(scope, subject string) (*models.LoginThrottle, error) {
+	var throttle models.LoginThrottle
+	err := r.db.Where("scope = ? AND subject = ?", scope, subject).First(&throttle).Error
+	return &throttle, err
+}
+
+// Attempt counts an attempt against a username or IP before its outcome is
+// known, unless it is locked out, at its limit or backing off. Lockouts that
+// ran out and failures older than window are cleared first. The check and
+// the increment are one guarded update, so concurrent attempts cannot go
+// past the limit. It reports whether the attempt was counted, along with
+// the counter.
+func (r *LoginThrottleRepository) Attempt(scope, subject string, limit int, window time.Duration, now time.Time) (*models.LoginThrottle, bool, error) {
+	err := r.db.Clauses(clause.OnConflict{DoNothing: true}).
+		Create(&models.LoginThrottle{Scope: scope, Subject: subject, LastFailureAt: now}).Error
+	if err != nil {
+		return nil, false, err
+	}
+
+	err = r.db.Model(&models.LoginThrottle{}).
+		Where("scope = ? AND subject = ?", scope, subject).
+		Where("(locked_until IS NOT NULL AND locked_until <= ?) OR (locked_until IS NULL AND last_failure_at < ?)", now, now.Add(-window)).
+		Updates(map[string]interface{}{"failures": 0, "locked_until": nil, "next_attempt_at": nil}).Error
+	if err != nil {
+		return nil, false, err
+	}
+
+	result := r.db.Model(&models.LoginThrottle{}).
+		Where("scope = ? AND subject = ? AND locked_until IS NULL AND failures < ?", scope, subject, limit).
+		Where("next_attempt_at IS NULL OR next_attempt_at <= ?", now).
+		Updates(map[string]interface{}{"failures": gorm.Expr("failures + 1"), "last_failure_at": now})
+	if result.Error != nil {
+		return nil, false, result.Error
+	}
+
+	throttle, err := r.Find(scope, subject)
+	return throttle, result.RowsAffected == 1, err
+}
+
+// Release hands back an attempt that did not fail
+func (r *LoginThrottleRepository) Release(scope, subject string) error {
+	return r.db.Model(&models.LoginThrottle{}).
+		Where("scope = ? AND subject = ? AND failures > 0", scope, subject).
+		Update("failures", gorm.Expr("failures - 1")).Error
+}
+
+// Backoff holds off further attempts at a username or IP until the given
+// time
+func (r *LoginThrottleRepository) Backoff(scope, subject string, until time.Time) error {
+	return r.db.Model(&models.LoginThrottle{}).
+		Where("scope = ? AND subject = ?", scope, subject).
+		Update("next_attempt_at", until).Error
+}
+
+// Lock locks a username or IP out until the given time. It reports whether
+// this call did it, so a lockout is only recorded once.
+func (r *LoginThrottleRepository) Lock(scope, subject string, until time.Time) (bool, error) {
+	result := r.db.Model(&models.LoginThrottle{}).
+		Where("scope = ? AND subject = ? AND locked_until IS NULL", scope, subject).
+		Update("locked_until", until)
+	return result.RowsAffected == 1, result.Error
+}
+
+// Reset forgets the failures of a username or IP
+func (r *LoginThrottleRepository) Reset(scope, subject string) error {
+	return r.db.Where("scope = ? AND subject = ?", scope, subject).Delete(&models.LoginThrottle{}).Error
+}
+
+// CreateLockoutEvent records a lockout
+func (r *LoginThrottleRepository) CreateLockoutEvent(event *models.LockoutEvent) error {
+	return r.db.Create(event).Error
+}
+
+// FindLockoutEvents returns the most recent lockouts, optionally only those
+// still in force
+func (r *LoginThrottleRepository) FindLockoutEvents(activeOnly bool, limit int) ([]models.LockoutEvent, error) {
+	var events []models.LockoutEvent
+	query := r.db.Order("created_at DESC, id DESC").Limit(limit)
+	if activeOnly {
+		query = query.Where("unlocked_at IS NULL AND locked_until > ?", time.Now())
+	}
+	err := query.Find(&events).Error
+	return events, err
+}
+
+// MarkUnlocked records that an admin lifted the lockouts of a username or
+// IP that are still in force
+func (r *LoginThrottleRepository) MarkUnlocked(scope, subject string, adminID uint, at time.Time) (int64, error) {
+	result := r.db.Model(&models.LockoutEvent{}).
+		Where("scope = ? AND subject = ? AND unlocked_at IS NULL AND locked_until > ?", scope, subject, at).
+		Updates(map[string]interface{}{"unlocked_at": at, "unlocked_by": adminID})
+	return result.RowsAffected, result.Error
+}
@@ -0,0 +1,92 @@
+package repositories
+
+import (
+	"GoChatApp/models"
+	"testing"
+	"time"
+)
+
+func TestLoginThrottleRepository_Attempt(t *testing.T) {
+	db := setupTestDB(t)
+	repo := NewLoginThrottleRepository(db)
+	now := time.Now()
+
+	repo.Attempt(models.ThrottleScopeIP, "10.0.0.1", 2, time.Hour, now)
+	for i := 0; i < 2; i++ {
+		if _, ok, err := repo.Attempt(models.ThrottleScopeAccount, "alice", 2, time.Hour, now); !ok || err != nil {
+			t.Fatalf("Attempt %d = %v, %v; want it counted", i+1, ok, err)
+		}
+	}
+	throttle, ok, _ := repo.Attempt(models.ThrottleScopeAccount, "alice", 2, time.Hour, now)
+	if ok || throttle.Failures != 2 {
+		t.Errorf("Expected the limit to hold, got %v with %d failures", ok, throttle.Failures)
+	}
+
+	// A released attempt makes room for another
+	repo.Release(models.ThrottleScopeAccount, "alice")
+	if _, ok, _ := repo.Attempt(models.ThrottleScopeAccount, "alice", 2, time.Hour, now); !ok {
+		t.Error("Expected a released attempt to be handed back")
+	}
+
+	// Lockouts run out, and so do old failures
+	if locked, _ := repo.Lock(models.ThrottleScopeAccount, "alice", now.Add(time.Minute)); !locked {
+		t.Error("Expected Lock() to lock")
+	}
+	if locked, _ := repo.Lock(models.ThrottleScopeAccount, "alice", now.Add(time.Minute)); locked {
+		t.Error("Expected a second Lock() to report nothing new")
+	}
+	if _, ok, _ := repo.Attempt(models.ThrottleScopeAccount, "alice", 2, time.Hour, now); ok {
+		t.Error("Expected a locked out username to be refused")
+	}
+	throttle, ok, _ = repo.Attempt(models.ThrottleScopeAccount, "alice", 2, time.Hour, now.Add(2*time.Minute))
+	if !ok || throttle.Failures != 1 || throttle.LockedUntil != nil {
+		t.Errorf("Expected a fresh count after the lockout, got %v %+v", ok, throttle)
+	}
+
+	repo.Reset(models.ThrottleScopeAccount, "alice")
+	if _, err := repo.Find(models.ThrottleScopeAccount, "alice"); err == nil {
+		t.Error("Find() should not find a reset counter")
+	}
+	if throttle, _ := repo.Find(models.ThrottleScopeIP, "10.0.0.1"); throttle.Failures != 1 {
+		t.Errorf("Expected other counters to be kept, got %d failures", throttle.Failures)
+	}
+}
+
+func TestLoginThrottleRepository_Backoff(t *testing.T) {
+	db := setupTestDB(t)
+	repo := NewLoginThrottleRepository(db)
+	now := time.Now()
+
+	repo.Attempt(models.ThrottleScopeAccount, "bob", 10, time.Hour, now)
+	repo.Backoff(models.ThrottleScopeAccount, "bob", now.Add(time.Minute))
+	if _, ok, _ := repo.Attempt(models.ThrottleScopeAccount, "bob", 10, time.Hour, now); ok {
+		t.Error("Expected an attempt while backing off to be refused")
+	}
+	if _, ok, _ := repo.Attempt(models.ThrottleScopeAccount, "bob", 10, time.Hour, now.Add(time.Minute)); !ok {
+		t.Error("Expected an attempt after the backoff to be counted")
+	}
+}
+
+func TestLoginThrottleRepository_LockoutEvents(t *testing.T) {
+	db := setupTestDB(t)
+	repo := NewLoginThrottleRepository(db)
+	now := time.Now()
+
+	repo.CreateLockoutEvent(&models.LockoutEvent{Scope: models.ThrottleScopeAccount, Subject: "expired", LockedUntil: now.Add(-time.Minute)})
+	repo.CreateLockoutEvent(&models.LockoutEvent{Scope: models.ThrottleScopeAccount, Subject: "alice", LockedUntil: now.Add(time.Hour)})
+
+	active, _ := repo.FindLockoutEvents(true, 10)
+	if len(active) != 1 || active[0].Subject != "alice" {
+		t.Fatalf("Expected only alice's lockout to be active, got %v", active)
+	}
+
+	if lifted, err := repo.MarkUnlocked(models.ThrottleScopeAccount, "alice", 1, now); lifted != 1 || err != nil {
+		t.Errorf("MarkUnlocked() = %d, %v; want 1", lifted, err)
+	}
+	if active, _ := repo.FindLockoutEvents(true, 10); len(active) != 0 {
+		t.Errorf("Expected no active lockouts, got %v", active)
+	}
+	if all, _ := repo.FindLockoutEvents(false, 10); len(all) != 2 || all[0].UnlockedBy == nil || *all[0].UnlockedBy != 1 {
+		t.Errorf("Expected the unlock to be recorded, got %v", all)
+	}
+}
@@ -39,6 +39,27 @@ func (r *MessageRepository) FindByRoomID(roomID uint, limit, offset int) ([]mode
 	return messages, err
 }
 
+// FindByRoomIDSince finds up to limit of the newest messages in a room with
+// an ID greater than sinceID, returned oldest first
+func (r *MessageRepository) FindByRoomIDSince(roomID, sinceID uint, limit int) ([]models.Message, error) {
+	var messages []models.Message
+	err := r.db.
+		Where("room_id = ? AND id > ? AND deleted = ?", roomID, sinceID, false).
+		Preload("User").
+		Order("id DESC").
+		Limit(limit).
+		Find(&messages).Error
+	if err != nil {
+		return nil, err
+	}
+
+	// Reverse into chronological order
+	for i, j := 0, len(messages)-1; i < j; i, j = i+1, j-1 {
+		messages[i], messages[j] = messages[j], messages[i]
+	}
+	return messages, nil
+}
+
 // FindAll returns all messages with pagination
 func (r *MessageRepository) FindAll(limit, offset int) ([]models.Message, error) {
 	var messages []models.Message
@@ -121,6 +121,53 @@ func TestMessageRepository_FindByRoomID(t *testing.T) {
 	}
 }
 
+func TestMessageRepository_FindByRoomIDSince(t *testing.T) {
+	db := setupTestDB(t)
+	msgRepo := NewMessageRepository(db)
+	userRepo := NewUserRepository(db)
+	roomRepo := NewRoomRepository(db)
+
+	user := &models.User{Username: "sender", Email: "sender@example.com", PasswordHash: "hash"}
+	userRepo.Create(user)
+
+	room1 := &models.Room{Name: "Room 1", Type: "public"}
+	room2 := &models.Room{Name: "Room 2", Type: "public"}
+	roomRepo.Create(room1)
+	roomRepo.Create(room2)
+
+	var ids []uint
+	for i := 0; i < 5; i++ {
+		msg := &models.Message{UserID: user.ID, RoomID: room1.ID, Content: "Message"}
+		msgRepo.Create(msg)
+		ids = append(ids, msg.ID)
+	}
+	msgRepo.Create(&models.Message{UserID: user.ID, RoomID: room2.ID, Content: "Other room"})
+
+	// Everything after the second message, oldest first
+	messages, err := msgRepo.FindByRoomIDSince(room1.ID, ids[1], 10)
+	if err != nil {
+		t.Errorf("FindByRoomIDSince() error = %v", err)
+		return
+	}
+	if len(messages) != 3 {
+		t.Fatalf("FindByRoomIDSince() returned %d messages, want 3", len(messages))
+	}
+	for i, msg := range messages {
+		if msg.ID != ids[i+2] {
+			t.Errorf("FindByRoomIDSince()[%d].ID = %d, want %d", i, msg.ID, ids[i+2])
+		}
+	}
+	if messages[0].User.Username != user.Username {
+		t.Error("FindByRoomIDSince() should preload User")
+	}
+
+	// Limit keeps the newest messages
+	messages, _ = msgRepo.FindByRoomIDSince(room1.ID, 0, 2)
+	if len(messages) != 2 || messages[0].ID != ids[3] || messages[1].ID != ids[4] {
+		t.Errorf("FindByRoomIDSince() with limit should return the newest messages oldest first, got %v", messages)
+	}
+}
+
 func TestMessageRepository_FindAll(t *testing.T) {
 	db := setupTestDB(t)
 	msgRepo := NewMessageRepository(db)
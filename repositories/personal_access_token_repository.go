@@ -0,0 +1,88 @@
+package repositories
+
+import (
+	"GoChatApp/models"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// touchInterval is how stale a token's last use may get before it is
+// recorded again, so busy scripts do not write on every request
+const touchInterval = time.Minute
+
+type PersonalAccessTokenRepository struct {
+	db *gorm.DB
+}
+
+func NewPersonalAccessTokenRepository(db *gorm.DB) *PersonalAccessTokenRepository {
+	return &PersonalAccessTokenRepository{db: db}
+}
+
+// Create creates a new personal access token
+func (r *PersonalAccessTokenRepository) Create(token *models.PersonalAccessToken) error {
+	return r.db.Create(token).Error
+}
+
+// FindActiveByHash finds an unrevoked, unexpired token by hash, along with
+// its user
+func (r *PersonalAccessTokenRepository) FindActiveByHash(tokenHash string) (*models.PersonalAccessToken, error) {
+	var token models.PersonalAccessToken
+	err := r.db.Preload("User").
+		Where("token_hash = ? AND revoked_at IS NULL AND (expires_at IS NULL OR expires_at > ?)", tokenHash, time.Now()).
+		First(&token).Error
+	return &token, err
+}
+
+// FindByUser returns a user's unrevoked tokens, expired or not, newest first
+func (r *PersonalAccessTokenRepository) FindByUser(userID uint) ([]models.PersonalAccessToken, error) {
+	var tokens []models.PersonalAccessToken
+	err := r.db.Where("user_id = ? AND revoked_at IS NULL", userID).
+		Order("created_at DESC").
+		Find(&tokens).Error
+	return tokens, err
+}
+
+// FindForUser finds one of a user's unrevoked tokens by ID
+func (r *PersonalAccessTokenRepository) FindForUser(id, userID uint) (*models.PersonalAccessToken, error) {
+	var token models.PersonalAccessToken
+	err := r.db.Where("user_id = ? AND revoked_at IS NULL", userID).First(&token, id).Error
+	return &token, err
+}
+
+// Rotate replaces the hash of an unrevoked token, so the old secret stops
+// working at once. It reports false if the token was revoked meanwhile.
+func (r *PersonalAccessTokenRepository) Rotate(token *models.PersonalAccessToken) (bool, error) {
+	result := r.db.Model(&models.PersonalAccessToken{}).
+		Where("id = ? AND revoked_at IS NULL", token.ID).
+		Updates(map[string]interface{}{
+			"token_hash": token.TokenHash,
+			"hint":       token.Hint,
+			"expires_at": token.ExpiresAt,
+			"rotated_at": token.RotatedAt,
+		})
+	return result.RowsAffected == 1, result.Error
+}
+
+// Revoke revokes one of a user's tokens. It reports false if the user has
+// no such unrevoked token.
+func (r *PersonalAccessTokenRepository) Revoke(id, userID uint) (bool, error) {
+	result := r.db.Model(&models.PersonalAccessToken{}).
+		Where("id = ? AND user_id = ? AND revoked_at IS NULL", id, userID).
+		Update("revoked_at", time.Now())
+	return result.RowsAffected == 1, result.Error
+}
+
+// Touch records when a token was last used, at most once a minute
+func (r *PersonalAccessTokenRepository) Touch(id uint, at time.Time) error {
+	return r.db.Model(&models.PersonalAccessToken{}).
+		Where("id = ? AND (last_used_at IS NULL OR last_used_at < ?)", id, at.Add(-touchInterval)).
+		Update("last_used_at", at).Error
+}
+
+// RevokeAllForUser revokes every unrevoked token of a user
+func (r *PersonalAccessTokenRepository) RevokeAllForUser(userID uint) error {
+	return r.db.Model(&models.PersonalAccessToken{}).
+		Where("user_id = ? AND revoked_at IS NULL", userID).
+		Update("revoked_at", time.Now()).Error
+}
@@ -0,0 +1,100 @@
+package repositories
+
+import (
+	"GoChatApp/models"
+	"testing"
+	"time"
+)
+
+func TestPersonalAccessTokenRepository_FindActiveByHash(t *testing.T) {
+	db := setupTestDB(t)
+	repo := NewPersonalAccessTokenRepository(db)
+	user := &models.User{Username: "bot", Email: "bot@example.com"}
+	NewUserRepository(db).Create(user)
+
+	past := time.Now().Add(-time.Hour)
+	future := time.Now().Add(time.Hour)
+	repo.Create(&models.PersonalAccessToken{UserID: user.ID, Name: "forever", TokenHash: "forever", Scopes: []string{models.ScopeMessagesWrite}})
+	repo.Create(&models.PersonalAccessToken{UserID: user.ID, Name: "later", TokenHash: "later", ExpiresAt: &future})
+	repo.Create(&models.PersonalAccessToken{UserID: user.ID, Name: "expired", TokenHash: "expired", ExpiresAt: &past})
+	revoked := &models.PersonalAccessToken{UserID: user.ID, Name: "revoked", TokenHash: "revoked"}
+	repo.Create(revoked)
+	repo.Revoke(revoked.ID, user.ID)
+
+	token, err := repo.FindActiveByHash("forever")
+	if err != nil {
+		t.Fatalf("FindActiveByHash() error = %v", err)
+	}
+	if token.User.Username != "bot" || !token.HasScope(models.ScopeMessagesWrite) {
+		t.Errorf("FindActiveByHash() = %+v, want the bot's token with its scopes", token)
+	}
+	if _, err := repo.FindActiveByHash("later"); err != nil {
+		t.Errorf("FindActiveByHash() should find an unexpired token: %v", err)
+	}
+	for _, hash := range []string{"expired", "revoked", "unknown"} {
+		if _, err := repo.FindActiveByHash(hash); err == nil {
+			t.Errorf("FindActiveByHash(%q) should fail", hash)
+		}
+	}
+
+	// Listing keeps expired tokens but not revoked ones
+	if tokens, _ := repo.FindByUser(user.ID); len(tokens) != 3 {
+		t.Errorf("FindByUser() returned %d tokens, want 3", len(tokens))
+	}
+}
+
+func TestPersonalAccessTokenRepository_RotateAndRevoke(t *testing.T) {
+	db := setupTestDB(t)
+	repo := NewPersonalAccessTokenRepository(db)
+
+	token := &models.PersonalAccessToken{UserID: 1, Name: "ci", TokenHash: "old"}
+	repo.Create(token)
+
+	if revoked, _ := repo.Revoke(token.ID, 2); revoked {
+		t.Error("Revoke() should not revoke another user's token")
+	}
+
+	token.TokenHash = "new"
+	if rotated, err := repo.Rotate(token); !rotated || err != nil {
+		t.Fatalf("Rotate() = %v, %v; want true", rotated, err)
+	}
+	if _, err := repo.FindActiveByHash("old"); err == nil {
+		t.Error("The old hash should stop working after a rotation")
+	}
+	if _, err := repo.FindActiveByHash("new"); err != nil {
+		t.Errorf("The new hash should work after a rotation: %v", err)
+	}
+
+	if revoked, err := repo.Revoke(token.ID, 1); !revoked || err != nil {
+		t.Fatalf("Revoke() = %v, %v; want true", revoked, err)
+	}
+	if rotated, _ := repo.Rotate(token); rotated {
+		t.Error("Rotate() should fail for a revoked token")
+	}
+	if _, err := repo.FindForUser(token.ID, 1); err == nil {
+		t.Error("FindForUser() should not find a revoked token")
+	}
+}
+
+func TestPersonalAccessTokenRepository_TouchIsThrottled(t *testing.T) {
+	db := setupTestDB(t)
+	repo := NewPersonalAccessTokenRepository(db)
+
+	token := &models.PersonalAccessToken{UserID: 1, Name: "ci", TokenHash: "hash"}
+	repo.Create(token)
+
+	first := time.Now()
+	repo.Touch(token.ID, first)
+	repo.Touch(token.ID, first.Add(30*time.Second))
+	found, _ := repo.FindForUser(token.ID, 1)
+	if found.LastUsedAt == nil || !found.LastUsedAt.Equal(first) {
+		t.Errorf("LastUsedAt = %v, want %v", found.LastUsedAt, first)
+	}
+
+	later := first.Add(2 * time.Minute)
+	repo.Touch(token.ID, later)
+	found, _ = repo.FindForUser(token.ID, 1)
+	if found.LastUsedAt == nil || !found.LastUsedAt.Equal(later) {
+		t.Errorf("LastUsedAt = %v, want %v", found.LastUsedAt, later)
+	}
+}
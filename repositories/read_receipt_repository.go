@@ -66,3 +66,32 @@ func (r *ReadReceiptRepository) GetUnreadCount(userID, roomID uint, messageRepo
 	err = query.Count(&count).Error
 	return count, err
 }
+
+// GetUnreadCounts gets counts of unread messages for a user in several rooms.
+// Rooms without unread messages are left out.
+func (r *ReadReceiptRepository) GetUnreadCounts(userID uint, roomIDs []uint) (map[uint]int64, error) {
+	counts := make(map[uint]int64, len(roomIDs))
+	if len(roomIDs) == 0 {
+		return counts, nil
+	}
+
+	var rows []struct {
+		RoomID uint
+		Count  int64
+	}
+	err := r.db.Model(&models.Message{}).
+		Select("messages.room_id AS room_id, COUNT(*) AS count").
+		Joins("LEFT JOIN read_receipts ON read_receipts.room_id = messages.room_id AND read_receipts.user_id = ?", userID).
+		Where("messages.room_id IN ? AND messages.deleted = ?", roomIDs, false).
+		Where("read_receipts.last_message_id IS NULL OR messages.id > read_receipts.last_message_id").
+		Group("messages.room_id").
+		Scan(&rows).Error
+	if err != nil {
+		return nil, err
+	}
+
+	for _, row := range rows {
+		counts[row.RoomID] = row.Count
+	}
+	return counts, nil
+}
@@ -116,3 +116,39 @@ func TestReadReceiptRepository_GetRoomReadReceipts(t *testing.T) {
 		t.Errorf("GetRoomReadReceipts() returned %d receipts, want 2", len(receipts))
 	}
 }
+
+func TestReadReceiptRepository_GetUnreadCounts(t *testing.T) {
+	db := setupTestDB(t)
+	receiptRepo := NewReadReceiptRepository(db)
+	userRepo := NewUserRepository(db)
+	roomRepo := NewRoomRepository(db)
+	msgRepo := NewMessageRepository(db)
+
+	user := &models.User{Username: "reader", Email: "reader@example.com", PasswordHash: "hash"}
+	userRepo.Create(user)
+
+	read := &models.Room{Name: "Read Room", Type: "public"}
+	unread := &models.Room{Name: "Unread Room", Type: "public"}
+	quiet := &models.Room{Name: "Quiet Room", Type: "public"}
+	roomRepo.Create(read)
+	roomRepo.Create(unread)
+	roomRepo.Create(quiet)
+
+	msg1 := &models.Message{UserID: user.ID, RoomID: read.ID, Content: "Seen"}
+	msg2 := &models.Message{UserID: user.ID, RoomID: read.ID, Content: "New"}
+	msg3 := &models.Message{UserID: user.ID, RoomID: unread.ID, Content: "Never read"}
+	msgRepo.Create(msg1)
+	msgRepo.Create(msg2)
+	msgRepo.Create(msg3)
+	receiptRepo.MarkAsRead(user.ID, read.ID, msg1.ID)
+
+	counts, err := receiptRepo.GetUnreadCounts(user.ID, []uint{read.ID, unread.ID, quiet.ID})
+	if err != nil {
+		t.Errorf("GetUnreadCounts() error = %v", err)
+		return
+	}
+
+	if counts[read.ID] != 1 || counts[unread.ID] != 1 || counts[quiet.ID] != 0 {
+		t.Errorf("GetUnreadCounts() = %v", counts)
+	}
+}
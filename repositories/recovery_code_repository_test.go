@@ -0,0 +1,41 @@
+package repositories
+
+import (
+	"testing"
+)
+
+func TestRecoveryCodeRepository_UseOnce(t *testing.T) {
+	db := setupTestDB(t)
+	repo := NewRecoveryCodeRepository(db)
+
+	repo.ReplaceForUser(1, []string{"a", "b"})
+	repo.ReplaceForUser(2, []string{"c"})
+
+	if used, _ := repo.Use(1, "c"); used {
+		t.Error("Use() should not accept another user's code")
+	}
+	if used, err := repo.Use(1, "a"); !used || err != nil {
+		t.Errorf("Use() = %v, %v; want true", used, err)
+	}
+	if used, _ := repo.Use(1, "a"); used {
+		t.Error("Use() should fail for a code already used")
+	}
+	if count, _ := repo.CountUnused(1); count != 1 {
+		t.Errorf("CountUnused() = %d, want 1", count)
+	}
+}
+
+func TestRecoveryCodeRepository_ReplaceForUser(t *testing.T) {
+	db := setupTestDB(t)
+	repo := NewRecoveryCodeRepository(db)
+
+	repo.ReplaceForUser(1, []string{"old"})
+	repo.ReplaceForUser(1, []string{"new1", "new2"})
+
+	if used, _ := repo.Use(1, "old"); used {
+		t.Error("Use() should not accept a replaced code")
+	}
+	if count, _ := repo.CountUnused(1); count != 2 {
+		t.Errorf("CountUnused() = %d, want 2", count)
+	}
+}
@@ -4,6 +4,7 @@ import (
 	"GoChatApp/models"
 
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 )
 
 type RoomRepository struct {
@@ -59,3 +60,55 @@ func (r *RoomRepository) IsMember(roomID, userID uint) (bool, error) {
 	err := r.db.Table("room_members").Where("room_id = ? AND user_id = ?", roomID, userID).Count(&count).Error
 	return count > 0, err
 }
+
+// CanAccess reports whether a user may read and post in a room. Public
+// rooms are open to everyone, other rooms require membership. It runs on
+// every message, so only the room's type is loaded.
+func (r *RoomRepository) CanAccess(roomID, userID uint) (bool, error) {
+	var room models.Room
+	if err := r.db.Model(&models.Room{}).Select("type").First(&room, roomID).Error; err != nil {
+		return false, err
+	}
+	if room.Type == "public" {
+		return true, nil
+	}
+	return r.IsMember(roomID, userID)
+}
+
+// AddInvite invites a user to a room; inviting them again changes nothing
+func (r *RoomRepository) AddInvite(invite *models.RoomInvite) error {
+	return r.db.Clauses(clause.OnConflict{DoNothing: true}).Create(invite).Error
+}
+
+// HasInvite reports whether a user has been invited to a room
+func (r *RoomRepository) HasInvite(roomID, userID uint) (bool, error) {
+	var count int64
+	err := r.db.Model(&models.RoomInvite{}).Where("room_id = ? AND user_id = ?", roomID, userID).Count(&count).Error
+	return count > 0, err
+}
+
+// DeleteInvite removes a user's invite to a room, once used
+func (r *RoomRepository) DeleteInvite(roomID, userID uint) error {
+	return r.db.Where("room_id = ? AND user_id = ?", roomID, userID).Delete(&models.RoomInvite{}).Error
+}
+
+// FindByMember returns the rooms a user is a member of
+func (r *RoomRepository) FindByMember(userID uint) ([]models.Room, error) {
+	var rooms []models.Room
+	err := r.db.Joins("JOIN room_members ON room_members.room_id = rooms.id").
+		Where("room_members.user_id = ?", userID).
+		Order("rooms.id").
+		Find(&rooms).Error
+	return rooms, err
+}
+
+// FindRoommateIDs returns the IDs of other users who share a room with a user
+func (r *RoomRepository) FindRoommateIDs(userID uint) ([]uint, error) {
+	var ids []uint
+	err := r.db.Table("room_members AS mine").
+		Joins("JOIN room_members AS theirs ON theirs.room_id = mine.room_id").
+		Where("mine.user_id = ? AND theirs.user_id != ?", userID, userID).
+		Distinct().
+		Pluck("theirs.user_id", &ids).Error
+	return ids, err
+}
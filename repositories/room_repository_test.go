@@ -206,3 +206,125 @@ func TestRoomRepository_Delete(t *testing.T) {
 		t.Error("Delete() room should not be findable after deletion")
 	}
 }
+
+func TestRoomRepository_FindRoommateIDs(t *testing.T) {
+	db := setupTestDB(t)
+	roomRepo := NewRoomRepository(db)
+	userRepo := NewUserRepository(db)
+
+	alice := &models.User{Username: "alice", Email: "alice@example.com", PasswordHash: "hash"}
+	bob := &models.User{Username: "bob", Email: "bob@example.com", PasswordHash: "hash"}
+	carol := &models.User{Username: "carol", Email: "carol@example.com", PasswordHash: "hash"}
+	userRepo.Create(alice)
+	userRepo.Create(bob)
+	userRepo.Create(carol)
+
+	room1 := &models.Room{Name: "Room 1", Type: "public"}
+	room2 := &models.Room{Name: "Room 2", Type: "public"}
+	roomRepo.Create(room1)
+	roomRepo.Create(room2)
+
+	// Bob shares two rooms with alice but should be listed once
+	roomRepo.AddMember(room1.ID, alice.ID)
+	roomRepo.AddMember(room1.ID, bob.ID)
+	roomRepo.AddMember(room2.ID, alice.ID)
+	roomRepo.AddMember(room2.ID, bob.ID)
+
+	ids, err := roomRepo.FindRoommateIDs(alice.ID)
+	if err != nil {
+		t.Errorf("FindRoommateIDs() error = %v", err)
+		return
+	}
+
+	if len(ids) != 1 || ids[0] != bob.ID {
+		t.Errorf("FindRoommateIDs() = %v, want [%v]", ids, bob.ID)
+	}
+
+	ids, _ = roomRepo.FindRoommateIDs(carol.ID)
+	if len(ids) != 0 {
+		t.Errorf("FindRoommateIDs() = %v, want none for user without rooms", ids)
+	}
+}
+
+func TestRoomRepository_FindByMember(t *testing.T) {
+	db := setupTestDB(t)
+	roomRepo := NewRoomRepository(db)
+	userRepo := NewUserRepository(db)
+
+	user := &models.User{Username: "member", Email: "member@example.com", PasswordHash: "hash"}
+	userRepo.Create(user)
+
+	joined := &models.Room{Name: "Joined", Type: "private"}
+	other := &models.Room{Name: "Other", Type: "public"}
+	roomRepo.Create(joined)
+	roomRepo.Create(other)
+	roomRepo.AddMember(joined.ID, user.ID)
+
+	rooms, err := roomRepo.FindByMember(user.ID)
+	if err != nil {
+		t.Errorf("FindByMember() error = %v", err)
+		return
+	}
+
+	if len(rooms) != 1 || rooms[0].ID != joined.ID {
+		t.Errorf("FindByMember() = %v, want only %q", rooms, joined.Name)
+	}
+}
+
+func TestRoomRepository_Invites(t *testing.T) {
+	db := setupTestDB(t)
+	repo := NewRoomRepository(db)
+
+	room := &models.Room{Name: "Invite Room", Type: "private"}
+	repo.Create(room)
+
+	if err := repo.AddInvite(&models.RoomInvite{RoomID: room.ID, UserID: 7, InvitedBy: 1}); err != nil {
+		t.Fatalf("AddInvite() error = %v", err)
+	}
+	// Inviting again is not an error
+	if err := repo.AddInvite(&models.RoomInvite{RoomID: room.ID, UserID: 7, InvitedBy: 1}); err != nil {
+		t.Errorf("AddInvite() again error = %v", err)
+	}
+
+	if invited, _ := repo.HasInvite(room.ID, 7); !invited {
+		t.Error("HasInvite() should report the invite")
+	}
+	if invited, _ := repo.HasInvite(room.ID, 8); invited {
+		t.Error("HasInvite() should not report other users")
+	}
+
+	repo.DeleteInvite(room.ID, 7)
+	if invited, _ := repo.HasInvite(room.ID, 7); invited {
+		t.Error("DeleteInvite() should remove the invite")
+	}
+}
+
+func TestRoomRepository_CanAccess(t *testing.T) {
+	db := setupTestDB(t)
+	roomRepo := NewRoomRepository(db)
+	userRepo := NewUserRepository(db)
+
+	member := &models.User{Username: "member", Email: "member@example.com", PasswordHash: "hash"}
+	outsider := &models.User{Username: "outsider", Email: "outsider@example.com", PasswordHash: "hash"}
+	userRepo.Create(member)
+	userRepo.Create(outsider)
+
+	public := &models.Room{Name: "Open", Type: "public", CreatedBy: member.ID}
+	private := &models.Room{Name: "Closed", Type: "private", CreatedBy: member.ID}
+	roomRepo.Create(public)
+	roomRepo.Create(private)
+	roomRepo.AddMember(private.ID, member.ID)
+
+	if ok, err := roomRepo.CanAccess(public.ID, outsider.ID); err != nil || !ok {
+		t.Errorf("CanAccess(public, outsider) = %v, %v; want true", ok, err)
+	}
+	if ok, err := roomRepo.CanAccess(private.ID, member.ID); err != nil || !ok {
+		t.Errorf("CanAccess(private, member) = %v, %v; want true", ok, err)
+	}
+	if ok, err := roomRepo.CanAccess(private.ID, outsider.ID); err != nil || ok {
+		t.Errorf("CanAccess(private, outsider) = %v, %v; want false", ok, err)
+	}
+	if _, err := roomRepo.CanAccess(9999, member.ID); err == nil {
+		t.Error("CanAccess() should fail for a missing room")
+	}
+}
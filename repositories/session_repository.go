@@ -0,0 +1,85 @@
+package repositories
+
+import (
+	"GoChatApp/models"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+type SessionRepository struct {
+	db *gorm.DB
+}
+
+func NewSessionRepository(db *gorm.DB) *SessionRepository {
+	return &SessionRepository{db: db}
+}
+
+// Create creates a new session
+func (r *SessionRepository) Create(session *models.Session) error {
+	return r.db.Create(session).Error
+}
+
+// FindByID finds a session by ID, revoked or not
+func (r *SessionRepository) FindByID(id uint) (*models.Session, error) {
+	var session models.Session
+	err := r.db.First(&session, id).Error
+	return &session, err
+}
+
+// FindActive finds a session that is neither revoked nor expired
+func (r *SessionRepository) FindActive(id uint) (*models.Session, error) {
+	var session models.Session
+	err := r.db.Where("revoked_at IS NULL AND expires_at > ?", time.Now()).First(&session, id).Error
+	return &session, err
+}
+
+// FindActiveByUser returns a user's active sessions, most recently used first
+func (r *SessionRepository) FindActiveByUser(userID uint) ([]models.Session, error) {
+	var sessions []models.Session
+	err := r.db.Where("user_id = ? AND revoked_at IS NULL AND expires_at > ?", userID, time.Now()).
+		Order("last_used_at DESC").
+		Find(&sessions).Error
+	return sessions, err
+}
+
+// Touch records when a session was last used
+func (r *SessionRepository) Touch(id uint, at time.Time) error {
+	return r.db.Model(&models.Session{}).Where("id = ?", id).Update("last_used_at", at).Error
+}
+
+// Revoke revokes a session. Revoking an already revoked session is a no-op.
+func (r *SessionRepository) Revoke(id uint) error {
+	return r.db.Model(&models.Session{}).
+		Where("id = ? AND revoked_at IS NULL", id).
+		Update("revoked_at", time.Now()).Error
+}
+
+// RevokeAllForUser revokes every active session of a user
+func (r *SessionRepository) RevokeAllForUser(userID uint) error {
+	return r.db.Model(&models.Session{}).
+		Where("user_id = ? AND revoked_at IS NULL", userID).
+		Update("revoked_at", time.Now()).Error
+}
+
+// CreateRefreshToken stores the hash of a session's next refresh token
+func (r *SessionRepository) CreateRefreshToken(sessionID uint, tokenHash string) error {
+	return r.db.Create(&models.RefreshToken{SessionID: sessionID, TokenHash: tokenHash}).Error
+}
+
+// FindRefreshToken finds a refresh token by hash, used or not
+func (r *SessionRepository) FindRefreshToken(tokenHash string) (*models.RefreshToken, error) {
+	var token models.RefreshToken
+	err := r.db.Where("token_hash = ?", tokenHash).First(&token).Error
+	return &token, err
+}
+
+// UseRefreshToken marks a refresh token as exchanged. It reports false if
+// the token had already been used, so two requests racing with the same
+// token cannot both succeed.
+func (r *SessionRepository) UseRefreshToken(id uint) (bool, error) {
+	result := r.db.Model(&models.RefreshToken{}).
+		Where("id = ? AND used_at IS NULL", id).
+		Update("used_at", time.Now())
+	return result.RowsAffected == 1, result.Error
+}
@@ -0,0 +1,66 @@
+package repositories
+
+import (
+	"GoChatApp/models"
+	"testing"
+	"time"
+)
+
+func TestSessionRepository_FindActive(t *testing.T) {
+	db := setupTestDB(t)
+	repo := NewSessionRepository(db)
+
+	active := &models.Session{UserID: 1, ExpiresAt: time.Now().Add(time.Hour)}
+	expired := &models.Session{UserID: 1, ExpiresAt: time.Now().Add(-time.Hour)}
+	revoked := &models.Session{UserID: 1, ExpiresAt: time.Now().Add(time.Hour)}
+	repo.Create(active)
+	repo.Create(expired)
+	repo.Create(revoked)
+	repo.Revoke(revoked.ID)
+
+	if _, err := repo.FindActive(active.ID); err != nil {
+		t.Errorf("FindActive() error = %v", err)
+	}
+	if _, err := repo.FindActive(expired.ID); err == nil {
+		t.Error("FindActive() should not find an expired session")
+	}
+	if _, err := repo.FindActive(revoked.ID); err == nil {
+		t.Error("FindActive() should not find a revoked session")
+	}
+
+	sessions, err := repo.FindActiveByUser(1)
+	if err != nil {
+		t.Errorf("FindActiveByUser() error = %v", err)
+	}
+	if len(sessions) != 1 || sessions[0].ID != active.ID {
+		t.Errorf("FindActiveByUser() = %v, want only session %d", sessions, active.ID)
+	}
+}
+
+func TestSessionRepository_UseRefreshTokenOnce(t *testing.T) {
+	db := setupTestDB(t)
+	repo := NewSessionRepository(db)
+
+	session := &models.Session{UserID: 1, ExpiresAt: time.Now().Add(time.Hour)}
+	repo.Create(session)
+	if err := repo.CreateRefreshToken(session.ID, "hash"); err != nil {
+		t.Fatalf("CreateRefreshToken() error = %v", err)
+	}
+
+	token, err := repo.FindRefreshToken("hash")
+	if err != nil {
+		t.Fatalf("FindRefreshToken() error = %v", err)
+	}
+
+	if used, err := repo.UseRefreshToken(token.ID); !used || err != nil {
+		t.Errorf("UseRefreshToken() = %v, %v; want true", used, err)
+	}
+	if used, _ := repo.UseRefreshToken(token.ID); used {
+		t.Error("UseRefreshToken() should fail for a token already used")
+	}
+
+	token, _ = repo.FindRefreshToken("hash")
+	if token.UsedAt == nil {
+		t.Error("UseRefreshToken() should record when the token was used")
+	}
+}
@@ -2,6 +2,7 @@ package repositories
 
 import (
 	"GoChatApp/models"
+	"time"
 
 	"gorm.io/gorm"
 )
@@ -52,7 +53,150 @@ func (r *UserRepository) Update(user *models.User) error {
 	return r.db.Save(user).Error
 }
 
+// FindByIDs finds all users with the given IDs
+func (r *UserRepository) FindByIDs(ids []uint) ([]models.User, error) {
+	var users []models.User
+	if len(ids) == 0 {
+		return users, nil
+	}
+	err := r.db.Where("id IN ?", ids).Find(&users).Error
+	return users, err
+}
+
+// UpdateLastSeen records when a user was last connected
+func (r *UserRepository) UpdateLastSeen(id uint, lastSeen time.Time) error {
+	return r.db.Model(&models.User{}).Where("id = ?", id).Update("last_seen_at", lastSeen).Error
+}
+
+// UpdatePassword replaces a user's password hash
+func (r *UserRepository) UpdatePassword(id uint, passwordHash string) error {
+	return r.db.Model(&models.User{}).Where("id = ?", id).Update("password_hash", passwordHash).Error
+}
+
+// UpdateProfile saves the fields a user may edit on their own profile,
+// leaving the rest of the row alone
+func (r *UserRepository) UpdateProfile(user *models.User) error {
+	return r.db.Model(user).Select("display_name", "bio", "avatar", "timezone", "pronouns").Updates(user).Error
+}
+
+// SetPendingEmail records the address a user wants to change to. Their
+// current address stays in use until ApplyPendingEmail.
+func (r *UserRepository) SetPendingEmail(id uint, email string) error {
+	return r.db.Model(&models.User{}).Where("id = ?", id).Update("pending_email", email).Error
+}
+
+// ApplyPendingEmail makes a confirmed pending address the user's email. It
+// reports false if the pending address is no longer the given one.
+func (r *UserRepository) ApplyPendingEmail(id uint, email string, at time.Time) (bool, error) {
+	result := r.db.Model(&models.User{}).
+		Where("id = ? AND pending_email = ?", id, email).
+		Updates(map[string]interface{}{
+			"email":             email,
+			"pending_email":     "",
+			"email_verified_at": at,
+		})
+	return result.RowsAffected == 1, result.Error
+}
+
+// MarkEmailVerified records that a user confirmed their email address
+func (r *UserRepository) MarkEmailVerified(id uint, at time.Time) error {
+	return r.db.Model(&models.User{}).Where("id = ?", id).Update("email_verified_at", at).Error
+}
+
 // Delete deletes a user
 func (r *UserRepository) Delete(id uint) error {
 	return r.db.Delete(&models.User{}, id).Error
 }
+
+// SetTOTPSecret stores a new, not yet confirmed TOTP secret. Two-factor
+// login stays off until EnableTOTP.
+func (r *UserRepository) SetTOTPSecret(id uint, secret string) error {
+	return r.db.Model(&models.User{}).Where("id = ?", id).Updates(map[string]interface{}{
+		"totp_secret":     secret,
+		"totp_enabled_at": nil,
+		"totp_last_step":  0,
+	}).Error
+}
+
+// EnableTOTP turns on two-factor login with the stored secret
+func (r *UserRepository) EnableTOTP(id uint, at time.Time) error {
+	return r.db.Model(&models.User{}).Where("id = ?", id).Update("totp_enabled_at", at).Error
+}
+
+// DisableTOTP turns off two-factor login and forgets the secret
+func (r *UserRepository) DisableTOTP(id uint) error {
+	return r.db.Model(&models.User{}).Where("id = ?", id).Updates(map[string]interface{}{
+		"totp_secret":     "",
+		"totp_enabled_at": nil,
+		"totp_last_step":  0,
+	}).Error
+}
+
+// UseTOTPStep records the time step of an accepted TOTP code. It reports
+// false if a code of that step or a later one was already accepted, so each
+// code works once.
+func (r *UserRepository) UseTOTPStep(id uint, step int64) (bool, error) {
+	result := r.db.Model(&models.User{}).
+		Where("id = ? AND totp_last_step < ?", id, step).
+		Update("totp_last_step", step)
+	return result.RowsAffected == 1, result.Error
+}
+
+// UserFilter narrows down a user search. Zero fields match everyone.
+type UserFilter struct {
+	Query    string // Part of the username or email address
+	Role     string
+	Disabled *bool
+}
+
+// Search finds users matching a filter, oldest first, and counts all the
+// matches for paging
+func (r *UserRepository) Search(filter UserFilter, limit, offset int) ([]models.User, int64, error) {
+	db := r.db.Model(&models.User{})
+	if filter.Query != "" {
+		db = db.Where("username LIKE ? OR email LIKE ?", "%"+filter.Query+"%", "%"+filter.Query+"%")
+	}
+	if filter.Role != "" {
+		db = db.Where("role = ?", filter.Role)
+	}
+	if filter.Disabled != nil {
+		if *filter.Disabled {
+			db = db.Where("disabled_at IS NOT NULL")
+		} else {
+			db = db.Where("disabled_at IS NULL")
+		}
+	}
+
+	var total int64
+	if err := db.Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+
+	var users []models.User
+	err := db.Order("id").Limit(limit).Offset(offset).Find(&users).Error
+	return users, total, err
+}
+
+// SetRole changes a user's global role
+func (r *UserRepository) SetRole(id uint, role string) error {
+	return r.db.Model(&models.User{}).Where("id = ?", id).Update("role", role).Error
+}
+
+// SetDisabled disables a user's account as of the given time, or enables
+// it again with nil
+func (r *UserRepository) SetDisabled(id uint, at *time.Time) error {
+	return r.db.Model(&models.User{}).Where("id = ?", id).Update("disabled_at", at).Error
+}
+
+// BootstrapAdmins makes the given users admins, but only while the server
+// has no admin at all. It returns how many users were promoted.
+func (r *UserRepository) BootstrapAdmins(ids []uint) (int64, error) {
+	if len(ids) == 0 {
+		return 0, nil
+	}
+	admins := r.db.Model(&models.User{}).Select("1").Where("role = ?", models.RoleAdmin)
+	result := r.db.Model(&models.User{}).
+		Where("id IN ? AND NOT EXISTS (?)", ids, admins).
+		Update("role", models.RoleAdmin)
+	return result.RowsAffected, result.Error
+}
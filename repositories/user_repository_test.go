@@ -3,6 +3,7 @@ package repositories
 import (
 	"GoChatApp/models"
 	"testing"
+	"time"
 
 	"gorm.io/driver/sqlite"
 	"gorm.io/gorm"
@@ -27,6 +28,15 @@ func setupTestDB(t *testing.T) *gorm.DB {
 		&models.DirectMessage{},
 		&models.Block{},
 		&models.ReadReceipt{},
+		&models.Session{},
+		&models.RefreshToken{},
+		&models.AccountToken{},
+		&models.RecoveryCode{},
+		&models.UserIdentity{},
+		&models.LoginThrottle{},
+		&models.LockoutEvent{},
+		&models.PersonalAccessToken{},
+		&models.RoomInvite{},
 	)
 	if err != nil {
 		t.Fatalf("Failed to migrate test database: %v", err)
@@ -183,6 +193,59 @@ func TestUserRepository_FindAll(t *testing.T) {
 	}
 }
 
+func TestUserRepository_FindByIDs(t *testing.T) {
+	db := setupTestDB(t)
+	repo := NewUserRepository(db)
+
+	users := []*models.User{
+		{Username: "user1", Email: "user1@example.com", PasswordHash: "hash"},
+		{Username: "user2", Email: "user2@example.com", PasswordHash: "hash"},
+		{Username: "user3", Email: "user3@example.com", PasswordHash: "hash"},
+	}
+
+	for _, u := range users {
+		repo.Create(u)
+	}
+
+	found, err := repo.FindByIDs([]uint{users[0].ID, users[2].ID})
+	if err != nil {
+		t.Errorf("FindByIDs() error = %v", err)
+		return
+	}
+
+	if len(found) != 2 {
+		t.Errorf("FindByIDs() returned %v users, want 2", len(found))
+	}
+
+	found, _ = repo.FindByIDs(nil)
+	if len(found) != 0 {
+		t.Errorf("FindByIDs() returned %v users for no IDs, want 0", len(found))
+	}
+}
+
+func TestUserRepository_UpdateLastSeen(t *testing.T) {
+	db := setupTestDB(t)
+	repo := NewUserRepository(db)
+
+	user := &models.User{
+		Username:     "testuser",
+		Email:        "test@example.com",
+		PasswordHash: "hashedpassword",
+	}
+	repo.Create(user)
+
+	lastSeen := time.Now().Add(-time.Minute).Truncate(time.Second)
+	if err := repo.UpdateLastSeen(user.ID, lastSeen); err != nil {
+		t.Errorf("UpdateLastSeen() error = %v", err)
+		return
+	}
+
+	found, _ := repo.FindByID(user.ID)
+	if found.LastSeenAt == nil || !found.LastSeenAt.Equal(lastSeen) {
+		t.Errorf("UpdateLastSeen() LastSeenAt = %v, want %v", found.LastSeenAt, lastSeen)
+	}
+}
+
 func TestUserRepository_Update(t *testing.T) {
 	db := setupTestDB(t)
 	repo := NewUserRepository(db)
@@ -209,6 +272,73 @@ func TestUserRepository_Update(t *testing.T) {
 	}
 }
 
+func TestUserRepository_UpdateProfile(t *testing.T) {
+	db := setupTestDB(t)
+	repo := NewUserRepository(db)
+
+	user := &models.User{
+		Username:     "testuser",
+		Email:        "test@example.com",
+		PasswordHash: "hashedpassword",
+	}
+	repo.Create(user)
+
+	// Only profile fields are saved, even if others changed in memory
+	user.DisplayName = "Test User"
+	user.Timezone = "Europe/Paris"
+	user.PasswordHash = "changed"
+	if err := repo.UpdateProfile(user); err != nil {
+		t.Fatalf("UpdateProfile() error = %v", err)
+	}
+
+	found, _ := repo.FindByID(user.ID)
+	if found.DisplayName != "Test User" || found.Timezone != "Europe/Paris" {
+		t.Errorf("UpdateProfile() profile = %q %q", found.DisplayName, found.Timezone)
+	}
+	if found.PasswordHash != "hashedpassword" {
+		t.Error("UpdateProfile() should not save the password hash")
+	}
+
+	// Clearing a field saves the empty value
+	user.DisplayName = ""
+	repo.UpdateProfile(user)
+	if found, _ := repo.FindByID(user.ID); found.DisplayName != "" {
+		t.Errorf("UpdateProfile() DisplayName = %q, want empty", found.DisplayName)
+	}
+}
+
+func TestUserRepository_PendingEmail(t *testing.T) {
+	db := setupTestDB(t)
+	repo := NewUserRepository(db)
+
+	user := &models.User{
+		Username:     "testuser",
+		Email:        "test@example.com",
+		PasswordHash: "hashedpassword",
+	}
+	repo.Create(user)
+
+	if err := repo.SetPendingEmail(user.ID, "new@example.com"); err != nil {
+		t.Fatalf("SetPendingEmail() error = %v", err)
+	}
+	if found, _ := repo.FindByID(user.ID); found.Email != "test@example.com" || found.PendingEmail != "new@example.com" {
+		t.Errorf("SetPendingEmail() = %q pending %q, want the address kept until applied", found.Email, found.PendingEmail)
+	}
+
+	// A superseded pending address is not applied
+	if applied, _ := repo.ApplyPendingEmail(user.ID, "other@example.com", time.Now()); applied {
+		t.Error("ApplyPendingEmail() applied an address that is not pending")
+	}
+	if applied, err := repo.ApplyPendingEmail(user.ID, "new@example.com", time.Now()); !applied || err != nil {
+		t.Fatalf("ApplyPendingEmail() = %v, %v; want applied", applied, err)
+	}
+
+	found, _ := repo.FindByID(user.ID)
+	if found.Email != "new@example.com" || found.PendingEmail != "" || found.EmailVerifiedAt == nil {
+		t.Errorf("ApplyPendingEmail() = %q pending %q verified %v, want new@example.com verified", found.Email, found.PendingEmail, found.EmailVerifiedAt)
+	}
+}
+
 func TestUserRepository_Delete(t *testing.T) {
 	db := setupTestDB(t)
 	repo := NewUserRepository(db)
@@ -232,3 +362,96 @@ func TestUserRepository_Delete(t *testing.T) {
 		t.Error("Delete() user should not be findable after deletion")
 	}
 }
+
+func TestUserRepository_TOTP(t *testing.T) {
+	db := setupTestDB(t)
+	repo := NewUserRepository(db)
+	user := &models.User{Username: "second", Email: "second@example.com", PasswordHash: "hash"}
+	repo.Create(user)
+
+	repo.SetTOTPSecret(user.ID, "SECRET")
+	found, _ := repo.FindByID(user.ID)
+	if found.TOTPSecret != "SECRET" || found.TOTPEnabledAt != nil {
+		t.Fatalf("Expected a pending secret, got %q enabled %v", found.TOTPSecret, found.TOTPEnabledAt)
+	}
+
+	repo.EnableTOTP(user.ID, time.Now())
+	if used, err := repo.UseTOTPStep(user.ID, 100); !used || err != nil {
+		t.Errorf("UseTOTPStep() = %v, %v; want true", used, err)
+	}
+	if used, _ := repo.UseTOTPStep(user.ID, 100); used {
+		t.Error("UseTOTPStep() should refuse a step already used")
+	}
+	if used, _ := repo.UseTOTPStep(user.ID, 99); used {
+		t.Error("UseTOTPStep() should refuse an earlier step")
+	}
+
+	repo.DisableTOTP(user.ID)
+	found, _ = repo.FindByID(user.ID)
+	if found.TOTPSecret != "" || found.TOTPEnabledAt != nil || found.TOTPLastStep != 0 {
+		t.Errorf("Expected two-factor login to be cleared, got %+v", found)
+	}
+}
+
+func TestUserRepository_Search(t *testing.T) {
+	db := setupTestDB(t)
+	repo := NewUserRepository(db)
+	for _, name := range []string{"alice", "bob", "carol", "alfred"} {
+		repo.Create(&models.User{Username: name, Email: name + "@example.com", PasswordHash: "hash"})
+	}
+	alice, _ := repo.FindByUsername("alice")
+	bob, _ := repo.FindByUsername("bob")
+	repo.SetRole(alice.ID, models.RoleModerator)
+	now := time.Now()
+	repo.SetDisabled(bob.ID, &now)
+
+	disabled, enabled := true, false
+	tests := []struct {
+		name   string
+		filter UserFilter
+		want   int64
+	}{
+		{"everyone", UserFilter{}, 4},
+		{"by name", UserFilter{Query: "al"}, 2},
+		{"by email", UserFilter{Query: "carol@"}, 1},
+		{"by role", UserFilter{Role: models.RoleModerator}, 1},
+		{"new users are plain users", UserFilter{Role: models.RoleUser}, 3},
+		{"disabled", UserFilter{Disabled: &disabled}, 1},
+		{"enabled", UserFilter{Disabled: &enabled}, 3},
+		{"combined", UserFilter{Query: "al", Role: models.RoleUser}, 1},
+	}
+	for _, tt := range tests {
+		users, total, err := repo.Search(tt.filter, 10, 0)
+		if err != nil || total != tt.want || int64(len(users)) != tt.want {
+			t.Errorf("%s: Search() = %d users, total %d, %v; want %d", tt.name, len(users), total, err, tt.want)
+		}
+	}
+
+	// Paging limits the page but not the total
+	users, total, _ := repo.Search(UserFilter{}, 2, 3)
+	if len(users) != 1 || total != 4 {
+		t.Errorf("Search() page = %d users, total %d; want 1 and 4", len(users), total)
+	}
+}
+
+func TestUserRepository_BootstrapAdmins(t *testing.T) {
+	db := setupTestDB(t)
+	repo := NewUserRepository(db)
+	first := &models.User{Username: "first", Email: "first@example.com", PasswordHash: "hash"}
+	second := &models.User{Username: "second", Email: "second@example.com", PasswordHash: "hash"}
+	repo.Create(first)
+	repo.Create(second)
+
+	if promoted, err := repo.BootstrapAdmins([]uint{first.ID, 999}); promoted != 1 || err != nil {
+		t.Fatalf("BootstrapAdmins() = %d, %v; want 1", promoted, err)
+	}
+	found, _ := repo.FindByID(first.ID)
+	if found.Role != models.RoleAdmin {
+		t.Errorf("Role = %q, want admin", found.Role)
+	}
+
+	// Once there is an admin, the bootstrap list is ignored
+	if promoted, _ := repo.BootstrapAdmins([]uint{second.ID}); promoted != 0 {
+		t.Errorf("BootstrapAdmins() promoted %d users with an admin present", promoted)
+	}
+}
@@ -3,6 +3,9 @@ package routes
 import (
 	"GoChatApp/handlers"
 	"GoChatApp/middleware"
+	"GoChatApp/models"
+	"GoChatApp/repositories"
+	"GoChatApp/utils"
 	"net/http"
 	"os"
 
@@ -10,7 +13,7 @@ import (
 )
 
 // SetupRoutes configures all application routes
-func SetupRoutes(router *gin.Engine, authHandler *handlers.AuthHandler, userHandler *handlers.UserHandler, messageHandler *handlers.MessageHandler, roomHandler *handlers.RoomHandler, reactionHandler *handlers.ReactionHandler, dmHandler *handlers.DMHandler, blockHandler *handlers.BlockHandler, receiptHandler *handlers.ReadReceiptHandler, uploadHandler *handlers.UploadHandler, wsHandler *handlers.WebSocketHandler) {
+func SetupRoutes(router *gin.Engine, authHandler *handlers.AuthHandler, oidcHandler *handlers.OIDCHandler, userHandler *handlers.UserHandler, messageHandler *handlers.MessageHandler, roomHandler *handlers.RoomHandler, reactionHandler *handlers.ReactionHandler, dmHandler *handlers.DMHandler, blockHandler *handlers.BlockHandler, receiptHandler *handlers.ReadReceiptHandler, uploadHandler *handlers.UploadHandler, wsHandler *handlers.WebSocketHandler, presenceHandler *handlers.PresenceHandler, adminHandler *handlers.AdminHandler, accessTokenHandler *handlers.AccessTokenHandler, sessionRepo *repositories.SessionRepository, accessTokenRepo *repositories.PersonalAccessTokenRepository, unverified *middleware.UnverifiedLimits) {
 	// Apply CORS middleware
 	router.Use(middleware.CORSMiddleware())
 
@@ -28,6 +31,12 @@ func SetupRoutes(router *gin.Engine, authHandler *handlers.AuthHandler, userHand
 	// Serve uploaded files
 	router.Static("/uploads", "./uploads")
 
+	// Public token verification keys for other services
+	router.GET("/.well-known/jwks.json", func(c *gin.Context) {
+		c.Header("Cache-Control", "public, max-age=300")
+		c.JSON(http.StatusOK, utils.CurrentKeyring().JWKS())
+	})
+
 	// API routes (public)
 	api := router.Group("/api")
 	{
@@ -38,7 +47,18 @@ func SetupRoutes(router *gin.Engine, authHandler *handlers.AuthHandler, userHand
 
 		// Authentication routes (public)
 		api.POST("/login", authHandler.Login)
+		api.POST("/login/2fa", authHandler.VerifyTwoFactor)
 		api.POST("/register", authHandler.Register)
+		api.POST("/token/refresh", authHandler.RefreshToken)
+		api.POST("/password/forgot", authHandler.ForgotPassword)
+		api.POST("/password/reset", authHandler.ResetPassword)
+		api.POST("/email/verify", authHandler.VerifyEmail)
+
+		// Single sign-on through OpenID Connect providers (public)
+		api.GET("/auth/oidc/providers", oidcHandler.GetProviders)
+		api.GET("/auth/oidc/:provider/login", oidcHandler.Login)
+		api.GET("/auth/oidc/:provider/callback", oidcHandler.Callback)
+		api.POST("/auth/oidc/exchange", oidcHandler.Exchange)
 
 		// Public user routes
 		api.GET("/users", userHandler.GetUsers)
@@ -58,42 +78,99 @@ func SetupRoutes(router *gin.Engine, authHandler *handlers.AuthHandler, userHand
 		// Read receipts (public read)
 		api.GET("/rooms/:id/receipts", receiptHandler.GetReadReceipts)
 
-		// WebSocket endpoint (auth via token query param)
+		// WebSocket and SSE endpoints (auth via single-use ticket)
 		api.GET("/ws", wsHandler.HandleWebSocket)
+		api.GET("/events", wsHandler.HandleEvents)
 	}
 
-	// Protected routes (require authentication)
+	// Protected routes (require a signed-in session)
 	protected := router.Group("/api")
-	protected.Use(middleware.AuthMiddleware())
+	protected.Use(middleware.AuthMiddleware(sessionRepo, nil))
+	{
+		// Session routes (protected)
+		protected.POST("/logout", authHandler.Logout)
+		protected.GET("/sessions", authHandler.GetSessions)
+		protected.DELETE("/sessions/:id", authHandler.RevokeSession)
+		protected.POST("/email/verify/resend", authHandler.ResendVerification)
+
+		// The signed-in user's own profile (protected)
+		protected.GET("/users/me", authHandler.GetMe)
+		protected.PATCH("/users/me", authHandler.UpdateMe)
+		protected.PUT("/users/me/password", authHandler.ChangePassword)
+		protected.PUT("/users/me/email", authHandler.ChangeEmail)
+
+		// Two-factor authentication (protected)
+		protected.POST("/2fa/setup", authHandler.SetupTwoFactor)
+		protected.POST("/2fa/confirm", authHandler.ConfirmTwoFactor)
+		protected.POST("/2fa/disable", authHandler.DisableTwoFactor)
+
+		// Personal access tokens (protected)
+		protected.GET("/tokens", accessTokenHandler.GetAccessTokens)
+		protected.POST("/tokens", accessTokenHandler.CreateAccessToken)
+		protected.POST("/tokens/:id/rotate", accessTokenHandler.RotateAccessToken)
+		protected.DELETE("/tokens/:id", accessTokenHandler.RevokeAccessToken)
+
+		// WebSocket connection tickets (protected)
+		protected.POST("/ws/ticket", wsHandler.IssueTicket)
+	}
+
+	// Scoped routes (require a signed-in session, or a personal access
+	// token with the route's scope)
+	scoped := router.Group("/api")
+	scoped.Use(middleware.AuthMiddleware(sessionRepo, accessTokenRepo))
+	{
+		// Message routes (scoped)
+		scoped.POST("/messages", middleware.RequireScope(models.ScopeMessagesWrite), messageHandler.SendMessage)
+
+		// Room routes (scoped)
+		scoped.POST("/rooms", middleware.RequireScope(models.ScopeRoomsWrite), unverified.Require(middleware.FeatureRooms), roomHandler.CreateRoom)
+		scoped.POST("/rooms/:id/join", middleware.RequireScope(models.ScopeRoomsWrite), roomHandler.JoinRoom)
+		scoped.POST("/rooms/:id/leave", middleware.RequireScope(models.ScopeRoomsWrite), roomHandler.LeaveRoom)
+		scoped.POST("/rooms/:id/invites", middleware.RequireScope(models.ScopeRoomsWrite), roomHandler.InviteMember)
+		scoped.DELETE("/rooms/:id/members/:user_id", middleware.RequireScope(models.ScopeRoomsWrite), roomHandler.KickMember)
+
+		// Presence routes (scoped)
+		scoped.GET("/presence", middleware.RequireScope(models.ScopeRoomsRead), presenceHandler.GetPresence)
+		scoped.GET("/rooms/:id/online", middleware.RequireScope(models.ScopeRoomsRead), presenceHandler.GetRoomOnline)
+
+		// Reaction routes (scoped)
+		scoped.POST("/messages/:id/reactions", middleware.RequireScope(models.ScopeMessagesWrite), reactionHandler.ToggleReaction)
+
+		// Direct message routes (scoped)
+		scoped.GET("/conversations", middleware.RequireScope(models.ScopeConversationsRead), dmHandler.GetConversations)
+		scoped.POST("/conversations", middleware.RequireScope(models.ScopeConversationsWrite), unverified.Require(middleware.FeatureDirectMessages), dmHandler.StartConversation)
+		scoped.GET("/conversations/:id/messages", middleware.RequireScope(models.ScopeConversationsRead), dmHandler.GetMessages)
+		scoped.POST("/conversations/:id/messages", middleware.RequireScope(models.ScopeConversationsWrite), unverified.Require(middleware.FeatureDirectMessages), dmHandler.SendMessage)
+		scoped.GET("/conversations/unread", middleware.RequireScope(models.ScopeConversationsRead), dmHandler.GetUnreadCount)
+
+		// Block routes (scoped)
+		scoped.GET("/blocks", middleware.RequireScope(models.ScopeBlocksRead), blockHandler.GetBlockedUsers)
+		scoped.POST("/users/:id/block", middleware.RequireScope(models.ScopeBlocksWrite), blockHandler.BlockUser)
+		scoped.DELETE("/users/:id/block", middleware.RequireScope(models.ScopeBlocksWrite), blockHandler.UnblockUser)
+
+		// Read receipt routes (scoped)
+		scoped.POST("/receipts", middleware.RequireScope(models.ScopeMessagesWrite), receiptHandler.MarkAsRead)
+
+		// File upload (scoped)
+		scoped.POST("/upload", middleware.RequireScope(models.ScopeUploadsWrite), unverified.Require(middleware.FeatureUploads), uploadHandler.UploadFile)
+	}
+
+	// Admin routes (require a moderator or admin account)
+	admin := protected.Group("/admin")
+	admin.Use(middleware.RequireRole(models.RoleModerator))
 	{
-		// Message routes (protected)
-		protected.POST("/messages", messageHandler.SendMessage)
-
-		// Room routes (protected)
-		protected.POST("/rooms", roomHandler.CreateRoom)
-		protected.POST("/rooms/:id/join", roomHandler.JoinRoom)
-		protected.POST("/rooms/:id/leave", roomHandler.LeaveRoom)
-
-		// Reaction routes (protected)
-		protected.POST("/messages/:id/reactions", reactionHandler.ToggleReaction)
-
-		// Direct message routes (protected)
-		protected.GET("/conversations", dmHandler.GetConversations)
-		protected.POST("/conversations", dmHandler.StartConversation)
-		protected.GET("/conversations/:id/messages", dmHandler.GetMessages)
-		protected.POST("/conversations/:id/messages", dmHandler.SendMessage)
-		protected.GET("/conversations/unread", dmHandler.GetUnreadCount)
-
-		// Block routes (protected)
-		protected.GET("/blocks", blockHandler.GetBlockedUsers)
-		protected.POST("/users/:id/block", blockHandler.BlockUser)
-		protected.DELETE("/users/:id/block", blockHandler.UnblockUser)
-
-		// Read receipt routes (protected)
-		protected.POST("/receipts", receiptHandler.MarkAsRead)
-
-		// File upload (protected)
-		protected.POST("/upload", uploadHandler.UploadFile)
+		// Login lockouts
+		admin.GET("/lockouts", adminHandler.GetLockouts)
+		admin.POST("/lockouts/unlock", adminHandler.Unlock)
+
+		// User management (changes need an admin)
+		admin.GET("/users", adminHandler.GetUsers)
+		admin.PUT("/users/:id/role", middleware.RequireRole(models.RoleAdmin), adminHandler.SetRole)
+		admin.POST("/users/:id/disable", middleware.RequireRole(models.RoleAdmin), adminHandler.DisableUser)
+		admin.POST("/users/:id/enable", middleware.RequireRole(models.RoleAdmin), adminHandler.EnableUser)
+
+		// WebSocket delivery counters
+		admin.GET("/ws/stats", wsHandler.GetStats)
 	}
 
 	// SPA fallback - serve index.html for all non-API/non-static routes
@@ -0,0 +1,209 @@
+// Package sso signs users in through OpenID Connect identity providers
+// using the authorization code flow with PKCE.
+package sso
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/coreos/go-oidc/v3/oidc"
+	"golang.org/x/oauth2"
+)
+
+// httpTimeout bounds each request to an identity provider
+const httpTimeout = 10 * time.Second
+
+// Provider is a configured OpenID Connect identity provider
+type Provider struct {
+	Name         string // Used in URLs, e.g. /api/auth/oidc/<name>/login
+	DisplayName  string // Shown on the login button
+	Issuer       string
+	ClientID     string
+	ClientSecret string
+	RedirectURL  string
+	Scopes       []string
+
+	client *http.Client
+
+	mu       sync.Mutex
+	provider *oidc.Provider // Discovered on first use
+}
+
+// Identity is what a provider vouches for about a user
+type Identity struct {
+	Subject           string
+	Email             string
+	EmailVerified     bool
+	PreferredUsername string
+	Name              string
+}
+
+// Login is the state of an authorization request that the callback must
+// present again. It stays with the user's browser.
+type Login struct {
+	State    string // Echoed back by the provider, against login CSRF
+	Nonce    string // Bound into the ID token, against token replay
+	Verifier string // PKCE code verifier, never sent to the browser's URL
+}
+
+// NewProvider creates a provider. The issuer's discovery document is only
+// fetched when the provider is first used, so an unreachable provider does
+// not stop the server from starting.
+func NewProvider(name, issuer, clientID, clientSecret, redirectURL string) *Provider {
+	return &Provider{
+		Name:         name,
+		DisplayName:  name,
+		Issuer:       issuer,
+		ClientID:     clientID,
+		ClientSecret: clientSecret,
+		RedirectURL:  redirectURL,
+		Scopes:       []string{oidc.ScopeOpenID, "email", "profile"},
+		client:       &http.Client{Timeout: httpTimeout},
+	}
+}
+
+// discover returns the provider's discovered configuration, fetching it if
+// an earlier attempt has not succeeded
+func (p *Provider) discover(ctx context.Context) (*oidc.Provider, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.provider != nil {
+		return p.provider, nil
+	}
+
+	// Keys are fetched later with this context, so it must outlive the request
+	provider, err := oidc.NewProvider(oidc.ClientContext(context.Background(), p.client), p.Issuer)
+	if err != nil {
+		return nil, fmt.Errorf("discovering %s: %w", p.Issuer, err)
+	}
+	p.provider = provider
+	return provider, nil
+}
+
+// oauth2Config is the client configuration for the provider's endpoints
+func (p *Provider) oauth2Config(provider *oidc.Provider) *oauth2.Config {
+	return &oauth2.Config{
+		ClientID:     p.ClientID,
+		ClientSecret: p.ClientSecret,
+		RedirectURL:  p.RedirectURL,
+		Endpoint:     provider.Endpoint(),
+		Scopes:       p.Scopes,
+	}
+}
+
+// AuthCodeURL starts a login. It returns the provider URL to send the user
+// to and the state to keep for the callback.
+func (p *Provider) AuthCodeURL(ctx context.Context) (string, *Login, error) {
+	provider, err := p.discover(ctx)
+	if err != nil {
+		return "", nil, err
+	}
+
+	login := &Login{
+		State:    oauth2.GenerateVerifier(),
+		Nonce:    oauth2.GenerateVerifier(),
+		Verifier: oauth2.GenerateVerifier(),
+	}
+	url := p.oauth2Config(provider).AuthCodeURL(login.State,
+		oidc.Nonce(login.Nonce),
+		oauth2.S256ChallengeOption(login.Verifier),
+	)
+	return url, login, nil
+}
+
+// Exchange redeems an authorization code for the user's identity. The ID
+// token's signature, issuer, audience, expiry and nonce are all checked.
+func (p *Provider) Exchange(ctx context.Context, login *Login, code string) (*Identity, error) {
+	provider, err := p.discover(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	ctx = context.WithValue(ctx, oauth2.HTTPClient, p.client)
+	token, err := p.oauth2Config(provider).Exchange(ctx, code, oauth2.VerifierOption(login.Verifier))
+	if err != nil {
+		return nil, fmt.Errorf("exchanging code: %w", err)
+	}
+	rawIDToken, ok := token.Extra("id_token").(string)
+	if !ok {
+		return nil, errors.New("no id_token in token response")
+	}
+
+	idToken, err := provider.Verifier(&oidc.Config{ClientID: p.ClientID}).Verify(ctx, rawIDToken)
+	if err != nil {
+		return nil, fmt.Errorf("verifying id_token: %w", err)
+	}
+	if idToken.Nonce != login.Nonce {
+		return nil, errors.New("id_token nonce does not match")
+	}
+
+	var claims struct {
+		Email             string `json:"email"`
+		EmailVerified     bool   `json:"email_verified"`
+		PreferredUsername string `json:"preferred_username"`
+		Name              string `json:"name"`
+	}
+	if err := idToken.Claims(&claims); err != nil {
+		return nil, fmt.Errorf("reading id_token claims: %w", err)
+	}
+
+	return &Identity{
+		Subject:           idToken.Subject,
+		Email:             claims.Email,
+		EmailVerified:     claims.EmailVerified,
+		PreferredUsername: claims.PreferredUsername,
+		Name:              claims.Name,
+	}, nil
+}
+
+// LoadProviders reads the providers named in OIDC_PROVIDERS from the
+// environment. For a provider named corp:
+//
+//   - OIDC_CORP_ISSUER: issuer URL (required)
+//   - OIDC_CORP_CLIENT_ID, OIDC_CORP_CLIENT_SECRET: client credentials
+//   - OIDC_CORP_DISPLAY_NAME: login button label (default the name)
+//   - OIDC_CORP_SCOPES: comma-separated scopes (default openid,email,profile)
+//   - OIDC_CORP_REDIRECT_URL: callback URL registered with the provider
+//     (default <baseURL>/api/auth/oidc/corp/callback)
+func LoadProviders(baseURL string) (map[string]*Provider, error) {
+	providers := make(map[string]*Provider)
+	for _, name := range strings.Split(os.Getenv("OIDC_PROVIDERS"), ",") {
+		name = strings.ToLower(strings.TrimSpace(name))
+		if name == "" {
+			continue
+		}
+		prefix := "OIDC_" + strings.ToUpper(strings.ReplaceAll(name, "-", "_")) + "_"
+
+		issuer := os.Getenv(prefix + "ISSUER")
+		clientID := os.Getenv(prefix + "CLIENT_ID")
+		if issuer == "" || clientID == "" {
+			return nil, fmt.Errorf("%sISSUER and %sCLIENT_ID must be set for provider %q", prefix, prefix, name)
+		}
+
+		redirectURL := os.Getenv(prefix + "REDIRECT_URL")
+		if redirectURL == "" {
+			redirectURL = baseURL + "/api/auth/oidc/" + name + "/callback"
+		}
+
+		provider := NewProvider(name, issuer, clientID, os.Getenv(prefix+"CLIENT_SECRET"), redirectURL)
+		if displayName := os.Getenv(prefix + "DISPLAY_NAME"); displayName != "" {
+			provider.DisplayName = displayName
+		}
+		if scopes := os.Getenv(prefix + "SCOPES"); scopes != "" {
+			provider.Scopes = nil
+			for _, scope := range strings.Split(scopes, ",") {
+				if scope = strings.TrimSpace(scope); scope != "" {
+					provider.Scopes = append(provider.Scopes, scope)
+				}
+			}
+		}
+		providers[name] = provider
+	}
+	return providers, nil
+}
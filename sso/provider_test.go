@@ -0,0 +1,57 @@
+package sso
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestLoadProviders(t *testing.T) {
+	t.Setenv("OIDC_PROVIDERS", "corp, partner-idp")
+	t.Setenv("OIDC_CORP_ISSUER", "https://login.corp.example")
+	t.Setenv("OIDC_CORP_CLIENT_ID", "chat")
+	t.Setenv("OIDC_CORP_CLIENT_SECRET", "secret")
+	t.Setenv("OIDC_CORP_DISPLAY_NAME", "Corp SSO")
+	t.Setenv("OIDC_PARTNER_IDP_ISSUER", "https://partner.example")
+	t.Setenv("OIDC_PARTNER_IDP_CLIENT_ID", "chat")
+	t.Setenv("OIDC_PARTNER_IDP_SCOPES", "openid, email")
+	t.Setenv("OIDC_PARTNER_IDP_REDIRECT_URL", "https://chat.example/callback")
+
+	providers, err := LoadProviders("https://chat.example")
+	if err != nil {
+		t.Fatalf("LoadProviders() error = %v", err)
+	}
+
+	corp := providers["corp"]
+	if corp == nil || corp.DisplayName != "Corp SSO" || corp.ClientSecret != "secret" {
+		t.Fatalf("Unexpected corp provider %+v", corp)
+	}
+	if corp.RedirectURL != "https://chat.example/api/auth/oidc/corp/callback" {
+		t.Errorf("RedirectURL = %q", corp.RedirectURL)
+	}
+
+	partner := providers["partner-idp"]
+	if partner == nil || partner.RedirectURL != "https://chat.example/callback" {
+		t.Fatalf("Unexpected partner provider %+v", partner)
+	}
+	if !reflect.DeepEqual(partner.Scopes, []string{"openid", "email"}) {
+		t.Errorf("Scopes = %v", partner.Scopes)
+	}
+}
+
+func TestLoadProviders_MissingIssuer(t *testing.T) {
+	t.Setenv("OIDC_PROVIDERS", "corp")
+	t.Setenv("OIDC_CORP_CLIENT_ID", "chat")
+
+	if _, err := LoadProviders("https://chat.example"); err == nil {
+		t.Error("LoadProviders() should fail without an issuer")
+	}
+}
+
+func TestLoadProviders_None(t *testing.T) {
+	t.Setenv("OIDC_PROVIDERS", "")
+
+	providers, err := LoadProviders("https://chat.example")
+	if err != nil || len(providers) != 0 {
+		t.Errorf("LoadProviders() = %v, %v; want no providers", providers, err)
+	}
+}
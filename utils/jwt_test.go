@@ -21,7 +21,7 @@ func TestGenerateToken(t *testing.T) {
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			token, err := GenerateToken(tt.userID, tt.username, tt.email)
+			token, err := GenerateToken(tt.userID, tt.username, tt.email, "user", 0)
 			if err != nil {
 				t.Errorf("GenerateToken() error = %v", err)
 				return
@@ -53,7 +53,7 @@ func TestGenerateToken(t *testing.T) {
 
 func TestValidateToken(t *testing.T) {
 	// Generate a valid token for testing
-	validToken, _ := GenerateToken(1, "testuser", "test@example.com")
+	validToken, _ := GenerateToken(1, "testuser", "test@example.com", "user", 0)
 
 	tests := []struct {
 		name        string
@@ -99,8 +99,7 @@ func TestTokenExpiration(t *testing.T) {
 		},
 	}
 
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
-	expiredToken, _ := token.SignedString(jwtSecret)
+	expiredToken, _ := CurrentKeyring().sign(claims)
 
 	_, err := ValidateToken(expiredToken)
 	if err == nil {
@@ -110,9 +109,9 @@ func TestTokenExpiration(t *testing.T) {
 
 func TestTokenUniqueness(t *testing.T) {
 	// Same user should get different tokens (due to IssuedAt timestamp)
-	token1, _ := GenerateToken(1, "user", "user@example.com")
+	token1, _ := GenerateToken(1, "user", "user@example.com", "user", 0)
 	time.Sleep(time.Millisecond * 10) // Small delay to ensure different timestamp
-	token2, _ := GenerateToken(1, "user", "user@example.com")
+	token2, _ := GenerateToken(1, "user", "user@example.com", "user", 0)
 
 	// Tokens might be the same if generated within the same second
 	// This is acceptable behavior, just verify both are valid
@@ -123,3 +122,30 @@ func TestTokenUniqueness(t *testing.T) {
 		t.Error("Both tokens should be valid")
 	}
 }
+
+func TestGenerateToken_CarriesSession(t *testing.T) {
+	token, _ := GenerateToken(1, "user", "user@example.com", "user", 42)
+
+	claims, err := ValidateToken(token)
+	if err != nil {
+		t.Fatalf("ValidateToken() error = %v", err)
+	}
+	if claims.SessionID != 42 {
+		t.Errorf("Claims.SessionID = %v, want 42", claims.SessionID)
+	}
+	if ttl := time.Until(claims.ExpiresAt.Time); ttl > AccessTokenTTL || ttl < AccessTokenTTL-time.Minute {
+		t.Errorf("Token expires in %v, want about %v", ttl, AccessTokenTTL)
+	}
+}
+
+func TestGenerateToken_CarriesRole(t *testing.T) {
+	token, _ := GenerateToken(1, "boss", "boss@example.com", "admin", 1)
+
+	claims, err := ValidateToken(token)
+	if err != nil {
+		t.Fatalf("ValidateToken() error = %v", err)
+	}
+	if claims.Role != "admin" {
+		t.Errorf("Claims.Role = %q, want admin", claims.Role)
+	}
+}
@@ -0,0 +1,369 @@
+package utils
+
+import (
+	"crypto"
+	"crypto/ed25519"
+	"crypto/hmac"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"log"
+	"math/big"
+	"os"
+	"sort"
+	"strings"
+	"sync/atomic"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// defaultSecret signs tokens when nothing else is configured. It is public,
+// so it is refused in production.
+const defaultSecret = "dev-secret-change-in-production"
+
+// Signing algorithms a key can use
+const (
+	AlgHS256 = "HS256"
+	AlgRS256 = "RS256"
+	AlgEdDSA = "EdDSA"
+)
+
+// Key is a token signing or verification key, named by the kid header of
+// the tokens it signs
+type Key struct {
+	ID        string
+	Algorithm string
+
+	sign   interface{} // []byte, *rsa.PrivateKey or ed25519.PrivateKey; nil if verify-only
+	verify interface{} // []byte, *rsa.PublicKey or ed25519.PublicKey
+}
+
+// Keyring signs tokens with one key and verifies them with any of its keys,
+// so a key can be rotated out without invalidating tokens it already signed
+type Keyring struct {
+	signing *Key
+	keys    map[string]*Key
+}
+
+// keyring is the process-wide keyring used by GenerateToken and ValidateToken
+var keyring atomic.Pointer[Keyring]
+
+func init() {
+	// A development keyring, so tests and tools work without configuration.
+	// main replaces it with InitKeyring.
+	secret := os.Getenv("JWT_SECRET")
+	if secret == "" {
+		secret = defaultSecret
+	}
+	keyring.Store(NewKeyring(NewHMACKey([]byte(secret))))
+}
+
+// NewKeyring creates a keyring that signs with the first key and also
+// accepts tokens signed by the others
+func NewKeyring(signing *Key, verifyOnly ...*Key) *Keyring {
+	k := &Keyring{signing: signing, keys: map[string]*Key{signing.ID: signing}}
+	for _, key := range verifyOnly {
+		k.keys[key.ID] = key
+	}
+	return k
+}
+
+// SetKeyring replaces the keyring used to sign and verify tokens
+func SetKeyring(k *Keyring) {
+	keyring.Store(k)
+}
+
+// CurrentKeyring returns the keyring used to sign and verify tokens
+func CurrentKeyring() *Keyring {
+	return keyring.Load()
+}
+
+// SigningKey returns the key new tokens are signed with
+func (k *Keyring) SigningKey() *Key {
+	return k.signing
+}
+
+// sign signs claims with the signing key and names it in the kid header
+func (k *Keyring) sign(claims jwt.Claims) (string, error) {
+	token := jwt.NewWithClaims(jwt.GetSigningMethod(k.signing.Algorithm), claims)
+	token.Header["kid"] = k.signing.ID
+	return token.SignedString(k.signing.sign)
+}
+
+// keyFunc finds the key a token names. Tokens without a kid predate the
+// keyring and are checked against the signing key. A key only verifies
+// tokens of its own algorithm, so an RSA public key can never be used as an
+// HMAC secret.
+func (k *Keyring) keyFunc(token *jwt.Token) (interface{}, error) {
+	key := k.signing
+	if kid, ok := token.Header["kid"].(string); ok {
+		if key, ok = k.keys[kid]; !ok {
+			return nil, fmt.Errorf("unknown key %q", kid)
+		}
+	}
+	if token.Method.Alg() != key.Algorithm {
+		return nil, fmt.Errorf("unexpected signing method %s", token.Method.Alg())
+	}
+	return key.verify, nil
+}
+
+// hmacKeyIDLabel is MACed under an HMAC secret to name its key
+const hmacKeyIDLabel = "GoChatApp JWT key ID"
+
+// NewHMACKey creates an HS256 key from a shared secret. The key ID is an
+// HMAC of a fixed label under the secret rather than a hash of the secret,
+// so it is no easier to test guesses against than a signed token.
+func NewHMACKey(secret []byte) *Key {
+	mac := hmac.New(sha256.New, secret)
+	mac.Write([]byte(hmacKeyIDLabel))
+	return &Key{
+		ID:        "hs256-" + hex.EncodeToString(mac.Sum(nil)[:8]),
+		Algorithm: AlgHS256,
+		sign:      secret,
+		verify:    secret,
+	}
+}
+
+// ParsePrivateKeyPEM reads an RSA (RS256) or Ed25519 (EdDSA) private key in
+// PKCS#1 or PKCS#8 PEM form
+func ParsePrivateKeyPEM(data []byte) (*Key, error) {
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, errors.New("no PEM block found")
+	}
+
+	var private crypto.PrivateKey
+	var err error
+	switch block.Type {
+	case "RSA PRIVATE KEY":
+		private, err = x509.ParsePKCS1PrivateKey(block.Bytes)
+	case "PRIVATE KEY":
+		private, err = x509.ParsePKCS8PrivateKey(block.Bytes)
+	default:
+		return nil, fmt.Errorf("unsupported PEM block %q", block.Type)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	switch private := private.(type) {
+	case *rsa.PrivateKey:
+		key, err := newPublicKey(&private.PublicKey)
+		if err != nil {
+			return nil, err
+		}
+		key.sign = private
+		return key, nil
+	case ed25519.PrivateKey:
+		key, err := newPublicKey(private.Public())
+		if err != nil {
+			return nil, err
+		}
+		key.sign = private
+		return key, nil
+	}
+	return nil, fmt.Errorf("unsupported private key type %T", private)
+}
+
+// ParsePublicKeyPEM reads an RSA or Ed25519 public key in PKIX PEM form. A
+// private key is accepted too and used for verification only.
+func ParsePublicKeyPEM(data []byte) (*Key, error) {
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, errors.New("no PEM block found")
+	}
+	if block.Type != "PUBLIC KEY" {
+		key, err := ParsePrivateKeyPEM(data)
+		if err != nil {
+			return nil, err
+		}
+		key.sign = nil
+		return key, nil
+	}
+
+	public, err := x509.ParsePKIXPublicKey(block.Bytes)
+	if err != nil {
+		return nil, err
+	}
+	return newPublicKey(public)
+}
+
+// newPublicKey creates a verify-only key named by its RFC 7638 thumbprint,
+// so every instance derives the same kid without configuration
+func newPublicKey(public crypto.PublicKey) (*Key, error) {
+	var key *Key
+	switch public := public.(type) {
+	case *rsa.PublicKey:
+		if public.N.BitLen() < 2048 {
+			return nil, errors.New("RSA keys must be at least 2048 bits")
+		}
+		key = &Key{Algorithm: AlgRS256, verify: public}
+	case ed25519.PublicKey:
+		key = &Key{Algorithm: AlgEdDSA, verify: public}
+	default:
+		return nil, fmt.Errorf("unsupported public key type %T", public)
+	}
+
+	// The thumbprint hashes the required members in lexicographic order
+	jwk := key.JWK()
+	var members string
+	if jwk.Kty == "RSA" {
+		members = fmt.Sprintf(`{"e":%q,"kty":"RSA","n":%q}`, jwk.E, jwk.N)
+	} else {
+		members = fmt.Sprintf(`{"crv":%q,"kty":"OKP","x":%q}`, jwk.Crv, jwk.X)
+	}
+	sum := sha256.Sum256([]byte(members))
+	key.ID = base64.RawURLEncoding.EncodeToString(sum[:])
+	return key, nil
+}
+
+// JWK describes a public key in JSON Web Key form
+type JWK struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Use string `json:"use"`
+	Alg string `json:"alg"`
+	N   string `json:"n,omitempty"`   // RSA modulus
+	E   string `json:"e,omitempty"`   // RSA exponent
+	Crv string `json:"crv,omitempty"` // OKP curve
+	X   string `json:"x,omitempty"`   // OKP public key
+}
+
+// JWK returns the key in JSON Web Key form. HMAC keys are secret and have
+// no public form; their JWK is empty.
+func (key *Key) JWK() JWK {
+	switch public := key.verify.(type) {
+	case *rsa.PublicKey:
+		return JWK{
+			Kty: "RSA",
+			Kid: key.ID,
+			Use: "sig",
+			Alg: key.Algorithm,
+			N:   base64.RawURLEncoding.EncodeToString(public.N.Bytes()),
+			E:   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(public.E)).Bytes()),
+		}
+	case ed25519.PublicKey:
+		return JWK{
+			Kty: "OKP",
+			Kid: key.ID,
+			Use: "sig",
+			Alg: key.Algorithm,
+			Crv: "Ed25519",
+			X:   base64.RawURLEncoding.EncodeToString(public),
+		}
+	}
+	return JWK{}
+}
+
+// JWKSet is a published set of verification keys
+type JWKSet struct {
+	Keys []JWK `json:"keys"`
+}
+
+// JWKS returns the public keys of the keyring, signing key first, for
+// services that verify tokens themselves. HMAC keys are never published.
+func (k *Keyring) JWKS() JWKSet {
+	set := JWKSet{Keys: []JWK{}}
+	if jwk := k.signing.JWK(); jwk.Kty != "" {
+		set.Keys = append(set.Keys, jwk)
+	}
+	ids := make([]string, 0, len(k.keys))
+	for id := range k.keys {
+		if id != k.signing.ID {
+			ids = append(ids, id)
+		}
+	}
+	sort.Strings(ids)
+	for _, id := range ids {
+		if jwk := k.keys[id].JWK(); jwk.Kty != "" {
+			set.Keys = append(set.Keys, jwk)
+		}
+	}
+	return set
+}
+
+// LoadKeyring builds the keyring from the environment:
+//
+//   - JWT_SIGNING_KEY_FILE: PEM private key (RSA or Ed25519) to sign with.
+//     Without it tokens are signed with JWT_SECRET using HS256.
+//   - JWT_SECRET: HMAC secret. When a signing key file is set it is kept
+//     for verification only, so HS256 tokens stay valid during a switch.
+//   - JWT_VERIFY_KEY_FILES: comma-separated PEM keys of retired key pairs.
+//   - JWT_PREVIOUS_SECRETS: comma-separated retired HMAC secrets.
+//
+// In production the built-in development secret is refused in every HMAC
+// key source.
+func LoadKeyring(production bool) (*Keyring, error) {
+	secret := os.Getenv("JWT_SECRET")
+	if production && (secret == defaultSecret || (secret == "" && os.Getenv("JWT_SIGNING_KEY_FILE") == "")) {
+		return nil, errors.New("JWT_SECRET or JWT_SIGNING_KEY_FILE must be set to a non-default value in production")
+	}
+
+	var signing *Key
+	var verifyOnly []*Key
+	if path := os.Getenv("JWT_SIGNING_KEY_FILE"); path != "" {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, err
+		}
+		if signing, err = ParsePrivateKeyPEM(data); err != nil {
+			return nil, fmt.Errorf("%s: %w", path, err)
+		}
+		if secret != "" {
+			verifyOnly = append(verifyOnly, NewHMACKey([]byte(secret)))
+		}
+	} else {
+		if secret == "" {
+			log.Println("JWT_SECRET is not set, signing tokens with the development secret")
+			secret = defaultSecret
+		}
+		signing = NewHMACKey([]byte(secret))
+	}
+
+	for _, path := range splitList(os.Getenv("JWT_VERIFY_KEY_FILES")) {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, err
+		}
+		key, err := ParsePublicKeyPEM(data)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", path, err)
+		}
+		verifyOnly = append(verifyOnly, key)
+	}
+	for _, previous := range splitList(os.Getenv("JWT_PREVIOUS_SECRETS")) {
+		if production && previous == defaultSecret {
+			return nil, errors.New("JWT_PREVIOUS_SECRETS must not contain the development secret in production")
+		}
+		verifyOnly = append(verifyOnly, NewHMACKey([]byte(previous)))
+	}
+
+	return NewKeyring(signing, verifyOnly...), nil
+}
+
+// InitKeyring loads the keyring from the environment and makes it current
+func InitKeyring(production bool) error {
+	k, err := LoadKeyring(production)
+	if err != nil {
+		return err
+	}
+	SetKeyring(k)
+	log.Printf("Signing tokens with %s key %s (%d verification keys)", k.signing.Algorithm, k.signing.ID, len(k.keys))
+	return nil
+}
+
+// splitList splits a comma-separated list, dropping empty entries
+func splitList(value string) []string {
+	var items []string
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
@@ -0,0 +1,203 @@
+package utils
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/hex"
+	"encoding/pem"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// withKeyring makes a keyring current for the rest of the test
+func withKeyring(t *testing.T, k *Keyring) {
+	previous := CurrentKeyring()
+	SetKeyring(k)
+	t.Cleanup(func() { SetKeyring(previous) })
+}
+
+func newRSAKey(t *testing.T) (*Key, []byte) {
+	private, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("Failed to generate RSA key: %v", err)
+	}
+	data := pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(private)})
+	key, err := ParsePrivateKeyPEM(data)
+	if err != nil {
+		t.Fatalf("ParsePrivateKeyPEM() error = %v", err)
+	}
+	return key, data
+}
+
+func newEd25519Key(t *testing.T) (*Key, []byte) {
+	_, private, _ := ed25519.GenerateKey(rand.Reader)
+	der, _ := x509.MarshalPKCS8PrivateKey(private)
+	data := pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der})
+	key, err := ParsePrivateKeyPEM(data)
+	if err != nil {
+		t.Fatalf("ParsePrivateKeyPEM() error = %v", err)
+	}
+	return key, data
+}
+
+func TestKeyring_AsymmetricAlgorithms(t *testing.T) {
+	rsaKey, _ := newRSAKey(t)
+	edKey, _ := newEd25519Key(t)
+
+	for _, key := range []*Key{rsaKey, edKey} {
+		t.Run(key.Algorithm, func(t *testing.T) {
+			withKeyring(t, NewKeyring(key))
+
+			token, err := GenerateToken(1, "user", "user@example.com", "user", 1)
+			if err != nil {
+				t.Fatalf("GenerateToken() error = %v", err)
+			}
+			parsed, _, _ := jwt.NewParser().ParseUnverified(token, &Claims{})
+			if parsed.Header["alg"] != key.Algorithm || parsed.Header["kid"] != key.ID {
+				t.Errorf("Token header = %v, want alg %s and kid %s", parsed.Header, key.Algorithm, key.ID)
+			}
+			if _, err := ValidateToken(token); err != nil {
+				t.Errorf("ValidateToken() error = %v", err)
+			}
+		})
+	}
+}
+
+func TestKeyring_Rotation(t *testing.T) {
+	oldKey, _ := newEd25519Key(t)
+	newKey, _ := newEd25519Key(t)
+
+	withKeyring(t, NewKeyring(oldKey))
+	oldToken, _ := GenerateToken(1, "user", "user@example.com", "user", 1)
+
+	// The retired key still verifies the tokens it signed
+	SetKeyring(NewKeyring(newKey, oldKey))
+	if _, err := ValidateToken(oldToken); err != nil {
+		t.Errorf("Expected token of a retired key to validate, got %v", err)
+	}
+
+	// Once dropped, its tokens are rejected
+	SetKeyring(NewKeyring(newKey))
+	if _, err := ValidateToken(oldToken); err == nil {
+		t.Error("Expected token of a dropped key to be rejected")
+	}
+}
+
+func TestKeyring_RejectsAlgorithmConfusion(t *testing.T) {
+	rsaKey, _ := newRSAKey(t)
+	withKeyring(t, NewKeyring(rsaKey))
+
+	// An HS256 token keyed with the published RSA key must not validate
+	public, _ := x509.MarshalPKIXPublicKey(rsaKey.verify)
+	token := jwt.NewWithClaims(jwt.SigningMethodHS256, Claims{UserID: 1})
+	token.Header["kid"] = rsaKey.ID
+	forged, _ := token.SignedString(public)
+
+	if _, err := ValidateToken(forged); err == nil {
+		t.Error("Expected HS256 token naming an RSA key to be rejected")
+	}
+}
+
+func TestKeyring_JWKSPublishesOnlyPublicKeys(t *testing.T) {
+	rsaKey, _ := newRSAKey(t)
+	edKey, _ := newEd25519Key(t)
+	k := NewKeyring(rsaKey, edKey, NewHMACKey([]byte("old-secret")))
+
+	set := k.JWKS()
+	if len(set.Keys) != 2 {
+		t.Fatalf("Expected 2 published keys, got %d", len(set.Keys))
+	}
+	if set.Keys[0].Kid != rsaKey.ID || set.Keys[0].Kty != "RSA" || set.Keys[0].N == "" {
+		t.Errorf("Expected the signing key first, got %+v", set.Keys[0])
+	}
+	if set.Keys[1].Kid != edKey.ID || set.Keys[1].Crv != "Ed25519" {
+		t.Errorf("Expected the Ed25519 key, got %+v", set.Keys[1])
+	}
+}
+
+func TestLoadKeyring_RefusesDefaultSecretInProduction(t *testing.T) {
+	t.Setenv("JWT_SIGNING_KEY_FILE", "")
+
+	t.Setenv("JWT_SECRET", "")
+	if _, err := LoadKeyring(true); err == nil {
+		t.Error("Expected a missing secret to be refused in production")
+	}
+	t.Setenv("JWT_SECRET", defaultSecret)
+	if _, err := LoadKeyring(true); err == nil {
+		t.Error("Expected the default secret to be refused in production")
+	}
+	if _, err := LoadKeyring(false); err != nil {
+		t.Errorf("Expected the default secret in development, got %v", err)
+	}
+}
+
+func TestLoadKeyring_RefusesDefaultSecretAsVerifyKeyInProduction(t *testing.T) {
+	dir := t.TempDir()
+	_, signingPEM := newEd25519Key(t)
+	os.WriteFile(filepath.Join(dir, "signing.pem"), signingPEM, 0600)
+	t.Setenv("JWT_SIGNING_KEY_FILE", filepath.Join(dir, "signing.pem"))
+	t.Setenv("JWT_VERIFY_KEY_FILES", "")
+
+	// Kept for verification next to a signing key
+	t.Setenv("JWT_SECRET", defaultSecret)
+	t.Setenv("JWT_PREVIOUS_SECRETS", "")
+	if _, err := LoadKeyring(true); err == nil {
+		t.Error("Expected the default secret to be refused as a verify-only key")
+	}
+
+	// Listed as a retired secret
+	t.Setenv("JWT_SECRET", "")
+	t.Setenv("JWT_PREVIOUS_SECRETS", "old-secret,"+defaultSecret)
+	if _, err := LoadKeyring(true); err == nil {
+		t.Error("Expected the default secret to be refused as a previous secret")
+	}
+	if _, err := LoadKeyring(false); err != nil {
+		t.Errorf("Expected the default secret in development, got %v", err)
+	}
+}
+
+func TestLoadKeyring_FromFiles(t *testing.T) {
+	dir := t.TempDir()
+	signing, signingPEM := newEd25519Key(t)
+	retired, retiredPEM := newRSAKey(t)
+	os.WriteFile(filepath.Join(dir, "signing.pem"), signingPEM, 0600)
+	os.WriteFile(filepath.Join(dir, "retired.pem"), retiredPEM, 0600)
+
+	t.Setenv("JWT_SIGNING_KEY_FILE", filepath.Join(dir, "signing.pem"))
+	t.Setenv("JWT_VERIFY_KEY_FILES", filepath.Join(dir, "retired.pem"))
+	t.Setenv("JWT_SECRET", "legacy-secret")
+	t.Setenv("JWT_PREVIOUS_SECRETS", "")
+
+	k, err := LoadKeyring(true)
+	if err != nil {
+		t.Fatalf("LoadKeyring() error = %v", err)
+	}
+	if k.SigningKey().ID != signing.ID {
+		t.Errorf("Expected to sign with %s, got %s", signing.ID, k.SigningKey().ID)
+	}
+	if key := k.keys[retired.ID]; key == nil || key.sign != nil {
+		t.Error("Expected the retired key to be kept for verification only")
+	}
+	if k.keys[NewHMACKey([]byte("legacy-secret")).ID] == nil {
+		t.Error("Expected JWT_SECRET to stay valid for verification")
+	}
+}
+
+func TestNewHMACKey_IDDoesNotHashSecret(t *testing.T) {
+	secret := []byte("weak-secret")
+	key := NewHMACKey(secret)
+
+	sum := sha256.Sum256(secret)
+	if key.ID == "hs256-"+hex.EncodeToString(sum[:8]) {
+		t.Error("Expected the key ID not to be a plain hash of the secret")
+	}
+	if key.ID != NewHMACKey(secret).ID || key.ID == NewHMACKey([]byte("other-secret")).ID {
+		t.Error("Expected the key ID to be stable per secret and differ between secrets")
+	}
+}
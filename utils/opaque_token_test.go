@@ -0,0 +1,21 @@
+package utils
+
+import "testing"
+
+func TestGenerateOpaqueToken(t *testing.T) {
+	token1, hash1, err := GenerateOpaqueToken()
+	if err != nil {
+		t.Fatalf("GenerateOpaqueToken() error = %v", err)
+	}
+	token2, _, _ := GenerateOpaqueToken()
+
+	if token1 == token2 {
+		t.Error("GenerateOpaqueToken() should return a different token each time")
+	}
+	if hash1 == token1 {
+		t.Error("GenerateOpaqueToken() should not store the token itself")
+	}
+	if HashOpaqueToken(token1) != hash1 {
+		t.Error("HashOpaqueToken() should match the hash returned with the token")
+	}
+}
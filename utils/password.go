@@ -1,15 +1,268 @@
 package utils
 
-import "golang.org/x/crypto/bcrypt"
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+	"strings"
+	"sync/atomic"
 
-// HashPassword hashes a password using bcrypt
-func HashPassword(password string) (string, error) {
-	bytes, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	"golang.org/x/crypto/argon2"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// PasswordHasher hashes passwords into self-describing PHC strings, such as
+// $argon2id$v=19$m=19456,t=2,p=1$<salt>$<hash> or bcrypt's $2a$10$...
+type PasswordHasher interface {
+	// Hash hashes a password with the hasher's current parameters
+	Hash(password string) (string, error)
+	// Handles reports whether a hash is in the hasher's format
+	Handles(hash string) bool
+	// Verify checks a password against a hash in the hasher's format, using
+	// the parameters recorded in the hash
+	Verify(hash, password string) bool
+	// Outdated reports whether a hash in the hasher's format was made with
+	// weaker parameters than the hasher's current ones
+	Outdated(hash string) bool
+}
+
+// Argon2idHasher hashes passwords with argon2id
+type Argon2idHasher struct {
+	Memory      uint32 // KiB
+	Iterations  uint32
+	Parallelism uint8
+	SaltLength  uint32
+	KeyLength   uint32
+}
+
+// NewArgon2idHasher creates an argon2id hasher with the parameters OWASP
+// recommends: 19 MiB of memory, 2 iterations, 1 lane
+func NewArgon2idHasher() *Argon2idHasher {
+	return &Argon2idHasher{Memory: 19 * 1024, Iterations: 2, Parallelism: 1, SaltLength: 16, KeyLength: 32}
+}
+
+// argon2Params are the parameters recorded in an argon2id hash
+type argon2Params struct {
+	memory      uint32
+	iterations  uint32
+	parallelism uint8
+	salt, key   []byte
+}
+
+func (h *Argon2idHasher) Hash(password string) (string, error) {
+	salt := make([]byte, h.SaltLength)
+	if _, err := rand.Read(salt); err != nil {
+		return "", err
+	}
+	key := argon2.IDKey([]byte(password), salt, h.Iterations, h.Memory, h.Parallelism, h.KeyLength)
+	return fmt.Sprintf("$argon2id$v=%d$m=%d,t=%d,p=%d$%s$%s", argon2.Version, h.Memory, h.Iterations, h.Parallelism,
+		base64.RawStdEncoding.EncodeToString(salt), base64.RawStdEncoding.EncodeToString(key)), nil
+}
+
+func (h *Argon2idHasher) Handles(hash string) bool {
+	return strings.HasPrefix(hash, "$argon2id$")
+}
+
+func (h *Argon2idHasher) Verify(hash, password string) bool {
+	params, err := parseArgon2id(hash)
+	if err != nil {
+		return false
+	}
+	key := argon2.IDKey([]byte(password), params.salt, params.iterations, params.memory, params.parallelism, uint32(len(params.key)))
+	return subtle.ConstantTimeCompare(key, params.key) == 1
+}
+
+func (h *Argon2idHasher) Outdated(hash string) bool {
+	params, err := parseArgon2id(hash)
+	if err != nil {
+		return true
+	}
+	return params.memory < h.Memory || params.iterations < h.Iterations || params.parallelism < h.Parallelism ||
+		uint32(len(params.salt)) < h.SaltLength || uint32(len(params.key)) < h.KeyLength
+}
+
+// parseArgon2id reads an argon2id hash in PHC format
+func parseArgon2id(hash string) (*argon2Params, error) {
+	parts := strings.Split(hash, "$")
+	if len(parts) != 6 || parts[1] != "argon2id" {
+		return nil, errors.New("not an argon2id hash")
+	}
+
+	var version int
+	if _, err := fmt.Sscanf(parts[2], "v=%d", &version); err != nil || version != argon2.Version {
+		return nil, fmt.Errorf("unsupported argon2 version %q", parts[2])
+	}
+
+	params := &argon2Params{}
+	if _, err := fmt.Sscanf(parts[3], "m=%d,t=%d,p=%d", &params.memory, &params.iterations, &params.parallelism); err != nil {
+		return nil, fmt.Errorf("invalid argon2 parameters %q", parts[3])
+	}
+	if params.memory == 0 || params.iterations == 0 || params.parallelism == 0 {
+		return nil, fmt.Errorf("invalid argon2 parameters %q", parts[3])
+	}
+
+	var err error
+	if params.salt, err = base64.RawStdEncoding.DecodeString(parts[4]); err != nil {
+		return nil, err
+	}
+	if params.key, err = base64.RawStdEncoding.DecodeString(parts[5]); err != nil || len(params.key) == 0 {
+		return nil, errors.New("invalid argon2 hash")
+	}
+	return params, nil
+}
+
+// BcryptHasher hashes passwords with bcrypt. Hashes made before hashers
+// were configurable are bcrypt hashes at the default cost.
+type BcryptHasher struct {
+	Cost int
+}
+
+func NewBcryptHasher() *BcryptHasher {
+	return &BcryptHasher{Cost: bcrypt.DefaultCost}
+}
+
+func (h *BcryptHasher) Hash(password string) (string, error) {
+	bytes, err := bcrypt.GenerateFromPassword([]byte(password), h.Cost)
 	return string(bytes), err
 }
 
+func (h *BcryptHasher) Handles(hash string) bool {
+	return strings.HasPrefix(hash, "$2a$") || strings.HasPrefix(hash, "$2b$") || strings.HasPrefix(hash, "$2y$")
+}
+
+func (h *BcryptHasher) Verify(hash, password string) bool {
+	return bcrypt.CompareHashAndPassword([]byte(hash), []byte(password)) == nil
+}
+
+func (h *BcryptHasher) Outdated(hash string) bool {
+	cost, err := bcrypt.Cost([]byte(hash))
+	return err != nil || cost < h.Cost
+}
+
+// passwordHasher is the hasher new hashes are made with
+var passwordHasher atomic.Pointer[PasswordHasher]
+
+func init() {
+	SetPasswordHasher(NewArgon2idHasher())
+}
+
+// SetPasswordHasher replaces the hasher new password hashes are made with.
+// Hashes in any supported format still verify.
+func SetPasswordHasher(h PasswordHasher) {
+	passwordHasher.Store(&h)
+}
+
+// CurrentPasswordHasher returns the hasher new password hashes are made with
+func CurrentPasswordHasher() PasswordHasher {
+	return *passwordHasher.Load()
+}
+
+// hasherFor finds the hasher that understands a hash: the current one, or
+// a default instance of another supported algorithm
+func hasherFor(hash string) PasswordHasher {
+	for _, h := range []PasswordHasher{CurrentPasswordHasher(), NewArgon2idHasher(), NewBcryptHasher()} {
+		if h.Handles(hash) {
+			return h
+		}
+	}
+	return nil
+}
+
+// HashPassword hashes a password with the current hasher
+func HashPassword(password string) (string, error) {
+	return CurrentPasswordHasher().Hash(password)
+}
+
 // CheckPassword compares a hashed password with a plain text password
 func CheckPassword(hashedPassword, password string) bool {
-	err := bcrypt.CompareHashAndPassword([]byte(hashedPassword), []byte(password))
-	return err == nil
+	h := hasherFor(hashedPassword)
+	return h != nil && h.Verify(hashedPassword, password)
+}
+
+// PasswordNeedsRehash reports whether a hash should be replaced, because it
+// was made with another algorithm or weaker parameters than the current
+// hasher's. Rehash after a successful CheckPassword, while the password is
+// at hand.
+func PasswordNeedsRehash(hashedPassword string) bool {
+	current := CurrentPasswordHasher()
+	return !current.Handles(hashedPassword) || current.Outdated(hashedPassword)
+}
+
+// LoadPasswordHasher builds the password hasher from the environment:
+//
+//   - PASSWORD_HASHER: argon2id (default) or bcrypt
+//   - ARGON2_MEMORY (KiB), ARGON2_ITERATIONS, ARGON2_PARALLELISM: argon2id
+//     parameters, defaulting to 19456, 2 and 1
+//   - BCRYPT_COST: bcrypt cost (default 10)
+func LoadPasswordHasher() (PasswordHasher, error) {
+	switch algorithm := os.Getenv("PASSWORD_HASHER"); algorithm {
+	case "", "argon2id":
+		h := NewArgon2idHasher()
+		if err := uint32FromEnv("ARGON2_MEMORY", &h.Memory); err != nil {
+			return nil, err
+		}
+		if err := uint32FromEnv("ARGON2_ITERATIONS", &h.Iterations); err != nil {
+			return nil, err
+		}
+		parallelism := uint32(h.Parallelism)
+		if err := uint32FromEnv("ARGON2_PARALLELISM", &parallelism); err != nil {
+			return nil, err
+		}
+		if parallelism == 0 || parallelism > 255 {
+			return nil, fmt.Errorf("ARGON2_PARALLELISM must be between 1 and 255")
+		}
+		h.Parallelism = uint8(parallelism)
+		if h.Memory < 8*uint32(h.Parallelism) || h.Iterations == 0 {
+			return nil, fmt.Errorf("ARGON2_MEMORY must be at least 8 KiB per lane and ARGON2_ITERATIONS at least 1")
+		}
+		return h, nil
+	case "bcrypt":
+		h := NewBcryptHasher()
+		if value := os.Getenv("BCRYPT_COST"); value != "" {
+			cost, err := strconv.Atoi(value)
+			if err != nil || cost < bcrypt.MinCost || cost > bcrypt.MaxCost {
+				return nil, fmt.Errorf("BCRYPT_COST must be between %d and %d", bcrypt.MinCost, bcrypt.MaxCost)
+			}
+			h.Cost = cost
+		}
+		return h, nil
+	default:
+		return nil, fmt.Errorf("unknown PASSWORD_HASHER %q (want argon2id or bcrypt)", algorithm)
+	}
+}
+
+// InitPasswordHasher loads the password hasher from the environment and
+// makes it current
+func InitPasswordHasher() error {
+	h, err := LoadPasswordHasher()
+	if err != nil {
+		return err
+	}
+	SetPasswordHasher(h)
+	switch h := h.(type) {
+	case *Argon2idHasher:
+		log.Printf("Hashing passwords with argon2id (m=%d, t=%d, p=%d)", h.Memory, h.Iterations, h.Parallelism)
+	case *BcryptHasher:
+		log.Printf("Hashing passwords with bcrypt (cost %d)", h.Cost)
+	}
+	return nil
+}
+
+// uint32FromEnv reads an optional number from the environment
+func uint32FromEnv(name string, value *uint32) error {
+	s := os.Getenv(name)
+	if s == "" {
+		return nil
+	}
+	n, err := strconv.ParseUint(s, 10, 32)
+	if err != nil {
+		return fmt.Errorf("%s: %w", name, err)
+	}
+	*value = uint32(n)
+	return nil
 }
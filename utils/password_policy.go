@@ -0,0 +1,121 @@
+package utils
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// defaultMinPasswordLength is the shortest password allowed by default
+const defaultMinPasswordLength = 8
+
+// defaultMaxPasswordBytes is the longest password allowed by default. It
+// keeps hashing a password cheap enough not to be a way to load the server.
+const defaultMaxPasswordBytes = 1024
+
+// bcryptMaxPasswordBytes is the longest password bcrypt can hash
+const bcryptMaxPasswordBytes = 72
+
+// minUsernameMatch is how long a username must be before passwords merely
+// containing it are refused; shorter ones are only refused as the whole
+// password
+const minUsernameMatch = 4
+
+// PasswordPolicy decides which new passwords are acceptable
+type PasswordPolicy struct {
+	MinLength int // In characters
+	MaxBytes  int // In bytes, lowered to 72 while new hashes use bcrypt
+
+	breached map[string]struct{}
+}
+
+// NewPasswordPolicy creates a policy with the default length limits and
+// no breached passwords
+func NewPasswordPolicy() *PasswordPolicy {
+	return &PasswordPolicy{MinLength: defaultMinPasswordLength, MaxBytes: defaultMaxPasswordBytes}
+}
+
+// maxBytes is the longest password the policy and the current hasher accept
+func (p *PasswordPolicy) maxBytes() int {
+	if _, ok := CurrentPasswordHasher().(*BcryptHasher); ok && (p.MaxBytes == 0 || p.MaxBytes > bcryptMaxPasswordBytes) {
+		return bcryptMaxPasswordBytes
+	}
+	return p.MaxBytes
+}
+
+// LoadBreached reads a list of known breached passwords, one per line, to
+// refuse. Blank lines and lines starting with # are skipped.
+func (p *PasswordPolicy) LoadBreached(path string) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	breached := make(map[string]struct{})
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		breached[strings.ToLower(line)] = struct{}{}
+	}
+	if err := scanner.Err(); err != nil {
+		return fmt.Errorf("%s: %w", path, err)
+	}
+	p.breached = breached
+	return nil
+}
+
+// Check returns why a password may not be used by the named user, or nil.
+// The error is meant to be shown to the user. Leading and trailing spaces
+// are ignored, as they are in the breached list, so padding neither makes
+// a password long enough nor disguises a breached one.
+func (p *PasswordPolicy) Check(password, username string) error {
+	trimmed := strings.TrimSpace(password)
+	if utf8.RuneCountInString(trimmed) < p.MinLength {
+		return fmt.Errorf("Password must be at least %d characters", p.MinLength)
+	}
+	// The limit applies to what is hashed, spaces included
+	if maxBytes := p.maxBytes(); maxBytes > 0 && len(password) > maxBytes {
+		return fmt.Errorf("Password must be at most %d bytes", maxBytes)
+	}
+
+	lower := strings.ToLower(trimmed)
+	name := strings.ToLower(username)
+	if name != "" && (lower == name || utf8.RuneCountInString(name) >= minUsernameMatch && strings.Contains(lower, name)) {
+		return errors.New("Password must not contain your username")
+	}
+
+	if _, ok := p.breached[lower]; ok {
+		return errors.New("Password is too common, it has appeared in a data breach")
+	}
+	return nil
+}
+
+// LoadPasswordPolicy builds the password policy from the environment:
+//
+//   - PASSWORD_MIN_LENGTH: shortest allowed password (default 8)
+//   - PASSWORD_BREACHED_LIST: file of breached passwords to refuse, one
+//     per line
+func LoadPasswordPolicy() (*PasswordPolicy, error) {
+	p := NewPasswordPolicy()
+	if value := os.Getenv("PASSWORD_MIN_LENGTH"); value != "" {
+		minLength, err := strconv.Atoi(value)
+		if err != nil || minLength < 1 {
+			return nil, fmt.Errorf("PASSWORD_MIN_LENGTH must be a positive number")
+		}
+		p.MinLength = minLength
+	}
+	if path := os.Getenv("PASSWORD_BREACHED_LIST"); path != "" {
+		if err := p.LoadBreached(path); err != nil {
+			return nil, err
+		}
+	}
+	return p, nil
+}
@@ -0,0 +1,85 @@
+package utils
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestPasswordPolicyCheck(t *testing.T) {
+	policy := NewPasswordPolicy()
+	path := filepath.Join(t.TempDir(), "breached.txt")
+	os.WriteFile(path, []byte("# top passwords\nqwertyuiop\n\nPassword1!\n"), 0o600)
+	if err := policy.LoadBreached(path); err != nil {
+		t.Fatalf("LoadBreached() error = %v", err)
+	}
+
+	tests := []struct {
+		name     string
+		password string
+		username string
+		ok       bool
+	}{
+		{"acceptable", "correct horse battery", "alice", true},
+		{"too short", "short", "alice", false},
+		{"length counts characters", "pässwörd", "alice", true},
+		{"same as username", "AliceAlice", "alicealice", false},
+		{"contains username", "my-alice-pass", "alice", false},
+		{"short username only as whole password", "bobsledding", "bob", true},
+		{"breached", "qwertyuiop", "alice", false},
+		{"breached ignores case", "password1!", "alice", false},
+		{"breached ignores surrounding spaces", " Password1!  ", "alice", false},
+		{"padding does not count towards length", "short    ", "alice", false},
+		{"username with surrounding spaces", " alicealice ", "alicealice", false},
+		{"comment lines are not passwords", "# top passwords", "alice", true},
+		{"longest allowed", strings.Repeat("x", 1024), "alice", true},
+		{"too long", strings.Repeat("x", 1025), "alice", false},
+		{"length limit counts bytes", strings.Repeat("ü", 513), "alice", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := policy.Check(tt.password, tt.username)
+			if (err == nil) != tt.ok {
+				t.Errorf("Check(%q, %q) = %v, want ok=%v", tt.password, tt.username, err, tt.ok)
+			}
+		})
+	}
+}
+
+func TestPasswordPolicyCheck_BcryptLimit(t *testing.T) {
+	previous := CurrentPasswordHasher()
+	SetPasswordHasher(NewBcryptHasher())
+	defer SetPasswordHasher(previous)
+
+	policy := NewPasswordPolicy()
+	if err := policy.Check(strings.Repeat("x", 72), "alice"); err != nil {
+		t.Errorf("Expected 72 bytes to be accepted under bcrypt, got %v", err)
+	}
+	if err := policy.Check(strings.Repeat("x", 73), "alice"); err == nil {
+		t.Error("Expected more than 72 bytes to be refused under bcrypt")
+	}
+}
+
+func TestLoadPasswordPolicy(t *testing.T) {
+	t.Setenv("PASSWORD_MIN_LENGTH", "12")
+	t.Setenv("PASSWORD_BREACHED_LIST", "")
+	policy, err := LoadPasswordPolicy()
+	if err != nil {
+		t.Fatalf("LoadPasswordPolicy() error = %v", err)
+	}
+	if policy.MinLength != 12 {
+		t.Errorf("MinLength = %d, want 12", policy.MinLength)
+	}
+
+	t.Setenv("PASSWORD_MIN_LENGTH", "zero")
+	if _, err := LoadPasswordPolicy(); err == nil {
+		t.Error("LoadPasswordPolicy() should fail on an invalid length")
+	}
+
+	t.Setenv("PASSWORD_MIN_LENGTH", "")
+	t.Setenv("PASSWORD_BREACHED_LIST", filepath.Join(t.TempDir(), "missing.txt"))
+	if _, err := LoadPasswordPolicy(); err == nil {
+		t.Error("LoadPasswordPolicy() should fail on a missing breached list")
+	}
+}
@@ -1,7 +1,10 @@
 package utils
 
 import (
+	"strings"
 	"testing"
+
+	"golang.org/x/crypto/bcrypt"
 )
 
 func TestHashPassword(t *testing.T) {
@@ -77,3 +80,124 @@ func TestCheckPasswordWithInvalidHash(t *testing.T) {
 		t.Error("CheckPassword() should return false for invalid hash")
 	}
 }
+
+func TestHashPasswordUsesCurrentHasher(t *testing.T) {
+	defer SetPasswordHasher(CurrentPasswordHasher())
+
+	SetPasswordHasher(&BcryptHasher{Cost: bcrypt.MinCost})
+	hash, _ := HashPassword("password123")
+	if !strings.HasPrefix(hash, "$2a$04$") {
+		t.Errorf("HashPassword() = %q, want a bcrypt hash at cost 4", hash)
+	}
+
+	SetPasswordHasher(NewArgon2idHasher())
+	hash, _ = HashPassword("password123")
+	if !strings.HasPrefix(hash, "$argon2id$v=19$m=19456,t=2,p=1$") {
+		t.Errorf("HashPassword() = %q, want an argon2id PHC string", hash)
+	}
+}
+
+func TestCheckPasswordAcceptsEveryFormat(t *testing.T) {
+	defer SetPasswordHasher(CurrentPasswordHasher())
+
+	bcryptHash, _ := (&BcryptHasher{Cost: bcrypt.MinCost}).Hash("password123")
+	argonHash, _ := (&Argon2idHasher{Memory: 64, Iterations: 1, Parallelism: 1, SaltLength: 16, KeyLength: 32}).Hash("password123")
+
+	for _, current := range []PasswordHasher{NewArgon2idHasher(), NewBcryptHasher()} {
+		SetPasswordHasher(current)
+		for _, hash := range []string{bcryptHash, argonHash} {
+			if !CheckPassword(hash, "password123") {
+				t.Errorf("CheckPassword(%q) = false with %T current", hash, current)
+			}
+			if CheckPassword(hash, "password124") {
+				t.Errorf("CheckPassword(%q) accepted the wrong password", hash)
+			}
+		}
+	}
+}
+
+func TestCheckPasswordWithMalformedArgon2Hash(t *testing.T) {
+	for _, hash := range []string{
+		"$argon2id$",
+		"$argon2id$v=19$m=64,t=1,p=1$c2FsdA",
+		"$argon2id$v=16$m=64,t=1,p=1$c2FsdHNhbHQ$a2V5",
+		"$argon2id$v=19$m=0,t=1,p=1$c2FsdHNhbHQ$a2V5",
+		"$argon2id$v=19$m=64,t=1,p=1$c2FsdHNhbHQ$",
+		"$argon2id$v=19$m=64,t=1,p=1$!!!$a2V5",
+	} {
+		if CheckPassword(hash, "password") {
+			t.Errorf("CheckPassword(%q) = true", hash)
+		}
+	}
+}
+
+func TestPasswordNeedsRehash(t *testing.T) {
+	defer SetPasswordHasher(CurrentPasswordHasher())
+
+	weakArgon, _ := (&Argon2idHasher{Memory: 64, Iterations: 1, Parallelism: 1, SaltLength: 16, KeyLength: 32}).Hash("pw")
+	currentArgon, _ := NewArgon2idHasher().Hash("pw")
+	weakBcrypt, _ := (&BcryptHasher{Cost: bcrypt.MinCost}).Hash("pw")
+	currentBcrypt, _ := (&BcryptHasher{Cost: bcrypt.MinCost + 1}).Hash("pw")
+
+	SetPasswordHasher(NewArgon2idHasher())
+	tests := []struct {
+		name string
+		hash string
+		want bool
+	}{
+		{"argon2id with current parameters", currentArgon, false},
+		{"argon2id with weaker parameters", weakArgon, true},
+		{"bcrypt when argon2id is current", currentBcrypt, true},
+	}
+	for _, tt := range tests {
+		if got := PasswordNeedsRehash(tt.hash); got != tt.want {
+			t.Errorf("%s: PasswordNeedsRehash() = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+
+	SetPasswordHasher(&BcryptHasher{Cost: bcrypt.MinCost + 1})
+	if !PasswordNeedsRehash(weakBcrypt) {
+		t.Error("bcrypt below the current cost should need a rehash")
+	}
+	if PasswordNeedsRehash(currentBcrypt) {
+		t.Error("bcrypt at the current cost should not need a rehash")
+	}
+	if !PasswordNeedsRehash(currentArgon) {
+		t.Error("argon2id should need a rehash when bcrypt is current")
+	}
+}
+
+func TestLoadPasswordHasher(t *testing.T) {
+	t.Setenv("PASSWORD_HASHER", "")
+	h, err := LoadPasswordHasher()
+	if err != nil {
+		t.Fatalf("LoadPasswordHasher() error = %v", err)
+	}
+	if argon, ok := h.(*Argon2idHasher); !ok || *argon != *NewArgon2idHasher() {
+		t.Errorf("LoadPasswordHasher() = %+v, want default argon2id", h)
+	}
+
+	t.Setenv("ARGON2_MEMORY", "65536")
+	t.Setenv("ARGON2_ITERATIONS", "3")
+	t.Setenv("ARGON2_PARALLELISM", "4")
+	h, _ = LoadPasswordHasher()
+	if argon := h.(*Argon2idHasher); argon.Memory != 65536 || argon.Iterations != 3 || argon.Parallelism != 4 {
+		t.Errorf("LoadPasswordHasher() = %+v, want m=65536 t=3 p=4", argon)
+	}
+
+	t.Setenv("PASSWORD_HASHER", "bcrypt")
+	t.Setenv("BCRYPT_COST", "12")
+	h, _ = LoadPasswordHasher()
+	if b, ok := h.(*BcryptHasher); !ok || b.Cost != 12 {
+		t.Errorf("LoadPasswordHasher() = %+v, want bcrypt cost 12", h)
+	}
+
+	for name, value := range map[string]string{"BCRYPT_COST": "99", "PASSWORD_HASHER": "md5"} {
+		t.Run(name, func(t *testing.T) {
+			t.Setenv(name, value)
+			if _, err := LoadPasswordHasher(); err == nil {
+				t.Errorf("LoadPasswordHasher() with %s=%s should fail", name, value)
+			}
+		})
+	}
+}
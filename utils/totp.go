@@ -0,0 +1,88 @@
+package utils
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base32"
+	"strings"
+	"time"
+
+	"github.com/pquerna/otp"
+	"github.com/pquerna/otp/totp"
+)
+
+// totpIssuer names the app in authenticator apps
+const totpIssuer = "GoChatApp"
+
+// totpPeriod is how long each TOTP code is current
+const totpPeriod = 30
+
+// totpSkew is how many periods either side of now a code is accepted, to
+// allow for clock drift
+const totpSkew = 1
+
+// GenerateTOTPSecret creates a TOTP secret for an account and the otpauth
+// URI that authenticator apps enroll from, usually shown as a QR code
+func GenerateTOTPSecret(accountName string) (secret, uri string, err error) {
+	key, err := totp.Generate(totp.GenerateOpts{
+		Issuer:      totpIssuer,
+		AccountName: accountName,
+		Period:      totpPeriod,
+	})
+	if err != nil {
+		return "", "", err
+	}
+	return key.Secret(), key.URL(), nil
+}
+
+// ValidateTOTP checks a code against a secret at a point in time. It
+// returns the time step the code belongs to, so callers can refuse a code
+// that was already used.
+func ValidateTOTP(secret, code string, at time.Time) (step int64, ok bool) {
+	if secret == "" {
+		return 0, false
+	}
+	code = strings.ReplaceAll(code, " ", "")
+	current := at.Unix() / totpPeriod
+	for offset := int64(-totpSkew); offset <= totpSkew; offset++ {
+		step := current + offset
+		expected, err := totp.GenerateCodeCustom(secret, time.Unix(step*totpPeriod, 0), totp.ValidateOpts{
+			Period:    totpPeriod,
+			Digits:    otp.DigitsSix,
+			Algorithm: otp.AlgorithmSHA1,
+		})
+		if err != nil {
+			return 0, false
+		}
+		if subtle.ConstantTimeCompare([]byte(expected), []byte(code)) == 1 {
+			return step, true
+		}
+	}
+	return 0, false
+}
+
+// recoveryEncoding spells recovery codes without padding or ambiguous case
+var recoveryEncoding = base32.StdEncoding.WithPadding(base32.NoPadding)
+
+// GenerateRecoveryCodes returns n random single-use recovery codes of the
+// form xxxxx-xxxxx
+func GenerateRecoveryCodes(n int) ([]string, error) {
+	codes := make([]string, n)
+	for i := range codes {
+		b := make([]byte, 7)
+		if _, err := rand.Read(b); err != nil {
+			return nil, err
+		}
+		code := strings.ToLower(recoveryEncoding.EncodeToString(b))[:10]
+		codes[i] = code[:5] + "-" + code[5:]
+	}
+	return codes, nil
+}
+
+// HashRecoveryCode hashes a recovery code for storage. Case, spaces and
+// dashes are ignored, so codes can be typed loosely.
+func HashRecoveryCode(code string) string {
+	code = strings.ToLower(code)
+	code = strings.NewReplacer("-", "", " ", "").Replace(code)
+	return HashOpaqueToken(code)
+}
@@ -0,0 +1,68 @@
+package utils
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/pquerna/otp/totp"
+)
+
+func TestGenerateTOTPSecret(t *testing.T) {
+	secret, uri, err := GenerateTOTPSecret("alice")
+	if err != nil {
+		t.Fatalf("GenerateTOTPSecret() error = %v", err)
+	}
+	if !strings.HasPrefix(uri, "otpauth://totp/GoChatApp:alice?") || !strings.Contains(uri, "secret="+secret) {
+		t.Errorf("Unexpected otpauth URI %q", uri)
+	}
+}
+
+func TestValidateTOTP(t *testing.T) {
+	secret, _, _ := GenerateTOTPSecret("alice")
+	now := time.Now()
+	code, _ := totp.GenerateCode(secret, now)
+
+	step, ok := ValidateTOTP(secret, code, now)
+	if !ok {
+		t.Fatal("ValidateTOTP() should accept the current code")
+	}
+	if step != now.Unix()/30 {
+		t.Errorf("ValidateTOTP() step = %d, want %d", step, now.Unix()/30)
+	}
+
+	// A code from the previous period is still accepted, with its own step
+	if step, ok := ValidateTOTP(secret, code, now.Add(30*time.Second)); !ok || step != now.Unix()/30 {
+		t.Errorf("ValidateTOTP() should accept a code one period late, got step %d ok %v", step, ok)
+	}
+	if _, ok := ValidateTOTP(secret, code, now.Add(2*time.Minute)); ok {
+		t.Error("ValidateTOTP() should reject an old code")
+	}
+	if _, ok := ValidateTOTP(secret, "000000x", now); ok {
+		t.Error("ValidateTOTP() should reject a malformed code")
+	}
+}
+
+func TestGenerateRecoveryCodes(t *testing.T) {
+	codes, err := GenerateRecoveryCodes(10)
+	if err != nil {
+		t.Fatalf("GenerateRecoveryCodes() error = %v", err)
+	}
+
+	seen := map[string]bool{}
+	for _, code := range codes {
+		if len(code) != 11 || code[5] != '-' {
+			t.Errorf("Unexpected recovery code format %q", code)
+		}
+		if seen[code] {
+			t.Errorf("Duplicate recovery code %q", code)
+		}
+		seen[code] = true
+	}
+
+	// Codes can be typed without the dash or in upper case
+	loose := strings.ToUpper(strings.Replace(codes[0], "-", " ", 1))
+	if HashRecoveryCode(loose) != HashRecoveryCode(codes[0]) {
+		t.Error("HashRecoveryCode() should ignore case, spaces and dashes")
+	}
+}